@@ -2,6 +2,11 @@ module Go-Machine-Learning
 
 go 1.22.4
 
+require (
+	golang.org/x/exp v0.0.0-20240823005443-9b4947da3948
+	gonum.org/v1/gonum v0.15.1
+)
+
 require (
 	git.sr.ht/~sbinet/gg v0.5.0 // indirect
 	github.com/ajstarks/svgo v0.0.0-20211024235047-1546f124cd8b // indirect
@@ -12,11 +17,9 @@ require (
 	github.com/goccmack/gocc v0.0.0-20230228185258-2292f9e40198 // indirect
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/exp v0.0.0-20240823005443-9b4947da3948 // indirect
 	golang.org/x/image v0.19.0 // indirect
 	golang.org/x/mod v0.20.0 // indirect
 	golang.org/x/text v0.17.0 // indirect
 	golang.org/x/tools v0.24.0 // indirect
-	gonum.org/v1/gonum v0.15.1 // indirect
 	gonum.org/v1/plot v0.14.0 // indirect
 )
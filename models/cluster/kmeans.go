@@ -1,7 +1,10 @@
 package cluster
 
 import (
+	"Go-Machine-Learning/training"
+	"context"
 	"math"
+	"time"
 
 	"gonum.org/v1/gonum/mat"
 )
@@ -35,7 +38,16 @@ func Euclidean(a mat.Vector, b mat.Vector) float64 {
 }
 
 // Calculates the centers and stores them in k.Centers
-func (k *Kmeans) Fit(X *mat.Dense) {
+// Returns the inertia, the sum of squared distances from each sample to its nearest center, of every iteration
+func (k *Kmeans) Fit(X *mat.Dense) *training.History {
+	//the context is never cancelled so there is no error
+	history, _ := k.FitContext(context.Background(), X)
+	return history
+}
+
+// Fit that stops between iterations once ctx is cancelled or its deadline passes, returning ctx.Err()
+// the centers from the last completed iteration are kept
+func (k *Kmeans) FitContext(ctx context.Context, X *mat.Dense) (*training.History, error) {
 	//Init the Centers
 	nSamples, nFeatures := X.Dims()
 	k.Centers = mat.NewDense(k.NClusters, nFeatures, nil)
@@ -46,7 +58,16 @@ func (k *Kmeans) Fit(X *mat.Dense) {
 		k.Centers.SetRow(i, row)
 	}
 
-	for range k.MaxIter {
+	history := training.NewHistory()
+	t0 := time.Now()
+
+	for iter := range k.MaxIter {
+		if ctx.Err() != nil {
+			history.StoppedEpoch = iter
+			break
+		}
+		t1 := time.Now()
+		inertia := 0.0
 
 		//for each sample, find its nearest center
 		// count the number of times a center appears to help compute average for new centers
@@ -67,6 +88,7 @@ func (k *Kmeans) Fit(X *mat.Dense) {
 				}
 			}
 			centerCounts[nearestCenter] += 1
+			inertia += nearestDist * nearestDist
 
 			//add the point to the total for the coresponding center
 			for f := range nFeatures {
@@ -88,8 +110,29 @@ func (k *Kmeans) Fit(X *mat.Dense) {
 		}
 
 		//fmt.Printf("k.Centers: %v\n", k.Centers)
+
+		//the inertia is of the centers the samples were assigned to, before they moved
+		history.Add(iter, training.Logs{"inertia": inertia}, 0, 1, time.Since(t1))
 	}
 
+	k.Inertia = k.inertia(X)
+	history.Seconds = time.Since(t0).Seconds()
+
+	return history, ctx.Err()
+}
+
+// sum of squared distances from each sample to its nearest center
+func (k *Kmeans) inertia(X *mat.Dense) float64 {
+	nSamples, _ := X.Dims()
+	inertia := 0.0
+	for i := range nSamples {
+		nearestDist := math.Inf(1)
+		for j := range k.NClusters {
+			nearestDist = math.Min(nearestDist, Euclidean(X.RowView(i), k.Centers.RowView(j)))
+		}
+		inertia += nearestDist * nearestDist
+	}
+	return inertia
 }
 
 // Calculates predicted classes based on the calculated centers
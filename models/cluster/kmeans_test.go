@@ -0,0 +1,65 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestKmeansHistory(t *testing.T) {
+	X := mat.NewDense(6, 2, []float64{
+		0, 0,
+		0, 1,
+		10, 10,
+		1, 0,
+		10, 11,
+		11, 10,
+	})
+
+	k := NewKMeans()
+	k.NClusters = 2
+	k.MaxIter = 5
+	history := k.Fit(X)
+
+	if history.Len() != 5 || history.Iterations != 5 {
+		t.Fatalf("%d epochs and %d iterations, want 5 of each", history.Len(), history.Iterations)
+	}
+
+	//moving the centers to the mean of their samples never increases the inertia
+	inertia := history.Metric("inertia")
+	for i := 1; i < len(inertia); i++ {
+		if inertia[i] > inertia[i-1] {
+			t.Errorf("inertia went up from %v to %v at iteration %d", inertia[i-1], inertia[i], i)
+		}
+	}
+
+	//each group has its center at a third of the way along both axes, giving 2/9 + 5/9 + 5/9 per group
+	want := 2 * (12.0 / 9)
+	if diff := k.Inertia - want; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("inertia %v want %v", k.Inertia, want)
+	}
+}
+
+func TestKmeansFitContext(t *testing.T) {
+	X := mat.NewDense(4, 1, []float64{0, 1, 10, 11})
+
+	k := NewKMeans()
+	k.NClusters = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	history, err := k.FitContext(ctx, X)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v want context.Canceled", err)
+	}
+	if history.Len() != 0 || history.StoppedEpoch != 0 {
+		t.Errorf("ran %d iterations after being cancelled", history.Len())
+	}
+	//the centers are the starting ones, taken from the first samples
+	if k.Centers.At(0, 0) != 0 || k.Centers.At(1, 0) != 1 {
+		t.Errorf("centers %v", mat.Formatted(k.Centers))
+	}
+}
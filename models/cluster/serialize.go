@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"Go-Machine-Learning/serialization"
+	"io"
+)
+
+const kmeansKind = "Kmeans"
+
+type kmeansState struct {
+	NClusters int
+	MaxIter   int
+	NRuns     int
+	Centers   *serialization.Matrix
+	Inertia   float64
+}
+
+// Saves the model in the compact binary format
+func (k *Kmeans) Save(w io.Writer) error {
+	return serialization.Write(w, kmeansKind, serialization.Binary, k.state())
+}
+
+// Saves the model as human readable JSON
+func (k *Kmeans) SaveJSON(w io.Writer) error {
+	return serialization.Write(w, kmeansKind, serialization.JSON, k.state())
+}
+
+// Loads a model saved with Save or SaveJSON
+func (k *Kmeans) Load(r io.Reader) error {
+	var s kmeansState
+	if err := serialization.Read(r, kmeansKind, &s); err != nil {
+		return err
+	}
+
+	centers, err := s.Centers.Dense()
+	if err != nil {
+		return err
+	}
+
+	k.NClusters = s.NClusters
+	k.MaxIter = s.MaxIter
+	k.NRuns = s.NRuns
+	k.Centers = centers
+	k.Inertia = s.Inertia
+	return nil
+}
+
+func (k *Kmeans) state() *kmeansState {
+	return &kmeansState{
+		NClusters: k.NClusters,
+		MaxIter:   k.MaxIter,
+		NRuns:     k.NRuns,
+		Centers:   serialization.FromDense(k.Centers),
+		Inertia:   k.Inertia,
+	}
+}
@@ -0,0 +1,37 @@
+package cluster
+
+import (
+	"bytes"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestKmeansSaveLoad(t *testing.T) {
+	X := mat.NewDense(6, 2, []float64{
+		0, 0,
+		10, 10,
+		0, 1,
+		10, 11,
+		1, 0,
+		11, 10,
+	})
+
+	k := NewKMeans()
+	k.NClusters = 2
+	k.Fit(X)
+
+	var buf bytes.Buffer
+	if err := k.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewKMeans()
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.NClusters != 2 || !mat.Equal(loaded.Predict(X), k.Predict(X)) {
+		t.Errorf("the loaded model predicts different clusters")
+	}
+}
@@ -3,7 +3,9 @@
 package models
 
 import (
+	"Go-Machine-Learning/training"
 	"Go-Machine-Learning/utils"
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -26,6 +28,9 @@ type GDLinearRegression struct {
 	//If true will print information to the console
 	Verbose bool
 
+	// Called as training progresses, when Verbose is on a training.ProgressLogger is run before these
+	Callbacks []training.Callback
+
 	//Regularisation, this can be l1, l2 or none
 	Regularisation string
 	// Multiplies the Regularisation term
@@ -79,6 +84,29 @@ func MSE(p *utils.Matrix, y *utils.Matrix) float64 {
 	return MSEVal
 }
 
+// Mean squared error with each squared residual multiplied by the weight of its sample, MSE when w is nil
+// 1/2m Σ w (p - y)²
+func weightedMSE(p, y, w *utils.Matrix) float64 {
+	if w == nil {
+		return MSE(p, y)
+	}
+
+	sum := 0.0
+	for i := range y.Rows {
+		residual := p.Data[i] - y.Data[i]
+		sum += w.Data[i] * residual * residual
+	}
+	return sum / float64(2.0*y.Rows)
+}
+
+// the rows start to end of the sample weights, nil when there are no weights
+func weightRows(w *utils.Matrix, start, end int) *utils.Matrix {
+	if w == nil {
+		return nil
+	}
+	return w.RowSlice(start, end)
+}
+
 // Makes new predictions based on updated weights
 func NewPredictions(X *utils.Matrix, glr *GDLinearRegression) *utils.Matrix {
 	var p utils.Matrix
@@ -87,8 +115,8 @@ func NewPredictions(X *utils.Matrix, glr *GDLinearRegression) *utils.Matrix {
 	return &p
 }
 
-// Uses Mean squared error
-func (glr *GDLinearRegression) calculateBatchGradients(X, y, p *utils.Matrix) (float64, *utils.Matrix) {
+// Uses Mean squared error, each residual is multiplied by the weight of its sample when w is not nil
+func (glr *GDLinearRegression) calculateBatchGradients(X, y, w, p *utils.Matrix) (float64, *utils.Matrix) {
 
 	// XT is the transposition of batch X
 	XT := X.MatCopy()
@@ -96,6 +124,11 @@ func (glr *GDLinearRegression) calculateBatchGradients(X, y, p *utils.Matrix) (f
 
 	var residual utils.Matrix
 	residual.Subtract(p, y)
+	if w != nil {
+		for i := range residual.Data {
+			residual.Data[i] *= w.Data[i]
+		}
+	}
 
 	N := 2.0 / float64(y.Rows)
 	BiasGrad := residual.Sum() * N
@@ -155,19 +188,50 @@ func (glr *GDLinearRegression) UpdateBias(gradient float64) {
 }
 
 // Fits the coefficients and the bias using gradient descent
-func (glr *GDLinearRegression) Fit(X *utils.Matrix, y *utils.Matrix) error {
+// Returns the loss of every epoch, an iteration is one update of the coefficients
+func (glr *GDLinearRegression) Fit(X *utils.Matrix, y *utils.Matrix) (*training.History, error) {
+	return glr.FitContext(context.Background(), X, y)
+}
+
+// Fit that minimises the weighted mean squared error, the loss and gradient of each sample are multiplied by its weight
+// there must be a weight for every row of X, a nil sampleWeight is the same as Fit
+func (glr *GDLinearRegression) FitWeighted(X *utils.Matrix, y *utils.Matrix, sampleWeight []float64) (*training.History, error) {
+	return glr.fit(context.Background(), X, y, sampleWeight)
+}
+
+// Fit that stops between batches once ctx is cancelled or its deadline passes, returning ctx.Err()
+// the coefficients from the last completed batch are kept so the model can still make predictions
+func (glr *GDLinearRegression) FitContext(ctx context.Context, X *utils.Matrix, y *utils.Matrix) (*training.History, error) {
+	return glr.fit(ctx, X, y, nil)
+}
+
+func (glr *GDLinearRegression) fit(ctx context.Context, X *utils.Matrix, y *utils.Matrix, sampleWeight []float64) (*training.History, error) {
 
 	if y.Cols != 1 {
-		return errors.New("output data must have one column of data")
+		return nil, errors.New("output data must have one column of data")
 	}
 
 	if X.Rows != y.Rows {
-		return errors.New("number of examples need to match between input and output data")
+		return nil, errors.New("number of examples need to match between input and output data")
+	}
+
+	//the weights are copied into a column so they can be shuffled alongside X and y
+	var w *utils.Matrix
+	if sampleWeight != nil {
+		if len(sampleWeight) != X.Rows {
+			return nil, errors.New("there must be one sample weight for every example")
+		}
+		for _, weight := range sampleWeight {
+			if weight < 0 {
+				return nil, errors.New("sample weights cannot be negative")
+			}
+		}
+		w = utils.CreateMatrix(X.Rows, 1, append([]float64(nil), sampleWeight...))
 	}
 
 	//Learning rate cannot be less than or equal to 0
 	if glr.LearningRate <= 0 {
-		return errors.New("Learning rate cannot be less than or equal to zero")
+		return nil, errors.New("Learning rate cannot be less than or equal to zero")
 	}
 
 	// Init the coefficients and Bias to zero
@@ -177,88 +241,82 @@ func (glr *GDLinearRegression) Fit(X *utils.Matrix, y *utils.Matrix) error {
 	BiasGradient := 0.0
 	var gradients *utils.Matrix
 
-	//start the timer
-	t0 := time.Now()
-
-	//early stopping values
-	bestLoss := math.Inf(1)
-	iterNoImprov := 0
+	progress := glr.newGDProgress(ctx)
+	if stop, err := training.Stopped(progress.callbacks.OnTrainBegin(training.Logs{"epochs": float64(glr.MaxIter)})); stop {
+		return progress.history, err
+	}
 
 	if glr.GDescentType == "batch" {
 
 		for i := range glr.MaxIter {
 
-			t1 := time.Now()
+			if stop, err := progress.beginEpoch(i); stop {
+				if err != nil {
+					return progress.history, err
+				}
+				break
+			}
 
 			p := *NewPredictions(X, glr)
-			BiasGradient, gradients = glr.calculateBatchGradients(X, y, &p)
+			BiasGradient, gradients = glr.calculateBatchGradients(X, y, w, &p)
 
 			glr.UpdateBias(BiasGradient)
 			glr.UpdateCoefficients(gradients)
 
-			MSE := MSE(&p, y)
-
-			if glr.Verbose {
-				fmt.Printf("-- Iteration %d\nBias: %v, Error: %v, Epoch Time: %v\n", (i + 1), glr.Bias, MSE, time.Since(t1))
+			if _, err := progress.batchEnd(0, &p, y, w); err != nil {
+				return progress.history, err
 			}
 
-			//check for early stopping
-			if glr.earlyStopping {
-				if MSE < bestLoss-glr.Tol {
-					bestLoss = MSE
-					iterNoImprov = 0
-				} else if MSE > bestLoss-glr.Tol {
-					iterNoImprov++
-				}
+			MSE := weightedMSE(&p, y, w)
 
-				if iterNoImprov == glr.nIterNoChange {
-					if glr.Verbose {
-						fmt.Println("Convergence after", i, "epochs took", time.Since(t0))
-					}
-					break
-				}
+			stop, err := progress.endEpoch(i, MSE)
+			if err != nil {
+				return progress.history, err
+			}
+			if stop {
+				break
 			}
 
 		}
 	} else if glr.GDescentType == "SGD" {
 
 		for j := range glr.MaxIter {
-			t1 := time.Now()
-			utils.ShuffleRows(X, y)
+			if stop, err := progress.beginEpoch(j); stop {
+				if err != nil {
+					return progress.history, err
+				}
+				break
+			}
+			utils.ShuffleRows(X, y, w)
 			for i := range X.Rows {
 
 				x_sample := X.Row(i)
 				y_sample := y.Row(i)
+				w_sample := weightRows(w, i, i+1)
 
 				p := *NewPredictions(x_sample, glr)
-				BiasGradient, gradients = glr.calculateBatchGradients(x_sample, y_sample, &p)
+				BiasGradient, gradients = glr.calculateBatchGradients(x_sample, y_sample, w_sample, &p)
 
 				glr.UpdateBias(BiasGradient)
 				glr.UpdateCoefficients(gradients)
 
+				if stop, err := progress.batchEnd(i, &p, y_sample, w_sample); stop {
+					if err != nil {
+						return progress.history, err
+					}
+					break
+				}
 			}
 
 			p := *NewPredictions(X, glr)
-			MSE := MSE(&p, y)
+			MSE := weightedMSE(&p, y, w)
 
-			if glr.Verbose {
-				fmt.Printf("-- Iteration %d\nBias: %v, Error: %v, Epoch Time: %v\n", (j + 1), glr.Bias, MSE, time.Since(t1))
+			stop, err := progress.endEpoch(j, MSE)
+			if err != nil {
+				return progress.history, err
 			}
-			//check for early stopping
-			if glr.earlyStopping {
-				if MSE < bestLoss-glr.Tol {
-					bestLoss = MSE
-					iterNoImprov = 0
-				} else if MSE > bestLoss-glr.Tol {
-					iterNoImprov++
-				}
-
-				if iterNoImprov == glr.nIterNoChange {
-					if glr.Verbose {
-						fmt.Println("Convergence after", j, "epochs took", time.Since(t0))
-					}
-					break
-				}
+			if stop {
+				break
 			}
 		}
 
@@ -268,8 +326,13 @@ func (glr *GDLinearRegression) Fit(X *utils.Matrix, y *utils.Matrix) error {
 		miniBatchStart := 0
 
 		for j := range glr.MaxIter {
-			t1 := time.Now()
-			utils.ShuffleRows(X, y)
+			if stop, err := progress.beginEpoch(j); stop {
+				if err != nil {
+					return progress.history, err
+				}
+				break
+			}
+			utils.ShuffleRows(X, y, w)
 
 			for miniBatch := 0; miniBatch*miniBatchSize < X.Rows; miniBatch++ {
 				miniBatchStart = miniBatch * miniBatchSize
@@ -281,37 +344,32 @@ func (glr *GDLinearRegression) Fit(X *utils.Matrix, y *utils.Matrix) error {
 
 				Xs := X.RowSlice(miniBatchStart, miniBatchEnd)
 				ys := y.RowSlice(miniBatchStart, miniBatchEnd)
+				ws := weightRows(w, miniBatchStart, miniBatchEnd)
 
 				p := *NewPredictions(Xs, glr)
 
-				BiasGradient, gradients := glr.calculateBatchGradients(Xs, ys, &p)
+				BiasGradient, gradients := glr.calculateBatchGradients(Xs, ys, ws, &p)
 
 				glr.UpdateBias(BiasGradient)
 				glr.UpdateCoefficients(gradients)
 
+				if stop, err := progress.batchEnd(miniBatch, &p, ys, ws); stop {
+					if err != nil {
+						return progress.history, err
+					}
+					break
+				}
 			}
 
 			p := *NewPredictions(X, glr)
-			MSE := MSE(&p, y)
+			MSE := weightedMSE(&p, y, w)
 
-			if glr.Verbose {
-				fmt.Printf("-- Iteration %d\nBias: %v, Error: %v, Epoch Time: %v\n", (j + 1), glr.Bias, MSE, time.Since(t1))
+			stop, err := progress.endEpoch(j, MSE)
+			if err != nil {
+				return progress.history, err
 			}
-			//check for early stopping
-			if glr.earlyStopping {
-				if MSE < bestLoss-glr.Tol {
-					bestLoss = MSE
-					iterNoImprov = 0
-				} else if MSE > bestLoss-glr.Tol {
-					iterNoImprov++
-				}
-
-				if iterNoImprov == glr.nIterNoChange {
-					if glr.Verbose {
-						fmt.Println("Convergence after", j, "epochs took", time.Since(t0))
-					}
-					break
-				}
+			if stop {
+				break
 			}
 
 		}
@@ -322,7 +380,134 @@ func (glr *GDLinearRegression) Fit(X *utils.Matrix, y *utils.Matrix) error {
 
 	glr.Fitted = true
 
-	return nil
+	progress.history.Seconds = time.Since(progress.start).Seconds()
+
+	_, err := training.Stopped(progress.callbacks.OnTrainEnd(progress.endLogs))
+	if err == nil {
+		err = ctx.Err()
+	}
+	return progress.history, err
+}
+
+// state of the callbacks and early stopping while fitting
+type gdProgress struct {
+	glr       *GDLinearRegression
+	ctx       context.Context
+	callbacks training.CallbackList
+
+	bestLoss     float64
+	iterNoImprov int
+
+	//set when a batch callback stops training part way through an epoch
+	stopped bool
+	endLogs training.Logs
+
+	history    *training.History
+	start      time.Time
+	epochStart time.Time
+	iterations int
+}
+
+func (glr *GDLinearRegression) newGDProgress(ctx context.Context) *gdProgress {
+	//printing the progress is the default callback when verbose is on
+	callbacks := training.CallbackList(glr.Callbacks)
+	if glr.Verbose {
+		callbacks = append(training.CallbackList{training.NewProgressLogger()}, callbacks...)
+	}
+
+	return &gdProgress{
+		glr:       glr,
+		ctx:       ctx,
+		callbacks: callbacks,
+		bestLoss:  math.Inf(1),
+		endLogs:   training.Logs{},
+		history:   training.NewHistory(),
+		start:     time.Now(),
+	}
+}
+
+// returns true if the context is done or a callback wants to stop before the epoch starts
+func (gp *gdProgress) beginEpoch(epoch int) (bool, error) {
+	gp.epochStart = time.Now()
+	gp.iterations = 0
+
+	stop, err := training.Stopped(gp.callbacks.OnEpochBegin(epoch, training.Logs{}))
+	if gp.ctx.Err() != nil {
+		stop = true
+	}
+	if stop {
+		gp.history.StoppedEpoch = epoch
+	}
+	return stop, err
+}
+
+// Passes the loss of a batch to the callbacks, returns true if one of them stopped training or the context is done
+// the loss is of the predictions made before the update, weighted by w when it is not nil
+func (gp *gdProgress) batchEnd(batch int, p, y, w *utils.Matrix) (bool, error) {
+	gp.iterations++
+
+	var stop bool
+	var err error
+	if len(gp.callbacks) > 0 {
+		stop, err = training.Stopped(gp.callbacks.OnBatchEnd(batch, training.Logs{"loss": weightedMSE(p, y, w), "size": float64(y.Rows)}))
+	}
+	if gp.ctx.Err() != nil {
+		stop = true
+	}
+
+	gp.stopped = gp.stopped || stop
+	return stop, err
+}
+
+// Passes the loss of an epoch to the callbacks and checks for early stopping
+// training will stop when loss > best_loss - Tol for nIterNoChange epochs
+// an epoch cut short by the context isn't recorded, so StoppedEpoch is the epoch that didn't finish like in the MLP
+func (gp *gdProgress) endEpoch(epoch int, loss float64) (bool, error) {
+	if gp.ctx.Err() != nil {
+		gp.history.Iterations += gp.iterations
+		gp.history.StoppedEpoch = epoch
+		return true, nil
+	}
+	stop := gp.stopped
+
+	if gp.glr.earlyStopping {
+		if loss < gp.bestLoss-gp.glr.Tol {
+			gp.bestLoss = loss
+			gp.iterNoImprov = 0
+		} else if loss > gp.bestLoss-gp.glr.Tol {
+			gp.iterNoImprov++
+		}
+
+		if gp.iterNoImprov == gp.glr.nIterNoChange {
+			gp.endLogs["stopped_epoch"] = float64(epoch)
+			stop = true
+		}
+	}
+
+	logs := training.Logs{"loss": loss, "bias": gp.glr.Bias}
+	gp.history.Add(epoch, logs, gp.glr.LearningRate, gp.iterations, time.Since(gp.epochStart))
+
+	callbackStop, err := training.Stopped(gp.callbacks.OnEpochEnd(epoch, logs))
+	if stop || callbackStop {
+		gp.history.StoppedEpoch = epoch
+	}
+	return stop || callbackStop, err
+}
+
+// SnapshotWeights and RestoreWeights let training.EarlyStopping put back the coefficients of the best epoch
+func (glr *GDLinearRegression) SnapshotWeights() any {
+	return gdSnapshot{coeffs: glr.Coeffs.MatCopy(), bias: glr.Bias}
+}
+
+func (glr *GDLinearRegression) RestoreWeights(snapshot any) {
+	s := snapshot.(gdSnapshot)
+	glr.Coeffs = s.coeffs.MatCopy()
+	glr.Bias = s.bias
+}
+
+type gdSnapshot struct {
+	coeffs *utils.Matrix
+	bias   float64
 }
 
 func (glr *GDLinearRegression) Predict(X *utils.Matrix) (float64, error) {
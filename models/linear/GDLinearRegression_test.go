@@ -0,0 +1,168 @@
+package models
+
+import (
+	"Go-Machine-Learning/training"
+	"Go-Machine-Learning/utils"
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// stops training at the end of an epoch
+type stopAt struct {
+	training.BaseCallback
+	epoch int
+}
+
+func (s stopAt) OnEpochEnd(epoch int, logs training.Logs) error {
+	if epoch == s.epoch {
+		return training.ErrStopTraining
+	}
+	return nil
+}
+
+func TestGDLinearRegressionHistory(t *testing.T) {
+	X := utils.CreateMatrix(4, 2, []float64{1, 2, 3, 4, 5, 6, 10, 5})
+	y := utils.CreateMatrix(4, 1, []float64{5, 11, 17, 26})
+
+	glr := NewGDLinearRegression()
+	glr.GDescentType = "miniBatch"
+	glr.batchSize = 3
+	glr.earlyStopping = false
+	glr.Callbacks = []training.Callback{stopAt{epoch: 4}}
+
+	history, err := glr.Fit(X, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if history.Len() != 5 || history.StoppedEpoch != 4 {
+		t.Errorf("ran %d epochs and stopped at %d, want 5 and 4", history.Len(), history.StoppedEpoch)
+	}
+	//4 samples in batches of 3
+	if history.Iterations != 10 {
+		t.Errorf("%d iterations want 10", history.Iterations)
+	}
+	if !glr.Fitted {
+		t.Errorf("model is not fitted after a callback stopped training")
+	}
+
+	loss := history.Metric("loss")
+	if loss[len(loss)-1] >= loss[0] {
+		t.Errorf("the loss did not decrease: %v", loss)
+	}
+	if history.Epochs[0].LearningRate != glr.LearningRate {
+		t.Errorf("learning rate %v want %v", history.Epochs[0].LearningRate, glr.LearningRate)
+	}
+}
+
+func TestGDLinearRegressionFitContext(t *testing.T) {
+	X := utils.CreateMatrix(4, 2, []float64{1, 2, 3, 4, 5, 6, 10, 5})
+	y := utils.CreateMatrix(4, 1, []float64{5, 11, 17, 26})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	glr := NewGDLinearRegression()
+	glr.earlyStopping = false
+	glr.MaxIter = math.MaxInt
+
+	history, err := glr.FitContext(ctx, X, y)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v want context.DeadlineExceeded", err)
+	}
+	//the epoch the deadline passed in or before isn't recorded, whenever it passes
+	if history.StoppedEpoch != history.Len() || !glr.Fitted {
+		t.Errorf("stopped at epoch %d of %d, fitted %v", history.StoppedEpoch, history.Len(), glr.Fitted)
+	}
+
+	x := utils.CreateMatrix(1, 2, []float64{4, 5})
+	if _, err := glr.Predict(x); err != nil {
+		t.Errorf("can't predict after the deadline: %v", err)
+	}
+}
+
+// cancels a context part way through an epoch
+type cancelAt struct {
+	training.BaseCallback
+	cancel  context.CancelFunc
+	batches *int
+}
+
+func (c cancelAt) OnBatchEnd(batch int, logs training.Logs) error {
+	*c.batches++
+	if *c.batches == 10 {
+		c.cancel()
+	}
+	return nil
+}
+
+func TestGDLinearRegressionCancelledEpoch(t *testing.T) {
+	X := utils.CreateMatrix(4, 2, []float64{1, 2, 3, 4, 5, 6, 10, 5})
+	y := utils.CreateMatrix(4, 1, []float64{5, 11, 17, 26})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	glr := NewGDLinearRegression()
+	glr.earlyStopping = false
+	glr.Callbacks = []training.Callback{cancelAt{cancel: cancel, batches: new(int)}}
+
+	//SGD runs 4 batches an epoch, so the 10th is in the middle of epoch 2
+	history, err := glr.FitContext(ctx, X, y)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v want context.Canceled", err)
+	}
+	if history.Len() != 2 || history.StoppedEpoch != 2 || history.Iterations != 10 {
+		t.Errorf("recorded %d epochs, stopped at %d after %d iterations, want 2, 2 and 10", history.Len(), history.StoppedEpoch, history.Iterations)
+	}
+}
+
+func TestGDLinearRegressionFitWeighted(t *testing.T) {
+	X := utils.CreateMatrix(4, 2, []float64{1, 2, 3, 4, 5, 6, 10, 5})
+	y := utils.CreateMatrix(4, 1, []float64{5, 11, 17, 26})
+
+	fit := func(weights []float64) *GDLinearRegression {
+		glr := NewGDLinearRegression()
+		glr.GDescentType = "batch"
+		glr.earlyStopping = false
+		glr.MaxIter = 50
+		glr.Regularisation = "none"
+		if _, err := glr.FitWeighted(X, y, weights); err != nil {
+			t.Fatal(err)
+		}
+		return glr
+	}
+
+	//batch gradient descent doesn't shuffle, so weights of 1 give exactly the unweighted fit
+	unweighted := fit(nil)
+	ones := fit([]float64{1, 1, 1, 1})
+	if !utils.ApproxEquals(unweighted.Coeffs, ones.Coeffs, 1e-12) || unweighted.Bias != ones.Bias {
+		t.Errorf("weights of 1 changed the fit: %v want %v", ones.Coeffs.Data, unweighted.Coeffs.Data)
+	}
+
+	//doubling every weight doubles the gradients of the loss, which is the same as doubling the learning rate
+	doubled := fit([]float64{2, 2, 2, 2})
+	fast := NewGDLinearRegression()
+	fast.GDescentType = "batch"
+	fast.earlyStopping = false
+	fast.MaxIter = 50
+	fast.Regularisation = "none"
+	fast.LearningRate *= 2
+	if _, err := fast.Fit(X, y); err != nil {
+		t.Fatal(err)
+	}
+	if !utils.ApproxEquals(doubled.Coeffs, fast.Coeffs, 1e-9) || math.Abs(doubled.Bias-fast.Bias) > 1e-9 {
+		t.Errorf("doubled weights %v want %v", doubled.Coeffs.Data, fast.Coeffs.Data)
+	}
+
+	glr := NewGDLinearRegression()
+	if _, err := glr.FitWeighted(X, y, []float64{1, 1}); err == nil {
+		t.Errorf("expected an error for too few weights")
+	}
+	if _, err := glr.FitWeighted(X, y, []float64{1, -1, 1, 1}); err == nil {
+		t.Errorf("expected an error for a negative weight")
+	}
+}
@@ -5,12 +5,15 @@ package models
 import (
 	"Go-Machine-Learning/utils"
 	"errors"
+	"math"
 )
 
 var (
 	ERRShape        = errors.New("Incorrect shapes, linear regression requires X and y to have the same number of rows")
 	ErrNotTrained   = errors.New("Cannot predict for untrained model")
 	ERRPredictShape = errors.New("Shape mismatch, shape of prediction vector does not match shahpe of training data")
+	ERRWeightShape  = errors.New("Incorrect shapes, there must be one sample weight for every row of X")
+	ERRWeight       = errors.New("Sample weights cannot be negative")
 )
 
 type LinearRegression struct {
@@ -23,11 +26,27 @@ func NewLinearRegression() *LinearRegression{
 }
 
 func (lr *LinearRegression) Fit(X, y *utils.Matrix) error {
+	return lr.FitWeighted(X, y, nil)
+}
+
+// Weighted least squares, each squared residual is multiplied by the weight of its sample
+// β = (X^T W X)^-1 X^T W y, where W is the diagonal matrix of the weights
+// This is OLS on the rows of X and y scaled by √w, a nil sampleWeight weighs every sample equally
+func (lr *LinearRegression) FitWeighted(X, y *utils.Matrix, sampleWeight []float64) error {
 
 	if X.Rows != y.Rows {
 		return ERRShape
 	}
 
+	if sampleWeight != nil && len(sampleWeight) != X.Rows {
+		return ERRWeightShape
+	}
+	for _, w := range sampleWeight {
+		if w < 0 {
+			return ERRWeight
+		}
+	}
+
 	//Create the design matrix by adding a column of 1's to the X matrix
 	newCols := X.Cols + 1
 	newData := make([]float64, X.Rows*newCols)
@@ -39,6 +58,21 @@ func (lr *LinearRegression) Fit(X, y *utils.Matrix) error {
 		}
 	}
 
+	//scale each row of the design matrix and y by the square root of its weight
+	if sampleWeight != nil {
+		yData := make([]float64, len(y.Data))
+		for i, w := range sampleWeight {
+			scale := math.Sqrt(w)
+			for j := range newCols {
+				newData[i*newCols+j] *= scale
+			}
+			for j := range y.Cols {
+				yData[i*y.Cols+j] = y.Data[i*y.Cols+j] * scale
+			}
+		}
+		y = utils.CreateMatrix(y.Rows, y.Cols, yData)
+	}
+
 	XDes := utils.CreateMatrix(X.Rows, newCols, newData)
 
 	//X Transposed
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"Go-Machine-Learning/utils"
+	"math"
+	"testing"
+)
+
+func TestLinearRegressionFitWeighted(t *testing.T) {
+	X := utils.CreateMatrix(5, 1, []float64{1, 2, 3, 4, 5})
+	y := utils.CreateMatrix(5, 1, []float64{2.1, 3.9, 6.2, 7.8, 30})
+
+	//a weight of 2 is the same as repeating the sample
+	weighted := NewLinearRegression()
+	if err := weighted.FitWeighted(X, y, []float64{2, 1, 1, 1, 1}); err != nil {
+		t.Fatal(err)
+	}
+	repeated := NewLinearRegression()
+	XRepeated := utils.CreateMatrix(6, 1, []float64{1, 1, 2, 3, 4, 5})
+	yRepeated := utils.CreateMatrix(6, 1, []float64{2.1, 2.1, 3.9, 6.2, 7.8, 30})
+	if err := repeated.Fit(XRepeated, yRepeated); err != nil {
+		t.Fatal(err)
+	}
+	for i := range weighted.Coeffs {
+		if math.Abs(weighted.Coeffs[i]-repeated.Coeffs[i]) > 1e-9 {
+			t.Errorf("coefficients %v want %v", weighted.Coeffs, repeated.Coeffs)
+		}
+	}
+
+	//the outlier is ignored when it has no weight, leaving y ≈ 2x
+	if err := weighted.FitWeighted(X, y, []float64{1, 1, 1, 1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(weighted.Coeffs[1]-1.94) > 1e-9 {
+		t.Errorf("slope %v want 1.94", weighted.Coeffs[1])
+	}
+
+	if err := weighted.FitWeighted(X, y, []float64{1, 1}); err != ERRWeightShape {
+		t.Errorf("got error %v for too few weights", err)
+	}
+	if err := weighted.FitWeighted(X, y, []float64{1, 1, -1, 1, 1}); err != ERRWeight {
+		t.Errorf("got error %v for a negative weight", err)
+	}
+}
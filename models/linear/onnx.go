@@ -0,0 +1,34 @@
+package models
+
+import (
+	"Go-Machine-Learning/onnx"
+	"io"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Writes the fitted model as an ONNX model, with a float input "input" of N samples x features and an output
+// "output" with the N predictions as a column
+func (lr *LinearRegression) ExportONNX(w io.Writer) error {
+	if !lr.fitted {
+		return ErrNotTrained
+	}
+	return onnx.Write(w, linearONNXModel(linearRegressionKind, lr.Coeffs[1:], lr.Coeffs[0]))
+}
+
+// Writes the fitted model as an ONNX model, with the same input and output as LinearRegression.ExportONNX
+func (glr *GDLinearRegression) ExportONNX(w io.Writer) error {
+	if !glr.Fitted || glr.Coeffs == nil {
+		return ErrNotTrained
+	}
+	return onnx.Write(w, linearONNXModel(gdLinearRegressionKind, glr.Coeffs.Data, glr.Bias))
+}
+
+// y = X • coeffs + bias as a single Gemm node
+func linearONNXModel(name string, coeffs []float64, bias float64) *onnx.Model {
+	model := onnx.NewModel(name)
+	model.Graph.AddInput("input", len(coeffs))
+	model.Graph.AddDense("linear", "input", "output", mat.NewDense(len(coeffs), 1, coeffs), []float64{bias})
+	model.Graph.AddOutput("output", 1)
+	return model
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"Go-Machine-Learning/onnx"
+	"Go-Machine-Learning/utils"
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// exports with export, reads the file back and checks it predicts every row of X like predict
+func checkExportedPredictions(t *testing.T, export func(io.Writer) error, predict func(*utils.Matrix) (float64, error), X *utils.Matrix) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	model, err := onnx.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs, err := model.Run(map[string]*mat.Dense{"input": mat.NewDense(X.Rows, X.Cols, X.Data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := outputs["output"]
+	if rows, cols := output.Dims(); rows != X.Rows || cols != 1 {
+		t.Fatalf("output is %dx%d, want %dx1", rows, cols, X.Rows)
+	}
+	for i := range X.Rows {
+		want, err := predict(X.Row(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		//the coefficients are float32 in the file
+		if got := output.At(i, 0); math.Abs(got-want) > 1e-5*math.Max(1, math.Abs(want)) {
+			t.Errorf("row %d: exported model predicts %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestLinearRegressionExportONNX(t *testing.T) {
+	X := utils.CreateMatrix(4, 2, []float64{1, 2, 3, 4, 5, 6, 10, 5})
+	y := utils.CreateMatrix(4, 1, []float64{5, 11, 17, 26})
+
+	lr := NewLinearRegression()
+	if err := lr.ExportONNX(io.Discard); err != ErrNotTrained {
+		t.Errorf("got error %v exporting an untrained model", err)
+	}
+	if err := lr.Fit(X, y); err != nil {
+		t.Fatal(err)
+	}
+	checkExportedPredictions(t, lr.ExportONNX, lr.Predict, X)
+}
+
+func TestGDLinearRegressionExportONNX(t *testing.T) {
+	X := utils.CreateMatrix(4, 2, []float64{1, 2, 3, 4, 5, 6, 10, 5})
+	y := utils.CreateMatrix(4, 1, []float64{4, 10, 16, 25})
+
+	glr := NewGDLinearRegression()
+	if err := glr.ExportONNX(io.Discard); err != ErrNotTrained {
+		t.Errorf("got error %v exporting an untrained model", err)
+	}
+	glr.GDescentType = "batch"
+	glr.MaxIter = 50
+	if _, err := glr.Fit(X, y); err != nil {
+		t.Fatal(err)
+	}
+	checkExportedPredictions(t, glr.ExportONNX, glr.Predict, X)
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"Go-Machine-Learning/serialization"
+	"Go-Machine-Learning/utils"
+	"fmt"
+	"io"
+)
+
+const (
+	linearRegressionKind   = "LinearRegression"
+	gdLinearRegressionKind = "GDLinearRegression"
+)
+
+type linearRegressionState struct {
+	Coeffs []float64
+	Fitted bool
+}
+
+// Saves the model in the compact binary format
+func (lr *LinearRegression) Save(w io.Writer) error {
+	return serialization.Write(w, linearRegressionKind, serialization.Binary, lr.state())
+}
+
+// Saves the model as human readable JSON
+func (lr *LinearRegression) SaveJSON(w io.Writer) error {
+	return serialization.Write(w, linearRegressionKind, serialization.JSON, lr.state())
+}
+
+// Loads a model saved with Save or SaveJSON
+func (lr *LinearRegression) Load(r io.Reader) error {
+	var s linearRegressionState
+	if err := serialization.Read(r, linearRegressionKind, &s); err != nil {
+		return err
+	}
+	lr.Coeffs = s.Coeffs
+	lr.fitted = s.Fitted
+	return nil
+}
+
+func (lr *LinearRegression) state() *linearRegressionState {
+	return &linearRegressionState{Coeffs: lr.Coeffs, Fitted: lr.fitted}
+}
+
+type gdLinearRegressionState struct {
+	Coeffs []float64
+	Bias   float64
+	Fitted bool
+
+	MaxIter        int
+	LearningRate   float64
+	Verbose        bool
+	Regularisation string
+	Alpha          float64
+	EarlyStopping  bool
+	Tol            float64
+	NIterNoChange  int
+	GDescentType   string
+	BatchSize      int
+}
+
+// Saves the model in the compact binary format
+func (glr *GDLinearRegression) Save(w io.Writer) error {
+	return serialization.Write(w, gdLinearRegressionKind, serialization.Binary, glr.state())
+}
+
+// Saves the model as human readable JSON
+func (glr *GDLinearRegression) SaveJSON(w io.Writer) error {
+	return serialization.Write(w, gdLinearRegressionKind, serialization.JSON, glr.state())
+}
+
+// Loads a model saved with Save or SaveJSON
+func (glr *GDLinearRegression) Load(r io.Reader) error {
+	var s gdLinearRegressionState
+	if err := serialization.Read(r, gdLinearRegressionKind, &s); err != nil {
+		return err
+	}
+
+	if s.Fitted && len(s.Coeffs) == 0 {
+		return fmt.Errorf("saved %s is fitted but has no coefficients", gdLinearRegressionKind)
+	}
+
+	glr.Coeffs = nil
+	if s.Coeffs != nil {
+		glr.Coeffs = utils.CreateMatrix(len(s.Coeffs), 1, s.Coeffs)
+	}
+	glr.Bias = s.Bias
+	glr.Fitted = s.Fitted
+	glr.MaxIter = s.MaxIter
+	glr.LearningRate = s.LearningRate
+	glr.Verbose = s.Verbose
+	glr.Regularisation = s.Regularisation
+	glr.Alpha = s.Alpha
+	glr.earlyStopping = s.EarlyStopping
+	glr.Tol = s.Tol
+	glr.nIterNoChange = s.NIterNoChange
+	glr.GDescentType = s.GDescentType
+	glr.batchSize = s.BatchSize
+	return nil
+}
+
+func (glr *GDLinearRegression) state() *gdLinearRegressionState {
+	s := &gdLinearRegressionState{
+		Bias:           glr.Bias,
+		Fitted:         glr.Fitted,
+		MaxIter:        glr.MaxIter,
+		LearningRate:   glr.LearningRate,
+		Verbose:        glr.Verbose,
+		Regularisation: glr.Regularisation,
+		Alpha:          glr.Alpha,
+		EarlyStopping:  glr.earlyStopping,
+		Tol:            glr.Tol,
+		NIterNoChange:  glr.nIterNoChange,
+		GDescentType:   glr.GDescentType,
+		BatchSize:      glr.batchSize,
+	}
+	if glr.Coeffs != nil {
+		s.Coeffs = glr.Coeffs.Data
+	}
+	return s
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"Go-Machine-Learning/utils"
+	"bytes"
+	"testing"
+)
+
+func TestLinearRegressionSaveLoad(t *testing.T) {
+	X := utils.CreateMatrix(4, 2, []float64{1, 2, 3, 4, 5, 6, 10, 5})
+	y := utils.CreateMatrix(4, 1, []float64{5, 11, 17, 26})
+
+	lr := NewLinearRegression()
+	lr.Fit(X, y)
+
+	for _, save := range []func(*bytes.Buffer) error{
+		func(b *bytes.Buffer) error { return lr.Save(b) },
+		func(b *bytes.Buffer) error { return lr.SaveJSON(b) },
+	} {
+		var buf bytes.Buffer
+		if err := save(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded := NewLinearRegression()
+		if err := loaded.Load(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		x := utils.CreateMatrix(1, 2, []float64{4, 5})
+		want, _ := lr.Predict(x)
+		got, err := loaded.Predict(x)
+		if err != nil || got != want {
+			t.Errorf("got %v, %v want %v", got, err, want)
+		}
+	}
+}
+
+func TestGDLinearRegressionSaveLoad(t *testing.T) {
+	X := utils.CreateMatrix(4, 2, []float64{1, 2, 3, 4, 5, 6, 10, 5})
+	y := utils.CreateMatrix(4, 1, []float64{4, 10, 16, 25})
+
+	glr := NewGDLinearRegression()
+	glr.GDescentType = "batch"
+	glr.MaxIter = 50
+	glr.Fit(X, y)
+
+	var buf bytes.Buffer
+	if err := glr.SaveJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewGDLinearRegression()
+	loaded.GDescentType = "SGD"
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	x := utils.CreateMatrix(1, 2, []float64{4, 5})
+	want, _ := glr.Predict(x)
+	got, err := loaded.Predict(x)
+	if err != nil || got != want {
+		t.Errorf("got %v, %v want %v", got, err, want)
+	}
+	if loaded.GDescentType != "batch" || loaded.batchSize != glr.batchSize {
+		t.Errorf("hyperparameters were not loaded")
+	}
+}
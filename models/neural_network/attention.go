@@ -0,0 +1,366 @@
+package neuralnetwork
+
+import (
+	"fmt"
+	"math"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// settings shared by the layers that take sequences of Shape{steps, dim} and return the same shape
+type sequenceLayer struct {
+	// Treat the steps where every value is MaskValue as padding, such as the zero vectors of an Embedding's PaddingIndex
+	// padding is left as MaskValue in the output so the layers after can mask it as well
+	Mask      bool
+	MaskValue float64
+
+	steps, dim int
+}
+
+func (s *sequenceLayer) build(layer string, input Shape) {
+	if len(input) != 2 {
+		panic(fmt.Sprintf("%s needs inputs of Shape{steps, dim}, got %v", layer, input))
+	}
+	s.steps, s.dim = input[0], input[1]
+}
+
+// which steps of the batch are padding, with one step per row
+func (s *sequenceLayer) paddingSteps(tokens *mat.Dense) []bool {
+	if !s.Mask {
+		return nil
+	}
+	rows, _ := tokens.Dims()
+	padding := make([]bool, rows)
+	for i := range rows {
+		padding[i] = true
+		for _, value := range tokens.RawRowView(i) {
+			if value != s.MaskValue {
+				padding[i] = false
+				break
+			}
+		}
+	}
+	return padding
+}
+
+// sets the padding steps of the output back to MaskValue
+func (s *sequenceLayer) fillPadding(tokens *mat.Dense, padding []bool) {
+	for i, pad := range padding {
+		if pad {
+			row := tokens.RawRowView(i)
+			for j := range row {
+				row[j] = s.MaskValue
+			}
+		}
+	}
+}
+
+// the batch with one step of a sample per row, (n·steps) x dim
+func (s *sequenceLayer) tokens(X *mat.Dense) *mat.Dense {
+	n, _ := X.Dims()
+	return reshape(X, n*s.steps, s.dim)
+}
+
+// m with its values read row by row into a rows x cols matrix, sharing them when m is not a view of a wider matrix
+func reshape(m *mat.Dense, rows, cols int) *mat.Dense {
+	raw := m.RawMatrix()
+	if raw.Stride == raw.Cols {
+		return mat.NewDense(rows, cols, raw.Data[:rows*cols])
+	}
+	return mat.NewDense(rows, cols, mat.DenseCopyOf(m).RawMatrix().Data)
+}
+
+// Multi-head scaled dot product self-attention, every step of a sequence looks at every other step
+// Q = X • Wq + bq, K = X • Wk + bk, V = X • Wv + bv, split into Heads blocks of dim/Heads columns
+// head = softmax(Q_h • K_h^T / sqrt(dim/Heads)) • V_h
+// output = [head_1 ... head_Heads] • Wo + bo
+// with Mask set the padding steps are left out of the softmax so no step attends to them
+type MultiHeadAttention struct {
+	sequenceLayer
+	// number of heads, which has to divide the dim of the input
+	Heads int
+
+	QueryWeights  *mat.Dense `json:"-"`
+	KeyWeights    *mat.Dense `json:"-"`
+	ValueWeights  *mat.Dense `json:"-"`
+	OutputWeights *mat.Dense `json:"-"`
+	QueryBias     *mat.Dense `json:"-"`
+	KeyBias       *mat.Dense `json:"-"`
+	ValueBias     *mat.Dense `json:"-"`
+	OutputBias    *mat.Dense `json:"-"`
+}
+
+func NewMultiHeadAttention(heads int) *MultiHeadAttention {
+	return &MultiHeadAttention{Heads: heads}
+}
+
+type attentionCache struct {
+	tokens, q, k, v *mat.Dense
+	//the attention weights of each sample and head, sample by sample
+	weights []*mat.Dense
+	//the heads side by side before the output projection
+	heads   *mat.Dense
+	padding []bool
+}
+
+func (l *MultiHeadAttention) Build(input Shape, rng *rand.Rand) Shape {
+	l.build("MultiHeadAttention", input)
+	if l.Heads <= 0 || l.dim%l.Heads != 0 {
+		panic(fmt.Sprintf("MultiHeadAttention.Heads %d must divide the dim of the input %d", l.Heads, l.dim))
+	}
+
+	init := GlorotUniform{}
+	l.QueryWeights = init.Initialize(l.dim, l.dim, rng)
+	l.KeyWeights = init.Initialize(l.dim, l.dim, rng)
+	l.ValueWeights = init.Initialize(l.dim, l.dim, rng)
+	l.OutputWeights = init.Initialize(l.dim, l.dim, rng)
+	l.QueryBias = mat.NewDense(1, l.dim, nil)
+	l.KeyBias = mat.NewDense(1, l.dim, nil)
+	l.ValueBias = mat.NewDense(1, l.dim, nil)
+	l.OutputBias = mat.NewDense(1, l.dim, nil)
+	return input
+}
+
+func (l *MultiHeadAttention) Forward(X *mat.Dense, training bool) (*mat.Dense, any) {
+	n, _ := X.Dims()
+	tokens := l.tokens(X)
+	out, cache := l.attend(tokens, l.paddingSteps(tokens))
+	l.fillPadding(out, cache.padding)
+	return reshape(out, n, l.steps*l.dim), cache
+}
+
+func (l *MultiHeadAttention) Backward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense) {
+	c := cache.(*attentionCache)
+	n, _ := grad.Dims()
+	//the padding in the output is a constant
+	dOut := maskRows(l.tokens(grad), c.padding)
+	dTokens, grads := l.attendBackward(dOut, c)
+	return reshape(dTokens, n, l.steps*l.dim), grads
+}
+
+func (l *MultiHeadAttention) Params() []*mat.Dense {
+	return []*mat.Dense{
+		l.QueryWeights, l.KeyWeights, l.ValueWeights, l.OutputWeights,
+		l.QueryBias, l.KeyBias, l.ValueBias, l.OutputBias,
+	}
+}
+
+// self-attention over the steps of each sample, the output of the padding steps is not meaningful
+func (l *MultiHeadAttention) attend(tokens *mat.Dense, padding []bool) (*mat.Dense, *attentionCache) {
+	rows, _ := tokens.Dims()
+	n := rows / l.steps
+	headDim := l.dim / l.Heads
+	scale := 1 / math.Sqrt(float64(headDim))
+
+	project := func(weights, bias *mat.Dense) *mat.Dense {
+		var p mat.Dense
+		p.Mul(tokens, weights)
+		addIntercepts(p, *bias)
+		return &p
+	}
+	q, k, v := project(l.QueryWeights, l.QueryBias), project(l.KeyWeights, l.KeyBias), project(l.ValueWeights, l.ValueBias)
+
+	heads := mat.NewDense(rows, l.dim, nil)
+	weights := make([]*mat.Dense, n*l.Heads)
+	for s := range n {
+		first, last := s*l.steps, (s+1)*l.steps
+		for h := range l.Heads {
+			qh := q.Slice(first, last, h*headDim, (h+1)*headDim)
+			kh := k.Slice(first, last, h*headDim, (h+1)*headDim)
+			vh := v.Slice(first, last, h*headDim, (h+1)*headDim)
+
+			var scores mat.Dense
+			scores.Mul(qh, kh.T())
+			scores.Scale(scale, &scores)
+			a := l.softmax(&scores, padding, first)
+
+			heads.Slice(first, last, h*headDim, (h+1)*headDim).(*mat.Dense).Mul(a, vh)
+			weights[s*l.Heads+h] = a
+		}
+	}
+
+	var out mat.Dense
+	out.Mul(heads, l.OutputWeights)
+	addIntercepts(out, *l.OutputBias)
+
+	return &out, &attentionCache{tokens: tokens, q: q, k: k, v: v, weights: weights, heads: heads, padding: padding}
+}
+
+// softmax over each row of the scores, leaving out the padding steps of the sample starting at row first
+// a sample that is all padding attends to nothing
+func (l *MultiHeadAttention) softmax(scores *mat.Dense, padding []bool, first int) *mat.Dense {
+	a := mat.NewDense(l.steps, l.steps, nil)
+	for i := range l.steps {
+		row, out := scores.RawRowView(i), a.RawRowView(i)
+		maxScore := math.Inf(-1)
+		for j, score := range row {
+			if padding == nil || !padding[first+j] {
+				maxScore = math.Max(maxScore, score)
+			}
+		}
+		if math.IsInf(maxScore, -1) {
+			continue
+		}
+
+		sum := 0.0
+		for j, score := range row {
+			if padding == nil || !padding[first+j] {
+				out[j] = math.Exp(score - maxScore)
+				sum += out[j]
+			}
+		}
+		for j := range out {
+			out[j] /= sum
+		}
+	}
+	return a
+}
+
+// δheads = δout • Wo^T, then for each head
+// δA = δhead • V_h^T, δV_h = A^T • δhead
+// δS = A ⊙ (δA - Σ_j δA ⊙ A) / sqrt(dim/Heads), the softmax backward for each row
+// δQ_h = δS • K_h, δK_h = δS^T • Q_h
+// and each projection passes its gradient back to the tokens like a dense layer
+func (l *MultiHeadAttention) attendBackward(dOut *mat.Dense, c *attentionCache) (*mat.Dense, []*mat.Dense) {
+	rows, _ := dOut.Dims()
+	n := rows / l.steps
+	headDim := l.dim / l.Heads
+	scale := 1 / math.Sqrt(float64(headDim))
+
+	var dOutputWeights, dHeads mat.Dense
+	dOutputWeights.Mul(c.heads.T(), dOut)
+	dHeads.Mul(dOut, l.OutputWeights.T())
+
+	dq, dk, dv := mat.NewDense(rows, l.dim, nil), mat.NewDense(rows, l.dim, nil), mat.NewDense(rows, l.dim, nil)
+	for s := range n {
+		first, last := s*l.steps, (s+1)*l.steps
+		for h := range l.Heads {
+			a := c.weights[s*l.Heads+h]
+			dHead := dHeads.Slice(first, last, h*headDim, (h+1)*headDim)
+
+			var dA mat.Dense
+			dA.Mul(dHead, c.v.Slice(first, last, h*headDim, (h+1)*headDim).T())
+			dv.Slice(first, last, h*headDim, (h+1)*headDim).(*mat.Dense).Mul(a.T(), dHead)
+
+			for i := range l.steps {
+				aRow, dARow := a.RawRowView(i), dA.RawRowView(i)
+				dot := 0.0
+				for j := range aRow {
+					dot += aRow[j] * dARow[j]
+				}
+				for j := range aRow {
+					dARow[j] = aRow[j] * (dARow[j] - dot) * scale
+				}
+			}
+
+			dq.Slice(first, last, h*headDim, (h+1)*headDim).(*mat.Dense).Mul(&dA, c.k.Slice(first, last, h*headDim, (h+1)*headDim))
+			dk.Slice(first, last, h*headDim, (h+1)*headDim).(*mat.Dense).Mul(dA.T(), c.q.Slice(first, last, h*headDim, (h+1)*headDim))
+		}
+	}
+
+	var dQueryWeights, dKeyWeights, dValueWeights mat.Dense
+	dQueryWeights.Mul(c.tokens.T(), dq)
+	dKeyWeights.Mul(c.tokens.T(), dk)
+	dValueWeights.Mul(c.tokens.T(), dv)
+
+	var dTokens mat.Dense
+	dTokens.Mul(dq, l.QueryWeights.T())
+	addMul(&dTokens, dk, l.KeyWeights.T())
+	addMul(&dTokens, dv, l.ValueWeights.T())
+
+	return &dTokens, []*mat.Dense{
+		&dQueryWeights, &dKeyWeights, &dValueWeights, &dOutputWeights,
+		columnSums(dq), columnSums(dk), columnSums(dv), columnSums(dOut),
+	}
+}
+
+// Adds the position of each step to its values so attention, which has no notion of order, can tell the steps apart
+// "sinusoidal" adds the fixed encodings of Attention Is All You Need
+// PE[t][2i] = sin(t / 10000^(2i/dim)), PE[t][2i+1] = cos(t / 10000^(2i/dim))
+// "learned" adds a trainable vector for each step
+type PositionalEncoding struct {
+	sequenceLayer
+	// "sinusoidal" or "learned"
+	Encoding string
+
+	// steps x dim, the encoding of each step
+	Positions *mat.Dense `json:"-"`
+}
+
+// Sinusoidal positional encoding
+func NewPositionalEncoding() *PositionalEncoding {
+	return &PositionalEncoding{Encoding: "sinusoidal"}
+}
+
+func (l *PositionalEncoding) Build(input Shape, rng *rand.Rand) Shape {
+	l.build("PositionalEncoding", input)
+
+	switch l.Encoding {
+	case "sinusoidal":
+		l.Positions = mat.NewDense(l.steps, l.dim, nil)
+		for t := range l.steps {
+			for j := range l.dim {
+				angle := float64(t) / math.Pow(10000, float64(j-j%2)/float64(l.dim))
+				if j%2 == 0 {
+					l.Positions.Set(t, j, math.Sin(angle))
+				} else {
+					l.Positions.Set(t, j, math.Cos(angle))
+				}
+			}
+		}
+	case "learned":
+		l.Positions = normalWeights(l.steps, l.dim, 0, 0.02, rng)
+	default:
+		panic("PositionalEncoding.Encoding must be \"sinusoidal\" or \"learned\"")
+	}
+	return input
+}
+
+func (l *PositionalEncoding) Forward(X *mat.Dense, training bool) (*mat.Dense, any) {
+	n, cols := X.Dims()
+	tokens := l.tokens(X)
+	padding := l.paddingSteps(tokens)
+
+	out := mat.NewDense(n, cols, nil)
+	positions := l.Positions.RawMatrix().Data
+	for i := range n {
+		row, outRow := X.RawRowView(i), out.RawRowView(i)
+		for j := range row {
+			outRow[j] = row[j]
+			if padding == nil || !padding[i*l.steps+j/l.dim] {
+				outRow[j] += positions[j]
+			}
+		}
+	}
+	return out, padding
+}
+
+// the gradient goes straight through, the learned encodings get the sum of it over the samples
+func (l *PositionalEncoding) Backward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense) {
+	dX := mat.DenseCopyOf(grad)
+	if l.Encoding != "learned" {
+		return dX, nil
+	}
+
+	padding := cache.([]bool)
+	n, _ := grad.Dims()
+	dPositions := mat.NewDense(l.steps, l.dim, nil)
+	sums := dPositions.RawMatrix().Data
+	for i := range n {
+		for j, value := range grad.RawRowView(i) {
+			if padding == nil || !padding[i*l.steps+j/l.dim] {
+				sums[j] += value
+			}
+		}
+	}
+	return dX, []*mat.Dense{dPositions}
+}
+
+// the sinusoidal encodings are fixed so only learned ones are parameters
+func (l *PositionalEncoding) Params() []*mat.Dense {
+	if l.Encoding != "learned" {
+		return nil
+	}
+	return []*mat.Dense{l.Positions}
+}
@@ -0,0 +1,215 @@
+package neuralnetwork
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// a classifier of sequences of 4 steps of dim 4, when masked the second sample is padded after 2 steps, the fourth
+// after 3 and the last is all padding
+func attentionSetup(masked bool, layers ...Layer) (*MultiLayerPerceptron, *mat.Dense, *mat.Dense) {
+	r := rand.New(rand.NewSource(14))
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.InputShape = Shape{4, 4}
+	mlp.Layers = layers
+	mlp.Arch = []int{16, 3}
+	mlp.Activation = "tanh"
+	mlp.OutputActivation = "softmax"
+	mlp.LearningRate = 1
+	mlp.initWeights()
+
+	//random values for the parameters that start at zero or one so their gradients are tested properly
+	for _, layer := range layers {
+		for _, param := range layer.Params() {
+			rows, cols := param.Dims()
+			if rows == 1 {
+				param.Copy(randomDense(r, 1, cols))
+			}
+		}
+	}
+
+	X := randomDense(r, 5, 16)
+	if masked {
+		for _, pad := range []struct{ sample, from int }{{1, 8}, {3, 12}, {4, 0}} {
+			for j := pad.from; j < 16; j++ {
+				X.Set(pad.sample, j, 0)
+			}
+		}
+	}
+	y := mat.NewDense(5, 3, nil)
+	for i := range 5 {
+		y.Set(i, r.Intn(3), 1)
+	}
+	return mlp, X, y
+}
+
+// compares the gradient of the input from Backward with a central finite difference of Σ G ⊙ output
+// the values that are zero are skipped when masked, as moving them would turn padding into a real step
+func checkInputGradient(t *testing.T, layer Layer, X *mat.Dense, masked bool) {
+	t.Helper()
+	r := rand.New(rand.NewSource(15))
+	out, cache := layer.Forward(X, true)
+	rows, cols := out.Dims()
+	G := randomDense(r, rows, cols)
+	dX, _ := layer.Backward(G, cache)
+
+	loss := func() float64 {
+		out, _ := layer.Forward(X, true)
+		var product mat.Dense
+		product.MulElem(out, G)
+		return mat.Sum(&product)
+	}
+
+	const h = 1e-5
+	rows, cols = X.Dims()
+	for i := range rows {
+		for j := range cols {
+			original := X.At(i, j)
+			if masked && original == 0 {
+				continue
+			}
+			X.Set(i, j, original+h)
+			plus := loss()
+			X.Set(i, j, original-h)
+			minus := loss()
+			X.Set(i, j, original)
+
+			if numeric := (plus - minus) / (2 * h); math.Abs(numeric-dX.At(i, j)) > 1e-6*math.Max(1, math.Abs(numeric)) {
+				t.Errorf("input[%d][%d]: backprop gradient %v, numerical gradient %v", i, j, dX.At(i, j), numeric)
+			}
+		}
+	}
+}
+
+func checkLayerGradients(t *testing.T, masked bool, layers ...Layer) {
+	t.Helper()
+	for _, layer := range layers {
+		if s, ok := layer.(interface{ settings() *sequenceLayer }); ok {
+			s.settings().Mask = masked
+		}
+	}
+	mlp, X, y := attentionSetup(masked, layers...)
+	grads := mlp.backprop(X, y, nil)
+
+	params := mlp.layerParams()
+	if len(params) != len(grads.layers) {
+		t.Fatalf("%d layer gradients for %d parameters", len(grads.layers), len(params))
+	}
+	for i, param := range params {
+		checkGradient(t, fmt.Sprintf("layer param %d", i), mlp, X, y, param, grads.layers[i])
+	}
+	for _, layer := range layers {
+		checkInputGradient(t, layer, X, masked)
+	}
+}
+
+func (s *sequenceLayer) settings() *sequenceLayer {
+	return s
+}
+
+func TestAttentionGradients(t *testing.T) {
+	for _, masked := range []bool{false, true} {
+		t.Run(fmt.Sprintf("masked %v", masked), func(t *testing.T) {
+			learned := NewPositionalEncoding()
+			learned.Encoding = "learned"
+			checkLayerGradients(t, masked, learned, NewMultiHeadAttention(2))
+		})
+	}
+}
+
+func TestAttentionIgnoresPadding(t *testing.T) {
+	r := rand.New(rand.NewSource(16))
+	short := randomDense(r, 2, 3*4)
+	padded := mat.NewDense(2, 5*4, nil)
+	padded.Slice(0, 2, 0, 12).(*mat.Dense).Copy(short)
+
+	//the weights don't depend on the number of steps, so the same seed gives the same layer
+	rng, _ := newRNG(1)
+	shorter := NewMultiHeadAttention(2)
+	shorter.Build(Shape{3, 4}, rng)
+	want, _ := shorter.Forward(short, false)
+
+	rng, _ = newRNG(1)
+	layer := NewMultiHeadAttention(2)
+	layer.Mask = true
+	layer.Build(Shape{5, 4}, rng)
+	got, _ := layer.Forward(padded, false)
+
+	if real := got.Slice(0, 2, 0, 12); !mat.EqualApprox(real, want, 1e-12) {
+		t.Errorf("attention over the real steps\n%v\nwant\n%v", mat.Formatted(real), mat.Formatted(want))
+	}
+	if padding := got.Slice(0, 2, 12, 20); !mat.Equal(padding, mat.NewDense(2, 8, nil)) {
+		t.Errorf("padding steps should stay as MaskValue, got %v", mat.Formatted(padding))
+	}
+}
+
+func TestAttentionIsPermutationEquivariant(t *testing.T) {
+	//without positions, swapping two steps of the input swaps them in the output
+	r := rand.New(rand.NewSource(17))
+	X := randomDense(r, 1, 3*4)
+	swapped := mat.DenseCopyOf(X)
+	for j := range 4 {
+		swapped.Set(0, j, X.At(0, 8+j))
+		swapped.Set(0, 8+j, X.At(0, j))
+	}
+
+	rng, _ := newRNG(1)
+	layer := NewMultiHeadAttention(4)
+	layer.Build(Shape{3, 4}, rng)
+	out, _ := layer.Forward(X, false)
+	outSwapped, _ := layer.Forward(swapped, false)
+
+	for j := range 4 {
+		if math.Abs(out.At(0, j)-outSwapped.At(0, 8+j)) > 1e-12 || math.Abs(out.At(0, 4+j)-outSwapped.At(0, 4+j)) > 1e-12 {
+			t.Fatalf("output\n%v\nswapped\n%v", mat.Formatted(out), mat.Formatted(outSwapped))
+		}
+	}
+}
+
+func TestSinusoidalPositions(t *testing.T) {
+	l := NewPositionalEncoding()
+	l.Build(Shape{3, 4}, nil)
+
+	for _, c := range []struct {
+		step, j int
+		want    float64
+	}{
+		{0, 0, 0}, {0, 1, 1},
+		{1, 0, math.Sin(1)}, {1, 1, math.Cos(1)},
+		{2, 2, math.Sin(2 / 100.0)}, {2, 3, math.Cos(2 / 100.0)},
+	} {
+		if got := l.Positions.At(c.step, c.j); math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("PE[%d][%d] = %v want %v", c.step, c.j, got, c.want)
+		}
+	}
+	if l.Params() != nil {
+		t.Errorf("sinusoidal encodings should not be trained")
+	}
+
+	out, _ := l.Forward(mat.NewDense(1, 12, nil), false)
+	if !mat.Equal(reshape(out, 3, 4), l.Positions) {
+		t.Errorf("positions of zero inputs\n%v\nwant\n%v", mat.Formatted(out), mat.Formatted(l.Positions))
+	}
+}
+
+func TestAttentionBadConfig(t *testing.T) {
+	for name, build := range map[string]func(){
+		"heads":     func() { NewMultiHeadAttention(3).Build(Shape{2, 4}, nil) },
+		"flat":      func() { NewMultiHeadAttention(1).Build(Shape{4}, nil) },
+		"positions": func() { (&PositionalEncoding{Encoding: "rotary"}).Build(Shape{2, 4}, nil) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic")
+				}
+			}()
+			build()
+		})
+	}
+}
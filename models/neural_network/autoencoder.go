@@ -0,0 +1,312 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/training"
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Autoencoder learns to reconstruct its input through a smaller code, for dimensionality reduction and anomaly scoring
+// the encoder maps each sample to its code and the decoder maps the code back to the sample
+// the reconstruction loss is the Decoder's LossFunction, between X and the output of the decoder
+type Autoencoder struct {
+	jointTraining
+	// Encoder.Arch goes from the features to the size of the code
+	Encoder *MultiLayerPerceptron
+	// Decoder.Arch goes from the size of the code back to the features
+	Decoder *MultiLayerPerceptron
+}
+
+// Autoencoder with relu hidden layers and the mean squared error, the encoder goes from features through hidden to
+// code values and the decoder goes back through hidden in reverse
+func NewAutoencoder(features int, hidden []int, code int) *Autoencoder {
+	encoder, decoder := mirroredNetworks(features, hidden, code, code)
+	return &Autoencoder{jointTraining: newJointTraining(), Encoder: encoder, Decoder: decoder}
+}
+
+// an encoder from features to encoded values through hidden, and a decoder from decoded values back to the features
+func mirroredNetworks(features int, hidden []int, encoded, decoded int) (*MultiLayerPerceptron, *MultiLayerPerceptron) {
+	network := func(arch []int) *MultiLayerPerceptron {
+		mlp := NewMultiLayerPerceptron()
+		mlp.Arch = arch
+		mlp.OutputActivation = "identity"
+		mlp.LossFunction = "MSELoss"
+		mlp.Verbose = false
+		return mlp
+	}
+
+	encoderArch := append(append([]int{features}, hidden...), encoded)
+	decoderArch := []int{decoded}
+	for i := len(hidden) - 1; i >= 0; i-- {
+		decoderArch = append(decoderArch, hidden[i])
+	}
+	decoderArch = append(decoderArch, features)
+	return network(encoderArch), network(decoderArch)
+}
+
+// panics if the encoder doesn't output encoded values or the decoder can't reconstruct its input from decoded values
+func checkCoder(model string, encoder, decoder *MultiLayerPerceptron, encoded, decoded int) {
+	if got := encoder.Arch[len(encoder.Arch)-1]; got != encoded {
+		panic(fmt.Sprintf("%s.Encoder outputs %d values, expected %d", model, got, encoded))
+	}
+	if got := decoder.inputSize(); got != decoded {
+		panic(fmt.Sprintf("%s.Decoder takes %d values, expected %d", model, got, decoded))
+	}
+	if got := decoder.Arch[len(decoder.Arch)-1]; got != encoder.inputSize() {
+		panic(fmt.Sprintf("%s.Decoder outputs %d values but the encoder takes %d", model, got, encoder.inputSize()))
+	}
+}
+
+// Trains the encoder and decoder together to reconstruct XTrain, XTest can be nil
+// the history has the reconstruction loss of each epoch, and the validation loss when there is test data
+// an error from a callback stops training and is returned alongside the history so far
+func (a *Autoencoder) Fit(XTrain, XTest *mat.Dense) (*training.History, error) {
+	a.Encoder.initJoint()
+	a.Decoder.initJoint()
+	code := a.Encoder.Arch[len(a.Encoder.Arch)-1]
+	checkCoder("Autoencoder", a.Encoder, a.Decoder, code, code)
+
+	return a.fit(XTrain, a.Encoder.LearningRate, a.step, func() training.Logs {
+		return reconstructionLogs(a.loss, XTrain, XTest)
+	})
+}
+
+// the loss of the training data and of the test data when there is some
+func reconstructionLogs(loss func(X *mat.Dense) float64, XTrain, XTest *mat.Dense) training.Logs {
+	logs := training.Logs{"loss": loss(XTrain)}
+	if XTest != nil {
+		logs["val_loss"] = loss(XTest)
+	}
+	return logs
+}
+
+// one step of SGD on a batch
+func (a *Autoencoder) step(X *mat.Dense) float64 {
+	loss, encoderGrads, decoderGrads := a.gradients(X)
+	a.Encoder.applyGradients(encoderGrads)
+	a.Decoder.applyGradients(decoderGrads)
+	return loss
+}
+
+// loss of a batch and the gradients of both networks, the error of the code from the decoder is carried on back
+// through the encoder
+func (a *Autoencoder) gradients(X *mat.Dense) (float64, *gradients, *gradients) {
+	n, _ := X.Dims()
+	encoded := a.Encoder.trainingForward(X)
+	decoded := a.Decoder.trainingForward(encoded.output())
+
+	loss := a.Decoder.outputLoss(X, decoded.activations, decoded.zs)
+	delta := a.Decoder.outputDelta(X, decoded.activations, decoded.zs)
+	decoderGrads, dCode := a.Decoder.backpropDelta(decoded, delta, n, true)
+	encoderDelta := a.Encoder.activationDelta(dCode, encoded.activations, encoded.zs)
+	encoderGrads, _ := a.Encoder.backpropDelta(encoded, encoderDelta, n, false)
+	return loss, encoderGrads, decoderGrads
+}
+
+// mean reconstruction loss of X
+func (a *Autoencoder) loss(X *mat.Dense) float64 {
+	return a.Decoder.loss().Value(X, a.Reconstruct(X))
+}
+
+// Code of each sample
+func (a *Autoencoder) Encode(X *mat.Dense) *mat.Dense {
+	a.checkFitted()
+	return a.Encoder.output(X)
+}
+
+// Samples reconstructed from their codes
+func (a *Autoencoder) Decode(codes *mat.Dense) *mat.Dense {
+	a.checkFitted()
+	return a.Decoder.output(codes)
+}
+
+// Each sample encoded and decoded again
+func (a *Autoencoder) Reconstruct(X *mat.Dense) *mat.Dense {
+	return a.Decode(a.Encode(X))
+}
+
+// Reconstruction loss of each sample, samples unlike the training data reconstruct badly so this is an anomaly score
+func (a *Autoencoder) ReconstructionError(X *mat.Dense) []float64 {
+	return rowLosses(a.Decoder.loss(), X, a.Reconstruct(X))
+}
+
+// the loss of each row of h against the same row of y
+func rowLosses(loss Loss, y, h *mat.Dense) []float64 {
+	rows, cols := y.Dims()
+	losses := make([]float64, rows)
+	for i := range rows {
+		losses[i] = loss.Value(y.Slice(i, i+1, 0, cols).(*mat.Dense), h.Slice(i, i+1, 0, cols).(*mat.Dense))
+	}
+	return losses
+}
+
+// VariationalAutoencoder learns a distribution of codes for each sample rather than a single code, so new samples can
+// be generated by decoding codes drawn from N(0, I)
+// the encoder outputs the mean μ and log variance log σ² of the code, and the decoder reconstructs the sample from
+// z = μ + σ ⊙ ε with ε ~ N(0, I), the reparameterisation trick that lets the error flow back through the sampling
+// loss = reconstruction + Beta · KL(N(μ, σ²) || N(0, I)), KL = -1/2 Σ (1 + log σ² - μ² - σ²)
+type VariationalAutoencoder struct {
+	jointTraining
+	// Encoder.Arch goes from the features to 2·Latent values, μ followed by log σ²
+	Encoder *MultiLayerPerceptron
+	// Decoder.Arch goes from Latent values back to the features
+	Decoder *MultiLayerPerceptron
+	// size of the code
+	Latent int
+	// weight of the KL divergence, 1 for a VAE and more for a β-VAE with a more disentangled code
+	Beta float64
+}
+
+// VariationalAutoencoder with relu hidden layers and the mean squared error, the encoder goes from features through
+// hidden to the distribution of a code of latent values and the decoder goes back through hidden in reverse
+func NewVariationalAutoencoder(features int, hidden []int, latent int) *VariationalAutoencoder {
+	encoder, decoder := mirroredNetworks(features, hidden, 2*latent, latent)
+	return &VariationalAutoencoder{jointTraining: newJointTraining(), Encoder: encoder, Decoder: decoder, Latent: latent, Beta: 1}
+}
+
+// Trains the encoder and decoder together to reconstruct XTrain, XTest can be nil
+// the history has the loss of each epoch with the codes at their means, and its reconstruction and KL parts
+// an error from a callback stops training and is returned alongside the history so far
+func (v *VariationalAutoencoder) Fit(XTrain, XTest *mat.Dense) (*training.History, error) {
+	if v.Latent <= 0 {
+		panic("VariationalAutoencoder.Latent must be greater than zero")
+	}
+	v.Encoder.initJoint()
+	v.Decoder.initJoint()
+	checkCoder("VariationalAutoencoder", v.Encoder, v.Decoder, 2*v.Latent, v.Latent)
+
+	return v.fit(XTrain, v.Encoder.LearningRate, v.step, func() training.Logs {
+		logs := training.Logs{}
+		for prefix, X := range map[string]*mat.Dense{"": XTrain, "val_": XTest} {
+			if X == nil {
+				continue
+			}
+			reconstruction, kl := v.losses(X)
+			logs[prefix+"loss"] = reconstruction + v.Beta*kl
+			logs[prefix+"reconstruction"] = reconstruction
+			logs[prefix+"kl"] = kl
+		}
+		return logs
+	})
+}
+
+// μ and log σ² side by side
+func (v *VariationalAutoencoder) split(stats *mat.Dense) (*mat.Dense, *mat.Dense) {
+	n, _ := stats.Dims()
+	return stats.Slice(0, n, 0, v.Latent).(*mat.Dense), stats.Slice(0, n, v.Latent, 2*v.Latent).(*mat.Dense)
+}
+
+// one step of SGD on a batch with a code drawn for each sample
+func (v *VariationalAutoencoder) step(X *mat.Dense) float64 {
+	n, _ := X.Dims()
+	loss, encoderGrads, decoderGrads := v.gradients(X, v.noise(n))
+	v.Encoder.applyGradients(encoderGrads)
+	v.Decoder.applyGradients(decoderGrads)
+	return loss
+}
+
+// n codes drawn from N(0, I)
+func (v *VariationalAutoencoder) noise(n int) *mat.Dense {
+	rng := v.random()
+	noise := mat.NewDense(n, v.Latent, nil)
+	for i := range n {
+		for j := range v.Latent {
+			noise.Set(i, j, rng.NormFloat64())
+		}
+	}
+	return noise
+}
+
+// loss of a batch and the gradients of both networks, with the codes z = μ + σ ⊙ noise
+// the error of z goes to μ directly and to log σ² through σ = exp(log σ² / 2), and the KL divergence adds
+// ∂KL/∂μ = μ and ∂KL/∂log σ² = (σ² - 1) / 2
+func (v *VariationalAutoencoder) gradients(X, noise *mat.Dense) (float64, *gradients, *gradients) {
+	n, _ := X.Dims()
+	encoded := v.Encoder.trainingForward(X)
+	mu, logVar := v.split(encoded.output())
+	z := reparameterise(mu, logVar, noise)
+
+	decoded := v.Decoder.trainingForward(z)
+	loss := v.Decoder.outputLoss(X, decoded.activations, decoded.zs) + v.Beta*klDivergence(mu, logVar)
+	delta := v.Decoder.outputDelta(X, decoded.activations, decoded.zs)
+	decoderGrads, dz := v.Decoder.backpropDelta(decoded, delta, n, true)
+
+	dStats := mat.NewDense(n, 2*v.Latent, nil)
+	for i := range n {
+		for j := range v.Latent {
+			m, lv, d := mu.At(i, j), logVar.At(i, j), dz.At(i, j)
+			sigma := math.Exp(lv / 2)
+			dStats.Set(i, j, d+v.Beta*m)
+			dStats.Set(i, v.Latent+j, d*noise.At(i, j)*sigma/2+v.Beta*(sigma*sigma-1)/2)
+		}
+	}
+	encoderDelta := v.Encoder.activationDelta(dStats, encoded.activations, encoded.zs)
+	encoderGrads, _ := v.Encoder.backpropDelta(encoded, encoderDelta, n, false)
+	return loss, encoderGrads, decoderGrads
+}
+
+// z = μ + σ ⊙ noise
+func reparameterise(mu, logVar, noise *mat.Dense) *mat.Dense {
+	rows, cols := mu.Dims()
+	z := mat.NewDense(rows, cols, nil)
+	for i := range rows {
+		for j := range cols {
+			z.Set(i, j, mu.At(i, j)+math.Exp(logVar.At(i, j)/2)*noise.At(i, j))
+		}
+	}
+	return z
+}
+
+// mean KL divergence of N(μ, σ²) from N(0, I) over the samples
+func klDivergence(mu, logVar *mat.Dense) float64 {
+	rows, cols := mu.Dims()
+	kl := 0.0
+	for i := range rows {
+		for j := range cols {
+			m, lv := mu.At(i, j), logVar.At(i, j)
+			kl += -(1 + lv - m*m - math.Exp(lv)) / 2
+		}
+	}
+	return kl / float64(rows)
+}
+
+// the mean reconstruction loss with the codes at their means, and the mean KL divergence
+func (v *VariationalAutoencoder) losses(X *mat.Dense) (float64, float64) {
+	mu, logVar := v.EncodeDistribution(X)
+	return v.Decoder.loss().Value(X, v.Decode(mu)), klDivergence(mu, logVar)
+}
+
+// The mean of the code of each sample
+func (v *VariationalAutoencoder) Encode(X *mat.Dense) *mat.Dense {
+	mu, _ := v.EncodeDistribution(X)
+	return mu
+}
+
+// The mean μ and log variance log σ² of the code of each sample
+func (v *VariationalAutoencoder) EncodeDistribution(X *mat.Dense) (*mat.Dense, *mat.Dense) {
+	v.checkFitted()
+	return v.split(v.Encoder.output(X))
+}
+
+// Samples generated from codes
+func (v *VariationalAutoencoder) Decode(codes *mat.Dense) *mat.Dense {
+	v.checkFitted()
+	return v.Decoder.output(codes)
+}
+
+// n new samples decoded from codes drawn from N(0, I)
+func (v *VariationalAutoencoder) Sample(n int) *mat.Dense {
+	return v.Decode(v.noise(n))
+}
+
+// Each sample decoded from the mean of its code
+func (v *VariationalAutoencoder) Reconstruct(X *mat.Dense) *mat.Dense {
+	return v.Decode(v.Encode(X))
+}
+
+// Reconstruction loss of each sample from the mean of its code, an anomaly score like Autoencoder.ReconstructionError
+func (v *VariationalAutoencoder) ReconstructionError(X *mat.Dense) []float64 {
+	return rowLosses(v.Decoder.loss(), X, v.Reconstruct(X))
+}
@@ -0,0 +1,59 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/datasets/mnist"
+	"fmt"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Autoencoder compressing MNIST digits to 32 values, and a variational autoencoder that generates new digits
+// the pixels are scaled to [0, 1] so the decoders output them through a sigmoid with the binary cross entropy
+func AutoencoderExample() {
+
+	XTrain, _ := mnist.LoadMnistTrain()
+	XTest, _ := mnist.LoadMnistTest()
+
+	//normalise data
+	XTrain.Scale(1.0/255, XTrain)
+	XTest.Scale(1.0/255, XTest)
+
+	// 784 -> 256 -> 32 -> 256 -> 784
+	autoencoder := NewAutoencoder(784, []int{256}, 32)
+	autoencoder.Decoder.OutputActivation = "sigmoid"
+	autoencoder.Decoder.LossFunction = "binaryCrossEntropyLoss"
+	autoencoder.Epochs = 10
+	autoencoder.BatchSize = 64
+	if _, err := autoencoder.Fit(XTrain, XTest); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	//the test digits the autoencoder reconstructs worst are the most unusual ones
+	errors := autoencoder.ReconstructionError(XTest)
+	worst := make([]int, len(errors))
+	for i := range worst {
+		worst[i] = i
+	}
+	sort.Slice(worst, func(i, j int) bool { return errors[worst[i]] > errors[worst[j]] })
+	fmt.Printf("most unusual test digits: %v\n", worst[:10])
+
+	// 784 -> 256 -> 2x8 -> 8 -> 256 -> 784
+	vae := NewVariationalAutoencoder(784, []int{256}, 8)
+	vae.Decoder.OutputActivation = "sigmoid"
+	vae.Decoder.LossFunction = "binaryCrossEntropyLoss"
+	vae.Epochs = 10
+	vae.BatchSize = 64
+	vae.Encoder.LearningRate, vae.Decoder.LearningRate = 1e-3, 1e-3
+	if _, err := vae.Fit(XTrain, XTest); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	//new digits decoded from random codes
+	digits := vae.Sample(2)
+	digit := mat.NewDense(28, 28, digits.RawRowView(0))
+	fmt.Printf("generated digit:\n%.1f\n", mat.Formatted(digit))
+
+}
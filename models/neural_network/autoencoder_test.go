@@ -0,0 +1,272 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/training"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// samples near a plane through 6 dimensions, so an autoencoder with a code of 2 can reconstruct them
+func planeSamples(r *rand.Rand, n int) *mat.Dense {
+	basis := mat.NewDense(2, 6, []float64{
+		1, 0.5, -0.5, 0, 0.3, 1,
+		0, 1, 0.5, -1, 0.6, -0.2,
+	})
+	codes := randomDense(r, n, 2)
+	X := mat.NewDense(n, 6, nil)
+	X.Mul(codes, basis)
+	return X
+}
+
+// sets up the networks of a joint model for a gradient check, with a learning rate of 1 so the gradients are exact
+func gradientCheckNetworks(networks ...*MultiLayerPerceptron) {
+	for _, mlp := range networks {
+		mlp.Activation = "tanh"
+		mlp.LearningRate = 1
+		mlp.initJoint()
+	}
+}
+
+// compares the gradients of each network with central finite differences of loss
+func checkJointGradients(t *testing.T, loss func() float64, networks map[string]*MultiLayerPerceptron, grads map[string]*gradients) {
+	t.Helper()
+	const h = 1e-5
+	const tol = 1e-6
+
+	for name, mlp := range networks {
+		params := append(append([]*mat.Dense{}, mlp.Weights...), mlp.Bias...)
+		paramGrads := append(append([]*mat.Dense{}, grads[name].weights...), grads[name].bias...)
+		for k, param := range params {
+			rows, cols := param.Dims()
+			for i := range rows {
+				for j := range cols {
+					original := param.At(i, j)
+					param.Set(i, j, original+h)
+					lossPlus := loss()
+					param.Set(i, j, original-h)
+					lossMinus := loss()
+					param.Set(i, j, original)
+
+					numeric := (lossPlus - lossMinus) / (2 * h)
+					analytic := paramGrads[k].At(i, j)
+					if math.Abs(numeric-analytic) > tol*math.Max(1, math.Abs(numeric)) {
+						t.Errorf("%s param %d [%d][%d]: backprop gradient %v, numerical gradient %v", name, k, i, j, analytic, numeric)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestAutoencoderGradients(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	X := randomDense(r, 5, 4)
+
+	a := NewAutoencoder(4, []int{3}, 2)
+	gradientCheckNetworks(a.Encoder, a.Decoder)
+
+	loss, encoderGrads, decoderGrads := a.gradients(X)
+	reconstructionLoss := func() float64 {
+		activations, zs, _ := a.Decoder.forward(a.Encoder.output(X), true)
+		return a.Decoder.outputLoss(X, activations, zs)
+	}
+	if want := reconstructionLoss(); math.Abs(loss-want) > 1e-12 {
+		t.Errorf("loss %v, expected %v", loss, want)
+	}
+	checkJointGradients(t, reconstructionLoss,
+		map[string]*MultiLayerPerceptron{"encoder": a.Encoder, "decoder": a.Decoder},
+		map[string]*gradients{"encoder": encoderGrads, "decoder": decoderGrads})
+}
+
+func TestVariationalAutoencoderGradients(t *testing.T) {
+	for _, beta := range []float64{0, 1, 4} {
+		t.Run(fmt.Sprintf("beta %v", beta), func(t *testing.T) {
+			r := rand.New(rand.NewSource(2))
+			X := randomDense(r, 5, 4)
+
+			v := NewVariationalAutoencoder(4, []int{3}, 2)
+			v.Beta = beta
+			gradientCheckNetworks(v.Encoder, v.Decoder)
+			noise := v.noise(5)
+
+			loss, encoderGrads, decoderGrads := v.gradients(X, noise)
+			vaeLoss := func() float64 {
+				mu, logVar := v.split(v.Encoder.output(X))
+				activations, zs, _ := v.Decoder.forward(reparameterise(mu, logVar, noise), true)
+				return v.Decoder.outputLoss(X, activations, zs) + v.Beta*klDivergence(mu, logVar)
+			}
+			if want := vaeLoss(); math.Abs(loss-want) > 1e-12 {
+				t.Errorf("loss %v, expected %v", loss, want)
+			}
+			checkJointGradients(t, vaeLoss,
+				map[string]*MultiLayerPerceptron{"encoder": v.Encoder, "decoder": v.Decoder},
+				map[string]*gradients{"encoder": encoderGrads, "decoder": decoderGrads})
+		})
+	}
+}
+
+func TestKLDivergence(t *testing.T) {
+	//N(0, 1) is the prior so there's no divergence
+	if kl := klDivergence(mat.NewDense(2, 3, nil), mat.NewDense(2, 3, nil)); kl != 0 {
+		t.Errorf("KL of the prior %v, expected 0", kl)
+	}
+	//KL(N(1, e) || N(0, 1)) = (e + 1 - 1 - 1) / 2 per value
+	mu := mat.NewDense(1, 2, []float64{1, 1})
+	logVar := mat.NewDense(1, 2, []float64{1, 1})
+	if kl, want := klDivergence(mu, logVar), math.E-1; math.Abs(kl-want) > 1e-12 {
+		t.Errorf("KL %v, expected %v", kl, want)
+	}
+}
+
+func TestAutoencoderTrains(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	XTrain := planeSamples(r, 300)
+	XTest := planeSamples(r, 50)
+
+	a := NewAutoencoder(6, []int{8}, 2)
+	a.Epochs = 60
+	a.BatchSize = 16
+	a.Verbose = false
+	a.Seed = 1
+	a.Encoder.Seed, a.Decoder.Seed = 1, 2
+
+	history, err := a.Fit(XTrain, XTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loss := history.Metric("val_loss")
+	if first, last := loss[0], loss[len(loss)-1]; last > first/5 {
+		t.Errorf("validation loss went from %v to %v, expected the autoencoder to learn the plane", first, last)
+	}
+	if codes := a.Encode(XTest); !sameDims(codes, 50, 2) {
+		t.Errorf("codes of shape %v", dims(codes))
+	}
+	if reconstructed := a.Reconstruct(XTest); !sameDims(reconstructed, 50, 6) {
+		t.Errorf("reconstructions of shape %v", dims(reconstructed))
+	}
+
+	//samples off the plane reconstruct worse than any sample on it
+	outliers := randomDense(r, 10, 6)
+	outliers.Scale(2, outliers)
+	normal := a.ReconstructionError(XTest)
+	threshold := 0.0
+	for _, e := range normal {
+		threshold = math.Max(threshold, e)
+	}
+	detected := 0
+	for _, e := range a.ReconstructionError(outliers) {
+		if e > threshold {
+			detected++
+		}
+	}
+	if detected < 9 {
+		t.Errorf("%d of 10 outliers reconstructed worse than all the normal samples", detected)
+	}
+}
+
+func TestVariationalAutoencoderTrains(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	X := planeSamples(r, 300)
+
+	v := NewVariationalAutoencoder(6, []int{8}, 2)
+	v.Epochs = 60
+	v.BatchSize = 16
+	v.Verbose = false
+	v.Seed = 1
+	v.Encoder.Seed, v.Decoder.Seed = 1, 2
+	v.Encoder.LearningRate, v.Decoder.LearningRate = 5e-3, 5e-3
+
+	history, err := v.Fit(X, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loss := history.Metric("loss")
+	if first, last := loss[0], loss[len(loss)-1]; last >= first {
+		t.Errorf("loss went from %v to %v, expected it to fall", first, last)
+	}
+	if kl := history.Metric("kl"); kl[len(kl)-1] <= 0 {
+		t.Errorf("KL %v, the codes should be spread out to reconstruct the samples", kl[len(kl)-1])
+	}
+
+	mu, logVar := v.EncodeDistribution(X)
+	if !sameDims(mu, 300, 2) || !sameDims(logVar, 300, 2) {
+		t.Errorf("distributions of shape %v and %v", dims(mu), dims(logVar))
+	}
+	samples := v.Sample(7)
+	if !sameDims(samples, 7, 6) {
+		t.Errorf("samples of shape %v", dims(samples))
+	}
+	if errors := v.ReconstructionError(X); len(errors) != 300 {
+		t.Errorf("%d reconstruction errors for 300 samples", len(errors))
+	}
+}
+
+func TestFitCallbackError(t *testing.T) {
+	X := planeSamples(rand.New(rand.NewSource(3)), 20)
+
+	//early stopping on the validation loss without any test data can't find the metric
+	a := NewAutoencoder(6, []int{8}, 2)
+	a.Epochs = 5
+	a.Verbose = false
+	a.Callbacks = []training.Callback{training.NewEarlyStopping("val_loss", 1)}
+
+	history, err := a.Fit(X, nil)
+	if err == nil || errors.Is(err, training.ErrStopTraining) {
+		t.Fatalf("expected an error for the missing val_loss, got %v", err)
+	}
+	if history.Len() != 1 {
+		t.Errorf("history has %d epochs, want the 1 before the error", history.Len())
+	}
+}
+
+func TestAutoencoderBadConfig(t *testing.T) {
+	for name, fit := range map[string]func(){
+		"code": func() {
+			a := NewAutoencoder(4, nil, 2)
+			a.Decoder.Arch = []int{3, 4}
+			a.Fit(mat.NewDense(2, 4, nil), nil)
+		},
+		"output": func() {
+			a := NewAutoencoder(4, nil, 2)
+			a.Decoder.Arch = []int{2, 5}
+			a.Fit(mat.NewDense(2, 4, nil), nil)
+		},
+		"latent": func() {
+			v := NewVariationalAutoencoder(4, nil, 2)
+			v.Latent = 3
+			v.Fit(mat.NewDense(2, 4, nil), nil)
+		},
+		"not fitted": func() {
+			NewAutoencoder(4, nil, 2).Encode(mat.NewDense(1, 4, nil))
+		},
+		"not fitted sample": func() {
+			NewVariationalAutoencoder(4, nil, 2).Sample(1)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic")
+				}
+			}()
+			fit()
+		})
+	}
+}
+
+func sameDims(m *mat.Dense, rows, cols int) bool {
+	r, c := m.Dims()
+	return r == rows && c == cols
+}
+
+func dims(m *mat.Dense) [2]int {
+	r, c := m.Dims()
+	return [2]int{r, c}
+}
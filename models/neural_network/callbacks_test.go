@@ -0,0 +1,165 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/training"
+	"errors"
+	"math"
+	"testing"
+)
+
+// stops training after a fixed number of epochs and counts the calls it gets
+type stopAfter struct {
+	training.BaseCallback
+	epochs int
+
+	batches, epochEnds int
+	trainEnd           bool
+	lastLogs           training.Logs
+}
+
+func (s *stopAfter) OnBatchEnd(batch int, logs training.Logs) error {
+	s.batches++
+	return nil
+}
+
+func (s *stopAfter) OnEpochEnd(epoch int, logs training.Logs) error {
+	s.epochEnds++
+	s.lastLogs = logs
+	if epoch+1 == s.epochs {
+		return training.ErrStopTraining
+	}
+	return nil
+}
+
+func (s *stopAfter) OnTrainEnd(logs training.Logs) error {
+	s.trainEnd = true
+	return nil
+}
+
+func TestTrainCallbacks(t *testing.T) {
+	mlp, X, y := gradientCheckSetup("none")
+	mlp.Epochs = 20
+	mlp.BatchSize = 4
+	mlp.Verbose = false
+	mlp.LearningRate = 1e-2
+
+	cb := &stopAfter{epochs: 3}
+	mlp.Callbacks = []training.Callback{cb}
+
+	history, err := mlp.Train(X, y, X, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if history.Len() != 3 || history.StoppedEpoch != 2 || history.Iterations != 6 {
+		t.Errorf("history has %d epochs, stopped at %d after %d iterations, want 3, 2 and 6", history.Len(), history.StoppedEpoch, history.Iterations)
+	}
+	if cb.epochEnds != 3 || len(mlp.LossCurve) != 3 {
+		t.Errorf("trained for %d epochs with %d losses recorded, want 3", cb.epochEnds, len(mlp.LossCurve))
+	}
+	//8 samples in batches of 4
+	if cb.batches != 6 {
+		t.Errorf("%d batches want 6", cb.batches)
+	}
+	if !cb.trainEnd || !mlp.Fitted {
+		t.Errorf("training did not finish cleanly after being stopped")
+	}
+	for _, key := range []string{"loss", "accuracy", "val_loss", "val_accuracy"} {
+		if _, ok := cb.lastLogs[key]; !ok {
+			t.Errorf("epoch logs %v are missing %q", cb.lastLogs, key)
+		}
+	}
+}
+
+func TestTrainCallbackError(t *testing.T) {
+	mlp, X, y := gradientCheckSetup("none")
+	mlp.Epochs = 5
+	mlp.Verbose = false
+	//early stopping on the validation loss without any test data can't find the metric
+	mlp.Callbacks = []training.Callback{training.NewEarlyStopping("val_loss", 1)}
+
+	history, err := mlp.Train(X, y, nil, nil)
+	if err == nil || errors.Is(err, training.ErrStopTraining) {
+		t.Fatalf("expected an error for the missing val_loss, got %v", err)
+	}
+	if history.Len() != 1 {
+		t.Errorf("history has %d epochs, want the 1 before the error", history.Len())
+	}
+}
+
+func TestEarlyStoppingCallback(t *testing.T) {
+	mlp, X, y := gradientCheckSetup("none")
+	mlp.Epochs = 10
+	mlp.Verbose = false
+
+	es := training.NewEarlyStopping("loss", 1)
+	es.Restore = mlp
+	//a learning rate of zero never improves after the first epoch
+	mlp.LearningRate = 0
+	mlp.Callbacks = []training.Callback{es}
+
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if es.BestEpoch != 0 || es.StoppedEpoch != 1 {
+		t.Errorf("best epoch %d stopped at %d, want 0 and 1", es.BestEpoch, es.StoppedEpoch)
+	}
+	if len(mlp.LossCurve) != 2 {
+		t.Errorf("trained for %d epochs want 2", len(mlp.LossCurve))
+	}
+}
+
+func TestEpochMetrics(t *testing.T) {
+	//a silent network with nothing using the metrics doesn't evaluate the data after each epoch
+	mlp, X, y := gradientCheckSetup("none")
+	mlp.Epochs = 3
+	mlp.Verbose = false
+
+	history, err := mlp.Train(X, y, X, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if history.Len() != 3 || len(mlp.LossCurve) != 0 {
+		t.Errorf("history has %d epochs with %d losses recorded, want 3 and 0", history.Len(), len(mlp.LossCurve))
+	}
+	for _, e := range history.Epochs {
+		if len(e.Metrics) != 0 {
+			t.Errorf("epoch %d has metrics %v when nothing uses them", e.Epoch, e.Metrics)
+		}
+	}
+
+	//asked for
+	mlp, X, y = gradientCheckSetup("none")
+	mlp.Epochs = 3
+	mlp.Verbose = false
+	mlp.EpochMetrics = true
+
+	history, err = mlp.Train(X, y, X, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mlp.LossCurve) != 3 || len(history.Metric("val_loss")) != 3 || math.IsNaN(history.Metric("val_loss")[2]) {
+		t.Errorf("%d losses recorded with EpochMetrics, want 3 and a val_loss for every epoch", len(mlp.LossCurve))
+	}
+
+	//a callback gets the metrics
+	mlp, X, y = gradientCheckSetup("none")
+	mlp.Epochs = 3
+	mlp.Verbose = false
+	cb := &stopAfter{epochs: 3}
+	mlp.Callbacks = []training.Callback{cb}
+
+	if _, err := mlp.Train(X, y, X, y); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mlp.LossCurve) != 3 {
+		t.Errorf("%d losses recorded with a callback, want 3", len(mlp.LossCurve))
+	}
+	if _, ok := cb.lastLogs["val_loss"]; !ok {
+		t.Errorf("epoch logs %v are missing \"val_loss\"", cb.lastLogs)
+	}
+}
@@ -0,0 +1,264 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/serialization"
+	"Go-Machine-Learning/training"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+const checkpointKind = "MultiLayerPerceptronCheckpoint"
+
+// how far through training a run has got, this is what a checkpoint saves alongside the network
+type trainingProgress struct {
+	//number of completed epochs
+	epoch   int
+	stopper *earlyStopper
+	split   *validationSplit
+	history *training.History
+}
+
+type snapshotState struct {
+	Weights, Bias           []*serialization.Matrix
+	Gamma, Beta             []*serialization.Matrix
+	RunningMean, RunningVar []*serialization.Matrix
+	Layers                  []*serialization.Matrix
+}
+
+// everything needed to carry on training from the end of an epoch
+type checkpointState struct {
+	Model *mlpState
+
+	WeightVelocities []*serialization.Matrix
+	BiasVelocities   []*serialization.Matrix
+	GammaVelocities  []*serialization.Matrix
+	BetaVelocities   []*serialization.Matrix
+	LayerVelocities  []*serialization.Matrix
+
+	Epoch          int
+	RNGState       []byte
+	LoaderRNGState []byte
+
+	LossCurve           []float64
+	ValidationScores    []float64
+	BestValidationScore float64
+	BestEpoch           int
+	IterNoImprov        int
+	BestWeights         *snapshotState
+
+	TrainIndices      []int
+	ValidationIndices []int
+
+	History *training.History
+}
+
+// returns true if a checkpoint should be written after completing the given number of epochs
+func (mlp *MultiLayerPerceptron) checkpointDue(epochs int, lastCheckpoint time.Time) bool {
+	if mlp.CheckpointPath == "" {
+		return false
+	}
+	if mlp.CheckpointEvery > 0 && epochs%mlp.CheckpointEvery == 0 {
+		return true
+	}
+	return mlp.CheckpointInterval > 0 && time.Since(lastCheckpoint) >= mlp.CheckpointInterval
+}
+
+// Writes a checkpoint to mlp.CheckpointPath
+// it is written to a temporary file first so a crash while writing never leaves a broken checkpoint behind
+func (mlp *MultiLayerPerceptron) writeCheckpoint(train *DataLoader, progress *trainingProgress) error {
+	state, err := mlp.checkpoint(train, progress)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(mlp.CheckpointPath), filepath.Base(mlp.CheckpointPath)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("error creating checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := serialization.Write(tmp, checkpointKind, serialization.Binary, state); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), mlp.CheckpointPath); err != nil {
+		return fmt.Errorf("error writing checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (mlp *MultiLayerPerceptron) checkpoint(train *DataLoader, progress *trainingProgress) (*checkpointState, error) {
+	rngState, err := mlp.rngSource.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	model, err := mlp.state()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &checkpointState{
+		Model:               model,
+		WeightVelocities:    serialization.FromDenses(mlp.weightVelocities),
+		BiasVelocities:      serialization.FromDenses(mlp.biasVelocities),
+		GammaVelocities:     serialization.FromDenses(mlp.gammaVelocities),
+		BetaVelocities:      serialization.FromDenses(mlp.betaVelocities),
+		LayerVelocities:     serialization.FromDenses(mlp.layerVelocities),
+		Epoch:               progress.epoch,
+		RNGState:            rngState,
+		LossCurve:           mlp.LossCurve,
+		ValidationScores:    mlp.ValidationScores,
+		BestValidationScore: mlp.BestValidationScore,
+		BestEpoch:           mlp.BestEpoch,
+		IterNoImprov:        progress.stopper.iterNoImprov,
+		History:             progress.history,
+	}
+
+	//the loader only has a generator once it has shuffled an epoch
+	if train.rngSource != nil {
+		state.LoaderRNGState, err = train.rngSource.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if best := progress.stopper.best; best != nil {
+		state.BestWeights = &snapshotState{
+			Weights:     serialization.FromDenses(best.weights),
+			Bias:        serialization.FromDenses(best.bias),
+			Gamma:       serialization.FromDenses(best.gamma),
+			Beta:        serialization.FromDenses(best.beta),
+			RunningMean: serialization.FromDenses(best.runningMean),
+			RunningVar:  serialization.FromDenses(best.runningVar),
+			Layers:      serialization.FromDenses(best.layers),
+		}
+	}
+
+	if progress.split != nil {
+		state.TrainIndices = progress.split.train
+		state.ValidationIndices = progress.split.validation
+	}
+
+	return state, nil
+}
+
+// Continues training from a checkpoint written during Train, until mlp.Epochs have been completed in total
+// XTrain, yTrain, XTest and yTest must be the same data that was used when the checkpoint was written
+// The network, optimizer and history come from the checkpoint, other settings such as early stopping come from mlp
+// The returned history includes the epochs run before the checkpoint
+func (mlp *MultiLayerPerceptron) Resume(checkpoint io.Reader, XTrain, yTrain, XTest, yTest *mat.Dense) (*training.History, error) {
+	loader := NewDataLoader(NewDenseDataset(XTrain, yTrain), mlp.BatchSize)
+	loader.Prefetch = 0
+
+	var test Dataset
+	if XTest != nil || yTest != nil {
+		test = NewDenseDataset(XTest, yTest)
+	}
+
+	return mlp.ResumeLoader(checkpoint, loader, test)
+}
+
+// Continues training from a checkpoint written during TrainLoader, until mlp.Epochs have been completed
+// The loader and test data must be the same that were used when the checkpoint was written
+func (mlp *MultiLayerPerceptron) ResumeLoader(checkpoint io.Reader, train *DataLoader, test Dataset) (*training.History, error) {
+	var state checkpointState
+	if err := serialization.Read(checkpoint, checkpointKind, &state); err != nil {
+		return nil, err
+	}
+	if state.Model == nil {
+		return nil, fmt.Errorf("checkpoint does not contain a network")
+	}
+
+	progress, err := mlp.restoreCheckpoint(&state, train)
+	if err != nil {
+		return nil, err
+	}
+
+	if progress.split != nil && len(progress.split.train)+len(progress.split.validation) != train.Dataset.Len() {
+		return nil, fmt.Errorf("checkpoint was written for %d samples but the dataset has %d", len(progress.split.train)+len(progress.split.validation), train.Dataset.Len())
+	}
+
+	return mlp.run(context.Background(), train, test, progress)
+}
+
+func (mlp *MultiLayerPerceptron) restoreCheckpoint(state *checkpointState, train *DataLoader) (*trainingProgress, error) {
+	//the number of epochs comes from mlp so a run can be resumed for longer than first planned
+	epochs := mlp.Epochs
+	if err := mlp.setState(state.Model); err != nil {
+		return nil, err
+	}
+	mlp.Epochs = epochs
+
+	velocities := make([][]*mat.Dense, 5)
+	for i, v := range [][]*serialization.Matrix{state.WeightVelocities, state.BiasVelocities, state.GammaVelocities, state.BetaVelocities, state.LayerVelocities} {
+		dense, err := serialization.ToDenses(v)
+		if err != nil {
+			return nil, err
+		}
+		velocities[i] = dense
+	}
+	mlp.weightVelocities, mlp.biasVelocities = velocities[0], velocities[1]
+	mlp.gammaVelocities, mlp.betaVelocities = velocities[2], velocities[3]
+	mlp.layerVelocities = velocities[4]
+
+	mlp.rng, mlp.rngSource = newRNG(1)
+	if err := mlp.rngSource.UnmarshalBinary(state.RNGState); err != nil {
+		return nil, fmt.Errorf("error restoring random number generator: %w", err)
+	}
+	if state.LoaderRNGState != nil {
+		train.rng, train.rngSource = newRNG(1)
+		if err := train.rngSource.UnmarshalBinary(state.LoaderRNGState); err != nil {
+			return nil, fmt.Errorf("error restoring random number generator: %w", err)
+		}
+	}
+
+	mlp.LossCurve = state.LossCurve
+	mlp.ValidationScores = state.ValidationScores
+
+	progress := &trainingProgress{epoch: state.Epoch, stopper: mlp.newEarlyStopper(), history: state.History}
+	if progress.history == nil {
+		progress.history = training.NewHistory()
+	}
+	mlp.BestValidationScore = state.BestValidationScore
+	mlp.BestEpoch = state.BestEpoch
+	progress.stopper.iterNoImprov = state.IterNoImprov
+
+	if best := state.BestWeights; best != nil {
+		snapshot := &paramSnapshot{}
+		for _, field := range []struct {
+			dst *[]*mat.Dense
+			src []*serialization.Matrix
+		}{
+			{&snapshot.weights, best.Weights},
+			{&snapshot.bias, best.Bias},
+			{&snapshot.gamma, best.Gamma},
+			{&snapshot.beta, best.Beta},
+			{&snapshot.runningMean, best.RunningMean},
+			{&snapshot.runningVar, best.RunningVar},
+			{&snapshot.layers, best.Layers},
+		} {
+			dense, err := serialization.ToDenses(field.src)
+			if err != nil {
+				return nil, err
+			}
+			*field.dst = dense
+		}
+		progress.stopper.best = snapshot
+	}
+
+	if state.ValidationIndices != nil {
+		progress.split = &validationSplit{train: state.TrainIndices, validation: state.ValidationIndices}
+	}
+
+	return progress, nil
+}
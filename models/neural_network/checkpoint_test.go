@@ -0,0 +1,146 @@
+package neuralnetwork
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// classifier that records its metrics every epoch so runs can be compared
+func checkpointTestMLP(epochs int) *MultiLayerPerceptron {
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{4, 6, 3}
+	mlp.Epochs = epochs
+	mlp.BatchSize = 3
+	mlp.Verbose = false
+	mlp.Seed = 5
+	mlp.Normalization = "batch"
+	mlp.EarlyStopping = true
+	mlp.Patience = 100
+	mlp.RestoreBestWeights = true
+	mlp.ValidationFraction = 0.25
+	return mlp
+}
+
+func TestResumeMatchesUninterruptedTraining(t *testing.T) {
+	_, X, y := gradientCheckSetup("none")
+
+	full := checkpointTestMLP(6)
+	fullHistory, err := full.Train(X, y, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "mlp.ckpt")
+	interrupted := checkpointTestMLP(3)
+	interrupted.CheckpointEvery = 3
+	interrupted.CheckpointPath = path
+	if _, err := interrupted.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	resumed := checkpointTestMLP(6)
+	history, err := resumed.Resume(file, X, y, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range full.Weights {
+		if !mat.Equal(full.Weights[i], resumed.Weights[i]) || !mat.Equal(full.Bias[i], resumed.Bias[i]) {
+			t.Errorf("layer %d differs from training without interruption", i)
+		}
+	}
+	for i := range full.Gamma {
+		if !mat.Equal(full.Gamma[i], resumed.Gamma[i]) || !mat.Equal(full.RunningVar[i], resumed.RunningVar[i]) {
+			t.Errorf("normalization %d differs from training without interruption", i)
+		}
+	}
+	if !reflect.DeepEqual(full.LossCurve, resumed.LossCurve) || !reflect.DeepEqual(full.ValidationScores, resumed.ValidationScores) {
+		t.Errorf("history differs from training without interruption:\n%v\n%v", full.ValidationScores, resumed.ValidationScores)
+	}
+	if history.Len() != 6 || !reflect.DeepEqual(history.Metric("val_loss"), fullHistory.Metric("val_loss")) {
+		t.Errorf("resumed history has %d epochs, want the 6 from training without interruption", history.Len())
+	}
+	if !resumed.Fitted {
+		t.Errorf("resumed network is not fitted")
+	}
+}
+
+func TestCheckpointDue(t *testing.T) {
+	mlp := NewMultiLayerPerceptron()
+	mlp.CheckpointEvery = 2
+
+	if mlp.checkpointDue(2, time.Now()) {
+		t.Errorf("checkpoint due without a CheckpointPath")
+	}
+
+	mlp.CheckpointPath = "mlp.ckpt"
+	if mlp.checkpointDue(1, time.Now()) || !mlp.checkpointDue(4, time.Now()) {
+		t.Errorf("checkpoints should be every 2 epochs")
+	}
+
+	mlp.CheckpointEvery = 0
+	mlp.CheckpointInterval = time.Minute
+	if mlp.checkpointDue(3, time.Now()) || !mlp.checkpointDue(3, time.Now().Add(-2*time.Minute)) {
+		t.Errorf("checkpoints should be every minute")
+	}
+}
+
+func TestWarmStart(t *testing.T) {
+	_, X, y := gradientCheckSetup("none")
+
+	mlp := checkpointTestMLP(3)
+	mlp.EarlyStopping = false
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	trained := copyAll(mlp.Weights)
+
+	//with no epochs to run a warm start must leave the weights exactly as they were
+	mlp.WarmStart = true
+	mlp.Epochs = 0
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := range trained {
+		if !mat.Equal(trained[i], mlp.Weights[i]) {
+			t.Errorf("layer %d was reinitialised", i)
+		}
+	}
+
+	mlp.WarmStart = false
+	mlp.Seed = 6
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if mat.Equal(trained[0], mlp.Weights[0]) {
+		t.Errorf("weights were not reinitialised without a warm start")
+	}
+}
+
+func TestTrainCheckpointError(t *testing.T) {
+	_, X, y := gradientCheckSetup("none")
+
+	mlp := checkpointTestMLP(3)
+	mlp.CheckpointEvery = 1
+	mlp.CheckpointPath = filepath.Join(t.TempDir(), "missing", "mlp.ckpt")
+
+	//a checkpoint that can't be written is returned, not a panic
+	history, err := mlp.Train(X, y, nil, nil)
+	if err == nil {
+		t.Fatalf("expected an error writing the checkpoint")
+	}
+	if history == nil || history.Len() != 1 {
+		t.Errorf("expected the history of the epoch before the checkpoint, got %+v", history)
+	}
+}
@@ -0,0 +1,53 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/datasets/mnist"
+	"Go-Machine-Learning/preprocessing"
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// LeNet-5 style network for MNIST, two convolution and pooling stages before the dense layers
+// the convolutions see each image as 28x28 pixels rather than a flat vector of 784
+func CNNExample() {
+
+	XTrain, yTrain := mnist.LoadMnistTrain()
+	XTest, yTest := mnist.LoadMnistTest()
+
+	yTrain = preprocessing.OneHotEncodeDense(10, yTrain)
+	yTest = preprocessing.OneHotEncodeDense(10, yTest)
+
+	//normalise data
+	XTrain.Scale(1.0/255, XTrain)
+	XTest.Scale(1.0/255, XTest)
+
+	// 1x28x28 -> 6x28x28 -> 6x14x14 -> 16x10x10 -> 16x5x5 -> 400
+	conv1 := NewConv2D(6, 5)
+	conv1.Padding = 2
+	conv2 := NewConv2D(16, 5)
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.InputShape = Shape{1, 28, 28}
+	mlp.Layers = []Layer{conv1, NewMaxPool2D(2), conv2, NewMaxPool2D(2), NewFlatten()}
+	mlp.Arch = []int{400, 120, 84, 10}
+	mlp.Epochs = 10
+	mlp.BatchSize = 64
+	mlp.LearningRate = 0.01
+	mlp.Activation = "relu"
+	mlp.IsClassifier = true
+	mlp.Workers = 4
+
+	//Train the model
+	if _, err := mlp.Train(XTrain, yTrain, XTest, yTest); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	//Make a prediciton of one of the samples
+	_, xcols := XTest.Dims()
+	xPredict := XTest.Slice(1, 3, 0, xcols).(*mat.Dense)
+	prediction := mlp.Predict(xPredict)
+	fmt.Printf("prediction: %v\n", prediction)
+
+}
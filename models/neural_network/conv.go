@@ -0,0 +1,242 @@
+package neuralnetwork
+
+import (
+	"fmt"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// 2D convolution over images stored channels first, Shape{channels, height, width}
+// Each filter covers every channel of a KernelSize x KernelSize window and gives one channel of the output
+// the output height is (H + 2·Padding - Dilation·(KernelSize - 1) - 1) / Stride + 1, and the same for the width
+// The windows of the batch are unrolled into the rows of one matrix (im2col) so the convolution is a single matrix multiply
+type Conv2D struct {
+	Filters    int
+	KernelSize int
+	// step between windows
+	Stride int
+	// zeros added around each edge of the image
+	Padding int
+	// spacing between the values a window covers, 1 covers neighbouring pixels
+	Dilation int
+	// activation applied to the output, "relu", "tanh", "sigmoid" or "identity"
+	Activation string
+	// How the filters are initialised, if nil it is chosen from the activation with DefaultInitializer
+	WeightInit Initializer `json:"-"`
+
+	// one column for each filter, with a row for every value of its window, channel by channel
+	Weights *mat.Dense `json:"-"`
+	// one bias for each filter
+	Bias *mat.Dense `json:"-"`
+
+	window window
+}
+
+// Conv2D with a stride and dilation of 1, no padding and a relu activation
+func NewConv2D(filters, kernelSize int) *Conv2D {
+	return &Conv2D{
+		Filters:    filters,
+		KernelSize: kernelSize,
+		Stride:     1,
+		Dilation:   1,
+		Activation: "relu",
+	}
+}
+
+// what Conv2D.Backward needs from the forward pass
+type convCache struct {
+	//the unrolled windows of the batch and the output before the activation, one row per window
+	cols, z *mat.Dense
+}
+
+func (l *Conv2D) Build(input Shape, rng *rand.Rand) Shape {
+	if l.Filters <= 0 {
+		panic("Conv2D.Filters must be greater than zero")
+	}
+	if _, ok := Derivative[l.Activation]; !ok {
+		panic(fmt.Sprintf("Conv2D.Activation %q must be \"relu\", \"tanh\", \"sigmoid\" or \"identity\"", l.Activation))
+	}
+	l.window = newWindow("Conv2D", input, l.KernelSize, l.Stride, l.Padding, l.Dilation)
+
+	init := l.WeightInit
+	if init == nil {
+		init = DefaultInitializer(l.Activation)
+	}
+	l.Weights = init.Initialize(l.window.windowSize(), l.Filters, rng)
+	l.Bias = mat.NewDense(1, l.Filters, nil)
+
+	return Shape{l.Filters, l.window.outHeight, l.window.outWidth}
+}
+
+// Z = im2col(X) • W + b
+// A = g(Z)
+func (l *Conv2D) Forward(X *mat.Dense, training bool) (*mat.Dense, any) {
+	n, _ := X.Dims()
+	cols := l.window.im2col(X)
+
+	var z mat.Dense
+	z.Mul(cols, l.Weights)
+	addIntercepts(z, *l.Bias)
+
+	a := mat.DenseCopyOf(&z)
+	Activate[l.Activation](a)
+
+	return l.window.channelsFirst(a, n), &convCache{cols: cols, z: &z}
+}
+
+// δZ = δA ⊙ g'(Z)
+// ΔW = im2col(X)^T • δZ
+// Δb = Σ δZ
+// δX = col2im(δZ • W^T)
+func (l *Conv2D) Backward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense) {
+	c := cache.(*convCache)
+	n, _ := grad.Dims()
+
+	dz := l.window.channelsLast(grad, n, l.Filters)
+	var derivative mat.Dense
+	derivative.CloneFrom(c.z)
+	Derivative[l.Activation](&derivative)
+	dz.MulElem(dz, &derivative)
+
+	var dw mat.Dense
+	dw.Mul(c.cols.T(), dz)
+	db := columnSums(dz)
+
+	var dcols mat.Dense
+	dcols.Mul(dz, l.Weights.T())
+
+	return l.window.col2im(&dcols, n), []*mat.Dense{&dw, db}
+}
+
+func (l *Conv2D) Params() []*mat.Dense {
+	return []*mat.Dense{l.Weights, l.Bias}
+}
+
+// the positions a square window slides over an image, shared by convolutions and pooling
+type window struct {
+	channels, height, width         int
+	size, stride, padding, dilation int
+	outHeight, outWidth             int
+}
+
+func newWindow(layer string, input Shape, size, stride, padding, dilation int) window {
+	if len(input) != 3 {
+		panic(fmt.Sprintf("%s needs inputs of Shape{channels, height, width}, got %v", layer, input))
+	}
+	if size <= 0 || stride <= 0 || dilation <= 0 || padding < 0 {
+		panic(fmt.Sprintf("%s needs a kernel size, stride and dilation greater than zero and a padding of at least zero", layer))
+	}
+
+	w := window{
+		channels: input[0], height: input[1], width: input[2],
+		size: size, stride: stride, padding: padding, dilation: dilation,
+	}
+	span := dilation*(size-1) + 1
+	w.outHeight = (w.height+2*padding-span)/stride + 1
+	w.outWidth = (w.width+2*padding-span)/stride + 1
+	if w.height+2*padding < span || w.width+2*padding < span {
+		panic(fmt.Sprintf("%s window of %d pixels does not fit in an input of %dx%d", layer, span, w.height, w.width))
+	}
+	return w
+}
+
+// number of values in one window across every channel
+func (w window) windowSize() int {
+	return w.channels * w.size * w.size
+}
+
+// number of positions of the window in each image
+func (w window) positions() int {
+	return w.outHeight * w.outWidth
+}
+
+// calls f for every value of the window at (oh, ow) that is inside the image, values in the padding are skipped
+// with the index of the value within the window and within the channels first image
+func (w window) each(oh, ow int, f func(col, pixel int)) {
+	k := w.size
+	for c := range w.channels {
+		for ki := range k {
+			ih := oh*w.stride - w.padding + ki*w.dilation
+			if ih < 0 || ih >= w.height {
+				continue
+			}
+			for kj := range k {
+				iw := ow*w.stride - w.padding + kj*w.dilation
+				if iw < 0 || iw >= w.width {
+					continue
+				}
+				f((c*k+ki)*k+kj, (c*w.height+ih)*w.width+iw)
+			}
+		}
+	}
+}
+
+// Unrolls every window of every image into a row, the rows of an image are in row major order of the window positions
+// padding is left as zeros
+func (w window) im2col(X *mat.Dense) *mat.Dense {
+	n, _ := X.Dims()
+	cols := mat.NewDense(n*w.positions(), w.windowSize(), nil)
+	for s := range n {
+		image := X.RawRowView(s)
+		for oh := range w.outHeight {
+			for ow := range w.outWidth {
+				row := cols.RawRowView(s*w.positions() + oh*w.outWidth + ow)
+				w.each(oh, ow, func(col, pixel int) {
+					row[col] = image[pixel]
+				})
+			}
+		}
+	}
+	return cols
+}
+
+// The reverse of im2col, adds the value of every window back onto the pixel it came from
+// pixels covered by more than one window get the sum, which is what backprop needs
+func (w window) col2im(cols *mat.Dense, n int) *mat.Dense {
+	images := mat.NewDense(n, w.channels*w.height*w.width, nil)
+	for s := range n {
+		image := images.RawRowView(s)
+		for oh := range w.outHeight {
+			for ow := range w.outWidth {
+				row := cols.RawRowView(s*w.positions() + oh*w.outWidth + ow)
+				w.each(oh, ow, func(col, pixel int) {
+					image[pixel] += row[col]
+				})
+			}
+		}
+	}
+	return images
+}
+
+// Turns a matrix with a row per window and a column per channel into one row per image, channels first
+func (w window) channelsFirst(m *mat.Dense, n int) *mat.Dense {
+	_, channels := m.Dims()
+	positions := w.positions()
+	out := mat.NewDense(n, channels*positions, nil)
+	for s := range n {
+		row := out.RawRowView(s)
+		for p := range positions {
+			for c, value := range m.RawRowView(s*positions + p) {
+				row[c*positions+p] = value
+			}
+		}
+	}
+	return out
+}
+
+// The reverse of channelsFirst
+func (w window) channelsLast(m *mat.Dense, n, channels int) *mat.Dense {
+	positions := w.positions()
+	out := mat.NewDense(n*positions, channels, nil)
+	for s := range n {
+		row := m.RawRowView(s)
+		for p := range positions {
+			outRow := out.RawRowView(s*positions + p)
+			for c := range channels {
+				outRow[c] = row[c*positions+p]
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,293 @@
+package neuralnetwork
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func randomDense(r *rand.Rand, rows, cols int) *mat.Dense {
+	m := mat.NewDense(rows, cols, nil)
+	for i := range rows {
+		for j := range cols {
+			m.Set(i, j, r.NormFloat64())
+		}
+	}
+	return m
+}
+
+// convolution written directly from its definition, out[f][oh][ow] = b[f] + Σ w[c][ki][kj][f] x[c][oh·s - p + ki·d][ow·s - p + kj·d]
+func directConv(l *Conv2D, X *mat.Dense, input Shape) *mat.Dense {
+	n, _ := X.Dims()
+	channels, height, width := input[0], input[1], input[2]
+	k, s, p, d := l.KernelSize, l.Stride, l.Padding, l.Dilation
+	outHeight := (height+2*p-d*(k-1)-1)/s + 1
+	outWidth := (width+2*p-d*(k-1)-1)/s + 1
+
+	out := mat.NewDense(n, l.Filters*outHeight*outWidth, nil)
+	for sample := range n {
+		for f := range l.Filters {
+			for oh := range outHeight {
+				for ow := range outWidth {
+					sum := l.Bias.At(0, f)
+					for c := range channels {
+						for ki := range k {
+							for kj := range k {
+								ih, iw := oh*s-p+ki*d, ow*s-p+kj*d
+								if ih < 0 || ih >= height || iw < 0 || iw >= width {
+									continue
+								}
+								sum += l.Weights.At((c*k+ki)*k+kj, f) * X.At(sample, (c*height+ih)*width+iw)
+							}
+						}
+					}
+					out.Set(sample, (f*outHeight+oh)*outWidth+ow, sum)
+				}
+			}
+		}
+	}
+	return out
+}
+
+func TestConv2DMatchesDirectConvolution(t *testing.T) {
+	input := Shape{2, 5, 6}
+	for _, config := range []struct{ kernel, stride, padding, dilation int }{
+		{3, 1, 0, 1},
+		{3, 2, 1, 1},
+		{2, 1, 2, 2},
+		{1, 3, 0, 1},
+	} {
+		t.Run(fmt.Sprintf("%+v", config), func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			rng, _ := newRNG(1)
+
+			l := NewConv2D(3, config.kernel)
+			l.Stride, l.Padding, l.Dilation = config.stride, config.padding, config.dilation
+			l.Activation = "identity"
+			output := l.Build(input, rng)
+			l.Bias = randomDense(r, 1, 3)
+
+			X := randomDense(r, 2, input.Size())
+			got, _ := l.Forward(X, true)
+			want := directConv(l, X, input)
+
+			_, cols := got.Dims()
+			if cols != output.Size() {
+				t.Fatalf("output has %d values, Build said %v", cols, output)
+			}
+			if !mat.EqualApprox(got, want, 1e-12) {
+				t.Errorf("convolution\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(want))
+			}
+		})
+	}
+}
+
+func TestPooling(t *testing.T) {
+	//one 4x4 channel and its negative
+	X := mat.NewDense(1, 32, []float64{
+		1, 2, 5, 0,
+		3, 4, 1, 1,
+		0, 0, 2, 2,
+		-1, 7, 2, 6,
+
+		-1, -2, -5, 0,
+		-3, -4, -1, -1,
+		0, 0, -2, -2,
+		1, -7, -2, -6,
+	})
+	input := Shape{2, 4, 4}
+
+	maxPool := NewMaxPool2D(2)
+	if shape := maxPool.Build(input, nil); fmt.Sprint(shape) != "[2 2 2]" {
+		t.Fatalf("max pool output shape %v want [2 2 2]", shape)
+	}
+	got, cache := maxPool.Forward(X, false)
+	want := mat.NewDense(1, 8, []float64{4, 5, 7, 6, -1, 0, 1, -2})
+	if !mat.Equal(got, want) {
+		t.Errorf("max pool %v want %v", mat.Formatted(got), mat.Formatted(want))
+	}
+
+	//the gradient only goes to the largest value of each window
+	grad, _ := maxPool.Backward(mat.NewDense(1, 8, []float64{1, 2, 3, 4, 5, 6, 7, 8}), cache)
+	if grad.At(0, 5) != 1 || grad.At(0, 2) != 2 || grad.At(0, 13) != 3 || grad.At(0, 15) != 4 || grad.At(0, 0) != 0 {
+		t.Errorf("max pool gradient %v", grad.RawRowView(0))
+	}
+
+	avgPool := NewAvgPool2D(2)
+	avgPool.Stride = 2
+	avgPool.Build(input, nil)
+	got, _ = avgPool.Forward(X, false)
+	want = mat.NewDense(1, 8, []float64{2.5, 1.75, 1.5, 3, -2.5, -1.75, -1.5, -3})
+	if !mat.EqualApprox(got, want, 1e-12) {
+		t.Errorf("average pool %v want %v", mat.Formatted(got), mat.Formatted(want))
+	}
+
+	flatten := NewFlatten()
+	if shape := flatten.Build(input, nil); fmt.Sprint(shape) != "[32]" {
+		t.Errorf("flatten output shape %v want [32]", shape)
+	}
+}
+
+// a small convolutional classifier for 1x7x7 images, with random inputs and one hot targets
+func convSetup(layers ...Layer) (*MultiLayerPerceptron, *mat.Dense, *mat.Dense) {
+	r := rand.New(rand.NewSource(2))
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.InputShape = Shape{1, 7, 7}
+	mlp.Layers = layers
+	mlp.Arch = []int{0, 4, 3}
+	mlp.Activation = "tanh"
+	mlp.OutputActivation = "softmax"
+	mlp.LearningRate = 1
+
+	//work out the size of the input to the dense layers
+	rng, _ := newRNG(1)
+	shape := mlp.InputShape
+	for _, layer := range layers {
+		shape = layer.Build(shape, rng)
+	}
+	mlp.Arch[0] = shape.Size()
+	mlp.initWeights()
+
+	//give the biases values so their gradients are tested properly
+	for _, layer := range layers {
+		if conv, ok := layer.(*Conv2D); ok {
+			conv.Bias = randomDense(r, 1, conv.Filters)
+		}
+	}
+
+	X := randomDense(r, 5, 49)
+	y := mat.NewDense(5, 3, nil)
+	for i := range 5 {
+		y.Set(i, r.Intn(3), 1)
+	}
+	return mlp, X, y
+}
+
+func tanhConv(filters, kernel, stride, padding, dilation int) *Conv2D {
+	l := NewConv2D(filters, kernel)
+	l.Stride, l.Padding, l.Dilation = stride, padding, dilation
+	l.Activation = "tanh"
+	return l
+}
+
+func TestConvLayerGradients(t *testing.T) {
+	for name, layers := range map[string]func() []Layer{
+		"conv-maxpool-conv": func() []Layer {
+			return []Layer{tanhConv(2, 3, 1, 1, 1), NewMaxPool2D(2), tanhConv(3, 2, 1, 0, 1), NewFlatten()}
+		},
+		"strided-dilated-avgpool": func() []Layer {
+			return []Layer{tanhConv(2, 2, 2, 1, 2), NewAvgPool2D(2), NewFlatten()}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mlp, X, y := convSetup(layers()...)
+			grads := mlp.backprop(X, y, nil)
+
+			params := mlp.layerParams()
+			if len(params) != len(grads.layers) {
+				t.Fatalf("%d layer gradients for %d parameters", len(grads.layers), len(params))
+			}
+			for i, param := range params {
+				checkGradient(t, fmt.Sprintf("layer param %d", i), mlp, X, y, param, grads.layers[i])
+			}
+			for l := range mlp.Weights {
+				checkGradient(t, "weights", mlp, X, y, mlp.Weights[l], grads.weights[l])
+			}
+		})
+	}
+}
+
+func TestConvNetTrains(t *testing.T) {
+	//6x6 images of a single horizontal or vertical line, in a random row or column
+	r := rand.New(rand.NewSource(3))
+	X := mat.NewDense(60, 36, nil)
+	y := mat.NewDense(60, 2, nil)
+	for i := range 60 {
+		line, vertical := r.Intn(6), i%2 == 1
+		for j := range 6 {
+			if vertical {
+				X.Set(i, j*6+line, 1)
+			} else {
+				X.Set(i, line*6+j, 1)
+			}
+		}
+		if vertical {
+			y.Set(i, 1, 1)
+		} else {
+			y.Set(i, 0, 1)
+		}
+	}
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.InputShape = Shape{1, 6, 6}
+	mlp.Layers = []Layer{NewConv2D(4, 3), NewMaxPool2D(2), NewFlatten()}
+	mlp.Arch = []int{16, 8, 2}
+	mlp.Epochs = 40
+	mlp.BatchSize = 10
+	mlp.LearningRate = 0.05
+	mlp.Verbose = false
+	mlp.EpochMetrics = true
+	mlp.Seed = 1
+
+	history, err := mlp.Train(X, y, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accuracy := history.Metric("accuracy")
+	if last := accuracy[len(accuracy)-1]; last < 100 {
+		t.Errorf("accuracy %v%%, expected the convolutions to tell the lines apart", last)
+	}
+}
+
+func TestConv2DBadConfig(t *testing.T) {
+	for name, build := range map[string]func(){
+		"too big":   func() { NewConv2D(1, 5).Build(Shape{1, 4, 4}, nil) },
+		"not image": func() { NewMaxPool2D(2).Build(Shape{16}, nil) },
+		"softmax": func() {
+			l := NewConv2D(1, 3)
+			l.Activation = "softmax"
+			l.Build(Shape{1, 4, 4}, nil)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic")
+				}
+			}()
+			build()
+		})
+	}
+}
+
+func TestMaxPoolKeepsLargest(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	X := randomDense(r, 3, 2*6*6)
+	l := NewMaxPool2D(3)
+	l.Stride = 1
+	l.Build(Shape{2, 6, 6}, nil)
+
+	got, _ := l.Forward(X, false)
+	for s := range 3 {
+		for c := range 2 {
+			for oh := range 4 {
+				for ow := range 4 {
+					want := math.Inf(-1)
+					for i := range 3 {
+						for j := range 3 {
+							want = math.Max(want, X.At(s, (c*6+oh+i)*6+ow+j))
+						}
+					}
+					if value := got.At(s, (c*4+oh)*4+ow); value != want {
+						t.Fatalf("sample %d channel %d (%d, %d) = %v want %v", s, c, oh, ow, value, want)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package neuralnetwork
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Dataset is a source of training samples that can be read a batch at a time
+// Batch returns the features and targets of the samples at the given indices, in that order
+type Dataset interface {
+	Len() int
+	Batch(indices []int) (*mat.Dense, *mat.Dense, error)
+}
+
+// WeightedDataset is a Dataset where each sample has a weight that multiplies its loss and gradient
+// SampleWeights returns the weights of the samples at the given indices, or nil if every sample weighs 1
+type WeightedDataset interface {
+	Dataset
+	SampleWeights(indices []int) []float64
+}
+
+// Dataset of matrices that are already in memory
+type DenseDataset struct {
+	X, y *mat.Dense
+	// optional weight of each sample, nil weighs every sample equally
+	Weights []float64
+}
+
+func NewDenseDataset(X, y *mat.Dense) *DenseDataset {
+	xRows, _ := X.Dims()
+	yRows, _ := y.Dims()
+	if xRows != yRows {
+		panic(fmt.Sprintf("X has %d samples but y has %d", xRows, yRows))
+	}
+	return &DenseDataset{X: X, y: y}
+}
+
+func (ds *DenseDataset) Len() int {
+	rows, _ := ds.X.Dims()
+	return rows
+}
+
+// Dataset of matrices in memory with a weight for every sample
+func NewWeightedDenseDataset(X, y *mat.Dense, sampleWeight []float64) *DenseDataset {
+	ds := NewDenseDataset(X, y)
+	if sampleWeight != nil && len(sampleWeight) != ds.Len() {
+		panic(fmt.Sprintf("X has %d samples but there are %d sample weights", ds.Len(), len(sampleWeight)))
+	}
+	for _, w := range sampleWeight {
+		if w < 0 {
+			panic("sample weights cannot be negative")
+		}
+	}
+	ds.Weights = sampleWeight
+	return ds
+}
+
+func (ds *DenseDataset) Batch(indices []int) (*mat.Dense, *mat.Dense, error) {
+	return gatherRows(ds.X, indices), gatherRows(ds.y, indices), nil
+}
+
+func (ds *DenseDataset) SampleWeights(indices []int) []float64 {
+	if ds.Weights == nil {
+		return nil
+	}
+	weights := make([]float64, len(indices))
+	for i, idx := range indices {
+		weights[i] = ds.Weights[idx]
+	}
+	return weights
+}
+
+// copies the rows at indices into a new matrix
+func gatherRows(m *mat.Dense, indices []int) *mat.Dense {
+	_, cols := m.Dims()
+	batch := mat.NewDense(len(indices), cols, nil)
+	for i, idx := range indices {
+		batch.SetRow(i, m.RawRowView(idx))
+	}
+	return batch
+}
+
+// Dataset that reads samples from a CSV file on disk rather than keeping them in memory
+// Only the byte offset of each line is stored, the lines of a batch are read and parsed when needed
+type CSVDataset struct {
+	// the columns of each line that are targets, every other column is a feature
+	TargetCols []int
+	// optional preprocessing applied to every batch, e.g. scaling the features and one hot encoding the targets
+	Transform func(X, y *mat.Dense) (*mat.Dense, *mat.Dense)
+
+	file    *os.File
+	offsets []int64
+	//column of the line -> column of y
+	targets map[int]int
+}
+
+// Opens a CSV file and indexes the start of every line
+// if header is true the first line is skipped
+func NewCSVDataset(path string, targetCols []int, header bool) (*CSVDataset, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file %s: %w", path, err)
+	}
+
+	ds := &CSVDataset{TargetCols: targetCols, file: file, targets: make(map[int]int)}
+	for i, c := range targetCols {
+		ds.targets[c] = i
+	}
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	first := true
+	for {
+		line, err := reader.ReadString('\n')
+		if len(strings.TrimSpace(line)) > 0 && !(first && header) {
+			ds.offsets = append(ds.offsets, offset)
+		}
+		first = false
+		offset += int64(len(line))
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error reading file %s: %w", path, err)
+		}
+	}
+	// the end of the file marks where the last line finishes
+	ds.offsets = append(ds.offsets, offset)
+
+	return ds, nil
+}
+
+func (ds *CSVDataset) Len() int {
+	return len(ds.offsets) - 1
+}
+
+// Reads and parses the lines at indices, ReadAt is used so batches can be read from several goroutines
+func (ds *CSVDataset) Batch(indices []int) (*mat.Dense, *mat.Dense, error) {
+	var X, y *mat.Dense
+
+	for i, idx := range indices {
+		start, end := ds.offsets[idx], ds.offsets[idx+1]
+		buf := make([]byte, end-start)
+		if _, err := ds.file.ReadAt(buf, start); err != nil && err != io.EOF {
+			return nil, nil, fmt.Errorf("error reading sample %d: %w", idx, err)
+		}
+
+		fields := strings.Split(strings.TrimSpace(string(buf)), ",")
+		if X == nil {
+			X = mat.NewDense(len(indices), len(fields)-len(ds.TargetCols), nil)
+			y = mat.NewDense(len(indices), len(ds.TargetCols), nil)
+		}
+
+		_, nFeatures := X.Dims()
+		if len(fields) != nFeatures+len(ds.TargetCols) {
+			return nil, nil, fmt.Errorf("sample %d has %d columns, expected %d", idx, len(fields), nFeatures+len(ds.TargetCols))
+		}
+
+		feature := 0
+		for c, field := range fields {
+			value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error parsing float value %s of sample %d: %w", field, idx, err)
+			}
+			if target, ok := ds.targets[c]; ok {
+				y.Set(i, target, value)
+			} else {
+				X.Set(i, feature, value)
+				feature++
+			}
+		}
+	}
+
+	if ds.Transform != nil {
+		X, y = ds.Transform(X, y)
+	}
+
+	return X, y, nil
+}
+
+// Closes the underlying file
+func (ds *CSVDataset) Close() error {
+	return ds.file.Close()
+}
+
+// Dataset made of some of the samples of another dataset, used to hold out validation data
+type subsetDataset struct {
+	parent  Dataset
+	indices []int
+}
+
+func (ds *subsetDataset) Len() int {
+	return len(ds.indices)
+}
+
+func (ds *subsetDataset) Batch(indices []int) (*mat.Dense, *mat.Dense, error) {
+	return ds.parent.Batch(ds.parentIndices(indices))
+}
+
+func (ds *subsetDataset) SampleWeights(indices []int) []float64 {
+	return sampleWeights(ds.parent, ds.parentIndices(indices))
+}
+
+func (ds *subsetDataset) parentIndices(indices []int) []int {
+	parentIndices := make([]int, len(indices))
+	for i, idx := range indices {
+		parentIndices[i] = ds.indices[idx]
+	}
+	return parentIndices
+}
+
+// the weights of the samples at indices if ds is a WeightedDataset, otherwise nil
+func sampleWeights(ds Dataset, indices []int) []float64 {
+	if weighted, ok := ds.(WeightedDataset); ok {
+		return weighted.SampleWeights(indices)
+	}
+	return nil
+}
+
+// DataLoader splits a Dataset into batches for each epoch of training
+type DataLoader struct {
+	Dataset   Dataset
+	BatchSize int
+	// Shuffle the order of the samples at the start of every epoch
+	Shuffle bool
+	// Drop the last batch of an epoch if it has fewer than BatchSize samples
+	DropLast bool
+	// Seed for the shuffling, 0 uses the current time
+	Seed uint64
+	// Number of batches read ahead on a background goroutine, 0 reads every batch when it is needed
+	Prefetch int
+
+	rng       *rand.Rand
+	rngSource *rand.PCGSource
+}
+
+func NewDataLoader(ds Dataset, batchSize int) *DataLoader {
+	return &DataLoader{
+		Dataset:   ds,
+		BatchSize: batchSize,
+		Shuffle:   true,
+		Prefetch:  2,
+	}
+}
+
+// Number of batches in one epoch
+func (dl *DataLoader) NumBatches() int {
+	n := dl.Dataset.Len()
+	if dl.DropLast {
+		return n / dl.BatchSize
+	}
+	return (n + dl.BatchSize - 1) / dl.BatchSize
+}
+
+// the sample indices of every batch in an epoch, shuffled if needed
+func (dl *DataLoader) epochBatches() [][]int {
+	if dl.BatchSize <= 0 {
+		panic("DataLoader.BatchSize must be greater than zero")
+	}
+
+	n := dl.Dataset.Len()
+	var order []int
+	if dl.Shuffle {
+		if dl.rng == nil {
+			dl.rng, dl.rngSource = newRNG(dl.Seed)
+		}
+		order = dl.rng.Perm(n)
+	} else {
+		order = make([]int, n)
+		for i := range order {
+			order[i] = i
+		}
+	}
+
+	batches := make([][]int, 0, dl.NumBatches())
+	for start := 0; start < n; start += dl.BatchSize {
+		end := min(start+dl.BatchSize, n)
+		if dl.DropLast && end-start < dl.BatchSize {
+			break
+		}
+		batches = append(batches, order[start:end])
+	}
+	return batches
+}
+
+// Starts a new epoch and returns an iterator over its batches
+// The iterator must be closed if it is not read until the end
+//
+//	it := loader.Iter()
+//	defer it.Close()
+//	for it.Next() {
+//		X, y := it.Batch()
+//	}
+//	if err := it.Err(); err != nil {...}
+func (dl *DataLoader) Iter() *BatchIterator {
+	it := &BatchIterator{dataset: dl.Dataset, batches: dl.epochBatches()}
+
+	if dl.Prefetch > 0 {
+		it.prefetched = make(chan loadedBatch, dl.Prefetch)
+		it.done = make(chan struct{})
+		go it.prefetch()
+	}
+
+	return it
+}
+
+type loadedBatch struct {
+	X, y    *mat.Dense
+	weights []float64
+	err     error
+}
+
+// reads the samples at indices along with their weights
+func loadBatch(ds Dataset, indices []int) loadedBatch {
+	X, y, err := ds.Batch(indices)
+	return loadedBatch{X: X, y: y, weights: sampleWeights(ds, indices), err: err}
+}
+
+// BatchIterator reads the batches of one epoch in order, see DataLoader.Iter
+type BatchIterator struct {
+	dataset Dataset
+	batches [][]int
+	next    int
+
+	current loadedBatch
+	err     error
+
+	prefetched chan loadedBatch
+	done       chan struct{}
+	closed     bool
+}
+
+// reads the batches on a background goroutine until they run out or the iterator is closed
+func (it *BatchIterator) prefetch() {
+	defer close(it.prefetched)
+	for _, indices := range it.batches {
+		select {
+		case <-it.done:
+			return
+		default:
+		}
+
+		batch := loadBatch(it.dataset, indices)
+		select {
+		case it.prefetched <- batch:
+		case <-it.done:
+			return
+		}
+		if batch.err != nil {
+			return
+		}
+	}
+}
+
+// Moves to the next batch, returns false when the epoch is finished or reading a batch failed
+func (it *BatchIterator) Next() bool {
+	if it.err != nil || it.closed {
+		return false
+	}
+
+	if it.prefetched != nil {
+		batch, ok := <-it.prefetched
+		if !ok {
+			it.current = loadedBatch{}
+			return false
+		}
+		it.current = batch
+	} else {
+		if it.next >= len(it.batches) {
+			it.current = loadedBatch{}
+			return false
+		}
+		it.current = loadBatch(it.dataset, it.batches[it.next])
+		it.next++
+	}
+
+	if it.current.err != nil {
+		it.err = it.current.err
+		return false
+	}
+	return true
+}
+
+// Returns the features and targets of the current batch
+func (it *BatchIterator) Batch() (*mat.Dense, *mat.Dense) {
+	if it.current.X == nil {
+		panic("Batch called before Next or after the last batch")
+	}
+	return it.current.X, it.current.y
+}
+
+// Returns the weights of the samples of the current batch, nil if the dataset is not weighted
+func (it *BatchIterator) Weights() []float64 {
+	return it.current.weights
+}
+
+// Returns the first error from reading a batch
+func (it *BatchIterator) Err() error {
+	return it.err
+}
+
+// Stops the background goroutine, it is safe to call more than once
+func (it *BatchIterator) Close() {
+	if it.closed {
+		return
+	}
+	it.closed = true
+	if it.done != nil {
+		close(it.done)
+		//drain so the goroutine is not left blocked on a send
+		for range it.prefetched {
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package neuralnetwork
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// dataset of n samples where the feature of each sample is its index and the target is 10 times that
+func indexDataset(n int) *DenseDataset {
+	X := mat.NewDense(n, 1, nil)
+	y := mat.NewDense(n, 1, nil)
+	for i := range n {
+		X.Set(i, 0, float64(i))
+		y.Set(i, 0, float64(10*i))
+	}
+	return NewDenseDataset(X, y)
+}
+
+// reads a whole epoch and returns the feature values in the order they were seen, with the size of each batch
+func readEpoch(t *testing.T, dl *DataLoader) ([]int, []int) {
+	t.Helper()
+	var order, sizes []int
+
+	batches := dl.Iter()
+	defer batches.Close()
+	for batches.Next() {
+		X, y := batches.Batch()
+		rows, _ := X.Dims()
+		sizes = append(sizes, rows)
+		for i := range rows {
+			if y.At(i, 0) != 10*X.At(i, 0) {
+				t.Fatalf("sample %v is paired with target %v", X.At(i, 0), y.At(i, 0))
+			}
+			order = append(order, int(X.At(i, 0)))
+		}
+	}
+	if err := batches.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return order, sizes
+}
+
+func TestDataLoaderInOrder(t *testing.T) {
+	dl := NewDataLoader(indexDataset(10), 4)
+	dl.Shuffle = false
+
+	order, sizes := readEpoch(t, dl)
+	if !reflect.DeepEqual(order, allIndices(10)) {
+		t.Errorf("order %v, want the samples in order", order)
+	}
+	if !reflect.DeepEqual(sizes, []int{4, 4, 2}) {
+		t.Errorf("batch sizes %v want [4 4 2]", sizes)
+	}
+
+	dl.DropLast = true
+	_, sizes = readEpoch(t, dl)
+	if !reflect.DeepEqual(sizes, []int{4, 4}) || dl.NumBatches() != 2 {
+		t.Errorf("batch sizes %v want [4 4] with the last batch dropped", sizes)
+	}
+}
+
+func TestDataLoaderShuffle(t *testing.T) {
+	dl := NewDataLoader(indexDataset(50), 8)
+	dl.Seed = 42
+
+	first, _ := readEpoch(t, dl)
+	second, _ := readEpoch(t, dl)
+
+	if reflect.DeepEqual(first, second) {
+		t.Errorf("two epochs had the same order")
+	}
+	for _, order := range [][]int{first, second} {
+		sorted := append([]int(nil), order...)
+		sort.Ints(sorted)
+		if !reflect.DeepEqual(sorted, allIndices(50)) {
+			t.Errorf("an epoch did not contain every sample exactly once: %v", order)
+		}
+	}
+
+	//the same seed gives the same sequence of epochs, with or without prefetching
+	again := NewDataLoader(indexDataset(50), 8)
+	again.Seed = 42
+	again.Prefetch = 0
+	againFirst, _ := readEpoch(t, again)
+	againSecond, _ := readEpoch(t, again)
+	if !reflect.DeepEqual(first, againFirst) || !reflect.DeepEqual(second, againSecond) {
+		t.Errorf("the same seed gave a different order")
+	}
+}
+
+func TestBatchIteratorCloseEarly(t *testing.T) {
+	dl := NewDataLoader(indexDataset(100), 1)
+	dl.Prefetch = 1
+
+	batches := dl.Iter()
+	if !batches.Next() {
+		t.Fatalf("expected a batch")
+	}
+	batches.Close()
+	batches.Close()
+
+	if batches.Next() {
+		t.Errorf("Next returned true after Close")
+	}
+}
+
+func writeCSV(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCSVDataset(t *testing.T) {
+	path := writeCSV(t, "label,a,b\n1,0.5,2\n0,1.5,3\n\n1,2.5,4")
+
+	ds, err := NewCSVDataset(path, []int{0}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	if ds.Len() != 3 {
+		t.Fatalf("Len() = %d want 3", ds.Len())
+	}
+
+	X, y, err := ds.Batch([]int{2, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mat.Equal(X, mat.NewDense(2, 2, []float64{2.5, 4, 0.5, 2})) {
+		t.Errorf("X = %v", mat.Formatted(X))
+	}
+	if !mat.Equal(y, mat.NewDense(2, 1, []float64{1, 1})) {
+		t.Errorf("y = %v", mat.Formatted(y))
+	}
+
+	ds.Transform = func(X, y *mat.Dense) (*mat.Dense, *mat.Dense) {
+		X.Scale(2, X)
+		return X, y
+	}
+	X, _, _ = ds.Batch([]int{1})
+	if X.At(0, 0) != 3 {
+		t.Errorf("Transform was not applied, got %v", X.At(0, 0))
+	}
+}
+
+func TestCSVDatasetBadValue(t *testing.T) {
+	ds, err := NewCSVDataset(writeCSV(t, "1,2\n1,x\n"), []int{0}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	dl := NewDataLoader(ds, 1)
+	dl.Shuffle = false
+	batches := dl.Iter()
+	defer batches.Close()
+	for batches.Next() {
+	}
+	if batches.Err() == nil {
+		t.Errorf("expected an error for the value x")
+	}
+}
+
+func TestTrainLoaderFromCSV(t *testing.T) {
+	//y = 2a - b, streamed from disk
+	var contents strings.Builder
+	for i := range 60 {
+		a, b := float64(i%7)/7, float64(i%5)/5
+		fmt.Fprintf(&contents, "%v,%v,%v\n", a, b, 2*a-b)
+	}
+
+	ds, err := NewCSVDataset(writeCSV(t, contents.String()), []int{2}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{2, 8, 1}
+	mlp.IsClassifier = false
+	mlp.LossFunction = "MSELoss"
+	mlp.Epochs = 200
+	mlp.Verbose = false
+	mlp.Seed = 1
+
+	loader := NewDataLoader(ds, 10)
+	loader.Seed = 1
+	if _, err := mlp.TrainLoader(loader, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	logs, err := mlp.evaluate(ds, 16, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loss := logs["loss"]
+	if loss > 0.01 {
+		t.Errorf("loss after training %v, expected the network to fit the data", loss)
+	}
+}
@@ -0,0 +1,148 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/training"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// copy of every learnt parameter of the network so it can be restored later
+type paramSnapshot struct {
+	weights, bias           []*mat.Dense
+	gamma, beta             []*mat.Dense
+	runningMean, runningVar []*mat.Dense
+	layers                  []*mat.Dense
+}
+
+func copyAll(ms []*mat.Dense) []*mat.Dense {
+	if ms == nil {
+		return nil
+	}
+	copies := make([]*mat.Dense, len(ms))
+	for i := range ms {
+		copies[i] = mat.DenseCopyOf(ms[i])
+	}
+	return copies
+}
+
+func (mlp *MultiLayerPerceptron) snapshot() *paramSnapshot {
+	return &paramSnapshot{
+		weights:     copyAll(mlp.Weights),
+		bias:        copyAll(mlp.Bias),
+		gamma:       copyAll(mlp.Gamma),
+		beta:        copyAll(mlp.Beta),
+		runningMean: copyAll(mlp.RunningMean),
+		runningVar:  copyAll(mlp.RunningVar),
+		layers:      copyAll(mlp.layerParams()),
+	}
+}
+
+func (mlp *MultiLayerPerceptron) restore(s *paramSnapshot) {
+	mlp.Weights = copyAll(s.weights)
+	mlp.Bias = copyAll(s.bias)
+	mlp.Gamma = copyAll(s.gamma)
+	mlp.Beta = copyAll(s.beta)
+	mlp.RunningMean = copyAll(s.runningMean)
+	mlp.RunningVar = copyAll(s.runningVar)
+	//the layers own their parameters so the values are copied back into them
+	if s.layers != nil {
+		mlp.restoreLayerParams(s.layers)
+	}
+	mlp.buildSparse()
+}
+
+// SnapshotWeights and RestoreWeights let training.EarlyStopping put back the weights of the best epoch
+func (mlp *MultiLayerPerceptron) SnapshotWeights() any {
+	return mlp.snapshot()
+}
+
+func (mlp *MultiLayerPerceptron) RestoreWeights(snapshot any) {
+	mlp.restore(snapshot.(*paramSnapshot))
+}
+
+// keeps track of the best value of the monitored metric during training
+type earlyStopper struct {
+	iterNoImprov int
+	best         *paramSnapshot
+}
+
+func (mlp *MultiLayerPerceptron) newEarlyStopper() *earlyStopper {
+	if mlp.Monitor != "loss" && mlp.Monitor != "accuracy" {
+		panic("mlp.Monitor must be \"loss\" or \"accuracy\"")
+	}
+
+	mlp.BestEpoch = -1
+	mlp.BestValidationScore = math.Inf(1)
+	if mlp.Monitor == "accuracy" {
+		mlp.BestValidationScore = math.Inf(-1)
+	}
+
+	return &earlyStopper{}
+}
+
+// Records the score of an epoch and returns true when training should stop
+// loss improves when score < best - MinDelta, accuracy improves when score > best + MinDelta
+func (s *earlyStopper) update(mlp *MultiLayerPerceptron, epoch int, score float64) bool {
+	improved := score < mlp.BestValidationScore-mlp.MinDelta
+	if mlp.Monitor == "accuracy" {
+		improved = score > mlp.BestValidationScore+mlp.MinDelta
+	}
+
+	if improved {
+		mlp.BestValidationScore = score
+		mlp.BestEpoch = epoch
+		s.iterNoImprov = 0
+		if mlp.RestoreBestWeights {
+			s.best = mlp.snapshot()
+		}
+		return false
+	}
+
+	s.iterNoImprov++
+	return s.iterNoImprov >= mlp.Patience
+}
+
+// Records the monitored metric from the logs of an epoch and returns true when training should stop
+// without validation data the training metrics are used like GDLinearRegression
+func (s *earlyStopper) record(mlp *MultiLayerPerceptron, epoch int, logs training.Logs) bool {
+	score, ok := logs["val_"+mlp.Monitor]
+	if !ok {
+		score = logs[mlp.Monitor]
+	}
+	mlp.ValidationScores = append(mlp.ValidationScores, score)
+
+	return s.update(mlp, epoch, score)
+}
+
+// puts back the weights from the best epoch, if there was one
+func (s *earlyStopper) restoreBest(mlp *MultiLayerPerceptron) {
+	if s.best != nil {
+		mlp.restore(s.best)
+	}
+}
+
+// which samples of the training data are held out for validation
+type validationSplit struct {
+	train, validation []int
+}
+
+// Randomly holds out mlp.ValidationFraction of nSamples
+func (mlp *MultiLayerPerceptron) validationSplit(nSamples int) *validationSplit {
+	if mlp.ValidationFraction >= 1 {
+		panic("mlp.ValidationFraction must be less than 1")
+	}
+
+	nVal := int(math.Ceil(mlp.ValidationFraction * float64(nSamples)))
+	if nVal >= nSamples {
+		panic("mlp.ValidationFraction leaves no samples for training")
+	}
+
+	perm := mlp.rng.Perm(nSamples)
+	return &validationSplit{train: perm[nVal:], validation: perm[:nVal]}
+}
+
+// returns the training data followed by the validation data
+func (split *validationSplit) apply(ds Dataset) (Dataset, Dataset) {
+	return &subsetDataset{parent: ds, indices: split.train}, &subsetDataset{parent: ds, indices: split.validation}
+}
@@ -0,0 +1,136 @@
+package neuralnetwork
+
+import (
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestEarlyStopperPatience(t *testing.T) {
+	mlp := NewMultiLayerPerceptron()
+	mlp.Patience = 2
+	mlp.MinDelta = 0.1
+
+	stopper := mlp.newEarlyStopper()
+
+	//0.75 is not enough of an improvement on 0.8 because of MinDelta
+	scores := []float64{1.0, 0.8, 0.75, 0.85}
+	stops := []bool{false, false, false, true}
+
+	for epoch, score := range scores {
+		if got := stopper.update(mlp, epoch, score); got != stops[epoch] {
+			t.Errorf("epoch %d score %v: stop = %v want %v", epoch, score, got, stops[epoch])
+		}
+	}
+
+	if mlp.BestEpoch != 1 || mlp.BestValidationScore != 0.8 {
+		t.Errorf("best epoch %d score %v, want epoch 1 score 0.8", mlp.BestEpoch, mlp.BestValidationScore)
+	}
+}
+
+func TestEarlyStopperAccuracy(t *testing.T) {
+	mlp := NewMultiLayerPerceptron()
+	mlp.Monitor = "accuracy"
+	mlp.Patience = 1
+	mlp.MinDelta = 0
+
+	stopper := mlp.newEarlyStopper()
+	if stopper.update(mlp, 0, 50) || stopper.update(mlp, 1, 60) {
+		t.Fatalf("stopped while the accuracy was increasing")
+	}
+	if !stopper.update(mlp, 2, 55) {
+		t.Errorf("expected to stop once the accuracy decreased")
+	}
+}
+
+func TestRestoreBestWeights(t *testing.T) {
+	mlp, _, _ := gradientCheckSetup("batch")
+	mlp.RestoreBestWeights = true
+	mlp.Patience = 1
+
+	stopper := mlp.newEarlyStopper()
+	stopper.update(mlp, 0, 1.0)
+	best := mlp.snapshot()
+
+	//change the weights after the best epoch, the score gets worse so they should be thrown away
+	mlp.Weights[0].Scale(2, mlp.Weights[0])
+	mlp.Gamma[0].Scale(3, mlp.Gamma[0])
+	mlp.RunningVar[0].Scale(4, mlp.RunningVar[0])
+	stopper.update(mlp, 1, 2.0)
+
+	stopper.restoreBest(mlp)
+	if !mat.Equal(mlp.Weights[0], best.weights[0]) || !mat.Equal(mlp.Gamma[0], best.gamma[0]) || !mat.Equal(mlp.RunningVar[0], best.runningVar[0]) {
+		t.Errorf("the parameters from the best epoch were not restored")
+	}
+}
+
+func TestTrainEarlyStopping(t *testing.T) {
+	_, X, y := gradientCheckSetup("none")
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{4, 5, 3}
+	mlp.Epochs = 50
+	mlp.Verbose = false
+	mlp.Seed = 1
+	mlp.EarlyStopping = true
+	mlp.Patience = 3
+	mlp.ValidationFraction = 0.25
+	//a learning rate of zero never improves after the first epoch
+	mlp.LearningRate = 0
+
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mlp.ValidationScores) != mlp.Patience+1 {
+		t.Errorf("trained for %d epochs, expected to stop after %d", len(mlp.ValidationScores), mlp.Patience+1)
+	}
+	if mlp.BestEpoch != 0 {
+		t.Errorf("best epoch %d want 0", mlp.BestEpoch)
+	}
+}
+
+func TestValidationSplit(t *testing.T) {
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{1, 1}
+	mlp.Seed = 3
+	mlp.initWeights()
+	mlp.ValidationFraction = 0.3
+
+	X := mat.NewDense(10, 1, []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	y := mat.NewDense(10, 1, []float64{0, 10, 20, 30, 40, 50, 60, 70, 80, 90})
+
+	trainSet, valSet := mlp.validationSplit(10).apply(NewDenseDataset(X, y))
+
+	if trainSet.Len() != 7 {
+		t.Errorf("training samples %d want 7", trainSet.Len())
+	}
+	if valSet.Len() != 3 {
+		t.Errorf("validation samples %d want 3", valSet.Len())
+	}
+
+	//every sample ends up in exactly one of the splits and X and y still line up
+	seen := make(map[float64]bool)
+	for _, split := range []Dataset{trainSet, valSet} {
+		XSplit, ySplit, _ := split.Batch(allIndices(split.Len()))
+		rows, _ := XSplit.Dims()
+		for i := range rows {
+			x := XSplit.At(i, 0)
+			if ySplit.At(i, 0) != 10*x {
+				t.Errorf("sample %v is paired with target %v", x, ySplit.At(i, 0))
+			}
+			seen[x] = true
+		}
+	}
+	if len(seen) != 10 {
+		t.Errorf("%d distinct samples after the split, want 10", len(seen))
+	}
+}
+
+func allIndices(n int) []int {
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = i
+	}
+	return indices
+}
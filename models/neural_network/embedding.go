@@ -0,0 +1,187 @@
+package neuralnetwork
+
+import (
+	"fmt"
+	"math"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Embedding maps integer IDs to trainable vectors, a dense alternative to one hot encoding categorical features with many
+// values. Each ID column of a sample is replaced by the row of Weights for its ID, and only the rows of the IDs in a batch
+// are updated as it is a SparseLayer
+type Embedding struct {
+	// number of distinct IDs, which run from 0 to VocabSize-1
+	VocabSize int
+	// length of each vector
+	Dim int
+	// the columns of each sample that hold IDs, the rest are numeric features which are passed through after the vectors
+	// nil when every column is an ID, the output then has Shape{columns, Dim} so a sequence of tokens can go on to a
+	// recurrent layer, otherwise it is flat
+	Columns []int
+	// PaddingIndex is an ID whose vector is always zero and never trained, such as the padding of shorter sequences
+	// it is only used when HasPadding is set, so the zero value of an Embedding has no padding
+	HasPadding   bool
+	PaddingIndex int
+	// VocabSize x Dim vectors to start from instead of random ones, such as pretrained word vectors
+	Pretrained *mat.Dense `json:"-"`
+
+	// VocabSize x Dim, row i is the vector of ID i
+	Weights *mat.Dense `json:"-"`
+
+	inputs int
+	//whether each input column holds IDs
+	isID []bool
+}
+
+// Embedding of every input column with no padding ID, initialised from N(0, 1)
+func NewEmbedding(vocabSize, dim int) *Embedding {
+	return &Embedding{VocabSize: vocabSize, Dim: dim}
+}
+
+type embeddingCache struct {
+	//the ID of each ID column of each sample, row by row
+	ids []int
+}
+
+func (l *Embedding) Build(input Shape, rng *rand.Rand) Shape {
+	if l.VocabSize <= 0 || l.Dim <= 0 {
+		panic("Embedding.VocabSize and Embedding.Dim must be greater than zero")
+	}
+	if l.HasPadding && (l.PaddingIndex < 0 || l.PaddingIndex >= l.VocabSize) {
+		panic(fmt.Sprintf("Embedding.PaddingIndex %d must be an ID below VocabSize", l.PaddingIndex))
+	}
+	if !l.HasPadding && l.PaddingIndex != 0 {
+		panic("Embedding.PaddingIndex is only used when Embedding.HasPadding is set")
+	}
+
+	l.inputs = input.Size()
+	l.isID = make([]bool, l.inputs)
+	if l.Columns == nil {
+		for j := range l.isID {
+			l.isID[j] = true
+		}
+	}
+	for _, column := range l.Columns {
+		if column < 0 || column >= l.inputs || l.isID[column] {
+			panic(fmt.Sprintf("Embedding.Columns must be distinct columns of the %d inputs, got %v", l.inputs, l.Columns))
+		}
+		l.isID[column] = true
+	}
+
+	if l.Pretrained != nil {
+		rows, cols := l.Pretrained.Dims()
+		if rows != l.VocabSize || cols != l.Dim {
+			panic(fmt.Sprintf("Embedding.Pretrained is %dx%d, expected VocabSize x Dim %dx%d", rows, cols, l.VocabSize, l.Dim))
+		}
+		l.Weights = mat.DenseCopyOf(l.Pretrained)
+	} else {
+		l.Weights = normalWeights(l.VocabSize, l.Dim, 0, 1, rng)
+	}
+	if l.HasPadding {
+		l.Weights.SetRow(l.PaddingIndex, make([]float64, l.Dim))
+	}
+
+	if l.Columns == nil {
+		return Shape{l.inputs, l.Dim}
+	}
+	return Shape{len(l.Columns)*l.Dim + l.inputs - len(l.Columns)}
+}
+
+// whether id is the padding ID, whose vector stays zero
+func (l *Embedding) padding(id int) bool {
+	return l.HasPadding && id == l.PaddingIndex
+}
+
+// the ID columns in the order their vectors are output
+func (l *Embedding) idColumns() []int {
+	if l.Columns != nil {
+		return l.Columns
+	}
+	columns := make([]int, l.inputs)
+	for j := range columns {
+		columns[j] = j
+	}
+	return columns
+}
+
+// looks up the vector of every ID, the numeric columns follow the vectors in their original order
+func (l *Embedding) Forward(X *mat.Dense, training bool) (*mat.Dense, any) {
+	n, _ := X.Dims()
+	columns := l.idColumns()
+	output := mat.NewDense(n, len(columns)*l.Dim+l.inputs-len(columns), nil)
+	ids := make([]int, n*len(columns))
+
+	for i := range n {
+		row, out := X.RawRowView(i), output.RawRowView(i)
+		for k, column := range columns {
+			value := row[column]
+			id := int(value)
+			if value != math.Trunc(value) || id < 0 || id >= l.VocabSize {
+				panic(fmt.Sprintf("Embedding: column %d of sample %d is %v, IDs must be whole numbers from 0 to %d", column, i, value, l.VocabSize-1))
+			}
+			ids[i*len(columns)+k] = id
+			if !l.padding(id) {
+				copy(out[k*l.Dim:(k+1)*l.Dim], l.Weights.RawRowView(id))
+			}
+		}
+
+		next := len(columns) * l.Dim
+		for j, value := range row {
+			if !l.isID[j] {
+				out[next] = value
+				next++
+			}
+		}
+	}
+
+	return output, &embeddingCache{ids: ids}
+}
+
+// Backward with the gradient of Weights as a dense VocabSize x Dim matrix
+func (l *Embedding) Backward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense) {
+	dX, _, sparse := l.SparseBackward(grad, cache)
+	dW := mat.NewDense(l.VocabSize, l.Dim, nil)
+	sparse[0].addTo(dW)
+	return dX, []*mat.Dense{dW}
+}
+
+// The gradient of Weights is the gradient of each vector in the output, in the row of its ID
+// IDs are not differentiable so their columns get no gradient, the numeric columns get theirs back unchanged
+func (l *Embedding) SparseBackward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense, []*SparseGradient) {
+	ids := cache.(*embeddingCache).ids
+	n, _ := grad.Dims()
+	columns := l.idColumns()
+
+	var rows []int
+	var values []float64
+	dX := mat.NewDense(n, l.inputs, nil)
+	for i := range n {
+		gradRow, dXRow := grad.RawRowView(i), dX.RawRowView(i)
+		for k := range columns {
+			if id := ids[i*len(columns)+k]; !l.padding(id) {
+				rows = append(rows, id)
+				values = append(values, gradRow[k*l.Dim:(k+1)*l.Dim]...)
+			}
+		}
+
+		next := len(columns) * l.Dim
+		for j := range dXRow {
+			if !l.isID[j] {
+				dXRow[j] = gradRow[next]
+				next++
+			}
+		}
+	}
+
+	sparse := &SparseGradient{Rows: rows}
+	if len(rows) > 0 {
+		sparse.Values = mat.NewDense(len(rows), l.Dim, values)
+	}
+	return dX, []*mat.Dense{nil}, []*SparseGradient{sparse}
+}
+
+func (l *Embedding) Params() []*mat.Dense {
+	return []*mat.Dense{l.Weights}
+}
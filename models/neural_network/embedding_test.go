@@ -0,0 +1,275 @@
+package neuralnetwork
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// samples of two categorical columns with 6 IDs around a numeric column, ID 0 is padding
+func embeddingSetup() (*MultiLayerPerceptron, *Embedding, *mat.Dense, *mat.Dense) {
+	r := rand.New(rand.NewSource(11))
+
+	embedding := NewEmbedding(6, 2)
+	embedding.Columns = []int{0, 2}
+	embedding.HasPadding = true
+	embedding.PaddingIndex = 0
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.InputShape = Shape{3}
+	mlp.Layers = []Layer{embedding}
+	mlp.Arch = []int{5, 4, 3}
+	mlp.Activation = "tanh"
+	mlp.OutputActivation = "softmax"
+	mlp.LearningRate = 1
+	mlp.initWeights()
+
+	X := mat.NewDense(6, 3, []float64{
+		1, 0.5, 2,
+		3, -1, 0,
+		1, 2, 1,
+		0, 0.1, 4,
+		5, 1.5, 3,
+		2, -0.3, 2,
+	})
+	y := mat.NewDense(6, 3, nil)
+	for i := range 6 {
+		y.Set(i, r.Intn(3), 1)
+	}
+	return mlp, embedding, X, y
+}
+
+func TestEmbeddingForward(t *testing.T) {
+	_, embedding, X, _ := embeddingSetup()
+	got, _ := embedding.Forward(X.Slice(0, 2, 0, 3).(*mat.Dense), false)
+
+	w := embedding.Weights
+	want := mat.NewDense(2, 5, []float64{
+		w.At(1, 0), w.At(1, 1), w.At(2, 0), w.At(2, 1), 0.5,
+		w.At(3, 0), w.At(3, 1), 0, 0, -1,
+	})
+	if !mat.Equal(got, want) {
+		t.Errorf("embedding\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(want))
+	}
+
+	//every column is an ID when Columns is nil, giving a sequence of vectors
+	tokens := NewEmbedding(4, 3)
+	rng, _ := newRNG(1)
+	if shape := tokens.Build(Shape{5}, rng); fmt.Sprint(shape) != "[5 3]" {
+		t.Errorf("token embedding shape %v want [5 3]", shape)
+	}
+}
+
+func TestEmbeddingGradients(t *testing.T) {
+	mlp, embedding, X, y := embeddingSetup()
+	grads := mlp.backprop(X, y, nil)
+
+	if grads.layers[0] != nil || grads.sparse[0] == nil {
+		t.Fatalf("expected a sparse gradient for the embedding")
+	}
+	for _, row := range grads.sparse[0].Rows {
+		if row == embedding.PaddingIndex {
+			t.Errorf("the padding ID has a gradient")
+		}
+	}
+
+	dense := mat.NewDense(6, 2, nil)
+	grads.sparse[0].addTo(dense)
+	checkGradient(t, "embedding", mlp, X, y, embedding.Weights, dense)
+	for l := range mlp.Weights {
+		checkGradient(t, "weights", mlp, X, y, mlp.Weights[l], grads.weights[l])
+	}
+
+	//the dense Backward gives the same gradient
+	_, caches := mlp.layersForward(X, true)
+	grad := randomDense(rand.New(rand.NewSource(12)), 6, 5)
+	_, denseGrads := embedding.Backward(grad, caches[0])
+	_, _, sparseGrads := embedding.SparseBackward(grad, caches[0])
+	fromSparse := mat.NewDense(6, 2, nil)
+	sparseGrads[0].addTo(fromSparse)
+	if !mat.EqualApprox(denseGrads[0], fromSparse, 1e-12) {
+		t.Errorf("dense gradient\n%v\nsparse gradient\n%v", mat.Formatted(denseGrads[0]), mat.Formatted(fromSparse))
+	}
+}
+
+func TestEmbeddingSparseUpdate(t *testing.T) {
+	mlp, embedding, X, y := embeddingSetup()
+	before := mat.DenseCopyOf(embedding.Weights)
+
+	//two steps on batches without IDs 4 and 5, after a step that used them so they have velocities
+	mlp.updateParams(mlp.backprop(X, y, nil))
+	afterFirst := mat.DenseCopyOf(embedding.Weights)
+	batch := X.Slice(0, 3, 0, 3).(*mat.Dense)
+	batchY := y.Slice(0, 3, 0, 3).(*mat.Dense)
+	mlp.updateParams(mlp.backprop(batch, batchY, nil))
+	mlp.updateParams(mlp.backprop(batch, batchY, nil))
+
+	for id := range 6 {
+		row := embedding.Weights.RawRowView(id)
+		switch id {
+		case 0:
+			if !mat.Equal(mat.NewVecDense(2, row), before.RowView(0)) {
+				t.Errorf("the padding vector changed to %v", row)
+			}
+		case 4, 5:
+			if !mat.Equal(mat.NewVecDense(2, row), afterFirst.RowView(id)) {
+				t.Errorf("ID %d is not in the batch but its vector changed", id)
+			}
+		default:
+			if mat.Equal(mat.NewVecDense(2, row), afterFirst.RowView(id)) {
+				t.Errorf("ID %d is in the batch but its vector did not change", id)
+			}
+		}
+	}
+}
+
+func TestParallelBackpropWithEmbedding(t *testing.T) {
+	mlp, _, X, y := embeddingSetup()
+
+	serial := mlp.backprop(X, y, nil)
+	parallel := mlp.parallelBackprop(X, y, nil, 3)
+
+	serialDense, parallelDense := mat.NewDense(6, 2, nil), mat.NewDense(6, 2, nil)
+	serial.sparse[0].addTo(serialDense)
+	parallel.sparse[0].addTo(parallelDense)
+	equalWithin(t, "embedding", []*mat.Dense{serialDense}, []*mat.Dense{parallelDense}, 1e-12)
+	equalWithin(t, "weights", serial.weights, parallel.weights, 1e-12)
+}
+
+func TestEmbeddingPretrained(t *testing.T) {
+	pretrained := mat.NewDense(3, 2, []float64{1, 2, 3, 4, 5, 6})
+	embedding := NewEmbedding(3, 2)
+	embedding.Pretrained = pretrained
+	embedding.HasPadding = true
+	embedding.PaddingIndex = 2
+	rng, _ := newRNG(1)
+	embedding.Build(Shape{1}, rng)
+
+	want := mat.NewDense(3, 2, []float64{1, 2, 3, 4, 0, 0})
+	if !mat.Equal(embedding.Weights, want) {
+		t.Errorf("weights\n%v\nwant\n%v", mat.Formatted(embedding.Weights), mat.Formatted(want))
+	}
+	if pretrained.At(2, 0) != 5 {
+		t.Errorf("the pretrained matrix was changed")
+	}
+}
+
+func TestEmbeddingLiteralHasNoPadding(t *testing.T) {
+	embedding := &Embedding{VocabSize: 3, Dim: 2}
+	rng, _ := newRNG(1)
+	embedding.Build(Shape{1}, rng)
+
+	//ID 0 gets its own vector and a gradient like any other ID
+	output, cache := embedding.Forward(mat.NewDense(1, 1, []float64{0}), true)
+	if !mat.Equal(output, embedding.Weights.Slice(0, 1, 0, 2)) || mat.Norm(output, 2) == 0 {
+		t.Errorf("ID 0 looked up %v want %v", mat.Formatted(output), mat.Formatted(embedding.Weights.Slice(0, 1, 0, 2)))
+	}
+	_, _, sparse := embedding.SparseBackward(mat.NewDense(1, 2, []float64{1, 1}), cache)
+	if len(sparse[0].Rows) != 1 || sparse[0].Rows[0] != 0 {
+		t.Errorf("ID 0 has gradient rows %v want [0]", sparse[0].Rows)
+	}
+}
+
+func TestEmbeddingBadConfig(t *testing.T) {
+	for name, build := range map[string]func(){
+		"pretrained shape": func() {
+			l := NewEmbedding(3, 2)
+			l.Pretrained = mat.NewDense(2, 2, nil)
+			l.Build(Shape{1}, nil)
+		},
+		"padding index": func() {
+			l := NewEmbedding(3, 2)
+			l.HasPadding = true
+			l.PaddingIndex = 3
+			l.Build(Shape{1}, nil)
+		},
+		"padding index without padding": func() {
+			l := NewEmbedding(3, 2)
+			l.PaddingIndex = 1
+			l.Build(Shape{1}, nil)
+		},
+		"column": func() {
+			l := NewEmbedding(3, 2)
+			l.Columns = []int{1, 1}
+			l.Build(Shape{2}, nil)
+		},
+		"ID": func() {
+			l := NewEmbedding(3, 2)
+			rng, _ := newRNG(1)
+			l.Build(Shape{1}, rng)
+			l.Forward(mat.NewDense(1, 1, []float64{3}), false)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic")
+				}
+			}()
+			build()
+		})
+	}
+}
+
+func TestSaveLoadEmbedding(t *testing.T) {
+	mlp, _, X, _ := embeddingSetup()
+	mlp.Fitted = true
+	want := mlp.DecisionFunction(X)
+
+	var buf bytes.Buffer
+	if err := mlp.SaveJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMultiLayerPerceptron()
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	embedding := loaded.Layers[0].(*Embedding)
+	if !embedding.HasPadding || embedding.PaddingIndex != 0 || fmt.Sprint(embedding.Columns) != "[0 2]" {
+		t.Errorf("the configuration of the embedding was not saved: %+v", embedding)
+	}
+	if got := loaded.DecisionFunction(X); !mat.EqualApprox(got, want, 1e-12) {
+		t.Errorf("loaded network predicts\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(want))
+	}
+}
+
+func TestEmbeddingTrains(t *testing.T) {
+	//the class is whether the category is even, the numeric feature is noise
+	r := rand.New(rand.NewSource(13))
+	X := mat.NewDense(200, 2, nil)
+	y := mat.NewDense(200, 2, nil)
+	for i := range 200 {
+		category := r.Intn(50)
+		X.Set(i, 0, r.NormFloat64())
+		X.Set(i, 1, float64(category))
+		y.Set(i, category%2, 1)
+	}
+
+	embedding := NewEmbedding(50, 4)
+	embedding.Columns = []int{1}
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.InputShape = Shape{2}
+	mlp.Layers = []Layer{embedding}
+	mlp.Arch = []int{5, 8, 2}
+	mlp.Epochs = 40
+	mlp.BatchSize = 10
+	mlp.LearningRate = 0.1
+	mlp.Verbose = false
+	mlp.EpochMetrics = true
+	mlp.Seed = 1
+
+	history, err := mlp.Train(X, y, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accuracy := history.Metric("accuracy")
+	if last := accuracy[len(accuracy)-1]; last < 95 {
+		t.Errorf("accuracy %v%%, expected the embedding to learn the categories", last)
+	}
+}
@@ -0,0 +1,305 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/training"
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// step along the input gradient used to differentiate the gradient penalty with respect to the critic's parameters
+const gradientPenaltyStep = 1e-4
+
+// GAN trains a generator to turn random codes into samples like the training data, against a discriminator that
+// learns to tell the generated samples from the real ones
+// the two networks are updated in turn, each with its own LearningRate and Momentum
+//
+// Loss "nonSaturating" is the original GAN, the discriminator outputs the logit of a sample being real and the
+// generator maximises log D(G(z)) rather than minimising log(1 - D(G(z))), which saturates early in training
+// Loss "wasserstein" is WGAN-GP, the discriminator is a critic whose score estimates the Wasserstein distance
+// between the real and generated samples, kept 1-Lipschitz by a penalty on the norm of its input gradient
+// L = E[D(fake)] - E[D(real)] + λ E[(‖∇D(x̂)‖ - 1)²], with x̂ between a real and a generated sample
+type GAN struct {
+	jointTraining
+	// Generator.Arch goes from Latent values to the features of a sample
+	Generator *MultiLayerPerceptron
+	// Discriminator.Arch goes from the features of a sample to a single score, with an identity output
+	Discriminator *MultiLayerPerceptron
+	// size of the random codes
+	Latent int
+	// "nonSaturating" or "wasserstein"
+	Loss string
+	// discriminator updates for each generator update, each on its own batch of real samples
+	// WGAN-GP trains the critic more, typically 5
+	CriticSteps int
+	// λ, the weight of the gradient penalty of the wasserstein loss
+	GradientPenalty float64
+
+	batches int
+	//sums of the losses over the batches of the epoch
+	discriminatorLoss, generatorLoss       float64
+	discriminatorBatches, generatorBatches int
+}
+
+// GAN with a leaky ReLU discriminator going from features through hidden to a score, and a ReLU generator going
+// from latent values through hidden in reverse to the features, with the non saturating loss
+func NewGAN(latent, features int, hidden []int) *GAN {
+	discriminator, generator := mirroredNetworks(features, hidden, 1, latent)
+	discriminator.Activation = "leakyRelu"
+	return &GAN{
+		jointTraining:   newJointTraining(),
+		Generator:       generator,
+		Discriminator:   discriminator,
+		Latent:          latent,
+		Loss:            "nonSaturating",
+		CriticSteps:     1,
+		GradientPenalty: 10,
+	}
+}
+
+// Trains the generator to produce samples like the rows of X
+// the history has the mean losses of the discriminator and of the generator over the batches of each epoch
+// an error from a callback stops training and is returned alongside the history so far
+func (g *GAN) Fit(X *mat.Dense) (*training.History, error) {
+	g.checkConfig()
+	g.Generator.initJoint()
+	g.Discriminator.initJoint()
+	checkCoder("GAN", g.Discriminator, g.Generator, 1, g.Latent)
+	g.batches = 0
+
+	return g.fit(X, g.Discriminator.LearningRate, g.step, g.epochLogs)
+}
+
+func (g *GAN) checkConfig() {
+	if g.Latent <= 0 {
+		panic("GAN.Latent must be greater than zero")
+	}
+	if g.CriticSteps < 1 {
+		panic("GAN.CriticSteps must be at least 1")
+	}
+	switch g.Loss {
+	case "nonSaturating":
+	case "wasserstein":
+		if g.GradientPenalty < 0 {
+			panic("GAN.GradientPenalty can't be negative")
+		}
+		//batch normalization mixes the samples so the critic's gradient for one sample depends on the others
+		if g.Discriminator.Normalization == "batch" {
+			panic("GAN.Discriminator can't use batch normalization with the wasserstein loss, use layer normalization")
+		}
+	default:
+		panic(fmt.Sprintf("GAN.Loss %q is not nonSaturating or wasserstein", g.Loss))
+	}
+	if out := g.Discriminator.OutputActivation; out != "" && out != "identity" {
+		panic(fmt.Sprintf("GAN.Discriminator needs an identity output activation, not %q", out))
+	}
+}
+
+// updates the discriminator on a batch of real samples, and the generator after every CriticSteps batches
+func (g *GAN) step(X *mat.Dense) float64 {
+	n, _ := X.Dims()
+	fake := g.Generator.output(g.noise(n))
+	var interpolated *mat.Dense
+	if g.Loss == "wasserstein" && g.GradientPenalty > 0 {
+		interpolated = g.interpolate(X, fake)
+	}
+	loss, grads := g.discriminatorGradients(X, fake, interpolated)
+	g.Discriminator.applyGradients(grads)
+	g.discriminatorLoss += loss
+	g.discriminatorBatches++
+
+	g.batches++
+	if g.batches%g.CriticSteps == 0 {
+		generatorLoss, generatorGrads := g.generatorGradients(g.noise(n))
+		g.Generator.applyGradients(generatorGrads)
+		g.generatorLoss += generatorLoss
+		g.generatorBatches++
+	}
+	return loss
+}
+
+// mean losses since the last epoch
+func (g *GAN) epochLogs() training.Logs {
+	logs := training.Logs{}
+	if g.discriminatorBatches > 0 {
+		logs["discriminator_loss"] = g.discriminatorLoss / float64(g.discriminatorBatches)
+	}
+	if g.generatorBatches > 0 {
+		logs["generator_loss"] = g.generatorLoss / float64(g.generatorBatches)
+	}
+	g.discriminatorLoss, g.generatorLoss = 0, 0
+	g.discriminatorBatches, g.generatorBatches = 0, 0
+	return logs
+}
+
+// n codes drawn from N(0, I)
+func (g *GAN) noise(n int) *mat.Dense {
+	rng := g.random()
+	noise := mat.NewDense(n, g.Latent, nil)
+	for i := range n {
+		for j := range g.Latent {
+			noise.Set(i, j, rng.NormFloat64())
+		}
+	}
+	return noise
+}
+
+// loss of the discriminator on the real and fake samples and the gradients of its parameters
+// the gradient penalty is taken at the interpolated samples when there are some
+func (g *GAN) discriminatorGradients(real, fake, interpolated *mat.Dense) (float64, *gradients) {
+	n, _ := real.Dims()
+	realPass := g.Discriminator.trainingForward(real)
+	fakePass := g.Discriminator.trainingForward(fake)
+
+	var loss float64
+	var realDelta, fakeDelta *mat.Dense
+	if g.Loss == "wasserstein" {
+		// ∂L/∂D(real) = -1/n, ∂L/∂D(fake) = 1/n
+		loss = mat.Sum(fakePass.output())/float64(n) - mat.Sum(realPass.output())/float64(n)
+		realDelta, fakeDelta = filled(n, -1), filled(n, 1)
+	} else {
+		// real samples are labelled 1 and fake ones 0, δ = σ(D) - y
+		loss = BinaryCrossEntropyFromLogits(filled(n, 1), realPass.output()) +
+			BinaryCrossEntropyFromLogits(filled(n, 0), fakePass.output())
+		realDelta, fakeDelta = logitDelta(realPass.output(), 1), logitDelta(fakePass.output(), 0)
+	}
+
+	grads, _ := g.Discriminator.backpropDelta(realPass, g.Discriminator.activationDelta(realDelta, realPass.activations, realPass.zs), n, false)
+	fakeGrads, _ := g.Discriminator.backpropDelta(fakePass, g.Discriminator.activationDelta(fakeDelta, fakePass.activations, fakePass.zs), n, false)
+	grads.add(fakeGrads)
+
+	if interpolated != nil {
+		penalty, penaltyGrads := g.gradientPenalty(interpolated)
+		loss += penalty
+		grads.add(penaltyGrads)
+	}
+	return loss, grads
+}
+
+// each sample at a random point on the line between a real and a fake sample
+func (g *GAN) interpolate(real, fake *mat.Dense) *mat.Dense {
+	n, features := real.Dims()
+	rng := g.random()
+	interpolated := mat.NewDense(n, features, nil)
+	for i := range n {
+		e := rng.Float64()
+		for j := range features {
+			interpolated.Set(i, j, e*real.At(i, j)+(1-e)*fake.At(i, j))
+		}
+	}
+	return interpolated
+}
+
+// λ E[(‖∇D(x̂)‖ - 1)²] at the interpolated samples x̂, and its gradient
+// the gradient with respect to the parameters θ needs the derivative of the input gradient, which is the directional
+// derivative of ∇θ D along u = ∇D(x̂) / ‖∇D(x̂)‖, taken as a central difference
+// ∂/∂θ (‖∇D‖ - 1)² = 2 (‖∇D‖ - 1) (∇θ D(x̂ + h u) - ∇θ D(x̂ - h u)) / 2h
+// which is exact for a piecewise linear critic unless the step crosses a kink
+func (g *GAN) gradientPenalty(interpolated *mat.Dense) (float64, *gradients) {
+	n, features := interpolated.Dims()
+	inputGrads := g.Discriminator.inputGradients(interpolated)
+	plus, minus := mat.DenseCopyOf(interpolated), mat.DenseCopyOf(interpolated)
+	plusDelta, minusDelta := mat.NewDense(n, 1, nil), mat.NewDense(n, 1, nil)
+	penalty := 0.0
+	for i := range n {
+		norm := mat.Norm(inputGrads.RowView(i), 2)
+		penalty += (norm - 1) * (norm - 1)
+		if norm == 0 {
+			continue
+		}
+		for j := range features {
+			u := inputGrads.At(i, j) / norm
+			plus.Set(i, j, plus.At(i, j)+gradientPenaltyStep*u)
+			minus.Set(i, j, minus.At(i, j)-gradientPenaltyStep*u)
+		}
+		scale := g.GradientPenalty * (norm - 1) / gradientPenaltyStep
+		plusDelta.Set(i, 0, scale)
+		minusDelta.Set(i, 0, -scale)
+	}
+
+	plusPass := g.Discriminator.trainingForward(plus)
+	minusPass := g.Discriminator.trainingForward(minus)
+	grads, _ := g.Discriminator.backpropDelta(plusPass, g.Discriminator.activationDelta(plusDelta, plusPass.activations, plusPass.zs), n, false)
+	minusGrads, _ := g.Discriminator.backpropDelta(minusPass, g.Discriminator.activationDelta(minusDelta, minusPass.activations, minusPass.zs), n, false)
+	grads.add(minusGrads)
+	return g.GradientPenalty * penalty / float64(n), grads
+}
+
+// gradient of the score of each sample with respect to that sample
+func (mlp *MultiLayerPerceptron) inputGradients(X *mat.Dense) *mat.Dense {
+	n, _ := X.Dims()
+	pass := mlp.trainingForward(X)
+	_, dX := mlp.backpropDelta(pass, mlp.activationDelta(filled(n, 1), pass.activations, pass.zs), n, true)
+	return dX
+}
+
+// loss of the generator on samples generated from noise and the gradients of its parameters
+// the error of the samples comes from backprop through the discriminator, whose own gradients are dropped
+func (g *GAN) generatorGradients(noise *mat.Dense) (float64, *gradients) {
+	n, _ := noise.Dims()
+	generated := g.Generator.trainingForward(noise)
+	scored := g.Discriminator.trainingForward(generated.output())
+
+	var loss float64
+	var delta *mat.Dense
+	if g.Loss == "wasserstein" {
+		// L = -E[D(G(z))]
+		loss = -mat.Sum(scored.output()) / float64(n)
+		delta = filled(n, -1)
+	} else {
+		// L = -E[log σ(D(G(z)))], the generated samples are labelled as real
+		loss = BinaryCrossEntropyFromLogits(filled(n, 1), scored.output())
+		delta = logitDelta(scored.output(), 1)
+	}
+
+	_, dSamples := g.Discriminator.backpropDelta(scored, g.Discriminator.activationDelta(delta, scored.activations, scored.zs), n, true)
+	grads, _ := g.Generator.backpropDelta(generated, g.Generator.activationDelta(dSamples, generated.activations, generated.zs), n, false)
+	return loss, grads
+}
+
+// n x 1 matrix of value
+func filled(n int, value float64) *mat.Dense {
+	m := mat.NewDense(n, 1, nil)
+	for i := range n {
+		m.Set(i, 0, value)
+	}
+	return m
+}
+
+// δ = σ(logit) - label, the error of the binary cross entropy of each logit
+func logitDelta(logits *mat.Dense, label float64) *mat.Dense {
+	n, _ := logits.Dims()
+	delta := mat.NewDense(n, 1, nil)
+	for i := range n {
+		delta.Set(i, 0, sigmoid(logits.At(i, 0))-label)
+	}
+	return delta
+}
+
+// n new samples generated from codes drawn from N(0, I)
+func (g *GAN) Sample(n int) *mat.Dense {
+	g.checkFitted()
+	return g.Generator.output(g.noise(n))
+}
+
+// Samples generated from the given codes, rows of Latent values
+func (g *GAN) Generate(codes *mat.Dense) *mat.Dense {
+	g.checkFitted()
+	return g.Generator.output(codes)
+}
+
+// Score of each sample from the discriminator, the probability that it's real for the non saturating loss and the
+// critic's unbounded score for the wasserstein loss
+func (g *GAN) Discriminate(X *mat.Dense) []float64 {
+	g.checkFitted()
+	scores := g.Discriminator.output(X)
+	n, _ := scores.Dims()
+	values := make([]float64, n)
+	for i := range n {
+		values[i] = scores.At(i, 0)
+		if g.Loss != "wasserstein" {
+			values[i] = sigmoid(values[i])
+		}
+	}
+	return values
+}
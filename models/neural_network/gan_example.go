@@ -0,0 +1,36 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/datasets/mnist"
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// GAN generating MNIST digits, the generator outputs the pixels through a sigmoid as the images are scaled to [0, 1]
+// set gan.Loss = "wasserstein" and gan.CriticSteps = 5 to train it as a WGAN-GP instead
+func GANExample() {
+
+	XTrain, _ := mnist.LoadMnistTrain()
+
+	//normalise data
+	XTrain.Scale(1.0/255, XTrain)
+
+	// generator 64 -> 256 -> 512 -> 784, discriminator 784 -> 512 -> 256 -> 1
+	gan := NewGAN(64, 784, []int{512, 256})
+	gan.Generator.OutputActivation = "sigmoid"
+	gan.Generator.LearningRate, gan.Discriminator.LearningRate = 1e-3, 1e-3
+	gan.Generator.Momentum, gan.Discriminator.Momentum = 0.5, 0.5
+	gan.Epochs = 30
+	gan.BatchSize = 64
+	if _, err := gan.Fit(XTrain); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	//new digits generated from random codes
+	digits := gan.Sample(2)
+	digit := mat.NewDense(28, 28, digits.RawRowView(0))
+	fmt.Printf("generated digit:\n%.1f\n", mat.Formatted(digit))
+
+}
@@ -0,0 +1,203 @@
+package neuralnetwork
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+)
+
+func ganSetup(loss string) (*GAN, *mat.Dense, *mat.Dense) {
+	r := rand.New(rand.NewSource(5))
+	g := NewGAN(2, 3, []int{4})
+	g.Loss = loss
+	g.Seed = 1
+	gradientCheckNetworks(g.Generator, g.Discriminator)
+	return g, randomDense(r, 6, 3), randomDense(r, 6, 3)
+}
+
+// mean score of X from the discriminator, and the mean of a function of the score
+func meanScore(g *GAN, X *mat.Dense, f func(score float64) float64) float64 {
+	activations, _, _ := g.Discriminator.forward(X, true)
+	scores := activations[len(activations)-1]
+	n, _ := scores.Dims()
+	total := 0.0
+	for i := range n {
+		total += f(scores.At(i, 0))
+	}
+	return total / float64(n)
+}
+
+func identityScore(s float64) float64 { return s }
+
+// -log σ(s) and -log(1 - σ(s))
+func realLoss(s float64) float64 { return math.Log1p(math.Exp(-s)) }
+func fakeLoss(s float64) float64 { return math.Log1p(math.Exp(s)) }
+
+func TestLeakyRelu(t *testing.T) {
+	x := mat.NewDense(1, 3, []float64{-2, 0.5, 3})
+	Activate["leakyRelu"](x)
+	if want := mat.NewDense(1, 3, []float64{-0.4, 0.5, 3}); !mat.EqualApprox(x, want, 1e-12) {
+		t.Errorf("leakyRelu %v, expected %v", mat.Formatted(x), mat.Formatted(want))
+	}
+	dx := mat.NewDense(1, 3, []float64{-2, 0.5, 3})
+	Derivative["leakyRelu"](dx)
+	if want := mat.NewDense(1, 3, []float64{0.2, 1, 1}); !mat.Equal(dx, want) {
+		t.Errorf("leakyRelu derivative %v, expected %v", mat.Formatted(dx), mat.Formatted(want))
+	}
+}
+
+func TestGANDiscriminatorGradients(t *testing.T) {
+	for _, loss := range []string{"nonSaturating", "wasserstein"} {
+		t.Run(loss, func(t *testing.T) {
+			g, real, fake := ganSetup(loss)
+			var interpolated *mat.Dense
+			if loss == "wasserstein" {
+				interpolated = g.interpolate(real, fake)
+			}
+			got, grads := g.discriminatorGradients(real, fake, interpolated)
+
+			discriminatorLoss := func() float64 {
+				if loss == "nonSaturating" {
+					return meanScore(g, real, realLoss) + meanScore(g, fake, fakeLoss)
+				}
+				//the penalty from the exact input gradients
+				penalty := 0.0
+				inputGrads := g.Discriminator.inputGradients(interpolated)
+				n, _ := inputGrads.Dims()
+				for i := range n {
+					norm := mat.Norm(inputGrads.RowView(i), 2)
+					penalty += (norm - 1) * (norm - 1)
+				}
+				return meanScore(g, fake, identityScore) - meanScore(g, real, identityScore) + g.GradientPenalty*penalty/float64(n)
+			}
+			if want := discriminatorLoss(); math.Abs(got-want) > 1e-12 {
+				t.Errorf("loss %v, expected %v", got, want)
+			}
+			checkJointGradients(t, discriminatorLoss,
+				map[string]*MultiLayerPerceptron{"discriminator": g.Discriminator},
+				map[string]*gradients{"discriminator": grads})
+		})
+	}
+}
+
+func TestGANGeneratorGradients(t *testing.T) {
+	for _, loss := range []string{"nonSaturating", "wasserstein"} {
+		t.Run(loss, func(t *testing.T) {
+			g, _, _ := ganSetup(loss)
+			noise := g.noise(6)
+			got, grads := g.generatorGradients(noise)
+
+			generatorLoss := func() float64 {
+				activations, _, _ := g.Generator.forward(noise, true)
+				generated := activations[len(activations)-1]
+				if loss == "nonSaturating" {
+					return meanScore(g, generated, realLoss)
+				}
+				return -meanScore(g, generated, identityScore)
+			}
+			if want := generatorLoss(); math.Abs(got-want) > 1e-12 {
+				t.Errorf("loss %v, expected %v", got, want)
+			}
+			checkJointGradients(t, generatorLoss,
+				map[string]*MultiLayerPerceptron{"generator": g.Generator},
+				map[string]*gradients{"generator": grads})
+		})
+	}
+}
+
+func TestGANLearnsDistribution(t *testing.T) {
+	for _, loss := range []string{"nonSaturating", "wasserstein"} {
+		t.Run(loss, func(t *testing.T) {
+			//samples from N((2, -1), 0.5²)
+			r := rand.New(rand.NewSource(6))
+			X := mat.NewDense(500, 2, nil)
+			for i := range 500 {
+				X.Set(i, 0, 2+0.5*r.NormFloat64())
+				X.Set(i, 1, -1+0.5*r.NormFloat64())
+			}
+
+			g := NewGAN(2, 2, []int{16})
+			g.Loss = loss
+			g.Epochs = 200
+			g.BatchSize = 25
+			g.Verbose = false
+			g.Seed = 1
+			g.Generator.Seed, g.Discriminator.Seed = 1, 11
+			g.Generator.LearningRate, g.Discriminator.LearningRate = 5e-4, 5e-4
+			if loss == "wasserstein" {
+				//a bigger critic trained more and faster than the generator
+				g.Discriminator.Arch = []int{2, 32, 32, 1}
+				g.Generator.Arch = []int{2, 32, 32, 2}
+				g.Discriminator.LearningRate = 1e-3
+				g.Generator.Momentum, g.Discriminator.Momentum = 0.5, 0.5
+				g.CriticSteps = 5
+			}
+
+			history, err := g.Fit(X)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if history.Len() != g.Epochs {
+				t.Fatalf("%d epochs in the history", history.Len())
+			}
+			for _, metric := range []string{"discriminator_loss", "generator_loss"} {
+				if values := history.Metric(metric); len(values) != g.Epochs {
+					t.Errorf("%d values of %s", len(values), metric)
+				}
+			}
+
+			samples := g.Sample(1000)
+			for j, want := range []float64{2, -1} {
+				column := mat.Col(nil, j, samples)
+				mean, std := stat.MeanStdDev(column, nil)
+				if math.Abs(mean-want) > 0.5 || std > 1.5 {
+					t.Errorf("feature %d of the samples has mean %v and std %v, expected %v and 0.5", j, mean, std, want)
+				}
+			}
+			if scores := g.Discriminate(X); len(scores) != 500 {
+				t.Errorf("%d scores for 500 samples", len(scores))
+			}
+		})
+	}
+}
+
+func TestGANBadConfig(t *testing.T) {
+	X := mat.NewDense(4, 3, nil)
+	for name, fit := range map[string]func(g *GAN){
+		"loss":            func(g *GAN) { g.Loss = "minimax" },
+		"latent":          func(g *GAN) { g.Latent = 0 },
+		"critic steps":    func(g *GAN) { g.CriticSteps = 0 },
+		"penalty":         func(g *GAN) { g.Loss, g.GradientPenalty = "wasserstein", -1 },
+		"batch norm":      func(g *GAN) { g.Loss, g.Discriminator.Normalization = "wasserstein", "batch" },
+		"output":          func(g *GAN) { g.Discriminator.OutputActivation = "sigmoid" },
+		"score":           func(g *GAN) { g.Discriminator.Arch = []int{3, 4, 2} },
+		"generator input": func(g *GAN) { g.Generator.Arch = []int{3, 4, 3} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic")
+				}
+			}()
+			g := NewGAN(2, 3, []int{4})
+			g.Verbose = false
+			fit(g)
+			g.Fit(X)
+		})
+	}
+
+	t.Run("not fitted", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("expected a panic")
+			} else if fmt.Sprint(r) == "" {
+				t.Errorf("empty panic")
+			}
+		}()
+		NewGAN(2, 3, nil).Sample(1)
+	})
+}
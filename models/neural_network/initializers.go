@@ -0,0 +1,165 @@
+package neuralnetwork
+
+import (
+	"math"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Initializer creates the starting weights of a layer with fanIn inputs and fanOut outputs
+// The returned matrix has fanIn rows and fanOut columns, the same shape as mlp.Weights
+type Initializer interface {
+	Initialize(fanIn, fanOut int, rng *rand.Rand) *mat.Dense
+}
+
+// InitializerFunc allows an ordinary function to be used as an Initializer
+type InitializerFunc func(fanIn, fanOut int, rng *rand.Rand) *mat.Dense
+
+func (f InitializerFunc) Initialize(fanIn, fanOut int, rng *rand.Rand) *mat.Dense {
+	return f(fanIn, fanOut, rng)
+}
+
+// Draws the weights from N(Mean, Std²), this was the only initialisation before with Std = 0.1
+type RandomNormal struct {
+	Mean, Std float64
+}
+
+func (init RandomNormal) Initialize(fanIn, fanOut int, rng *rand.Rand) *mat.Dense {
+	return normalWeights(fanIn, fanOut, init.Mean, init.Std, rng)
+}
+
+// He initialisation for ReLU layers, N(0, 2/fanIn)
+type HeNormal struct{}
+
+func (HeNormal) Initialize(fanIn, fanOut int, rng *rand.Rand) *mat.Dense {
+	return normalWeights(fanIn, fanOut, 0, math.Sqrt(2/float64(fanIn)), rng)
+}
+
+// He initialisation for ReLU layers, U(-l, l) where l = sqrt(6/fanIn)
+type HeUniform struct{}
+
+func (HeUniform) Initialize(fanIn, fanOut int, rng *rand.Rand) *mat.Dense {
+	return uniformWeights(fanIn, fanOut, math.Sqrt(6/float64(fanIn)), rng)
+}
+
+// Xavier/Glorot initialisation for sigmoid, tanh and softmax layers, N(0, 2/(fanIn + fanOut))
+type GlorotNormal struct{}
+
+func (GlorotNormal) Initialize(fanIn, fanOut int, rng *rand.Rand) *mat.Dense {
+	return normalWeights(fanIn, fanOut, 0, math.Sqrt(2/float64(fanIn+fanOut)), rng)
+}
+
+// Xavier/Glorot initialisation for sigmoid, tanh and softmax layers, U(-l, l) where l = sqrt(6/(fanIn + fanOut))
+type GlorotUniform struct{}
+
+func (GlorotUniform) Initialize(fanIn, fanOut int, rng *rand.Rand) *mat.Dense {
+	return uniformWeights(fanIn, fanOut, math.Sqrt(6/float64(fanIn+fanOut)), rng)
+}
+
+// LeCun initialisation, N(0, 1/fanIn)
+type LeCunNormal struct{}
+
+func (LeCunNormal) Initialize(fanIn, fanOut int, rng *rand.Rand) *mat.Dense {
+	return normalWeights(fanIn, fanOut, 0, math.Sqrt(1/float64(fanIn)), rng)
+}
+
+// LeCun initialisation, U(-l, l) where l = sqrt(3/fanIn)
+type LeCunUniform struct{}
+
+func (LeCunUniform) Initialize(fanIn, fanOut int, rng *rand.Rand) *mat.Dense {
+	return uniformWeights(fanIn, fanOut, math.Sqrt(3/float64(fanIn)), rng)
+}
+
+// Orthogonal initialisation, the weights are an orthogonal matrix multiplied by Gain
+// The rows are orthonormal when fanIn <= fanOut, otherwise the columns are
+// A Gain of 0 is treated as 1
+type Orthogonal struct {
+	Gain float64
+}
+
+func (init Orthogonal) Initialize(fanIn, fanOut int, rng *rand.Rand) *mat.Dense {
+	gain := init.Gain
+	if gain == 0 {
+		gain = 1
+	}
+
+	//QR needs at least as many rows as columns so factorise the transpose for wide matrices
+	rows, cols := fanIn, fanOut
+	if rows < cols {
+		rows, cols = cols, rows
+	}
+
+	a := normalWeights(rows, cols, 0, 1, rng)
+
+	var qr mat.QR
+	qr.Factorize(a)
+
+	var q, r mat.Dense
+	qr.QTo(&q)
+	qr.RTo(&r)
+
+	//make the decomposition unique by making the diagonal of R positive, otherwise Q is not uniformly distributed
+	weights := mat.NewDense(rows, cols, nil)
+	for j := range cols {
+		sign := 1.0
+		if r.At(j, j) < 0 {
+			sign = -1.0
+		}
+		for i := range rows {
+			weights.Set(i, j, q.At(i, j)*sign*gain)
+		}
+	}
+
+	if fanIn < fanOut {
+		return mat.DenseCopyOf(weights.T())
+	}
+	return weights
+}
+
+// Sets every weight to zero
+type Zeros struct{}
+
+func (Zeros) Initialize(fanIn, fanOut int, rng *rand.Rand) *mat.Dense {
+	return mat.NewDense(fanIn, fanOut, nil)
+}
+
+// Sets every weight to Value
+type Constant struct {
+	Value float64
+}
+
+func (init Constant) Initialize(fanIn, fanOut int, rng *rand.Rand) *mat.Dense {
+	data := make([]float64, fanIn*fanOut)
+	for i := range data {
+		data[i] = init.Value
+	}
+	return mat.NewDense(fanIn, fanOut, data)
+}
+
+// Chooses an initialiser that keeps the variance of the activations stable for the given activation
+// ReLU layers use He, everything else uses Glorot
+func DefaultInitializer(activation string) Initializer {
+	switch activation {
+	case "relu", "leakyRelu":
+		return HeNormal{}
+	default:
+		return GlorotUniform{}
+	}
+}
+
+func normalWeights(fanIn, fanOut int, mean, std float64, rng *rand.Rand) *mat.Dense {
+	data := make([]float64, fanIn*fanOut)
+	for i := range data {
+		data[i] = mean + rng.NormFloat64()*std
+	}
+	return mat.NewDense(fanIn, fanOut, data)
+}
+
+func uniformWeights(fanIn, fanOut int, limit float64, rng *rand.Rand) *mat.Dense {
+	data := make([]float64, fanIn*fanOut)
+	for i := range data {
+		data[i] = (2*rng.Float64() - 1) * limit
+	}
+	return mat.NewDense(fanIn, fanOut, data)
+}
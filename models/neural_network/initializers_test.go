@@ -0,0 +1,159 @@
+package neuralnetwork
+
+import (
+	"math"
+	"testing"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+)
+
+func TestInitializerStatistics(t *testing.T) {
+	fanIn, fanOut := 400, 300
+
+	tests := []struct {
+		name  string
+		init  Initializer
+		std   float64
+		limit float64
+	}{
+		{"HeNormal", HeNormal{}, math.Sqrt(2.0 / 400), 0},
+		{"HeUniform", HeUniform{}, math.Sqrt(2.0 / 400), math.Sqrt(6.0 / 400)},
+		{"GlorotNormal", GlorotNormal{}, math.Sqrt(2.0 / 700), 0},
+		{"GlorotUniform", GlorotUniform{}, math.Sqrt(2.0 / 700), math.Sqrt(6.0 / 700)},
+		{"LeCunNormal", LeCunNormal{}, math.Sqrt(1.0 / 400), 0},
+		{"LeCunUniform", LeCunUniform{}, math.Sqrt(1.0 / 400), math.Sqrt(3.0 / 400)},
+		{"RandomNormal", RandomNormal{Std: 0.1}, 0.1, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := test.init.Initialize(fanIn, fanOut, rand.New(rand.NewSource(1)))
+
+			rows, cols := w.Dims()
+			if rows != fanIn || cols != fanOut {
+				t.Fatalf("shape: got %dx%d want %dx%d", rows, cols, fanIn, fanOut)
+			}
+
+			data := w.RawMatrix().Data
+			mean, std := stat.MeanStdDev(data, nil)
+			if math.Abs(mean) > 0.05*test.std {
+				t.Errorf("mean: got %v want 0", mean)
+			}
+			if math.Abs(std-test.std) > 0.02*test.std {
+				t.Errorf("std: got %v want %v", std, test.std)
+			}
+
+			if test.limit > 0 {
+				for _, v := range data {
+					if math.Abs(v) > test.limit {
+						t.Fatalf("value %v outside of the limit %v", v, test.limit)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestOrthogonal(t *testing.T) {
+	for _, shape := range [][2]int{{6, 4}, {4, 6}, {5, 5}} {
+		w := Orthogonal{Gain: 2}.Initialize(shape[0], shape[1], rand.New(rand.NewSource(1)))
+
+		//the smaller side should be orthonormal after removing the gain, WᵀW = 4I or WWᵀ = 4I
+		var product mat.Dense
+		n := min(shape[0], shape[1])
+		if shape[0] >= shape[1] {
+			product.Mul(w.T(), w)
+		} else {
+			product.Mul(w, w.T())
+		}
+
+		for i := range n {
+			for j := range n {
+				want := 0.0
+				if i == j {
+					want = 4
+				}
+				if math.Abs(product.At(i, j)-want) > 1e-10 {
+					t.Errorf("shape %v: product[%d][%d] = %v want %v", shape, i, j, product.At(i, j), want)
+				}
+			}
+		}
+	}
+}
+
+func TestDefaultInitializer(t *testing.T) {
+	for _, activation := range []string{"relu", "leakyRelu"} {
+		if _, ok := DefaultInitializer(activation).(HeNormal); !ok {
+			t.Errorf("%s should default to He initialisation", activation)
+		}
+	}
+	for _, activation := range []string{"sigmoid", "tanh", "softmax", "identity"} {
+		if _, ok := DefaultInitializer(activation).(GlorotUniform); !ok {
+			t.Errorf("%s should default to Glorot initialisation", activation)
+		}
+	}
+}
+
+func TestInitWeights(t *testing.T) {
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{3, 4, 2}
+	mlp.Seed = 7
+	mlp.ZeroBias = true
+	mlp.WeightInit = Constant{Value: 0.5}
+	mlp.initWeights()
+
+	for i := range mlp.Weights {
+		for _, v := range mlp.Weights[i].RawMatrix().Data {
+			if v != 0.5 {
+				t.Fatalf("layer %d weight %v, expected the constant 0.5", i, v)
+			}
+		}
+		for _, v := range mlp.Bias[i].RawMatrix().Data {
+			if v != 0 {
+				t.Fatalf("layer %d bias %v, expected zero", i, v)
+			}
+		}
+	}
+
+	//the same seed gives the same starting weights
+	a := NewMultiLayerPerceptron()
+	a.Arch = []int{3, 4, 2}
+	a.Seed = 7
+	a.initWeights()
+	b := NewMultiLayerPerceptron()
+	b.Arch = []int{3, 4, 2}
+	b.Seed = 7
+	b.initWeights()
+	for i := range a.Weights {
+		if !mat.Equal(a.Weights[i], b.Weights[i]) || !mat.Equal(a.Bias[i], b.Bias[i]) {
+			t.Errorf("layer %d differs between two networks with the same seed", i)
+		}
+	}
+
+	//custom starting weights are copied so training does not change the caller's matrices
+	custom := NewMultiLayerPerceptron()
+	custom.Arch = []int{3, 4, 2}
+	custom.InitialWeights = a.Weights
+	custom.InitialBias = a.Bias
+	custom.initWeights()
+	for i := range custom.Weights {
+		if !mat.Equal(custom.Weights[i], a.Weights[i]) || custom.Weights[i] == a.Weights[i] {
+			t.Errorf("layer %d initial weights were not copied", i)
+		}
+	}
+}
+
+func TestInitWeightsWrongShape(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected a panic for initial weights with the wrong shape")
+		}
+	}()
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{3, 4, 2}
+	mlp.InitialWeights = []*mat.Dense{mat.NewDense(3, 4, nil), mat.NewDense(3, 2, nil)}
+	mlp.initWeights()
+}
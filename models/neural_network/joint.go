@@ -0,0 +1,135 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/training"
+	"time"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// settings for models made of several networks that are trained together, such as the encoder and decoder of an
+// autoencoder, each network keeps its own LearningRate, Momentum and regularisation so they are optimized separately
+type jointTraining struct {
+	Epochs    int
+	BatchSize int
+	// Seed for shuffling the data and for the noise the model draws, 0 uses the current time
+	// the starting weights come from the Seed of each network
+	Seed    uint64
+	Verbose bool
+	// Callbacks are notified as training progresses, see training.Callback
+	Callbacks []training.Callback
+	Fitted    bool
+
+	rng *rand.Rand
+}
+
+func newJointTraining() jointTraining {
+	return jointTraining{Epochs: 100, BatchSize: 32, Verbose: true}
+}
+
+// generator for the noise of the model, created from Seed the first time it is needed
+func (t *jointTraining) random() *rand.Rand {
+	if t.rng == nil {
+		t.rng, _ = newRNG(t.Seed)
+	}
+	return t.rng
+}
+
+// Runs Epochs over shuffled batches of the rows of X, step trains the networks on one batch and returns its loss
+// metrics gives the logs recorded at the end of each epoch
+// callbacks can stop training early, an error from one of them stops training and is returned with the history so far
+func (t *jointTraining) fit(X *mat.Dense, learningRate float64, step func(X *mat.Dense) float64, metrics func() training.Logs) (*training.History, error) {
+	history := training.NewHistory()
+	t0 := time.Now()
+
+	loader := NewDataLoader(NewDenseDataset(X, X), t.BatchSize)
+	loader.Seed = t.Seed
+	loader.Prefetch = 0
+
+	callbacks := training.CallbackList(t.Callbacks)
+	if t.Verbose {
+		callbacks = append(training.CallbackList{training.NewProgressLogger()}, callbacks...)
+	}
+
+	if stop, err := training.Stopped(callbacks.OnTrainBegin(training.Logs{"epochs": float64(t.Epochs)})); stop {
+		return history, err
+	}
+
+	for i := range t.Epochs {
+		epochStart := time.Now()
+		stop, err := training.Stopped(callbacks.OnEpochBegin(i, training.Logs{}))
+		if err != nil {
+			return history, err
+		}
+		if stop {
+			history.StoppedEpoch = i
+			break
+		}
+
+		batches := loader.Iter()
+		iterations := 0
+		for !stop && batches.Next() {
+			Xs, _ := batches.Batch()
+			loss := step(Xs)
+
+			n, _ := Xs.Dims()
+			stop, err = training.Stopped(callbacks.OnBatchEnd(iterations, training.Logs{"loss": loss, "size": float64(n)}))
+			iterations++
+		}
+		batches.Close()
+		t.Fitted = true
+		if err != nil {
+			return history, err
+		}
+
+		logs := metrics()
+		history.Add(i, logs, learningRate, iterations, time.Since(epochStart))
+
+		callbackStop, err := training.Stopped(callbacks.OnEpochEnd(i, logs))
+		if err != nil {
+			return history, err
+		}
+		if stop || callbackStop {
+			history.StoppedEpoch = i
+			break
+		}
+	}
+
+	history.Seconds = time.Since(t0).Seconds()
+	_, err := training.Stopped(callbacks.OnTrainEnd(training.Logs{}))
+	return history, err
+}
+
+// panics before the model has been trained
+func (t *jointTraining) checkFitted() {
+	if !t.Fitted {
+		panic("Model needs to be trained before making a prediction")
+	}
+}
+
+// adds the regularisation penalty to the gradients of a batch and takes an optimizer step
+func (mlp *MultiLayerPerceptron) applyGradients(grads *gradients) {
+	mlp.addPenaltyGrads(grads)
+	mlp.updateParams(grads)
+}
+
+// Sets up a network that is trained as part of a bigger model, with random starting weights
+func (mlp *MultiLayerPerceptron) initJoint() {
+	mlp.joint = true
+	mlp.initWeights()
+}
+
+// the output of the network for X, without the checks of Predict
+func (mlp *MultiLayerPerceptron) output(X *mat.Dense) *mat.Dense {
+	activations, _, _ := mlp.forward(X, false)
+	return activations[len(activations)-1]
+}
+
+// size of the input of the network
+func (mlp *MultiLayerPerceptron) inputSize() int {
+	if len(mlp.Layers) > 0 {
+		return mlp.InputShape.Size()
+	}
+	return mlp.Arch[0]
+}
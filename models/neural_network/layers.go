@@ -0,0 +1,227 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/serialization"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Shape of a single sample, e.g. Shape{channels, height, width} for an image
+// every sample is stored as one row of a matrix, flattened in row major order of its shape
+type Shape []int
+
+// number of values in a sample of this shape
+func (s Shape) Size() int {
+	size := 1
+	for _, dim := range s {
+		size *= dim
+	}
+	return size
+}
+
+// Layer is a part of a network that transforms a batch of samples, one sample per row
+// mlp.Layers are run in order before the dense layers of the network
+type Layer interface {
+	// Build sets the layer up for inputs of the given shape, initialising its parameters with rng
+	// and returns the shape of its output
+	Build(input Shape, rng *rand.Rand) Shape
+	// Forward returns the output of the layer for a batch, and anything Backward needs to know about that batch
+	// it must not change the layer, so shards of a batch can run at the same time
+	Forward(X *mat.Dense, training bool) (*mat.Dense, any)
+	// Backward takes the gradient of the loss with respect to the output of Forward and returns the gradient with respect
+	// to its input, and the gradient of each of Params summed over the batch
+	Backward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense)
+	// Params are the learnable parameters of the layer, updated in place during training
+	Params() []*mat.Dense
+}
+
+// SparseGradient is the gradient of a parameter where only some rows are non-zero, Values holds those rows in the order
+// of Rows, a row can appear more than once and its gradients are then added together
+// Values is nil when there are no Rows
+type SparseGradient struct {
+	Rows   []int
+	Values *mat.Dense
+}
+
+// adds the gradient to a dense matrix the shape of the whole parameter
+func (g *SparseGradient) addTo(dst *mat.Dense) {
+	for i, row := range g.Rows {
+		dstRow := dst.RawRowView(row)
+		for j, value := range g.Values.RawRowView(i) {
+			dstRow[j] += value
+		}
+	}
+}
+
+// SparseLayer is a Layer where each batch only uses a few rows of some of its parameters, such as an embedding table
+// where only the rows of the IDs in the batch are used
+// The network trains it with SparseBackward instead of Backward, so the memory and time of an update scale with the batch
+// rather than the size of the parameter, and only the rows in the batch are updated
+type SparseLayer interface {
+	Layer
+	// SparseBackward is Backward with the gradient of each parameter either dense or sparse, the other one nil
+	SparseBackward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense, []*SparseGradient)
+}
+
+// Layers that can be saved and loaded with a network, by the name of their type
+// a custom layer has to be added here before a network using it can be saved
+// the exported fields of a layer are saved as its configuration, so parameters should be tagged `json:"-"`
+var LayerTypes = map[string]func() Layer{
+	"Conv2D":    func() Layer { return &Conv2D{} },
+	"MaxPool2D": func() Layer { return &MaxPool2D{} },
+	"AvgPool2D": func() Layer { return &AvgPool2D{} },
+	"Flatten":   func() Layer { return &Flatten{} },
+	"SimpleRNN": func() Layer { return &SimpleRNN{} },
+	"LSTM":      func() Layer { return &LSTM{} },
+	"GRU":       func() Layer { return &GRU{} },
+	"Embedding": func() Layer { return &Embedding{} },
+
+	"MultiHeadAttention": func() Layer { return &MultiHeadAttention{} },
+	"PositionalEncoding": func() Layer { return &PositionalEncoding{} },
+	"TransformerEncoder": func() Layer { return &TransformerEncoder{} },
+}
+
+// Builds each of mlp.Layers in turn, the output size of the last one has to be the size of the first dense layer
+func (mlp *MultiLayerPerceptron) buildLayers(rng *rand.Rand) {
+	if len(mlp.Layers) == 0 {
+		return
+	}
+	if len(mlp.InputShape) == 0 {
+		panic("mlp.InputShape must be set to use mlp.Layers")
+	}
+
+	shape := mlp.InputShape
+	for _, layer := range mlp.Layers {
+		shape = layer.Build(shape, rng)
+	}
+	if shape.Size() != mlp.Arch[0] {
+		panic(fmt.Sprintf("mlp.Layers output %d values per sample but mlp.Arch[0] is %d", shape.Size(), mlp.Arch[0]))
+	}
+}
+
+// Runs the batch through mlp.Layers, returning the input of the dense layers and the cache of every layer
+func (mlp *MultiLayerPerceptron) layersForward(X *mat.Dense, training bool) (*mat.Dense, []any) {
+	caches := make([]any, len(mlp.Layers))
+	for i, layer := range mlp.Layers {
+		X, caches[i] = layer.Forward(X, training)
+	}
+	return X, caches
+}
+
+// Propagates the error of the input of the dense layers back through mlp.Layers
+// returns the gradients of the parameters of every layer in the order of layerParams, scaled by η/m like the rest
+// each parameter has either a dense or a sparse gradient, the other is nil
+// also returns the error of the input of the first layer
+func (mlp *MultiLayerPerceptron) layersBackward(grad *mat.Dense, caches []any, nSamples int) ([]*mat.Dense, []*SparseGradient, *mat.Dense) {
+	layerGrads := make([][]*mat.Dense, len(mlp.Layers))
+	layerSparse := make([][]*SparseGradient, len(mlp.Layers))
+	for i := len(mlp.Layers) - 1; i >= 0; i-- {
+		if sparse, ok := mlp.Layers[i].(SparseLayer); ok {
+			grad, layerGrads[i], layerSparse[i] = sparse.SparseBackward(grad, caches[i])
+		} else {
+			grad, layerGrads[i] = mlp.Layers[i].Backward(grad, caches[i])
+			layerSparse[i] = make([]*SparseGradient, len(layerGrads[i]))
+		}
+	}
+
+	scale := mlp.LearningRate / float64(nSamples)
+	var grads []*mat.Dense
+	var sparseGrads []*SparseGradient
+	for i, paramGrads := range layerGrads {
+		for j, g := range paramGrads {
+			if g != nil {
+				g.Scale(scale, g)
+			}
+			if s := layerSparse[i][j]; s != nil && len(s.Rows) > 0 {
+				s.Values.Scale(scale, s.Values)
+			}
+			grads = append(grads, g)
+			sparseGrads = append(sparseGrads, layerSparse[i][j])
+		}
+	}
+	return grads, sparseGrads, grad
+}
+
+// the parameters of every layer in mlp.Layers, in order
+func (mlp *MultiLayerPerceptron) layerParams() []*mat.Dense {
+	var params []*mat.Dense
+	for _, layer := range mlp.Layers {
+		params = append(params, layer.Params()...)
+	}
+	return params
+}
+
+// copies the values of a snapshot back into the parameters of the layers
+func (mlp *MultiLayerPerceptron) restoreLayerParams(values []*mat.Dense) {
+	for i, param := range mlp.layerParams() {
+		param.Copy(values[i])
+	}
+}
+
+// a layer as it is saved, its type, configuration and parameters
+type layerState struct {
+	Type   string
+	Config json.RawMessage
+	Params []*serialization.Matrix
+}
+
+func layerStates(layers []Layer) ([]layerState, error) {
+	var states []layerState
+	for _, layer := range layers {
+		name := reflect.TypeOf(layer).Elem().Name()
+		if _, ok := LayerTypes[name]; !ok {
+			return nil, fmt.Errorf("layer %s is not one of the LayerTypes so it can't be saved", name)
+		}
+		config, err := json.Marshal(layer)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding layer %s: %w", name, err)
+		}
+		states = append(states, layerState{Type: name, Config: config, Params: serialization.FromDenses(layer.Params())})
+	}
+	return states, nil
+}
+
+// Recreates saved layers, building them for the input shape then replacing their parameters with the saved ones
+func layersFromStates(states []layerState, input Shape) ([]Layer, error) {
+	if len(states) == 0 {
+		return nil, nil
+	}
+
+	rng, _ := newRNG(1)
+	layers := make([]Layer, len(states))
+	shape := input
+	for i, state := range states {
+		newLayer, ok := LayerTypes[state.Type]
+		if !ok {
+			return nil, fmt.Errorf("saved layer %s is not one of the LayerTypes", state.Type)
+		}
+		layer := newLayer()
+		if err := json.Unmarshal(state.Config, layer); err != nil {
+			return nil, fmt.Errorf("error decoding layer %s: %w", state.Type, err)
+		}
+		shape = layer.Build(shape, rng)
+
+		saved, err := serialization.ToDenses(state.Params)
+		if err != nil {
+			return nil, err
+		}
+		params := layer.Params()
+		if len(saved) != len(params) {
+			return nil, fmt.Errorf("saved layer %d has %d parameters, %s has %d", i, len(saved), state.Type, len(params))
+		}
+		for j := range params {
+			r, c := params[j].Dims()
+			sr, sc := saved[j].Dims()
+			if r != sr || c != sc {
+				return nil, fmt.Errorf("saved parameter %d of layer %d has shape %dx%d, expected %dx%d", j, i, sr, sc, r, c)
+			}
+			params[j].Copy(saved[j])
+		}
+		layers[i] = layer
+	}
+	return layers, nil
+}
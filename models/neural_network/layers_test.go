@@ -0,0 +1,104 @@
+package neuralnetwork
+
+import (
+	"bytes"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func convNet() (*MultiLayerPerceptron, *mat.Dense, *mat.Dense) {
+	conv := NewConv2D(2, 3)
+	conv.Stride, conv.Padding, conv.Dilation = 2, 1, 1
+	return convSetup(conv, NewMaxPool2D(2), NewFlatten())
+}
+
+func TestSaveLoadLayers(t *testing.T) {
+	mlp, X, _ := convNet()
+	mlp.Fitted = true
+	want := mlp.DecisionFunction(X)
+
+	for name, save := range map[string]func(*bytes.Buffer) error{
+		"binary": func(buf *bytes.Buffer) error { return mlp.Save(buf) },
+		"json":   func(buf *bytes.Buffer) error { return mlp.SaveJSON(buf) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := save(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := NewMultiLayerPerceptron()
+			if err := loaded.Load(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if len(loaded.Layers) != 3 {
+				t.Fatalf("loaded %d layers want 3", len(loaded.Layers))
+			}
+			conv := loaded.Layers[0].(*Conv2D)
+			if conv.Stride != 2 || conv.Padding != 1 || conv.Filters != 2 {
+				t.Errorf("the configuration of the convolution was not saved: %+v", conv)
+			}
+			if got := loaded.DecisionFunction(X); !mat.EqualApprox(got, want, 1e-12) {
+				t.Errorf("loaded network predicts\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(want))
+			}
+		})
+	}
+}
+
+// a layer that isn't one of the LayerTypes
+type doubleLayer struct{ Flatten }
+
+func (l *doubleLayer) Forward(X *mat.Dense, training bool) (*mat.Dense, any) {
+	var out mat.Dense
+	out.Scale(2, X)
+	return &out, nil
+}
+
+func TestSaveUnknownLayer(t *testing.T) {
+	mlp, _, _ := convSetup(&doubleLayer{})
+	if err := mlp.Save(&bytes.Buffer{}); err == nil {
+		t.Errorf("expected an error saving a layer that is not one of the LayerTypes")
+	}
+}
+
+func TestParallelBackpropWithLayers(t *testing.T) {
+	mlp, X, y := convNet()
+
+	serial := mlp.backprop(X, y, nil)
+	parallel := mlp.parallelBackprop(X, y, nil, 2)
+
+	equalWithin(t, "layers", serial.layers, parallel.layers, 1e-12)
+	equalWithin(t, "weights", serial.weights, parallel.weights, 1e-12)
+}
+
+func TestRestoreLayerParams(t *testing.T) {
+	mlp, X, y := convNet()
+	mlp.Fitted = true
+	before := mlp.DecisionFunction(X)
+	snapshot := mlp.SnapshotWeights()
+
+	mlp.updateParams(mlp.backprop(X, y, nil))
+	if mat.EqualApprox(mlp.DecisionFunction(X), before, 1e-12) {
+		t.Fatalf("the update did not change the network")
+	}
+
+	mlp.RestoreWeights(snapshot)
+	if got := mlp.DecisionFunction(X); !mat.EqualApprox(got, before, 1e-12) {
+		t.Errorf("restored network predicts\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(before))
+	}
+}
+
+func TestLayersWrongArch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic when the layers don't output Arch[0] values")
+		}
+	}()
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.InputShape = Shape{1, 6, 6}
+	mlp.Layers = []Layer{NewConv2D(2, 3), NewFlatten()}
+	mlp.Arch = []int{36, 2}
+	mlp.initWeights()
+}
@@ -0,0 +1,411 @@
+package neuralnetwork
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Loss compares the targets y with the output h of a network for a batch of m samples
+// Value is the mean loss over the samples and Gradient is its gradient with respect to h
+type Loss interface {
+	Value(y, h *mat.Dense) float64
+	Gradient(y, h *mat.Dense) *mat.Dense
+}
+
+// Losses that can be chosen with mlp.LossFunction, other losses can be added to the map
+var Losses = map[string]Loss{
+	"MSELoss":                MSE{},
+	"MAELoss":                MAE{},
+	"huberLoss":              Huber{Delta: 1},
+	"binaryCrossEntropyLoss": BinaryCrossEntropy{Epsilon: defaultEpsilon},
+	"crossEntropyLoss":       CategoricalCrossEntropy{Epsilon: defaultEpsilon},
+	"nllLoss":                NLL{},
+	"hingeLoss":              Hinge{},
+	"squaredHingeLoss":       SquaredHinge{},
+	"klDivergenceLoss":       KLDivergence{Epsilon: defaultEpsilon},
+}
+
+// losses that clip the predictions before taking logs, the MLP sets the clipping from mlp.Epsilon
+type clippedLoss interface {
+	withEpsilon(epsilon float64) Loss
+}
+
+// applies f to every element of y and h, returning the sum of the values and the matrix of gradients
+func elementwise(y, h *mat.Dense, f func(y, h float64) (float64, float64)) (float64, *mat.Dense) {
+	rows, cols := y.Dims()
+	grad := mat.NewDense(rows, cols, nil)
+	sum := 0.0
+	for i := range rows {
+		for j := range cols {
+			value, g := f(y.At(i, j), h.At(i, j))
+			sum += value
+			grad.Set(i, j, g/float64(rows))
+		}
+	}
+	return sum / float64(rows), grad
+}
+
+func clip(p, epsilon float64) float64 {
+	return math.Min(math.Max(p, epsilon), 1-epsilon)
+}
+
+// Mean squared error, 1/2m Σ (h - y)²
+type MSE struct{}
+
+func (MSE) Value(y, h *mat.Dense) float64 {
+	value, _ := elementwise(y, h, mseElement)
+	return value
+}
+
+func (MSE) Gradient(y, h *mat.Dense) *mat.Dense {
+	_, grad := elementwise(y, h, mseElement)
+	return grad
+}
+
+func mseElement(y, h float64) (float64, float64) {
+	return (h - y) * (h - y) / 2, h - y
+}
+
+// Mean absolute error, 1/m Σ |h - y|
+type MAE struct{}
+
+func (MAE) Value(y, h *mat.Dense) float64 {
+	value, _ := elementwise(y, h, maeElement)
+	return value
+}
+
+func (MAE) Gradient(y, h *mat.Dense) *mat.Dense {
+	_, grad := elementwise(y, h, maeElement)
+	return grad
+}
+
+func maeElement(y, h float64) (float64, float64) {
+	return math.Abs(h - y), sign(h - y)
+}
+
+// Huber loss, squared for errors smaller than Delta and absolute for larger ones so outliers have less pull
+// r²/2 if |r| <= δ, otherwise δ(|r| - δ/2)
+type Huber struct {
+	Delta float64
+}
+
+func (l Huber) element(y, h float64) (float64, float64) {
+	r := h - y
+	if math.Abs(r) <= l.Delta {
+		return r * r / 2, r
+	}
+	return l.Delta * (math.Abs(r) - l.Delta/2), l.Delta * sign(r)
+}
+
+func (l Huber) Value(y, h *mat.Dense) float64 {
+	value, _ := elementwise(y, h, l.element)
+	return value
+}
+
+func (l Huber) Gradient(y, h *mat.Dense) *mat.Dense {
+	_, grad := elementwise(y, h, l.element)
+	return grad
+}
+
+// Binary cross entropy for independent probabilities, usually after a sigmoid output
+// -1/m Σ y log(h) + (1 - y) log(1 - h), with h clipped to [Epsilon, 1 - Epsilon]
+type BinaryCrossEntropy struct {
+	Epsilon float64
+}
+
+func (l BinaryCrossEntropy) element(y, h float64) (float64, float64) {
+	p := clip(h, l.Epsilon)
+	return -(y*math.Log(p) + (1-y)*math.Log(1-p)), (p - y) / (p * (1 - p))
+}
+
+func (l BinaryCrossEntropy) Value(y, h *mat.Dense) float64 {
+	value, _ := elementwise(y, h, l.element)
+	return value
+}
+
+func (l BinaryCrossEntropy) Gradient(y, h *mat.Dense) *mat.Dense {
+	_, grad := elementwise(y, h, l.element)
+	return grad
+}
+
+func (l BinaryCrossEntropy) withEpsilon(epsilon float64) Loss {
+	l.Epsilon = epsilon
+	return l
+}
+
+// Cross entropy for one hot or soft targets, usually after a softmax output
+// -1/m Σ y log(h), with h clipped to [Epsilon, 1 - Epsilon]
+type CategoricalCrossEntropy struct {
+	Epsilon float64
+}
+
+func (l CategoricalCrossEntropy) element(y, h float64) (float64, float64) {
+	if y == 0 {
+		return 0, 0
+	}
+	p := clip(h, l.Epsilon)
+	return -y * math.Log(p), -y / p
+}
+
+func (l CategoricalCrossEntropy) Value(y, h *mat.Dense) float64 {
+	return CrossEntropy(y, h, l.Epsilon)
+}
+
+func (l CategoricalCrossEntropy) Gradient(y, h *mat.Dense) *mat.Dense {
+	_, grad := elementwise(y, h, l.element)
+	return grad
+}
+
+func (l CategoricalCrossEntropy) withEpsilon(epsilon float64) Loss {
+	l.Epsilon = epsilon
+	return l
+}
+
+// Negative log likelihood of log probabilities, usually after a log softmax output where it is the cross entropy
+// -1/m Σ y h
+type NLL struct{}
+
+func (NLL) Value(y, h *mat.Dense) float64 {
+	value, _ := elementwise(y, h, nllElement)
+	return value
+}
+
+func (NLL) Gradient(y, h *mat.Dense) *mat.Dense {
+	_, grad := elementwise(y, h, nllElement)
+	return grad
+}
+
+func nllElement(y, h float64) (float64, float64) {
+	return -y * h, -y
+}
+
+// converts 0/1 targets to the -1/1 targets used by the hinge losses
+func hingeTarget(y float64) float64 {
+	if y > 0 {
+		return 1
+	}
+	return -1
+}
+
+// Hinge loss for margin classifiers, targets of 0 are treated as -1
+// 1/m Σ max(0, 1 - y h)
+type Hinge struct{}
+
+func (Hinge) Value(y, h *mat.Dense) float64 {
+	value, _ := elementwise(y, h, hingeElement)
+	return value
+}
+
+func (Hinge) Gradient(y, h *mat.Dense) *mat.Dense {
+	_, grad := elementwise(y, h, hingeElement)
+	return grad
+}
+
+func hingeElement(y, h float64) (float64, float64) {
+	t := hingeTarget(y)
+	margin := 1 - t*h
+	if margin <= 0 {
+		return 0, 0
+	}
+	return margin, -t
+}
+
+// Squared hinge loss, targets of 0 are treated as -1
+// 1/m Σ max(0, 1 - y h)²
+type SquaredHinge struct{}
+
+func (SquaredHinge) Value(y, h *mat.Dense) float64 {
+	value, _ := elementwise(y, h, squaredHingeElement)
+	return value
+}
+
+func (SquaredHinge) Gradient(y, h *mat.Dense) *mat.Dense {
+	_, grad := elementwise(y, h, squaredHingeElement)
+	return grad
+}
+
+func squaredHingeElement(y, h float64) (float64, float64) {
+	t := hingeTarget(y)
+	margin := 1 - t*h
+	if margin <= 0 {
+		return 0, 0
+	}
+	return margin * margin, -2 * t * margin
+}
+
+// Kullback-Leibler divergence of the predicted distribution h from the target distribution y
+// 1/m Σ y log(y / h), with h clipped to [Epsilon, 1 - Epsilon]
+type KLDivergence struct {
+	Epsilon float64
+}
+
+func (l KLDivergence) element(y, h float64) (float64, float64) {
+	if y == 0 {
+		return 0, 0
+	}
+	p := clip(h, l.Epsilon)
+	return y * math.Log(y/p), -y / p
+}
+
+func (l KLDivergence) Value(y, h *mat.Dense) float64 {
+	value, _ := elementwise(y, h, l.element)
+	return value
+}
+
+func (l KLDivergence) Gradient(y, h *mat.Dense) *mat.Dense {
+	_, grad := elementwise(y, h, l.element)
+	return grad
+}
+
+func (l KLDivergence) withEpsilon(epsilon float64) Loss {
+	l.Epsilon = epsilon
+	return l
+}
+
+// Binary cross entropy of the sigmoid of the logits, calculated so it can't overflow
+// max(z, 0) - z y + log(1 + exp(-|z|))
+func BinaryCrossEntropyFromLogits(y, logits *mat.Dense) float64 {
+	value, _ := elementwise(y, logits, func(y, z float64) (float64, float64) {
+		return math.Max(z, 0) - z*y + math.Log1p(math.Exp(-math.Abs(z))), 0
+	})
+	return value
+}
+
+// The name of the loss that is trained, mlp.LossFunction unless it is the cross entropy of outputs that need another form of it
+// a multi-label network uses the binary cross entropy of each label, and the outputs of a log softmax are already
+// log probabilities so their cross entropy is the negative log likelihood
+func (mlp *MultiLayerPerceptron) lossFunction() string {
+	if mlp.LossFunction != "crossEntropyLoss" {
+		return mlp.LossFunction
+	}
+	if mlp.MultiLabel {
+		return "binaryCrossEntropyLoss"
+	}
+	if mlp.outputActivation() == "logsoftmax" {
+		return "nllLoss"
+	}
+	return mlp.LossFunction
+}
+
+// The loss chosen by mlp.LossFunction, clipped with mlp.Epsilon
+func (mlp *MultiLayerPerceptron) loss() Loss {
+	loss, ok := Losses[mlp.lossFunction()]
+	if !ok {
+		panic(fmt.Sprintf("mlp.LossFunction %q is not one of the Losses", mlp.LossFunction))
+	}
+	if clipped, ok := loss.(clippedLoss); ok && mlp.Epsilon > 0 {
+		return clipped.withEpsilon(mlp.Epsilon)
+	}
+	return loss
+}
+
+// The output activation and loss pairs whose combined gradient with respect to the logits is h - y,
+// or exp(h) - y for a log softmax, their loss is also calculated from the logits to avoid taking the log of a saturated output
+func (mlp *MultiLayerPerceptron) fusedOutput(loss Loss) bool {
+	output := mlp.outputActivation()
+	switch loss.(type) {
+	case CategoricalCrossEntropy:
+		return output == "softmax"
+	case NLL:
+		return output == "logsoftmax"
+	case BinaryCrossEntropy:
+		return output == "sigmoid"
+	}
+	return false
+}
+
+// Loss of the output of a forward pass, without the regularisation penalty
+func (mlp *MultiLayerPerceptron) outputLoss(y *mat.Dense, activations, zs []*mat.Dense) float64 {
+	loss := mlp.loss()
+	if mlp.fusedOutput(loss) {
+		if output := mlp.outputActivation(); output == "softmax" || output == "logsoftmax" {
+			return CrossEntropyFromLogits(y, zs[len(zs)-1])
+		}
+		return BinaryCrossEntropyFromLogits(y, zs[len(zs)-1])
+	}
+	return loss.Value(y, activations[len(activations)-1])
+}
+
+// Error of the output layer of each sample, the gradient of the loss with respect to the logits
+// multiplied by the number of samples as backprop scales the gradients by η/m
+// δ^L = m ∂L/∂a^L ⊙ f'(Z^L), or the Jacobian of the softmax or log softmax times ∂L/∂a^L for those outputs
+func (mlp *MultiLayerPerceptron) outputDelta(y *mat.Dense, activations, zs []*mat.Dense) *mat.Dense {
+	h := activations[len(activations)-1]
+	rows, _ := h.Dims()
+	loss := mlp.loss()
+
+	// δ^L = a^L - y, a log softmax output is exponentiated back to the probabilities first
+	if mlp.fusedOutput(loss) {
+		var delta mat.Dense
+		if mlp.outputActivation() == "logsoftmax" {
+			delta.Apply(func(_, _ int, v float64) float64 { return math.Exp(v) }, h)
+			delta.Sub(&delta, y)
+		} else {
+			delta.Sub(h, y)
+		}
+		return &delta
+	}
+
+	grad := loss.Gradient(y, h)
+	grad.Scale(float64(rows), grad)
+
+	return mlp.activationDelta(grad, activations, zs)
+}
+
+// δ^L from the gradient of the loss with respect to the output of the network, through the output activation
+// grad is changed in place
+func (mlp *MultiLayerPerceptron) activationDelta(grad *mat.Dense, activations, zs []*mat.Dense) *mat.Dense {
+	output := mlp.outputActivation()
+	switch output {
+	case "softmax":
+		return softmaxJVP(activations[len(activations)-1], grad)
+	case "logsoftmax":
+		return logSoftmaxJVP(activations[len(activations)-1], grad)
+	}
+
+	derivative, ok := Derivative[output]
+	if !ok {
+		panic(fmt.Sprintf("output activation %q has no derivative", output))
+	}
+	var dz mat.Dense
+	dz.CloneFrom(zs[len(zs)-1])
+	derivative(&dz)
+	grad.MulElem(grad, &dz)
+	return grad
+}
+
+// Multiplies the gradient of each row by the Jacobian of the log softmax l of that row
+// δ_i = g_i - exp(l_i) Σ_j g_j
+func logSoftmaxJVP(l, grad *mat.Dense) *mat.Dense {
+	rows, cols := l.Dims()
+	delta := mat.NewDense(rows, cols, nil)
+	for i := range rows {
+		sum := 0.0
+		for j := range cols {
+			sum += grad.At(i, j)
+		}
+		for j := range cols {
+			delta.Set(i, j, grad.At(i, j)-math.Exp(l.At(i, j))*sum)
+		}
+	}
+	return delta
+}
+
+// Multiplies the gradient of each row by the Jacobian of the softmax s of that row
+// δ_i = s_i (g_i - Σ_j s_j g_j)
+func softmaxJVP(s, grad *mat.Dense) *mat.Dense {
+	rows, cols := s.Dims()
+	delta := mat.NewDense(rows, cols, nil)
+	for i := range rows {
+		dot := 0.0
+		for j := range cols {
+			dot += s.At(i, j) * grad.At(i, j)
+		}
+		for j := range cols {
+			delta.Set(i, j, s.At(i, j)*(grad.At(i, j)-dot))
+		}
+	}
+	return delta
+}
@@ -0,0 +1,138 @@
+package neuralnetwork
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestLossGradients(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+
+	//probabilities away from 0 and 1 so every loss is smooth around them
+	y := mat.NewDense(4, 3, nil)
+	h := mat.NewDense(4, 3, nil)
+	for i := range 4 {
+		y.Set(i, r.Intn(3), 1)
+		for j := range 3 {
+			h.Set(i, j, 0.05+0.9*r.Float64())
+		}
+	}
+
+	for name, loss := range Losses {
+		t.Run(name, func(t *testing.T) {
+			grad := loss.Gradient(y, h)
+
+			const eps = 1e-6
+			for i := range 4 {
+				for j := range 3 {
+					original := h.At(i, j)
+					h.Set(i, j, original+eps)
+					plus := loss.Value(y, h)
+					h.Set(i, j, original-eps)
+					minus := loss.Value(y, h)
+					h.Set(i, j, original)
+
+					numeric := (plus - minus) / (2 * eps)
+					if math.Abs(numeric-grad.At(i, j)) > 1e-6 {
+						t.Errorf("gradient (%d, %d) %v numeric %v", i, j, grad.At(i, j), numeric)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHuber(t *testing.T) {
+	y := mat.NewDense(1, 2, []float64{0, 0})
+	h := mat.NewDense(1, 2, []float64{0.5, 3})
+	loss := Huber{Delta: 1}
+
+	//0.5 is inside delta so it is squared, 3 is outside so it grows linearly
+	if got, want := loss.Value(y, h), 0.125+2.5; math.Abs(got-want) > 1e-12 {
+		t.Errorf("value %v want %v", got, want)
+	}
+	if grad := loss.Gradient(y, h); grad.At(0, 0) != 0.5 || grad.At(0, 1) != 1 {
+		t.Errorf("gradient %v", mat.Formatted(grad))
+	}
+}
+
+func TestHingeTargets(t *testing.T) {
+	h := mat.NewDense(1, 2, []float64{2, -0.5})
+
+	//targets of 0 and -1 are the same negative class
+	zeros := Hinge{}.Value(mat.NewDense(1, 2, []float64{1, 0}), h)
+	minusOnes := Hinge{}.Value(mat.NewDense(1, 2, []float64{1, -1}), h)
+	if zeros != minusOnes || zeros != 0.5 {
+		t.Errorf("hinge loss with 0 targets %v, with -1 targets %v, want 0.5", zeros, minusOnes)
+	}
+}
+
+// the gradients of every parameter, including the biases, match the loss for each output activation and loss
+func TestBackpropLossGradients(t *testing.T) {
+	for _, test := range []struct {
+		output, loss string
+	}{
+		{"softmax", "crossEntropyLoss"},
+		{"softmax", "MSELoss"},
+		{"softmax", "klDivergenceLoss"},
+		{"logsoftmax", "nllLoss"},
+		{"logsoftmax", "MSELoss"},
+		{"sigmoid", "binaryCrossEntropyLoss"},
+		{"sigmoid", "MSELoss"},
+		{"identity", "MSELoss"},
+		{"identity", "MAELoss"},
+		{"identity", "huberLoss"},
+		{"tanh", "hingeLoss"},
+		{"tanh", "squaredHingeLoss"},
+	} {
+		t.Run(test.output+"/"+test.loss, func(t *testing.T) {
+			mlp, X, y := gradientCheckSetup("none")
+			mlp.OutputActivation = test.output
+			mlp.LossFunction = test.loss
+
+			grads := mlp.backprop(X, y, nil)
+			for l := range mlp.Weights {
+				checkGradient(t, "weights", mlp, X, y, mlp.Weights[l], grads.weights[l])
+				checkGradient(t, "bias", mlp, X, y, mlp.Bias[l], grads.bias[l])
+			}
+		})
+	}
+}
+
+func TestSoftmaxJVP(t *testing.T) {
+	s := mat.NewDense(1, 3, []float64{0.2, 0.3, 0.5})
+	g := mat.NewDense(1, 3, []float64{1, -2, 0.5})
+
+	//the Jacobian of the softmax is diag(s) - s sᵀ
+	jacobian := mat.NewDense(3, 3, nil)
+	for i := range 3 {
+		for j := range 3 {
+			value := -s.At(0, i) * s.At(0, j)
+			if i == j {
+				value += s.At(0, i)
+			}
+			jacobian.Set(i, j, value)
+		}
+	}
+	var want mat.Dense
+	want.Mul(g, jacobian)
+
+	if got := softmaxJVP(s, g); !mat.EqualApprox(got, &want, 1e-12) {
+		t.Errorf("got %v want %v", mat.Formatted(got), mat.Formatted(&want))
+	}
+}
+
+func TestUnknownLoss(t *testing.T) {
+	mlp, X, y := gradientCheckSetup("none")
+	mlp.LossFunction = "notALoss"
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for an unknown loss")
+		}
+	}()
+	mlp.backprop(X, y, nil)
+}
@@ -1,11 +1,13 @@
 package neuralnetwork
 
 import (
+	"Go-Machine-Learning/training"
+	"context"
 	"fmt"
 	"math"
-	"math/rand"
 	"time"
 
+	"golang.org/x/exp/rand"
 	"gonum.org/v1/gonum/mat"
 )
 
@@ -23,30 +25,177 @@ type MultiLayerPerceptron struct {
 	Bias    []*mat.Dense
 	Weights []*mat.Dense
 
+	// Layers run on each sample before the dense layers, such as convolutions and pooling for images
+	// the output size of the last layer has to be Arch[0], regularisation and max norm only apply to the dense layers
+	Layers []Layer
+	// Shape of each sample given to the first of the Layers, e.g. Shape{channels, height, width} for images
+	InputShape Shape
+
 	Fitted       bool
 	IsClassifier bool
 	// output layer activation layer depends on whether it is a classification or regression problem
+	// when empty the network uses sigmoid for multi-label networks, softmax for classifiers and identity for regression
 	OutputActivation string
 
+	// Each sample can belong to any number of classes, the outputs are independent sigmoids trained with
+	// binary cross entropy and the targets have a 1 for every class the sample belongs to
+	MultiLabel bool
+	// decision threshold of each label of a multi-label network, 0.5 for every label if nil
+	Thresholds []float64
+	// Label of each class of a classifier, Predict returns these instead of the index of the class when set
+	// a binary classifier with a single output unit has two labels, for probabilities below and above 0.5
+	Classes []float64
+
+	// Multiplies the loss and gradient of the samples of each class of a classifier, classes that are missing weigh 1
+	ClassWeight map[int]float64
+	// Weigh each class by n_samples / (n_classes · samples in the class) so rare classes count as much as common ones
+	// this replaces ClassWeight
+	BalancedClassWeight bool
+
+	// How the weights are initialised, if nil it is chosen from the activation of each layer with DefaultInitializer
+	WeightInit Initializer
+	// Start the biases at zero instead of drawing them from N(0, 0.1)
+	ZeroBias bool
+	// Custom starting weights and biases, these are copied instead of using WeightInit when set
+	// they must have the same shapes as mlp.Weights and mlp.Bias
+	InitialWeights []*mat.Dense
+	InitialBias    []*mat.Dense
+	// Seed of the random number generator used for initialisation, 0 uses the current time
+	Seed uint64
+
+	// Regularisation of the weights (not the biases), this can be "l1", "l2", "elasticnet" or "none"
+	Regularisation string
+	// Multiplies the regularisation penalty
+	Alpha float64
+	// Fraction of the elasticnet penalty that is l1, the rest is l2
+	L1Ratio float64
+	// Per layer values of Alpha, one for each layer of weights, a 0 disables the penalty for that layer
+	LayerAlpha []float64
+	// If greater than 0 the incoming weights of each unit are rescaled to have at most this l2 norm after every update
+	MaxNorm float64
+	// 0 for every weight removed by Prune and 1 for the rest, one matrix per layer of weights
+	// pruned weights stay at zero through training, including when the weights are initialised again
+	// predictions use a sparse copy of the pruned layers made when they're pruned, trained or loaded,
+	// so call Prune again after changing the Weights of a pruned network by hand
+	WeightMasks []*mat.Dense
+
+	// Stop training when the monitored metric has not improved for Patience epochs
+	// the test data is used when given, otherwise the training data
+	EarlyStopping bool
+	// Metric used for early stopping, "loss" or "accuracy"
+	Monitor string
+	// Number of epochs without improvement before stopping
+	Patience int
+	// The monitored metric has to improve by more than MinDelta to count as an improvement
+	MinDelta float64
+	// Restore the weights from the best epoch once training stops
+	RestoreBestWeights bool
+	// Fraction of the training data held out as test data when Train is called without any
+	ValidationFraction float64
+
+	// Training loss after each epoch and the metric monitored by early stopping
+	// the loss is recorded whenever the epoch metrics are calculated, see EpochMetrics, and the scores only when EarlyStopping is on
+	LossCurve        []float64
+	ValidationScores []float64
+	// Best value of the monitored metric and the epoch it happened in
+	BestValidationScore float64
+	BestEpoch           int
+
+	// Write a checkpoint to CheckpointPath every CheckpointEvery epochs and/or every CheckpointInterval, 0 disables either
+	CheckpointEvery    int
+	CheckpointInterval time.Duration
+	CheckpointPath     string
+	// Keep training the current weights when the model is already fitted instead of initialising new ones
+	WarmStart bool
+
+	// Called as training progresses, when Verbose is on a training.ProgressLogger is run before these
+	Callbacks []training.Callback
+	// Evaluate the whole training and test data after each epoch for the History and LossCurve
+	// the metrics are always calculated when Verbose, EarlyStopping or Callbacks need them, otherwise the History has no logs
+	EpochMetrics bool
+
+	// predictions are clipped to [Epsilon, 1 - Epsilon] before taking logs in cross entropy
+	// not needed after a softmax output, where the loss is calculated from the logits
+	Epsilon float64
+
+	// number of goroutines each batch is split across, 1 or less computes the gradients serially
+	// batch normalization needs the statistics of the whole batch so it can't be used with more than 1 worker
+	Workers int
+
+	// Normalization applied to each hidden layer before its activation, can be "batch", "layer" or "none"
+	Normalization string
+	// momentum of the running mean and variance kept by batch normalization
+	NormMomentum float64
+	// added to the variance to avoid dividing by zero
+	NormEpsilon float64
+
+	//learnable scale and shift of the normalization, one per hidden layer
+	Gamma []*mat.Dense
+	Beta  []*mat.Dense
+	//running statistics used by batch normalization when making predictions
+	RunningMean []*mat.Dense
+	RunningVar  []*mat.Dense
+
+	rng       *rand.Rand
+	rngSource *rand.PCGSource
+
 	//used for momentum SGD
 	weightVelocities []*mat.Dense
 	biasVelocities   []*mat.Dense
+	gammaVelocities  []*mat.Dense
+	betaVelocities   []*mat.Dense
+	layerVelocities  []*mat.Dense
+
+	//the pruned layers in CSR form for inference, built once the weights stop changing and nil while they're trained
+	sparse []*csrMatrix
+
+	//trained as part of a bigger model, its output defaults to the identity
+	joint bool
+}
+
+// gradients for every learnable parameter in the network, these are already scaled by the learning rate
+type gradients struct {
+	weights []*mat.Dense
+	bias    []*mat.Dense
+	gamma   []*mat.Dense
+	beta    []*mat.Dense
+	//parameters of mlp.Layers, in the order of layerParams
+	//the gradient of a parameter of a SparseLayer can be in sparse instead, with nil in layers
+	layers []*mat.Dense
+	sparse []*SparseGradient
+
+	//loss of the batch the gradients were calculated on, without the regularisation penalty
+	loss float64
 }
 
 func NewMultiLayerPerceptron() *MultiLayerPerceptron {
 	return &MultiLayerPerceptron{
-		Epochs:       100,
-		BatchSize:    32,
-		LearningRate: 1e-2,
-		Verbose:      true,
-		Activation:   "relu",
-		Fitted:       false,
-		Momentum:     0.9,
-		IsClassifier: true,
-		LossFunction: "crossEntropyLoss",
+		Epochs:         100,
+		BatchSize:      32,
+		LearningRate:   1e-2,
+		Verbose:        true,
+		Activation:     "relu",
+		Fitted:         false,
+		Momentum:       0.9,
+		IsClassifier:   true,
+		LossFunction:   "crossEntropyLoss",
+		Regularisation: "none",
+		Alpha:          1e-4,
+		L1Ratio:        0.5,
+		Monitor:        "loss",
+		Patience:       10,
+		MinDelta:       1e-4,
+		Epsilon:        defaultEpsilon,
+		Workers:        1,
+		Normalization:  "none",
+		NormMomentum:   0.9,
+		NormEpsilon:    1e-5,
 	}
 }
 
+// slope of the leaky ReLU for negative inputs, so units that are off still pass on some gradient
+const leakyReluSlope = 0.2
+
 // activation functions applied over a layer
 var Activate = map[string]func(x *mat.Dense){
 	"identity": func(x *mat.Dense) {},
@@ -70,31 +219,28 @@ var Activate = map[string]func(x *mat.Dense){
 			}
 		}
 	},
-	"tanh": func(x *mat.Dense) {
+	"leakyRelu": func(x *mat.Dense) {
 		rows, cols := x.Dims()
 		for i := range rows {
 			for j := range cols {
-				value := math.Tanh(x.At(i, j))
-				x.Set(i, j, value)
+				value := x.At(i, j)
+				if value < 0 {
+					x.Set(i, j, leakyReluSlope*value)
+				}
 			}
 		}
 	},
-	"softmax": func(x *mat.Dense) {
+	"tanh": func(x *mat.Dense) {
 		rows, cols := x.Dims()
-
 		for i := range rows {
-			sum := 0.0
 			for j := range cols {
-				value := math.Exp(x.At(i, j))
+				value := math.Tanh(x.At(i, j))
 				x.Set(i, j, value)
-				sum += value
-			}
-
-			for j := range cols {
-				x.Set(i, j, (x.At(i, j) / sum))
 			}
 		}
 	},
+	"softmax":    Softmax,
+	"logsoftmax": LogSoftmax,
 }
 
 var Derivative = map[string]func(x *mat.Dense){
@@ -128,45 +274,41 @@ var Derivative = map[string]func(x *mat.Dense){
 			}
 		}
 	},
-	"tanh": func(x *mat.Dense) {
+	"leakyRelu": func(x *mat.Dense) {
 		rows, cols := x.Dims()
 		for i := range rows {
 			for j := range cols {
-				value := 1 - math.Pow(math.Tanh(x.At(i, j)), 2)
-				x.Set(i, j, value)
-			}
-		}
-	},
-}
-
-var LossFunctions = map[string]func(y, h *mat.Dense) float64{
-	"MSELoss": func(y, h *mat.Dense) float64 {
-		sum := 0.0
-		var loss mat.Dense
-		loss.Sub(y, h)
-		rows, cols := loss.Dims()
-		for i := range rows {
-			for j := range cols {
-				value := loss.At(i, j)
-				sum += value * value
+				value := x.At(i, j)
+				if value > 0 {
+					x.Set(i, j, 1)
+				} else {
+					x.Set(i, j, leakyReluSlope)
+				}
 			}
 		}
-		return sum / (2 * float64(y.RawMatrix().Rows))
 	},
-	"crossEntropyLoss": func(y, h *mat.Dense) float64 {
-		sum := 0.0
-		rows, cols := y.Dims()
+	"tanh": func(x *mat.Dense) {
+		rows, cols := x.Dims()
 		for i := range rows {
 			for j := range cols {
-				if y.At(i, j) != 0 {
-					sum += -math.Log(h.At(i, j))
-				}
+				value := 1 - math.Pow(math.Tanh(x.At(i, j)), 2)
+				x.Set(i, j, value)
 			}
 		}
-		return sum / float64(rows)
 	},
 }
 
+// value of each of the Losses, for code that only needs the loss and not its gradient
+var LossFunctions = lossValues()
+
+func lossValues() map[string]func(y, h *mat.Dense) float64 {
+	values := make(map[string]func(y, h *mat.Dense) float64, len(Losses))
+	for name, loss := range Losses {
+		values[name] = loss.Value
+	}
+	return values
+}
+
 func sigmoid(z float64) float64 {
 	return 1.0 / (1.0 + math.Exp(-z))
 }
@@ -176,140 +318,499 @@ func sigmoidDerivative(z float64) float64 {
 	return s * (1 - s)
 }
 
-// Inits the weights of the biases and Weights for every neuron that follows normal distribution
-// Each layer there is a matrix containing the weights and biases, excluding the input layer
+// Inits the weights and biases for every layer, excluding the input layer
+// Each layer there is a matrix containing the weights and biases
+// The weights come from mlp.InitialWeights if given, otherwise mlp.WeightInit or the default for the layer's activation
 func (mlp *MultiLayerPerceptron) initWeights() {
 	mlp.Nlayers = len(mlp.Arch)
 	mlp.Bias = make([]*mat.Dense, mlp.Nlayers-1)
 	mlp.Weights = make([]*mat.Dense, mlp.Nlayers-1)
+	mlp.weightVelocities, mlp.biasVelocities = nil, nil
+	mlp.layerVelocities = nil
+	mlp.sparse = nil
+
+	mlp.rng, mlp.rngSource = newRNG(mlp.Seed)
+	mlp.buildLayers(mlp.rng)
+
+	if mlp.InitialWeights != nil && len(mlp.InitialWeights) != mlp.Nlayers-1 {
+		panic(fmt.Sprintf("mlp.InitialWeights has %d layers, the architecture needs %d", len(mlp.InitialWeights), mlp.Nlayers-1))
+	}
+	if mlp.InitialBias != nil && len(mlp.InitialBias) != mlp.Nlayers-1 {
+		panic(fmt.Sprintf("mlp.InitialBias has %d layers, the architecture needs %d", len(mlp.InitialBias), mlp.Nlayers-1))
+	}
 
 	for i := 1; i < len(mlp.Arch); i++ {
-		biasData := make([]float64, mlp.Arch[i])
-		for j := range biasData {
-			biasData[j] = rand.NormFloat64() * 0.1
+		fanIn, fanOut := mlp.Arch[i-1], mlp.Arch[i]
+
+		if mlp.InitialWeights != nil {
+			mlp.Weights[i-1] = copyInitial(mlp.InitialWeights[i-1], fanIn, fanOut, "weights", i-1)
+		} else {
+			init := mlp.WeightInit
+			if init == nil {
+				activation := mlp.Activation
+				if i == len(mlp.Arch)-1 {
+					activation = mlp.outputActivation()
+				}
+				init = DefaultInitializer(activation)
+			}
+			mlp.Weights[i-1] = init.Initialize(fanIn, fanOut, mlp.rng)
 		}
-		mlp.Bias[i-1] = mat.NewDense(1, mlp.Arch[i], biasData)
 
-		weightData := make([]float64, mlp.Arch[i-1]*mlp.Arch[i])
-		for j := range weightData {
-			weightData[j] = rand.NormFloat64() * 0.1
+		if mlp.InitialBias != nil {
+			mlp.Bias[i-1] = copyInitial(mlp.InitialBias[i-1], 1, fanOut, "bias", i-1)
+		} else if mlp.ZeroBias {
+			mlp.Bias[i-1] = Zeros{}.Initialize(1, fanOut, mlp.rng)
+		} else {
+			mlp.Bias[i-1] = RandomNormal{Std: 0.1}.Initialize(1, fanOut, mlp.rng)
 		}
-		mlp.Weights[i-1] = mat.NewDense(mlp.Arch[i-1], mlp.Arch[i], weightData)
+	}
+
+	mlp.initNormParams()
+	mlp.applyMasks()
+}
+
+// Creates a random number generator, the source is kept so its state can be saved in checkpoints
+// a seed of 0 uses the current time
+func newRNG(seed uint64) (*rand.Rand, *rand.PCGSource) {
+	if seed == 0 {
+		seed = uint64(time.Now().UnixNano())
+	}
+	source := &rand.PCGSource{}
+	source.Seed(seed)
+	return rand.New(source), source
+}
+
+// copies a user supplied starting matrix after checking it has the shape of the layer
+func copyInitial(m *mat.Dense, rows, cols int, name string, layer int) *mat.Dense {
+	r, c := m.Dims()
+	if r != rows || c != cols {
+		panic(fmt.Sprintf("initial %s for layer %d has shape %dx%d, expected %dx%d", name, layer, r, c, rows, cols))
+	}
+	return mat.DenseCopyOf(m)
+}
+
+// Inits the normalization parameters for each hidden layer, γ = 1 and β = 0 so the layer starts as the identity
+// The running mean and variance start at 0 and 1
+func (mlp *MultiLayerPerceptron) initNormParams() {
+	mlp.Gamma, mlp.Beta, mlp.RunningMean, mlp.RunningVar = nil, nil, nil, nil
+	mlp.gammaVelocities, mlp.betaVelocities = nil, nil
+
+	if !mlp.normalized() {
+		return
+	}
 
+	nHidden := mlp.Nlayers - 2
+	mlp.Gamma = make([]*mat.Dense, nHidden)
+	mlp.Beta = make([]*mat.Dense, nHidden)
+	mlp.RunningMean = make([]*mat.Dense, nHidden)
+	mlp.RunningVar = make([]*mat.Dense, nHidden)
+
+	for i := range nHidden {
+		units := mlp.Arch[i+1]
+		ones := make([]float64, units)
+		for j := range ones {
+			ones[j] = 1
+		}
+		mlp.Gamma[i] = mat.NewDense(1, units, ones)
+		mlp.Beta[i] = mat.NewDense(1, units, nil)
+		mlp.RunningMean[i] = mat.NewDense(1, units, nil)
+		mlp.RunningVar[i] = mat.NewDense(1, units, append([]float64(nil), ones...))
 	}
 }
 
-// Trains using SGD by splitting the data into batches
+// Trains using SGD by splitting the data into batches, the samples are shuffled at the start of every epoch
 // XTest and yTest can be nil if there is no test data for training
-func (mlp *MultiLayerPerceptron) Train(XTrain, yTrain, XTest, yTest *mat.Dense) {
-	mlp.initWeights()
+// if there is no test data and mlp.ValidationFraction > 0, a random part of the training data is held out for validation
+// Returns the history of every epoch, which has the loss and accuracy when they are calculated, see EpochMetrics
+// Returns an error if a checkpoint can't be written or a callback fails, alongside the history of the epochs completed so far
+func (mlp *MultiLayerPerceptron) Train(XTrain, yTrain, XTest, yTest *mat.Dense) (*training.History, error) {
+	return mlp.TrainContext(context.Background(), XTrain, yTrain, XTest, yTest)
+}
+
+// Train where the loss and gradient of each sample are multiplied by its weight, useful for imbalanced data
+// there must be a weight for every row of XTrain, a nil sampleWeight is the same as Train
+// the weights are combined with mlp.ClassWeight or mlp.BalancedClassWeight when they are set
+func (mlp *MultiLayerPerceptron) TrainWeighted(XTrain, yTrain *mat.Dense, sampleWeight []float64, XTest, yTest *mat.Dense) (*training.History, error) {
+	loader := NewDataLoader(NewWeightedDenseDataset(XTrain, yTrain, sampleWeight), mlp.BatchSize)
+	loader.Seed = mlp.Seed
+	loader.Prefetch = 0
+
+	var test Dataset
+	if XTest != nil || yTest != nil {
+		test = NewDenseDataset(XTest, yTest)
+	}
+
+	return mlp.TrainLoader(loader, test)
+}
 
-	//set the Activation of the output layer depending on problem type
-	if mlp.IsClassifier {
-		mlp.OutputActivation = "softmax"
-	} else if !mlp.IsClassifier {
-		mlp.OutputActivation = "identity"
+// Train that stops between batches once ctx is cancelled or its deadline passes, returning ctx.Err()
+// A cancelled network is left with the weights from the last completed batch, or the best epoch when
+// mlp.RestoreBestWeights is set, so it can still be used to make predictions
+func (mlp *MultiLayerPerceptron) TrainContext(ctx context.Context, XTrain, yTrain, XTest, yTest *mat.Dense) (*training.History, error) {
+	loader := NewDataLoader(NewDenseDataset(XTrain, yTrain), mlp.BatchSize)
+	loader.Seed = mlp.Seed
+	//the data is already in memory so there is nothing to gain from reading ahead
+	loader.Prefetch = 0
+
+	var test Dataset
+	if XTest != nil || yTest != nil {
+		test = NewDenseDataset(XTest, yTest)
 	}
 
-	testingData := true
-	if XTest == nil && yTest == nil {
-		testingData = false
+	return mlp.TrainLoaderContext(ctx, loader, test)
+}
+
+// The activation of the output layer, mlp.OutputActivation or the default for the problem type when it is empty
+// each label of a multi-label network is an independent binary problem
+func (mlp *MultiLayerPerceptron) outputActivation() string {
+	switch {
+	case mlp.OutputActivation != "":
+		return mlp.OutputActivation
+	case mlp.joint:
+		return "identity"
+	case mlp.MultiLabel:
+		return "sigmoid"
+	case mlp.IsClassifier:
+		return "softmax"
+	}
+	return "identity"
+}
+
+// Trains using SGD on the batches from the loader, the loader decides the batch size and shuffling
+// test can be nil if there is no test data for training
+// samples are weighted when the loader's dataset is a WeightedDataset
+// Returns an error if reading a batch from either dataset fails or a checkpoint can't be written
+// the history of the epochs completed so far is returned alongside an error
+func (mlp *MultiLayerPerceptron) TrainLoader(train *DataLoader, test Dataset) (*training.History, error) {
+	return mlp.TrainLoaderContext(context.Background(), train, test)
+}
+
+// TrainLoader that stops between batches once ctx is cancelled, see TrainContext
+func (mlp *MultiLayerPerceptron) TrainLoaderContext(ctx context.Context, train *DataLoader, test Dataset) (*training.History, error) {
+	//a warm start keeps training the current weights and optimizer velocities
+	if mlp.WarmStart && mlp.Fitted {
+		if mlp.rng == nil {
+			mlp.rng, mlp.rngSource = newRNG(mlp.Seed)
+		}
+	} else {
+		mlp.initWeights()
 	}
 
-	loss := LossFunctions[mlp.LossFunction]
+	progress := &trainingProgress{stopper: mlp.newEarlyStopper(), history: training.NewHistory()}
+	mlp.LossCurve = nil
+	mlp.ValidationScores = nil
 
-	nSamples, features := XTrain.Dims()
-	_, ycols := yTrain.Dims()
+	if test == nil && mlp.ValidationFraction > 0 {
+		progress.split = mlp.validationSplit(train.Dataset.Len())
+	}
 
+	return mlp.run(ctx, train, test, progress)
+}
+
+// Runs the epochs of training that are left after progress.epoch, adding them to progress.history
+// when ctx is cancelled the epoch that was running is abandoned and ctx.Err() is returned
+func (mlp *MultiLayerPerceptron) run(ctx context.Context, train *DataLoader, test Dataset, progress *trainingProgress) (*training.History, error) {
+	history := progress.history
 	t0 := time.Now()
-	t1 := time.Now()
+	//a pruned network gets its sparse weights back however training ends
+	defer mlp.buildSparse()
+
+	testingData := test != nil
+
+	if progress.split != nil {
+		//copy the loader so the caller's dataset is not replaced
+		split := *train
+		split.Dataset, test = progress.split.apply(train.Dataset)
+		train = &split
+		testingData = true
+	}
+
+	//the class weights come from the data that is actually trained on, after the validation split
+	classWeight, err := mlp.classWeights(train.Dataset, train.BatchSize)
+	if err != nil {
+		return history, err
+	}
+
+	//printing the progress is the default callback when verbose is on
+	callbacks := training.CallbackList(mlp.Callbacks)
+	if mlp.Verbose {
+		callbacks = append(training.CallbackList{training.NewProgressLogger()}, callbacks...)
+	}
+
+	if stop, err := training.Stopped(callbacks.OnTrainBegin(training.Logs{"epochs": float64(mlp.Epochs)})); stop {
+		return history, err
+	}
+
+	lastCheckpoint := time.Now()
+	stopper := progress.stopper
+	endLogs := training.Logs{}
 
-	batchSize := mlp.BatchSize
-	batchStart := 0
+	for i := progress.epoch; i < mlp.Epochs; i++ {
+		epochStart := time.Now()
 
-	for i := range mlp.Epochs {
-		for batch := 0; batch*batchSize < nSamples; batch++ {
-			batchStart = batch * batchSize
-			batchEnd := batchStart + batchSize
+		stop, err := training.Stopped(callbacks.OnEpochBegin(i, training.Logs{}))
+		if err != nil {
+			return history, err
+		}
+		if stop {
+			history.StoppedEpoch = i
+			break
+		}
 
-			if batchEnd > nSamples {
-				batchEnd = nSamples
+		iterations, stop, err := mlp.runEpoch(ctx, train, classWeight, callbacks)
+		if err != nil {
+			return history, err
+		}
+
+		//the metrics of a part of an epoch aren't worth waiting for once the context is done
+		if ctx.Err() != nil {
+			history.Iterations += iterations
+			history.StoppedEpoch = i
+			break
+		}
+		progress.epoch = i + 1
+
+		logs := training.Logs{}
+		if mlp.needEpochMetrics() {
+			logs, err = mlp.epochMetrics(train, test, testingData, classWeight)
+			if err != nil {
+				return history, err
 			}
+		}
+		history.Add(i, logs, mlp.LearningRate, iterations, time.Since(epochStart))
+
+		if mlp.EarlyStopping && stopper.record(mlp, i, logs) {
+			endLogs["stopped_epoch"] = float64(i)
+			endLogs["best_epoch"] = float64(mlp.BestEpoch)
+			stop = true
+		}
 
-			Xs := XTrain.Slice(batchStart, batchEnd, 0, features).(*mat.Dense)
-			ys := yTrain.Slice(batchStart, batchEnd, 0, ycols).(*mat.Dense)
+		callbackStop, err := training.Stopped(callbacks.OnEpochEnd(i, logs))
+		if err != nil {
+			return history, err
+		}
 
-			weightGrads, biasGrads := mlp.backprop(Xs, ys)
+		if stop || callbackStop {
+			history.StoppedEpoch = i
+			break
+		}
 
-			mlp.updateParams(weightGrads, biasGrads)
+		if mlp.checkpointDue(progress.epoch, lastCheckpoint) {
+			history.Seconds += time.Since(t0).Seconds()
+			t0 = time.Now()
+			if err := mlp.writeCheckpoint(train, progress); err != nil {
+				return history, err
+			}
+			lastCheckpoint = time.Now()
 		}
+	}
 
-		//Calculating metrics, if there is no test data then we dont include a test loss or test accuracy
-		//Printing information to screen for each epoch if verbose is true
-		if mlp.Verbose {
-			if mlp.IsClassifier && testingData {
+	if mlp.EarlyStopping && mlp.RestoreBestWeights {
+		stopper.restoreBest(mlp)
+	}
 
-				//training metrics
-				trainActivatations, _ := mlp.forwardPass(XTrain)
-				trainLoss := loss(yTrain, trainActivatations[len(trainActivatations)-1])
-				trainAccuracy := mlp.Accuracy(yTrain, trainActivatations[len(trainActivatations)-1])
-				fmt.Printf("Epoch %v, training loss: %.4f, training accuracy: %.4f%%, ", i, trainLoss, trainAccuracy)
+	//a network cancelled before its first update still has its random starting weights
+	if ctx.Err() == nil || history.Iterations > 0 {
+		mlp.Fitted = true
+	}
+	history.Seconds += time.Since(t0).Seconds()
+
+	_, err = training.Stopped(callbacks.OnTrainEnd(endLogs))
+	if err == nil {
+		err = ctx.Err()
+	}
+	return history, err
+}
 
-				//testing metrics
-				testActivations, _ := mlp.forwardPass(XTest)
-				testLoss := loss(yTest, testActivations[len(testActivations)-1])
-				testAccuracy := mlp.Accuracy(yTest, testActivations[len(testActivations)-1])
-				fmt.Printf("testing loss: %.4f, testing accuracy: %.4f%% time:%v\n", testLoss, testAccuracy, time.Since(t0))
+// Runs SGD over every batch of one epoch
+// returns the number of batches and true if a callback asked for training to stop
+// ctx is checked before every batch, the epoch ends early once it is done
+// each sample is weighted by its sample weight and the weight of its class
+func (mlp *MultiLayerPerceptron) runEpoch(ctx context.Context, train *DataLoader, classWeight []float64, callbacks training.CallbackList) (int, bool, error) {
+	batches := train.Iter()
+	defer batches.Close()
 
-			} else if mlp.IsClassifier && !testingData {
+	batch := 0
+	for ; ctx.Err() == nil && batches.Next(); batch++ {
+		Xs, ys := batches.Batch()
+		weights := batchWeights(batches.Weights(), ys, classWeight)
 
-				//train metrics
-				trainActivatations, _ := mlp.forwardPass(XTrain)
-				trainLoss := loss(yTrain, trainActivatations[len(trainActivatations)-1])
-				trainAccuracy := mlp.Accuracy(yTrain, trainActivatations[len(trainActivatations)-1])
-				fmt.Printf("Epoch %v, loss: %.4f, accuracy: %.4f%%, time:%v\n", i, trainLoss, trainAccuracy, time.Since(t0))
+		grads := mlp.batchGradients(Xs, ys, weights)
+
+		mlp.updateParams(grads)
+
+		n, _ := Xs.Dims()
+		if stop, err := training.Stopped(callbacks.OnBatchEnd(batch, training.Logs{"loss": grads.loss, "size": float64(n)})); stop {
+			return batch + 1, true, err
+		}
+	}
+
+	return batch, false, batches.Err()
+}
 
-			} else if !mlp.IsClassifier && testingData {
+// Whether the loss and metrics over the whole data have to be calculated at the end of each epoch
+func (mlp *MultiLayerPerceptron) needEpochMetrics() bool {
+	return mlp.EpochMetrics || mlp.Verbose || mlp.EarlyStopping || len(mlp.Callbacks) > 0
+}
 
-				//train metrics
-				trainActivatations, _ := mlp.forwardPass(XTrain)
-				trainLoss := loss(yTrain, trainActivatations[len(trainActivatations)-1])
-				fmt.Printf("Epoch %v, training loss: %.4f, ", i, trainLoss)
+// Calculates and records the metrics at the end of an epoch
+// if there is no test data then we dont include a test loss or test accuracy
+// the class weights only apply to the training loss, like the gradients it is calculated from
+func (mlp *MultiLayerPerceptron) epochMetrics(train *DataLoader, test Dataset, testingData bool, classWeight []float64) (training.Logs, error) {
+	logs, err := mlp.evaluate(train.Dataset, train.BatchSize, classWeight)
+	if err != nil {
+		return nil, err
+	}
+	mlp.LossCurve = append(mlp.LossCurve, logs["loss"])
 
-				//test metrics
-				testActivations, _ := mlp.forwardPass(XTest)
-				testLoss := loss(yTest, testActivations[len(testActivations)-1])
-				fmt.Printf("test loss: %.4f time:%v\n", testLoss, time.Since(t0))
+	if testingData {
+		testLogs, err := mlp.evaluate(test, train.BatchSize, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range testLogs {
+			logs["val_"+k] = v
+		}
+	}
 
-			} else if !mlp.IsClassifier && !testingData {
+	return logs, nil
+}
 
-				//train metrics
-				trainActivatations, _ := mlp.forwardPass(XTrain)
-				trainLoss := loss(yTrain, trainActivatations[len(trainActivatations)-1])
-				fmt.Printf("Epoch %v, loss: %.4f, time:%v\n", i, trainLoss, time.Since(t0))
+// Metrics of the network over a whole dataset, read in batches of batchSize
+// The loss always, the accuracy for classifiers, and for multi-label networks the accuracy is the subset accuracy
+// alongside the Hamming loss and the mean F1 score of the labels
+// The loss is weighted by the sample weights of a WeightedDataset and by classWeight if it is not nil
+func (mlp *MultiLayerPerceptron) evaluate(ds Dataset, batchSize int, classWeight []float64) (training.Logs, error) {
+	loader := &DataLoader{Dataset: ds, BatchSize: batchSize}
+	batches := loader.Iter()
+	defer batches.Close()
+
+	//the loss and accuracy are means over the samples, so weight each batch by its size
+	totalLoss, totalAccuracy := 0.0, 0.0
+	var counts labelCounts
+	for batches.Next() {
+		X, y := batches.Batch()
+		n, _ := X.Dims()
+
+		activations, zs := mlp.forwardPass(X)
+		h := activations[len(activations)-1]
+
+		weights := batchWeights(batches.Weights(), y, classWeight)
+		totalLoss += mlp.weightedOutputLoss(y, activations, zs, weights) * float64(n)
+		if mlp.MultiLabel {
+			counts.add(y, mlp.applyThresholds(h))
+		} else if mlp.IsClassifier {
+			//a single output unit is thresholded as a probability, which an identity output isn't
+			if _, cols := h.Dims(); cols == 1 {
+				h = probabilities(mat.DenseCopyOf(zs[len(zs)-1]), mlp.outputActivation(), false)
 			}
+			totalAccuracy += mlp.Accuracy(y, h) * float64(n)
 		}
+	}
+	if err := batches.Err(); err != nil {
+		return nil, err
+	}
+
+	nSamples := float64(ds.Len())
+	logs := training.Logs{"loss": totalLoss/nSamples + mlp.penalty()}
+	if mlp.MultiLabel {
+		report := counts.report()
+		logs["accuracy"] = report.SubsetAccuracy * 100
+		logs["hamming_loss"] = report.HammingLoss
+		logs["macro_f1"] = macroF1(report.F1)
+	} else if mlp.IsClassifier {
+		logs["accuracy"] = totalAccuracy / nSamples
+	}
+	return logs, nil
+}
+
+// Predictions for each sample
+// regression = the output of the network, one column per target
+// classification = column of the most probable class of each sample, the index of its output unit or its label in
+// mlp.Classes, a single output unit is a binary classifier that predicts class 1 from a probability of 0.5
+// multi-label = 0 or 1 for every label, see PredictLabels
+func (mlp *MultiLayerPerceptron) Predict(X *mat.Dense) *mat.Dense {
+	if mlp.MultiLabel {
+		return mlp.PredictLabels(X)
+	}
+	if !mlp.IsClassifier {
+		mlp.checkFitted()
+		act, _ := mlp.forwardPass(X)
+		return act[len(act)-1]
+	}
+
+	return predictClasses(mlp.PredictProba(X), mlp.Classes)
+}
 
-		t0 = time.Now()
+// column of the most probable class of each sample, or its label in classes when there are some
+func predictClasses(proba *mat.Dense, classes []float64) *mat.Dense {
+	rows, cols := proba.Dims()
+	if classes != nil && len(classes) != max(cols, 2) {
+		panic(fmt.Sprintf("Classes has %d labels for %d classes", len(classes), max(cols, 2)))
 	}
+	predicted := mat.NewDense(rows, 1, nil)
+	for i := range rows {
+		class := predictedClass(proba.RawRowView(i))
+		if classes != nil {
+			predicted.Set(i, 0, classes[class])
+		} else {
+			predicted.Set(i, 0, float64(class))
+		}
+	}
+	return predicted
+}
 
-	fmt.Println("Training finished, time taken :", time.Since(t1))
+// the class with the highest probability, a single output unit is the probability of class 1 so it is thresholded at 0.5
+func predictedClass(proba []float64) int {
+	if len(proba) == 1 {
+		if proba[0] >= 0.5 {
+			return 1
+		}
+		return 0
+	}
+	return argmax(proba)
+}
 
-	mlp.Fitted = true
+// Probability of each class for every sample of a classifier, one column per output unit
+// softmax and sigmoid outputs are already probabilities, a log softmax output is exponentiated and any other output,
+// such as the identity of a network trained with a hinge loss, goes through a softmax or a sigmoid for a single unit
+// each label of a multi-label network has its own probability
+func (mlp *MultiLayerPerceptron) PredictProba(X *mat.Dense) *mat.Dense {
+	if !mlp.IsClassifier && !mlp.MultiLabel {
+		panic("PredictProba is only for classifiers, use Predict for regression")
+	}
+	return probabilities(mlp.DecisionFunction(X), mlp.outputActivation(), mlp.MultiLabel)
+}
 
+// the probabilities of a classifier from its logits, see PredictProba
+// logits is overwritten
+func probabilities(logits *mat.Dense, output string, multiLabel bool) *mat.Dense {
+	switch output {
+	case "softmax", "logsoftmax":
+		Softmax(logits)
+	case "sigmoid":
+		Activate["sigmoid"](logits)
+	default:
+		if _, cols := logits.Dims(); cols == 1 || multiLabel {
+			Activate["sigmoid"](logits)
+		} else {
+			Softmax(logits)
+		}
+	}
+	return logits
 }
 
-// Effectively returns the final activation layer of a foward pass
-// regression = matrix with single prediction value
-// Classification task = matrix containing predicted classes
-func (mlp *MultiLayerPerceptron) Predict(X *mat.Dense) *mat.Dense {
+// Raw scores of each output unit before the output activation, the logits of a classifier
+func (mlp *MultiLayerPerceptron) DecisionFunction(X *mat.Dense) *mat.Dense {
+	mlp.checkFitted()
+	_, zs := mlp.forwardPass(X)
+	return zs[len(zs)-1]
+}
 
+func (mlp *MultiLayerPerceptron) checkFitted() {
 	if !mlp.Fitted {
 		panic("Model needs to be trained before making a prediction")
 	}
-
-	act, _ := mlp.forwardPass(X)
-	return act[len(act)-1]
 }
 
 // does a broadcast addition of biases to matrix a
@@ -327,69 +828,150 @@ func addIntercepts(a, b mat.Dense) {
 // Z^[l] = W^[l] • a^[l-1] + b^[l]
 // A^[l] = g(Z^[l])
 func (mlp *MultiLayerPerceptron) forwardPass(X *mat.Dense) ([]*mat.Dense, []*mat.Dense) {
+	activations, zs, _ := mlp.forward(X, false)
+	return activations, zs
+}
+
+// Foward pass through mlp.Layers and then the dense layers, the first activation is the output of mlp.Layers
+func (mlp *MultiLayerPerceptron) forward(X *mat.Dense, training bool) ([]*mat.Dense, []*mat.Dense, []*normCache) {
+	input, _ := mlp.layersForward(X, training)
+	return mlp.denseForward(input, training)
+}
+
+// Foward pass of the dense layers that also returns the normalization caches needed for backprop
+// When the hidden layers are normalized the zs are taken after the normalization
+// Z^[l] = γ^[l] ⊙ norm(W^[l] • a^[l-1] + b^[l]) + β^[l]
+// training decides whether batch normalization uses the batch or running statistics
+func (mlp *MultiLayerPerceptron) denseForward(X *mat.Dense, training bool) ([]*mat.Dense, []*mat.Dense, []*normCache) {
 	activations := make([]*mat.Dense, len(mlp.Weights)+1)
 	zs := make([]*mat.Dense, len(mlp.Weights))
+	caches := make([]*normCache, len(mlp.Weights))
 
 	activations[0] = X
 	activatezs := Activate[mlp.Activation]
-	activateOutput := Activate[mlp.OutputActivation]
+	activateOutput := Activate[mlp.outputActivation()]
+
+	//pruned layers multiply faster as sparse matrices, training keeps to the dense ones it updates
+	var sparse []*csrMatrix
+	if !training {
+		sparse = mlp.sparse
+	}
 
 	for i := range mlp.Nlayers - 1 {
 
-		var z mat.Dense
-		z.Mul(activations[i], mlp.Weights[i])
-		activations[i+1] = &z
+		if sparse != nil && sparse[i] != nil {
+			activations[i+1] = sparse[i].mulLeft(activations[i])
+		} else {
+			var z mat.Dense
+			z.Mul(activations[i], mlp.Weights[i])
+			activations[i+1] = &z
+		}
 		addIntercepts(*activations[i+1], *mlp.Bias[i])
 
+		outputLayer := (i + 1) == mlp.Nlayers-1
+
+		if mlp.normalized() && !outputLayer {
+			activations[i+1], caches[i] = mlp.normForward(activations[i+1], i, training)
+		}
+
 		var a mat.Dense
-		a.CloneFrom(&z)
+		a.CloneFrom(activations[i+1])
 		zs[i] = &a
 
 		//for classifiers we apply the softmax to the final layer, regression just identity
-		if (i + 1) == mlp.Nlayers-1 {
+		if outputLayer {
 			activateOutput(activations[i+1])
 		} else {
 			activatezs(activations[i+1])
 		}
 	}
 
-	return activations, zs
+	return activations, zs, caches
 }
 
 // calculate the loss gradient which will be used to update the paramaters for a specific layer
+// nSamples is the size of the whole batch, which can be more than the rows of deltas when the batch is split into shards
 // Δw = η/m Σ (δ • (a^l-1)^T)
 // Δb = η/m Σ δ
-func (mlp *MultiLayerPerceptron) calculateLossGrads(weightGrads, biasGrads, deltas []*mat.Dense, activation *mat.Dense, layer, nSamples int) {
+func (mlp *MultiLayerPerceptron) calculateLossGrads(grads *gradients, deltas []*mat.Dense, activation *mat.Dense, layer, nSamples int) {
 	var dw mat.Dense
 	dw.Mul(activation.T(), deltas[layer])
 	dw.Scale((mlp.LearningRate / float64(nSamples)), &dw)
-	weightGrads[layer] = &dw
+	grads.weights[layer] = &dw
 
-	var db *mat.Dense
-	db = RowMean(deltas[layer])
+	db := columnSums(deltas[layer])
 	db.Scale((mlp.LearningRate / float64(nSamples)), db)
-	biasGrads[layer] = db
+	grads.bias[layer] = db
 }
 
 // calculates the derivates with respect to each parameter and weight
-func (mlp *MultiLayerPerceptron) backprop(X, y *mat.Dense) ([]*mat.Dense, []*mat.Dense) {
-	//obtain the activations and zs
-	activations, zs := mlp.forwardPass(X)
+// w is the weight of each sample, nil weighs them equally
+func (mlp *MultiLayerPerceptron) backprop(X, y *mat.Dense, w []float64) *gradients {
 	nSamples, _ := X.Dims()
+	grads := mlp.shardGradients(X, y, w, nSamples)
+
+	mlp.addPenaltyGrads(grads)
+
+	return grads
+}
+
+// Calculates the gradients of the loss over a shard of a batch of nSamples
+// the gradients of every shard of a batch add up to the gradients of the whole batch, the penalty is not included
+// the error of each sample is multiplied by its weight in w, so its loss and every gradient are weighted the same
+func (mlp *MultiLayerPerceptron) shardGradients(X, y *mat.Dense, w []float64, nSamples int) *gradients {
+	//obtain the activations and zs
+	pass := mlp.trainingForward(X)
+	shardSize, _ := X.Dims()
+
+	//getting the error of the output layer (L) so we can propagate backwards
+	delta := mlp.outputDelta(y, pass.activations, pass.zs)
+	scaleRows(delta, w)
+
+	grads, _ := mlp.backpropDelta(pass, delta, nSamples, false)
+	grads.loss = mlp.weightedOutputLoss(y, pass.activations, pass.zs, w) * float64(shardSize) / float64(nSamples)
+	return grads
+}
+
+// what backprop needs to keep from a forward pass during training
+type forwardPass struct {
+	layerCaches []any
+	activations []*mat.Dense
+	zs          []*mat.Dense
+	normCaches  []*normCache
+}
+
+// Foward pass through mlp.Layers and the dense layers for training
+func (mlp *MultiLayerPerceptron) trainingForward(X *mat.Dense) *forwardPass {
+	input, layerCaches := mlp.layersForward(X, true)
+	activations, zs, caches := mlp.denseForward(input, true)
+	return &forwardPass{layerCaches: layerCaches, activations: activations, zs: zs, normCaches: caches}
+}
+
+// the output of the network for the forward pass
+func (p *forwardPass) output() *mat.Dense {
+	return p.activations[len(p.activations)-1]
+}
+
+// Propagates the error δ^L of the output layer back through the network, the pass can't be used again afterwards
+// returns the gradients of every parameter for a batch of nSamples, and when inputGrad is set the error of the input X
+// so the network can be trained as part of a bigger model, the error of X is per sample like δ^L
+func (mlp *MultiLayerPerceptron) backpropDelta(pass *forwardPass, delta *mat.Dense, nSamples int, inputGrad bool) (*gradients, *mat.Dense) {
+	activations, zs, caches := pass.activations, pass.zs, pass.normCaches
 	layer := mlp.Nlayers - 2
 	derivativeZ := Derivative[mlp.Activation]
 
-	weightGrads := make([]*mat.Dense, mlp.Nlayers-1)
-	biasGrads := make([]*mat.Dense, mlp.Nlayers-1)
+	grads := &gradients{
+		weights: make([]*mat.Dense, mlp.Nlayers-1),
+		bias:    make([]*mat.Dense, mlp.Nlayers-1),
+	}
+	if mlp.normalized() {
+		grads.gamma = make([]*mat.Dense, mlp.Nlayers-2)
+		grads.beta = make([]*mat.Dense, mlp.Nlayers-2)
+	}
 	deltas := make([]*mat.Dense, mlp.Nlayers-1)
+	deltas[layer] = delta
 
-	//getting the error of the output layer (L) so we can propagate backwards
-	// δ^L = (a^L - y)
-	var delta mat.Dense
-	delta.Sub(activations[len(activations)-1], y)
-	deltas[layer] = &delta
-
-	mlp.calculateLossGrads(weightGrads, biasGrads, deltas, activations[len(activations)-2], layer, nSamples)
+	mlp.calculateLossGrads(grads, deltas, activations[len(activations)-2], layer, nSamples)
 
 	//propagate that error backwards
 	//δ^l = ((w^l)^T) • δ^l+1) ⊙ f'(Z^L)
@@ -400,50 +982,130 @@ func (mlp *MultiLayerPerceptron) backprop(X, y *mat.Dense) ([]*mat.Dense, []*mat
 		newDelta.MulElem(&newDelta, zs[l-1])
 		deltas[l-1] = &newDelta
 
-		mlp.calculateLossGrads(weightGrads, biasGrads, deltas, activations[l-1], l-1, nSamples)
+		//the error so far is with respect to the normalized output, so also propagate through the normalization
+		// Δγ = η/m Σ (δ ⊙ x̂)
+		// Δβ = η/m Σ δ
+		if mlp.normalized() {
+			dx, dgamma, dbeta := mlp.normBackward(deltas[l-1], caches[l-1], l-1)
+			dgamma.Scale(mlp.LearningRate/float64(nSamples), dgamma)
+			dbeta.Scale(mlp.LearningRate/float64(nSamples), dbeta)
+			grads.gamma[l-1] = dgamma
+			grads.beta[l-1] = dbeta
+			deltas[l-1] = dx
+		}
+
+		mlp.calculateLossGrads(grads, deltas, activations[l-1], l-1, nSamples)
 
 	}
-	return weightGrads, biasGrads
+
+	//carry on propagating the error through mlp.Layers
+	// δX = δ^1 • (w^1)^T
+	if len(mlp.Layers) == 0 && !inputGrad {
+		return grads, nil
+	}
+	var dInput mat.Dense
+	dInput.Mul(deltas[0], mlp.Weights[0].T())
+	if len(mlp.Layers) == 0 {
+		return grads, &dInput
+	}
+	var dX *mat.Dense
+	grads.layers, grads.sparse, dX = mlp.layersBackward(&dInput, pass.layerCaches, nSamples)
+	return grads, dX
 }
 
 // updates all the weights and biases with momentum
 // w = w - Δw
-func (mlp *MultiLayerPerceptron) updateParams(weightGrads, biasGrads []*mat.Dense) {
+func (mlp *MultiLayerPerceptron) updateParams(grads *gradients) {
 	// on the first iteration we need to init the velocities to zero
 	if mlp.weightVelocities == nil {
-		mlp.weightVelocities = make([]*mat.Dense, len(weightGrads))
-		mlp.biasVelocities = make([]*mat.Dense, len(biasGrads))
-		for i := range mlp.weightVelocities {
-			r, c := weightGrads[i].Dims()
-			mlp.weightVelocities[i] = mat.NewDense(r, c, make([]float64, r*c))
+		mlp.weightVelocities = zerosLike(grads.weights)
+		mlp.biasVelocities = zerosLike(grads.bias)
+	}
+
+	for i := range len(grads.weights) {
+		momentumStep(mlp.Weights[i], mlp.weightVelocities[i], grads.weights[i], mlp.Momentum)
+		momentumStep(mlp.Bias[i], mlp.biasVelocities[i], grads.bias[i], mlp.Momentum)
+	}
+	mlp.applyMasks()
+	//the sparse weights are out of date until training finishes
+	mlp.sparse = nil
+
+	// γ and β are updated in the same way as the weights and biases
+	if mlp.normalized() {
+		if mlp.gammaVelocities == nil {
+			mlp.gammaVelocities = zerosLike(grads.gamma)
+			mlp.betaVelocities = zerosLike(grads.beta)
+		}
+
+		for i := range len(grads.gamma) {
+			momentumStep(mlp.Gamma[i], mlp.gammaVelocities[i], grads.gamma[i], mlp.Momentum)
+			momentumStep(mlp.Beta[i], mlp.betaVelocities[i], grads.beta[i], mlp.Momentum)
+		}
+	}
+
+	if len(grads.layers) > 0 {
+		params := mlp.layerParams()
+		if mlp.layerVelocities == nil {
+			mlp.layerVelocities = zerosLike(params)
 		}
-		for i := range mlp.biasVelocities {
-			r, c := biasGrads[i].Dims()
-			mlp.biasVelocities[i] = mat.NewDense(r, c, make([]float64, r*c))
+		for i, param := range params {
+			if grads.layers[i] != nil {
+				momentumStep(param, mlp.layerVelocities[i], grads.layers[i], mlp.Momentum)
+			} else {
+				sparseMomentumStep(param, mlp.layerVelocities[i], grads.sparse[i], mlp.Momentum)
+			}
 		}
 	}
 
-	for i := range len(weightGrads) {
-		//updating Weights
-		// v = beta * v - dw
-		var updateW mat.Dense
-		updateW.Scale(mlp.Momentum, mlp.weightVelocities[i])
-		updateW.Sub(&updateW, weightGrads[i])
-		mlp.weightVelocities[i].Copy(&updateW)
+	mlp.applyMaxNorm()
+}
 
-		// w = w + v
-		mlp.Weights[i].Add(mlp.Weights[i], mlp.weightVelocities[i])
+// v = beta * v - grad
+// param = param + v
+func momentumStep(param, velocity, grad *mat.Dense, momentum float64) {
+	var update mat.Dense
+	update.Scale(momentum, velocity)
+	update.Sub(&update, grad)
+	velocity.Copy(&update)
 
-		// Updating biases
-		// v = beta * v - db
-		var updateB mat.Dense
-		updateB.Scale(mlp.Momentum, mlp.biasVelocities[i])
-		updateB.Sub(&updateB, biasGrads[i])
-		mlp.biasVelocities[i].Copy(&updateB)
+	param.Add(param, velocity)
+}
+
+// momentumStep on only the rows with a gradient, the velocity of the other rows is left until they are next used
+func sparseMomentumStep(param, velocity *mat.Dense, grad *SparseGradient, momentum float64) {
+	//add up the gradients of rows that appear more than once before stepping
+	_, cols := param.Dims()
+	rowGrads := make(map[int][]float64)
+	var rows []int
+	for i, row := range grad.Rows {
+		sum, ok := rowGrads[row]
+		if !ok {
+			sum = make([]float64, cols)
+			rowGrads[row] = sum
+			rows = append(rows, row)
+		}
+		for j, value := range grad.Values.RawRowView(i) {
+			sum[j] += value
+		}
+	}
+
+	for _, row := range rows {
+		v, p := velocity.RawRowView(row), param.RawRowView(row)
+		for j, g := range rowGrads[row] {
+			v[j] = momentum*v[j] - g
+			p[j] += v[j]
+		}
+	}
+}
 
-		// b = b + v
-		mlp.Bias[i].Add(mlp.Bias[i], mlp.biasVelocities[i])
+// returns matrices of zeros with the same shapes as ms
+func zerosLike(ms []*mat.Dense) []*mat.Dense {
+	zeros := make([]*mat.Dense, len(ms))
+	for i := range ms {
+		r, c := ms[i].Dims()
+		zeros[i] = mat.NewDense(r, c, nil)
 	}
+	return zeros
 }
 
 func RowMean(m *mat.Dense) *mat.Dense {
@@ -460,13 +1122,13 @@ func RowMean(m *mat.Dense) *mat.Dense {
 }
 
 // accuracy for clasification tasks to display % of predicted correct
+// a binary classifier with a single output unit has the probability of class 1 in h and the class, 0 or 1, in y
 func (mlp *MultiLayerPerceptron) Accuracy(y, h *mat.Dense) float64 {
-	rows, _ := y.Dims()
+	rows, cols := y.Dims()
 	correct := 0.0
 	for i := range rows {
-		row := h.RawRowView(i)
-		maxIdx := argmax(row)
-		if y.At(i, maxIdx) == 1.0 {
+		class := predictedClass(h.RawRowView(i))
+		if cols == 1 && y.At(i, 0) == float64(class) || cols > 1 && y.At(i, class) == 1.0 {
 			correct++
 		}
 	}
@@ -475,7 +1137,7 @@ func (mlp *MultiLayerPerceptron) Accuracy(y, h *mat.Dense) float64 {
 
 // Function that returns index of largest value in a matrix
 func argmax(x []float64) int {
-	maxVal := 0.0
+	maxVal := math.Inf(-1)
 	maxIdx := 0
 	for i := range x {
 		value := x[i]
@@ -1,7 +1,7 @@
 package neuralnetwork
 
 import (
-	"Go-Machine-Learning/dataSets/mnist"
+	"Go-Machine-Learning/datasets/mnist"
 	"Go-Machine-Learning/preprocessing"
 	"fmt"
 
@@ -59,7 +59,10 @@ func MLPExample() {
 	mlp.IsClassifier = true
 
 	//Train the model
-	mlp.Train(XTrain, yTrain, XTest, yTest)
+	if _, err := mlp.Train(XTrain, yTrain, XTest, yTest); err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	//Make a prediciton of one of the samples
 	_, xcols := XTrain.Dims()
@@ -67,5 +70,6 @@ func MLPExample() {
 	//fmt.Printf("xPredict: %v\n", xPredict)
 	prediction := mlp.Predict(xPredict)
 	fmt.Printf("prediction: %v\n", prediction)
+	fmt.Printf("probabilities: %v\n", mat.Formatted(mlp.PredictProba(xPredict)))
 
 }
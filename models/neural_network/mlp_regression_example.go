@@ -24,5 +24,8 @@ func MLPRegressionExample() {
 	mlp.LossFunction = "MSELoss"
 	mlp.LearningRate = 0.0001
 
-	mlp.Train(X, y, nil, nil)
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		fmt.Println(err)
+		return
+	}
 }
@@ -0,0 +1,298 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/training"
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// cancels a context after a number of batches
+type cancelAfter struct {
+	training.BaseCallback
+	batches int
+	cancel  context.CancelFunc
+	seen    int
+}
+
+func (c *cancelAfter) OnBatchEnd(batch int, logs training.Logs) error {
+	c.seen++
+	if c.seen == c.batches {
+		c.cancel()
+	}
+	return nil
+}
+
+func TestTrainContextCancel(t *testing.T) {
+	mlp, X, y := gradientCheckSetup("batch")
+	mlp.Epochs = 10
+	mlp.BatchSize = 4
+	mlp.Verbose = false
+	mlp.LearningRate = 1e-2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	//2 batches per epoch, so this cancels part way through the second epoch
+	cb := &cancelAfter{batches: 3, cancel: cancel}
+	mlp.Callbacks = []training.Callback{cb}
+
+	history, err := mlp.TrainContext(ctx, X, y, nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v want context.Canceled", err)
+	}
+
+	if cb.seen != 3 {
+		t.Errorf("trained on %d batches after cancelling, want 3", cb.seen)
+	}
+	if history.Len() != 1 || history.Iterations != 3 || history.StoppedEpoch != 1 {
+		t.Errorf("history has %d epochs and %d iterations, stopped at %d, want 1, 3 and 1", history.Len(), history.Iterations, history.StoppedEpoch)
+	}
+	if !mlp.Fitted {
+		t.Fatalf("network is not fitted after training on 3 batches")
+	}
+
+	pred := mlp.PredictProba(X)
+	r, c := pred.Dims()
+	for i := range r {
+		for j := range c {
+			if math.IsNaN(pred.At(i, j)) {
+				t.Fatalf("prediction is NaN after cancelling")
+			}
+		}
+	}
+}
+
+func TestTrainContextRestoresBestWeights(t *testing.T) {
+	mlp, X, y := gradientCheckSetup("none")
+	mlp.Epochs = 10
+	mlp.BatchSize = 4
+	mlp.Verbose = false
+	mlp.EarlyStopping = true
+	mlp.RestoreBestWeights = true
+	mlp.Patience = 100
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	//cancel during the fourth epoch, after the weights have moved on from the best epoch so far
+	mlp.Callbacks = []training.Callback{&cancelAfter{batches: 7, cancel: cancel}}
+
+	if _, err := mlp.TrainContext(ctx, X, y, X, y); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v want context.Canceled", err)
+	}
+
+	logs, err := mlp.evaluate(NewDenseDataset(X, y), 8, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loss := logs["loss"]
+	if diff := loss - mlp.BestValidationScore; diff > 1e-12 || diff < -1e-12 {
+		t.Errorf("loss after cancelling %v, want the best validation loss %v", loss, mlp.BestValidationScore)
+	}
+}
+
+func TestTrainContextDeadline(t *testing.T) {
+	mlp, X, y := gradientCheckSetup("none")
+	mlp.Verbose = false
+	mlp.Fitted = false
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	history, err := mlp.TrainContext(ctx, X, y, nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v want context.DeadlineExceeded", err)
+	}
+	if history.Iterations != 0 || mlp.Fitted {
+		t.Errorf("trained for %d iterations after the deadline, fitted %v", history.Iterations, mlp.Fitted)
+	}
+
+	//the weights are still the right shape to keep training with
+	if r, c := mlp.Weights[0].Dims(); r != 4 || c != mlp.Arch[1] {
+		t.Errorf("weights are %dx%d", r, c)
+	}
+}
+
+func TestArgmaxNegative(t *testing.T) {
+	if got := argmax([]float64{-3, -1, -2}); got != 1 {
+		t.Errorf("argmax of an all negative row %d, want 1", got)
+	}
+}
+
+// fitted network with random weights and the given output, and samples to predict
+func predictSetup(arch []int, output string, classifier bool) (*MultiLayerPerceptron, *mat.Dense) {
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = arch
+	mlp.OutputActivation = output
+	mlp.IsClassifier = classifier
+	mlp.Seed = 1
+	mlp.initWeights()
+	mlp.Fitted = true
+	return mlp, randomDense(rand.New(rand.NewSource(7)), 20, arch[0])
+}
+
+func TestPredictClasses(t *testing.T) {
+	for _, output := range []string{"softmax", "logsoftmax", "identity"} {
+		t.Run(output, func(t *testing.T) {
+			mlp, X := predictSetup([]int{3, 5, 4}, output, true)
+			proba := mlp.PredictProba(X)
+			logits := mlp.DecisionFunction(X)
+			classes := mlp.Predict(X)
+
+			//every output turns into the softmax of the logits
+			want := mat.DenseCopyOf(logits)
+			Softmax(want)
+			if !mat.EqualApprox(proba, want, 1e-12) {
+				t.Errorf("probabilities\n%v\nwant the softmax of the logits\n%v", mat.Formatted(proba), mat.Formatted(want))
+			}
+			if _, cols := classes.Dims(); cols != 1 {
+				t.Fatalf("Predict returned %d columns, want one class per sample", cols)
+			}
+			for i := range 20 {
+				if got, want := classes.At(i, 0), float64(argmax(logits.RawRowView(i))); got != want {
+					t.Errorf("sample %d predicted class %v, want %v", i, got, want)
+				}
+			}
+
+			mlp.Classes = []float64{10, 20, 30, 40}
+			labels := mlp.Predict(X)
+			for i := range 20 {
+				if got, want := labels.At(i, 0), mlp.Classes[int(classes.At(i, 0))]; got != want {
+					t.Errorf("sample %d predicted label %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPredictAllNegativeLogits(t *testing.T) {
+	mlp, X := predictSetup([]int{3, 3}, "identity", true)
+	mlp.Weights[0] = mat.NewDense(3, 3, nil)
+	mlp.Bias[0] = mat.NewDense(1, 3, []float64{-5, -1, -3})
+
+	for i, class := range mat.Col(nil, 0, mlp.Predict(X)) {
+		if class != 1 {
+			t.Fatalf("sample %d predicted class %v, want 1 which has the largest logit", i, class)
+		}
+	}
+}
+
+func TestPredictBinary(t *testing.T) {
+	mlp, X := predictSetup([]int{3, 4, 1}, "sigmoid", true)
+	mlp.Classes = []float64{-1, 1}
+	proba := mlp.PredictProba(X)
+	labels := mlp.Predict(X)
+
+	for i := range 20 {
+		want := -1.0
+		if proba.At(i, 0) >= 0.5 {
+			want = 1
+		}
+		if got := labels.At(i, 0); got != want {
+			t.Errorf("sample %d with probability %v predicted %v, want %v", i, proba.At(i, 0), got, want)
+		}
+	}
+}
+
+func TestAccuracyBinary(t *testing.T) {
+	//the class is which side of a line through the origin each sample is on
+	X := randomDense(rand.New(rand.NewSource(9)), 200, 2)
+	y := mat.NewDense(200, 1, nil)
+	for i := range 200 {
+		if X.At(i, 0)+X.At(i, 1) > 0 {
+			y.Set(i, 0, 1)
+		}
+	}
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{2, 8, 1}
+	mlp.OutputActivation = "sigmoid"
+	mlp.LossFunction = "binaryCrossEntropyLoss"
+	mlp.Epochs = 30
+	mlp.LearningRate = 0.1
+	mlp.Verbose = false
+	mlp.EpochMetrics = true
+	mlp.Seed = 1
+	history, err := mlp.Train(X, y, X, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	predicted := mlp.Predict(X)
+	correct := 0.0
+	for i := range 200 {
+		if predicted.At(i, 0) == y.At(i, 0) {
+			correct++
+		}
+	}
+	want := correct / 2
+	if want < 90 {
+		t.Fatalf("predicted %v%% of the samples correctly", want)
+	}
+	if got := mlp.Accuracy(y, mlp.PredictProba(X)); got != want {
+		t.Errorf("accuracy %v%%, want %v%% like Predict", got, want)
+	}
+	accuracy := history.Metric("val_accuracy")
+	if got := accuracy[len(accuracy)-1]; math.Abs(got-want) > 1e-9 {
+		t.Errorf("val_accuracy %v%% of the last epoch, want %v%%", got, want)
+	}
+}
+
+func TestPredictRegression(t *testing.T) {
+	mlp, X := predictSetup([]int{3, 4, 2}, "identity", false)
+	if got, want := mlp.Predict(X), mlp.DecisionFunction(X); !mat.Equal(got, want) {
+		t.Errorf("regression predictions\n%v\nwant the output of the network\n%v", mat.Formatted(got), mat.Formatted(want))
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected PredictProba to panic for regression")
+		}
+	}()
+	mlp.PredictProba(X)
+}
+
+func TestPredictMultiLabel(t *testing.T) {
+	mlp, X := predictSetup([]int{3, 4, 3}, "sigmoid", false)
+	mlp.MultiLabel = true
+	if got, want := mlp.Predict(X), mlp.applyThresholds(mlp.PredictProba(X)); !mat.Equal(got, want) {
+		t.Errorf("multi-label predictions\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(want))
+	}
+}
+
+func TestPredictWrongClasses(t *testing.T) {
+	for name, classes := range map[string][]float64{"too few": {1, 2}, "too many": {1, 2, 3, 4, 5}} {
+		t.Run(name, func(t *testing.T) {
+			mlp, X := predictSetup([]int{3, 4}, "softmax", true)
+			mlp.Classes = classes
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic")
+				}
+			}()
+			mlp.Predict(X)
+		})
+	}
+}
+
+func TestSaveLoadClasses(t *testing.T) {
+	mlp, X := predictSetup([]int{3, 4}, "softmax", true)
+	mlp.Classes = []float64{3, 5, 7, 9}
+
+	var buf bytes.Buffer
+	if err := mlp.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMultiLayerPerceptron()
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.Predict(X), mlp.Predict(X); !mat.Equal(got, want) {
+		t.Errorf("loaded network predicts %v, want %v", mat.Formatted(got.T()), mat.Formatted(want.T()))
+	}
+}
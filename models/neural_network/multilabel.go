@@ -0,0 +1,137 @@
+package neuralnetwork
+
+import (
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// MultiLabelReport is how well a multi-label network predicts each set of labels
+type MultiLabelReport struct {
+	// fraction of samples where every label is right
+	SubsetAccuracy float64
+	// fraction of labels that are wrong over every sample
+	HammingLoss float64
+	// F1 score of each label, 0 for a label that is never present or predicted
+	F1 []float64
+}
+
+// the decision threshold of each output unit, mlp.Thresholds or 0.5
+func (mlp *MultiLayerPerceptron) threshold(label int) float64 {
+	if mlp.Thresholds == nil {
+		return 0.5
+	}
+	return mlp.Thresholds[label]
+}
+
+// Turns the predicted probabilities of each label into 0 or 1 using the thresholds
+func (mlp *MultiLayerPerceptron) applyThresholds(h *mat.Dense) *mat.Dense {
+	rows, cols := h.Dims()
+	if mlp.Thresholds != nil && len(mlp.Thresholds) != cols {
+		panic(fmt.Sprintf("mlp.Thresholds has %d thresholds for %d labels", len(mlp.Thresholds), cols))
+	}
+
+	labels := mat.NewDense(rows, cols, nil)
+	for i := range rows {
+		for j := range cols {
+			if h.At(i, j) >= mlp.threshold(j) {
+				labels.Set(i, j, 1)
+			}
+		}
+	}
+	return labels
+}
+
+// Predicts which labels each sample has, a matrix of 0s and 1s with a column for every label
+func (mlp *MultiLayerPerceptron) PredictLabels(X *mat.Dense) *mat.Dense {
+	return mlp.applyThresholds(mlp.PredictProba(X))
+}
+
+// Evaluates a multi-label network on X with the true labels y
+func (mlp *MultiLayerPerceptron) EvaluateMultiLabel(X, y *mat.Dense) MultiLabelReport {
+	var counts labelCounts
+	counts.add(y, mlp.PredictLabels(X))
+	return counts.report()
+}
+
+// Fraction of samples where every predicted label matches the true labels
+func SubsetAccuracy(y, pred *mat.Dense) float64 {
+	var counts labelCounts
+	counts.add(y, pred)
+	return counts.report().SubsetAccuracy
+}
+
+// Fraction of the labels of every sample that are predicted wrong
+func HammingLoss(y, pred *mat.Dense) float64 {
+	var counts labelCounts
+	counts.add(y, pred)
+	return counts.report().HammingLoss
+}
+
+// F1 score of each label, 2·tp / (2·tp + fp + fn)
+func F1PerLabel(y, pred *mat.Dense) []float64 {
+	var counts labelCounts
+	counts.add(y, pred)
+	return counts.report().F1
+}
+
+// totals of the predictions of every label, kept across batches
+type labelCounts struct {
+	samples, exact, wrongLabels float64
+	tp, fp, fn                  []float64
+}
+
+func (c *labelCounts) add(y, pred *mat.Dense) {
+	rows, cols := y.Dims()
+	if c.tp == nil {
+		c.tp = make([]float64, cols)
+		c.fp = make([]float64, cols)
+		c.fn = make([]float64, cols)
+	}
+
+	for i := range rows {
+		wrong := 0.0
+		for j := range cols {
+			actual, predicted := y.At(i, j) == 1, pred.At(i, j) == 1
+			switch {
+			case actual && predicted:
+				c.tp[j]++
+			case predicted:
+				c.fp[j]++
+				wrong++
+			case actual:
+				c.fn[j]++
+				wrong++
+			}
+		}
+		if wrong == 0 {
+			c.exact++
+		}
+		c.wrongLabels += wrong
+	}
+	c.samples += float64(rows)
+}
+
+func (c *labelCounts) report() MultiLabelReport {
+	f1 := make([]float64, len(c.tp))
+	for j := range f1 {
+		if denominator := 2*c.tp[j] + c.fp[j] + c.fn[j]; denominator > 0 {
+			f1[j] = 2 * c.tp[j] / denominator
+		}
+	}
+
+	return MultiLabelReport{
+		SubsetAccuracy: c.exact / c.samples,
+		HammingLoss:    c.wrongLabels / (c.samples * float64(len(c.tp))),
+		F1:             f1,
+	}
+}
+
+// mean of the F1 scores of every label
+func macroF1(f1 []float64) float64 {
+	total := 0.0
+	for _, score := range f1 {
+		total += score
+	}
+	return total / float64(len(f1))
+}
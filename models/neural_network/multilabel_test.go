@@ -0,0 +1,168 @@
+package neuralnetwork
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestMultiLabelMetrics(t *testing.T) {
+	y := mat.NewDense(3, 3, []float64{
+		1, 0, 1,
+		0, 1, 0,
+		1, 1, 0,
+	})
+	pred := mat.NewDense(3, 3, []float64{
+		1, 0, 1,
+		0, 0, 0,
+		1, 1, 1,
+	})
+
+	if got := SubsetAccuracy(y, pred); math.Abs(got-1.0/3) > 1e-12 {
+		t.Errorf("subset accuracy %v want 1/3", got)
+	}
+	if got := HammingLoss(y, pred); math.Abs(got-2.0/9) > 1e-12 {
+		t.Errorf("Hamming loss %v want 2/9", got)
+	}
+
+	// label 0: tp 2, label 1: tp 1 fn 1, label 2: tp 1 fp 1
+	want := []float64{1, 2.0 / 3, 2.0 / 3}
+	got := F1PerLabel(y, pred)
+	for j := range want {
+		if math.Abs(got[j]-want[j]) > 1e-12 {
+			t.Errorf("F1 %v want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestThresholds(t *testing.T) {
+	mlp := NewMultiLayerPerceptron()
+	h := mat.NewDense(2, 2, []float64{
+		0.4, 0.6,
+		0.8, 0.2,
+	})
+
+	if got := mlp.applyThresholds(h); !mat.Equal(got, mat.NewDense(2, 2, []float64{0, 1, 1, 0})) {
+		t.Errorf("default thresholds gave %v", mat.Formatted(got))
+	}
+
+	mlp.Thresholds = []float64{0.3, 0.9}
+	if got := mlp.applyThresholds(h); !mat.Equal(got, mat.NewDense(2, 2, []float64{1, 0, 1, 0})) {
+		t.Errorf("thresholds %v gave %v", mlp.Thresholds, mat.Formatted(got))
+	}
+}
+
+// each sample has a label for every one of its features that is positive
+func multiLabelData(n int, seed int64) (*mat.Dense, *mat.Dense) {
+	r := rand.New(rand.NewSource(seed))
+	X := mat.NewDense(n, 3, nil)
+	y := mat.NewDense(n, 3, nil)
+	for i := range n {
+		for j := range 3 {
+			X.Set(i, j, r.NormFloat64())
+			if X.At(i, j) > 0 {
+				y.Set(i, j, 1)
+			}
+		}
+	}
+	return X, y
+}
+
+func TestTrainMultiLabel(t *testing.T) {
+	X, y := multiLabelData(300, 1)
+	XTest, yTest := multiLabelData(100, 2)
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{3, 16, 3}
+	mlp.MultiLabel = true
+	mlp.Epochs = 60
+	mlp.LearningRate = 0.1
+	mlp.Verbose = false
+	mlp.EpochMetrics = true
+	mlp.Seed = 1
+
+	history, err := mlp.Train(X, y, XTest, yTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mlp.outputActivation() != "sigmoid" || mlp.lossFunction() != "binaryCrossEntropyLoss" {
+		t.Errorf("multi-label network trained with %s and %s", mlp.outputActivation(), mlp.lossFunction())
+	}
+	if mlp.OutputActivation != "" || mlp.LossFunction != "crossEntropyLoss" {
+		t.Errorf("training changed the config to %q and %q", mlp.OutputActivation, mlp.LossFunction)
+	}
+
+	report := mlp.EvaluateMultiLabel(XTest, yTest)
+	if report.SubsetAccuracy < 0.9 || report.HammingLoss > 0.05 {
+		t.Errorf("subset accuracy %v and Hamming loss %v", report.SubsetAccuracy, report.HammingLoss)
+	}
+	for j, f1 := range report.F1 {
+		if f1 < 0.9 {
+			t.Errorf("F1 of label %d is %v", j, f1)
+		}
+	}
+
+	last := history.Epochs[history.Len()-1].Metrics
+	if math.Abs(last["val_accuracy"]-report.SubsetAccuracy*100) > 1e-9 || last["val_hamming_loss"] != report.HammingLoss {
+		t.Errorf("epoch metrics %v do not match the report %+v", last, report)
+	}
+}
+
+func TestRetrainSingleLabel(t *testing.T) {
+	X, y := blobs(rand.New(rand.NewSource(8)), 150)
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{8, 16, 3}
+	mlp.MultiLabel = true
+	mlp.Epochs = 5
+	mlp.Verbose = false
+	mlp.Seed = 1
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	//the sigmoid outputs and binary cross entropy of the multi-label network don't stay in the config
+	mlp.MultiLabel = false
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if mlp.outputActivation() != "softmax" || mlp.lossFunction() != "crossEntropyLoss" {
+		t.Errorf("retrained with %s and %s, want softmax and crossEntropyLoss", mlp.outputActivation(), mlp.lossFunction())
+	}
+	proba := mlp.PredictProba(X)
+	for i := range 150 {
+		if sum := mat.Sum(proba.RowView(i)); math.Abs(sum-1) > 1e-9 {
+			t.Fatalf("probabilities of sample %d sum to %v", i, sum)
+		}
+	}
+}
+
+func TestMultiLabelSaveLoad(t *testing.T) {
+	mlp, X, _ := gradientCheckSetup("none")
+	mlp.MultiLabel = true
+	mlp.OutputActivation = "sigmoid"
+	mlp.Thresholds = []float64{0.2, 0.5, 0.7}
+	mlp.Fitted = true
+
+	var buf bytes.Buffer
+	if err := mlp.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMultiLayerPerceptron()
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !loaded.MultiLabel || !reflect.DeepEqual(loaded.Thresholds, mlp.Thresholds) {
+		t.Errorf("loaded multi-label %v thresholds %v", loaded.MultiLabel, loaded.Thresholds)
+	}
+	if !mat.Equal(loaded.PredictLabels(X), mlp.PredictLabels(X)) {
+		t.Errorf("loaded network predicts different labels")
+	}
+}
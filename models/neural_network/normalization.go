@@ -0,0 +1,190 @@
+package neuralnetwork
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// values saved during the forward pass of a normalization layer that are needed for the backward pass
+type normCache struct {
+	//the normalized input x̂ = (x - μ) / sqrt(σ² + ε)
+	xhat *mat.Dense
+	//1 / sqrt(σ² + ε), per column for batch normalization and per row for layer normalization
+	invStd []float64
+}
+
+// Normalizes each column (feature) of x over the batch
+// During training the batch statistics are used and the running statistics are updated,
+// during prediction the running statistics are used instead
+// x̂ = (x - μ) / sqrt(σ² + ε)
+func (mlp *MultiLayerPerceptron) batchNormForward(x *mat.Dense, layer int, training bool) (*mat.Dense, *normCache) {
+	rows, cols := x.Dims()
+	xhat := mat.NewDense(rows, cols, nil)
+	invStd := make([]float64, cols)
+
+	for j := range cols {
+		var mean, variance float64
+
+		if training {
+			for i := range rows {
+				mean += x.At(i, j)
+			}
+			mean /= float64(rows)
+
+			for i := range rows {
+				diff := x.At(i, j) - mean
+				variance += diff * diff
+			}
+			variance /= float64(rows)
+
+			// running = m * running + (1 - m) * batch
+			m := mlp.NormMomentum
+			mlp.RunningMean[layer].Set(0, j, m*mlp.RunningMean[layer].At(0, j)+(1-m)*mean)
+			mlp.RunningVar[layer].Set(0, j, m*mlp.RunningVar[layer].At(0, j)+(1-m)*variance)
+		} else {
+			mean = mlp.RunningMean[layer].At(0, j)
+			variance = mlp.RunningVar[layer].At(0, j)
+		}
+
+		invStd[j] = 1 / math.Sqrt(variance+mlp.NormEpsilon)
+		for i := range rows {
+			xhat.Set(i, j, (x.At(i, j)-mean)*invStd[j])
+		}
+	}
+
+	return xhat, &normCache{xhat: xhat, invStd: invStd}
+}
+
+// Normalizes each row (sample) of x over its features, this is the same during training and prediction
+func (mlp *MultiLayerPerceptron) layerNormForward(x *mat.Dense) (*mat.Dense, *normCache) {
+	return normalizeRows(x, mlp.NormEpsilon)
+}
+
+// x̂ = (x - μ) / sqrt(σ² + ε) with the mean and variance of each row
+func normalizeRows(x *mat.Dense, epsilon float64) (*mat.Dense, *normCache) {
+	rows, cols := x.Dims()
+	xhat := mat.NewDense(rows, cols, nil)
+	invStd := make([]float64, rows)
+
+	for i := range rows {
+		row := x.RawRowView(i)
+
+		mean := 0.0
+		for _, value := range row {
+			mean += value
+		}
+		mean /= float64(cols)
+
+		variance := 0.0
+		for _, value := range row {
+			diff := value - mean
+			variance += diff * diff
+		}
+		variance /= float64(cols)
+
+		invStd[i] = 1 / math.Sqrt(variance+epsilon)
+		for j, value := range row {
+			xhat.Set(i, j, (value-mean)*invStd[i])
+		}
+	}
+
+	return xhat, &normCache{xhat: xhat, invStd: invStd}
+}
+
+// Applies the normalization of the hidden layer followed by the learnable scale and shift
+// y = γ ⊙ x̂ + β
+func (mlp *MultiLayerPerceptron) normForward(x *mat.Dense, layer int, training bool) (*mat.Dense, *normCache) {
+	var xhat *mat.Dense
+	var cache *normCache
+
+	switch mlp.Normalization {
+	case "batch":
+		xhat, cache = mlp.batchNormForward(x, layer, training)
+	case "layer":
+		xhat, cache = mlp.layerNormForward(x)
+	default:
+		panic("mlp.Normalization must be \"batch\", \"layer\" or \"none\"")
+	}
+
+	rows, cols := xhat.Dims()
+	y := mat.NewDense(rows, cols, nil)
+	for i := range rows {
+		for j := range cols {
+			y.Set(i, j, mlp.Gamma[layer].At(0, j)*xhat.At(i, j)+mlp.Beta[layer].At(0, j))
+		}
+	}
+
+	return y, cache
+}
+
+// Backward pass of the normalization layer, dout is the gradient with respect to the output y
+// Returns the gradient with respect to the input x, and the unscaled sums for γ and β
+// ∂L/∂γ = Σ dout ⊙ x̂
+// ∂L/∂β = Σ dout
+func (mlp *MultiLayerPerceptron) normBackward(dout *mat.Dense, cache *normCache, layer int) (*mat.Dense, *mat.Dense, *mat.Dense) {
+	rows, cols := dout.Dims()
+
+	dgamma := mat.NewDense(1, cols, nil)
+	dbeta := mat.NewDense(1, cols, nil)
+	dxhat := mat.NewDense(rows, cols, nil)
+
+	for i := range rows {
+		for j := range cols {
+			d := dout.At(i, j)
+			dgamma.Set(0, j, dgamma.At(0, j)+d*cache.xhat.At(i, j))
+			dbeta.Set(0, j, dbeta.At(0, j)+d)
+			dxhat.Set(i, j, d*mlp.Gamma[layer].At(0, j))
+		}
+	}
+
+	dx := mat.NewDense(rows, cols, nil)
+
+	switch mlp.Normalization {
+	case "batch":
+		// for every column over the N samples in the batch
+		// ∂L/∂x = 1/N * invStd * (N * ∂L/∂x̂ - Σ ∂L/∂x̂ - x̂ ⊙ Σ(∂L/∂x̂ ⊙ x̂))
+		n := float64(rows)
+		for j := range cols {
+			sum, sumXhat := 0.0, 0.0
+			for i := range rows {
+				sum += dxhat.At(i, j)
+				sumXhat += dxhat.At(i, j) * cache.xhat.At(i, j)
+			}
+			for i := range rows {
+				value := cache.invStd[j] / n * (n*dxhat.At(i, j) - sum - cache.xhat.At(i, j)*sumXhat)
+				dx.Set(i, j, value)
+			}
+		}
+	case "layer":
+		dx = normalizeRowsBackward(dxhat, cache)
+	}
+
+	return dx, dgamma, dbeta
+}
+
+// gradient with respect to x of normalizeRows given the gradient with respect to x̂
+// same as batch normalization but over the D features of each row
+// ∂L/∂x = 1/D * invStd * (D * ∂L/∂x̂ - Σ ∂L/∂x̂ - x̂ ⊙ Σ(∂L/∂x̂ ⊙ x̂))
+func normalizeRowsBackward(dxhat *mat.Dense, cache *normCache) *mat.Dense {
+	rows, cols := dxhat.Dims()
+	dx := mat.NewDense(rows, cols, nil)
+	d := float64(cols)
+	for i := range rows {
+		sum, sumXhat := 0.0, 0.0
+		for j := range cols {
+			sum += dxhat.At(i, j)
+			sumXhat += dxhat.At(i, j) * cache.xhat.At(i, j)
+		}
+		for j := range cols {
+			value := cache.invStd[i] / d * (d*dxhat.At(i, j) - sum - cache.xhat.At(i, j)*sumXhat)
+			dx.Set(i, j, value)
+		}
+	}
+	return dx
+}
+
+// returns true if the hidden layers are normalized
+func (mlp *MultiLayerPerceptron) normalized() bool {
+	return mlp.Normalization != "" && mlp.Normalization != "none"
+}
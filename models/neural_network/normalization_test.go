@@ -0,0 +1,151 @@
+package neuralnetwork
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// creates a small classifier with random inputs and one hot targets that can be used for gradient checks
+func gradientCheckSetup(normalization string) (*MultiLayerPerceptron, *mat.Dense, *mat.Dense) {
+	r := rand.New(rand.NewSource(1))
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{4, 6, 5, 3}
+	mlp.Activation = "tanh"
+	mlp.OutputActivation = "softmax"
+	mlp.Normalization = normalization
+	//with a learning rate of 1 the gradients from backprop are the true gradients of the loss
+	mlp.LearningRate = 1
+	mlp.initWeights()
+
+	//move γ and β away from 1 and 0 so their gradients are tested properly
+	for i := range mlp.Gamma {
+		_, cols := mlp.Gamma[i].Dims()
+		for j := range cols {
+			mlp.Gamma[i].Set(0, j, 1+r.NormFloat64()*0.3)
+			mlp.Beta[i].Set(0, j, r.NormFloat64()*0.3)
+		}
+	}
+
+	nSamples := 8
+	X := mat.NewDense(nSamples, 4, nil)
+	y := mat.NewDense(nSamples, 3, nil)
+	for i := range nSamples {
+		for j := range 4 {
+			X.Set(i, j, r.NormFloat64())
+		}
+		y.Set(i, r.Intn(3), 1)
+	}
+
+	return mlp, X, y
+}
+
+// loss using the batch statistics plus the regularisation penalty, which is what backprop differentiates
+func trainingLoss(mlp *MultiLayerPerceptron, X, y *mat.Dense) float64 {
+	activations, zs, _ := mlp.forward(X, true)
+	return mlp.outputLoss(y, activations, zs) + mlp.penalty()
+}
+
+// compares every element of grad with a central finite difference of the loss with respect to param
+func checkGradient(t *testing.T, name string, mlp *MultiLayerPerceptron, X, y, param, grad *mat.Dense) {
+	t.Helper()
+	const h = 1e-5
+	const tol = 1e-6
+
+	rows, cols := param.Dims()
+	for i := range rows {
+		for j := range cols {
+			original := param.At(i, j)
+
+			param.Set(i, j, original+h)
+			lossPlus := trainingLoss(mlp, X, y)
+			param.Set(i, j, original-h)
+			lossMinus := trainingLoss(mlp, X, y)
+			param.Set(i, j, original)
+
+			numeric := (lossPlus - lossMinus) / (2 * h)
+			analytic := grad.At(i, j)
+
+			if math.Abs(numeric-analytic) > tol*math.Max(1, math.Abs(numeric)) {
+				t.Errorf("%s[%d][%d]: backprop gradient %v, numerical gradient %v", name, i, j, analytic, numeric)
+			}
+		}
+	}
+}
+
+func TestNormalizationGradients(t *testing.T) {
+	for _, normalization := range []string{"none", "batch", "layer"} {
+		t.Run(normalization, func(t *testing.T) {
+			mlp, X, y := gradientCheckSetup(normalization)
+			grads := mlp.backprop(X, y, nil)
+
+			for l := range mlp.Weights {
+				checkGradient(t, "weights", mlp, X, y, mlp.Weights[l], grads.weights[l])
+				checkGradient(t, "bias", mlp, X, y, mlp.Bias[l], grads.bias[l])
+			}
+			for l := range mlp.Gamma {
+				checkGradient(t, "gamma", mlp, X, y, mlp.Gamma[l], grads.gamma[l])
+				checkGradient(t, "beta", mlp, X, y, mlp.Beta[l], grads.beta[l])
+			}
+		})
+	}
+}
+
+func TestBatchNormStatistics(t *testing.T) {
+	mlp, X, _ := gradientCheckSetup("batch")
+	mlp.NormMomentum = 0
+
+	//with zero momentum the running statistics are exactly the last batch statistics
+	mlp.forward(X, true)
+
+	z := mat.NewDense(8, 6, nil)
+	z.Mul(X, mlp.Weights[0])
+	addIntercepts(*z, *mlp.Bias[0])
+
+	for j := range 6 {
+		col := mat.Col(nil, j, z)
+		mean := 0.0
+		for _, v := range col {
+			mean += v
+		}
+		mean /= float64(len(col))
+		variance := 0.0
+		for _, v := range col {
+			variance += (v - mean) * (v - mean)
+		}
+		variance /= float64(len(col))
+
+		if math.Abs(mlp.RunningMean[0].At(0, j)-mean) > 1e-12 {
+			t.Errorf("running mean %d: got %v want %v", j, mlp.RunningMean[0].At(0, j), mean)
+		}
+		if math.Abs(mlp.RunningVar[0].At(0, j)-variance) > 1e-12 {
+			t.Errorf("running variance %d: got %v want %v", j, mlp.RunningVar[0].At(0, j), variance)
+		}
+	}
+
+	//predicting uses the running statistics so it matches the training output on the same batch
+	train, _, _ := mlp.forward(X, true)
+	predict, _ := mlp.forwardPass(X)
+	if !mat.EqualApprox(train[len(train)-1], predict[len(predict)-1], 1e-4) {
+		t.Errorf("prediction with running statistics does not match the training output")
+	}
+}
+
+func TestLayerNormPerSample(t *testing.T) {
+	mlp, X, _ := gradientCheckSetup("layer")
+
+	//layer normalization only depends on the sample so predicting one row gives the same result as in a batch
+	batch, _ := mlp.forwardPass(X)
+	single, _ := mlp.forwardPass(mat.DenseCopyOf(X.Slice(2, 3, 0, 4)))
+
+	want := batch[len(batch)-1].RawRowView(2)
+	got := single[len(single)-1].RawRowView(0)
+	for j := range want {
+		if math.Abs(want[j]-got[j]) > 1e-12 {
+			t.Errorf("output %d: got %v want %v", j, got[j], want[j])
+		}
+	}
+}
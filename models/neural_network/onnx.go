@@ -0,0 +1,84 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/onnx"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Returned when exporting a network that hasn't been trained
+var ErrNotTrained = errors.New("model needs to be trained before it can be exported")
+
+// ONNX operators of the activations, the identity has no node
+var onnxActivations = map[string]string{
+	"relu":       "Relu",
+	"leakyRelu":  "LeakyRelu",
+	"sigmoid":    "Sigmoid",
+	"tanh":       "Tanh",
+	"softmax":    "Softmax",
+	"logsoftmax": "LogSoftmax",
+}
+
+// Writes the trained network as an ONNX model, so it can be served by an ONNX runtime
+// the graph has a float input "input" of N samples x mlp.Arch[0] features and an output "output" with the activations
+// of the output layer, which are what Predict returns for regression and PredictProba for softmax and sigmoid outputs
+// each dense layer is a Gemm node followed by its activation, batch normalization is folded into the weights
+// returns ErrNotTrained for a network that isn't fitted and an error for the parts of a network ONNX can't express
+func (mlp *MultiLayerPerceptron) ExportONNX(w io.Writer) error {
+	if !mlp.Fitted {
+		return ErrNotTrained
+	}
+	if len(mlp.Layers) > 0 {
+		return errors.New("only the dense layers of a network can be exported to ONNX, it has mlp.Layers")
+	}
+	if mlp.Normalization == "layer" {
+		return errors.New("layer normalization can't be exported to ONNX")
+	}
+	model, err := mlp.onnxModel()
+	if err != nil {
+		return err
+	}
+	return onnx.Write(w, model)
+}
+
+func (mlp *MultiLayerPerceptron) onnxModel() (*onnx.Model, error) {
+	model := onnx.NewModel("MultiLayerPerceptron")
+	g := &model.Graph
+	g.AddInput("input", mlp.Arch[0])
+
+	weights, bias := mlp.foldedLayers()
+	last := len(weights) - 1
+	input := "input"
+	for l := range weights {
+		activation, output := mlp.Activation, fmt.Sprintf("layer%d_output", l)
+		if l == last {
+			activation, output = mlp.outputActivation(), "output"
+		}
+
+		prefix := fmt.Sprintf("layer%d", l)
+		if activation == "identity" {
+			g.AddDense(prefix, input, output, weights[l], bias[l].RawRowView(0))
+			input = output
+			continue
+		}
+		op, ok := onnxActivations[activation]
+		if !ok {
+			return nil, fmt.Errorf("activation %q can't be exported to ONNX", activation)
+		}
+		z := prefix + "_linear"
+		g.AddDense(prefix, input, z, weights[l], bias[l].RawRowView(0))
+		switch op {
+		case "LeakyRelu":
+			g.AddNode(op, []string{z}, []string{output}, onnx.FloatAttribute("alpha", leakyReluSlope))
+		case "Softmax", "LogSoftmax":
+			g.AddNode(op, []string{z}, []string{output}, onnx.IntAttribute("axis", 1))
+		default:
+			g.AddNode(op, []string{z}, []string{output})
+		}
+		input = output
+	}
+
+	g.AddOutput("output", mlp.Arch[last+1])
+	return model, nil
+}
@@ -0,0 +1,68 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/datasets/mnist"
+	"Go-Machine-Learning/onnx"
+	"Go-Machine-Learning/preprocessing"
+	"fmt"
+	"math"
+	"os"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// MNIST classifier exported to mnist.onnx for an ONNX runtime, then read back to check it gives the same probabilities
+func ONNXExample() {
+
+	XTrain, yTrain := mnist.LoadMnistTrain()
+	XTest, yTest := mnist.LoadMnistTest()
+
+	yTrain = preprocessing.OneHotEncodeDense(10, yTrain)
+	yTest = preprocessing.OneHotEncodeDense(10, yTest)
+
+	//normalise data
+	XTrain.Scale(1.0/255, XTrain)
+	XTest.Scale(1.0/255, XTest)
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{784, 128, 10}
+	mlp.Epochs = 5
+	mlp.BatchSize = 64
+	mlp.LearningRate = 0.01
+	mlp.IsClassifier = true
+	if _, err := mlp.Train(XTrain, yTrain, XTest, yTest); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	f, err := os.Create("mnist.onnx")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer f.Close()
+	if err := mlp.ExportONNX(f); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		fmt.Println(err)
+		return
+	}
+	model, err := onnx.Read(f)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	outputs, err := model.Run(map[string]*mat.Dense{"input": XTest})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	var diff mat.Dense
+	diff.Sub(outputs["output"], mlp.PredictProba(XTest))
+	diff.Apply(func(_, _ int, v float64) float64 { return math.Abs(v) }, &diff)
+	fmt.Printf("exported %d nodes, largest difference from PredictProba %.2g\n", len(model.Graph.Nodes), mat.Max(&diff))
+
+}
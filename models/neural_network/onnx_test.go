@@ -0,0 +1,140 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/onnx"
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// exports the network, reads the file back and runs it on X
+func runExported(t *testing.T, mlp *MultiLayerPerceptron, X *mat.Dense) (*onnx.Model, *mat.Dense) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := mlp.ExportONNX(&buf); err != nil {
+		t.Fatal(err)
+	}
+	model, err := onnx.Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs, err := model.Run(map[string]*mat.Dense{"input": X})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model, outputs["output"]
+}
+
+func TestExportONNX(t *testing.T) {
+	for name, test := range map[string]struct {
+		arch       []int
+		activation string
+		output     string
+		classifier bool
+		ops        []string
+	}{
+		"softmax":    {[]int{6, 10, 8, 3}, "relu", "softmax", true, []string{"Gemm", "Relu", "Gemm", "Relu", "Gemm", "Softmax"}},
+		"sigmoid":    {[]int{6, 10, 1}, "leakyRelu", "sigmoid", true, []string{"Gemm", "LeakyRelu", "Gemm", "Sigmoid"}},
+		"regression": {[]int{6, 10, 2}, "sigmoid", "identity", false, []string{"Gemm", "Sigmoid", "Gemm"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mlp, X := predictSetup(test.arch, test.output, test.classifier)
+			mlp.Activation = test.activation
+			model, got := runExported(t, mlp, X)
+
+			var ops []string
+			for _, n := range model.Graph.Nodes {
+				ops = append(ops, n.OpType)
+			}
+			if !reflect.DeepEqual(ops, test.ops) {
+				t.Errorf("nodes %v, want %v", ops, test.ops)
+			}
+			in, out := model.Graph.Inputs[0], model.Graph.Outputs[0]
+			if in.Name != "input" || in.Shape[1].Value != int64(test.arch[0]) || out.Name != "output" || out.Shape[1].Value != int64(test.arch[len(test.arch)-1]) {
+				t.Errorf("graph input %+v and output %+v", in, out)
+			}
+
+			//the parameters are float32 so the outputs only agree to about 7 digits
+			activations, _ := mlp.forwardPass(X)
+			if want := activations[len(activations)-1]; !mat.EqualApprox(got, want, 1e-5) {
+				t.Errorf("exported network gives\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(want))
+			}
+		})
+	}
+}
+
+func TestExportONNXMatchesPredictions(t *testing.T) {
+	for _, normalization := range []string{"none", "batch"} {
+		t.Run(normalization, func(t *testing.T) {
+			mlp, X, _ := trainedClassifier(t, normalization)
+			mlp.Prune(0.5, "global")
+			_, got := runExported(t, mlp, X)
+
+			want := mlp.PredictProba(X)
+			if !mat.EqualApprox(got, want, 1e-5) {
+				t.Errorf("exported network gives\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(want))
+			}
+			if !mat.Equal(predictClasses(got, nil), mlp.Predict(X)) {
+				t.Errorf("exported network predicts different classes")
+			}
+		})
+	}
+}
+
+func TestExportONNXLogSoftmax(t *testing.T) {
+	X, y := blobs(rand.New(rand.NewSource(8)), 300)
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{8, 16, 3}
+	mlp.Activation = "tanh"
+	mlp.OutputActivation = "logsoftmax"
+	mlp.Epochs = 10
+	mlp.BatchSize = 16
+	mlp.Verbose = false
+	mlp.Seed = 1
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	model, got := runExported(t, mlp, X)
+	if last := model.Graph.Nodes[len(model.Graph.Nodes)-1]; last.OpType != "LogSoftmax" {
+		t.Errorf("last node %s want LogSoftmax", last.OpType)
+	}
+
+	//the exported network outputs log probabilities
+	got.Apply(func(_, _ int, v float64) float64 { return math.Exp(v) }, got)
+	if want := mlp.PredictProba(X); !mat.EqualApprox(got, want, 1e-5) {
+		t.Errorf("probabilities of the exported network\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(want))
+	}
+}
+
+func TestExportONNXBadConfig(t *testing.T) {
+	for name, export := range map[string]func(mlp *MultiLayerPerceptron){
+		"not fitted": func(mlp *MultiLayerPerceptron) { mlp.Fitted = false },
+		"layers":     func(mlp *MultiLayerPerceptron) { mlp.Layers = []Layer{NewFlatten()} },
+		"layer norm": func(mlp *MultiLayerPerceptron) { mlp.Normalization = "layer" },
+		"activation": func(mlp *MultiLayerPerceptron) { mlp.Activation = "swish" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			mlp, _ := predictSetup([]int{3, 4, 2}, "softmax", true)
+			export(mlp)
+
+			var buf bytes.Buffer
+			err := mlp.ExportONNX(&buf)
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if name == "not fitted" && !errors.Is(err, ErrNotTrained) {
+				t.Errorf("got error %v want %v", err, ErrNotTrained)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("wrote %d bytes of a network that can't be exported", buf.Len())
+			}
+		})
+	}
+}
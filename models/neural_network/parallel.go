@@ -0,0 +1,103 @@
+package neuralnetwork
+
+import (
+	"sync"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Calculates the gradients of a batch, split across mlp.Workers goroutines when there is more than one
+// w is the weight of each sample, nil if the batch is unweighted
+func (mlp *MultiLayerPerceptron) batchGradients(X, y *mat.Dense, w []float64) *gradients {
+	nSamples, _ := X.Dims()
+	if mlp.Workers > 1 && mlp.Normalization == "batch" {
+		panic("mlp.Workers must be 1 with batch normalization, the shards would each be normalised by their own statistics")
+	}
+	if mlp.Workers <= 1 || nSamples < 2 {
+		return mlp.backprop(X, y, w)
+	}
+	return mlp.parallelBackprop(X, y, w, min(mlp.Workers, nSamples))
+}
+
+// Splits the batch into shards of consecutive rows and runs the forward and backward pass of each shard
+// in its own goroutine, then adds up the gradients of the shards before a single optimizer step
+// Every shard reads the same weights, which are not changed until all of the shards have finished
+// The gradients are added in shard order so training is repeatable for a given number of workers
+func (mlp *MultiLayerPerceptron) parallelBackprop(X, y *mat.Dense, w []float64, shards int) *gradients {
+	nSamples, nFeatures := X.Dims()
+	_, nOutputs := y.Dims()
+
+	results := make([]*gradients, shards)
+	var wg sync.WaitGroup
+	for s := range shards {
+		start, end := s*nSamples/shards, (s+1)*nSamples/shards
+		XShard := X.Slice(start, end, 0, nFeatures).(*mat.Dense)
+		yShard := y.Slice(start, end, 0, nOutputs).(*mat.Dense)
+		var wShard []float64
+		if w != nil {
+			wShard = w[start:end]
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[s] = mlp.shardGradients(XShard, yShard, wShard, nSamples)
+		}()
+	}
+	wg.Wait()
+
+	grads := results[0]
+	for _, shard := range results[1:] {
+		grads.add(shard)
+	}
+
+	mlp.addPenaltyGrads(grads)
+
+	return grads
+}
+
+// adds the gradients of another shard of the same batch
+func (g *gradients) add(other *gradients) {
+	for _, params := range []struct{ dst, src []*mat.Dense }{
+		{g.weights, other.weights},
+		{g.bias, other.bias},
+		{g.gamma, other.gamma},
+		{g.beta, other.beta},
+		{g.layers, other.layers},
+	} {
+		for i := range params.dst {
+			if params.dst[i] != nil {
+				params.dst[i].Add(params.dst[i], params.src[i])
+			}
+		}
+	}
+
+	//the rows of sparse gradients are put together, rows in both shards are added when the update is made
+	for i, sparse := range g.sparse {
+		switch {
+		case sparse == nil || len(other.sparse[i].Rows) == 0:
+		case len(sparse.Rows) == 0:
+			g.sparse[i] = other.sparse[i]
+		default:
+			var values mat.Dense
+			values.Stack(sparse.Values, other.sparse[i].Values)
+			sparse.Rows = append(sparse.Rows, other.sparse[i].Rows...)
+			sparse.Values = &values
+		}
+	}
+	g.loss += other.loss
+}
+
+// sums each column of m into a row vector
+func columnSums(m *mat.Dense) *mat.Dense {
+	rows, cols := m.Dims()
+	sums := mat.NewDense(1, cols, nil)
+	for j := range cols {
+		sum := 0.0
+		for i := range rows {
+			sum += m.At(i, j)
+		}
+		sums.Set(0, j, sum)
+	}
+	return sums
+}
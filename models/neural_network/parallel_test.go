@@ -0,0 +1,108 @@
+package neuralnetwork
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func equalWithin(t *testing.T, name string, want, got []*mat.Dense, tol float64) {
+	t.Helper()
+	for i := range want {
+		if !mat.EqualApprox(want[i], got[i], tol) {
+			t.Errorf("%s %d differs:\nwant %v\ngot  %v", name, i, mat.Formatted(want[i]), mat.Formatted(got[i]))
+		}
+	}
+}
+
+func TestParallelBackpropMatchesSerial(t *testing.T) {
+	for _, normalization := range []string{"none", "layer"} {
+		for _, shards := range []int{2, 3, 8} {
+			t.Run(fmt.Sprintf("%s/%d", normalization, shards), func(t *testing.T) {
+				mlp, X, y := gradientCheckSetup(normalization)
+				mlp.Regularisation = "l2"
+				mlp.Alpha = 0.1
+
+				serial := mlp.backprop(X, y, nil)
+				parallel := mlp.parallelBackprop(X, y, nil, shards)
+
+				equalWithin(t, "weights", serial.weights, parallel.weights, 1e-12)
+				equalWithin(t, "bias", serial.bias, parallel.bias, 1e-12)
+				equalWithin(t, "gamma", serial.gamma, parallel.gamma, 1e-12)
+				equalWithin(t, "beta", serial.beta, parallel.beta, 1e-12)
+				if math.Abs(serial.loss-parallel.loss) > 1e-12 {
+					t.Errorf("loss %v want %v", parallel.loss, serial.loss)
+				}
+			})
+		}
+	}
+}
+
+func TestTrainWorkersMatchesSerial(t *testing.T) {
+	_, X, y := gradientCheckSetup("none")
+
+	train := func(workers int) *MultiLayerPerceptron {
+		mlp := NewMultiLayerPerceptron()
+		mlp.Arch = []int{4, 6, 3}
+		mlp.Epochs = 20
+		mlp.BatchSize = 4
+		mlp.Verbose = false
+		mlp.Seed = 7
+		mlp.Workers = workers
+		if _, err := mlp.Train(X, y, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		return mlp
+	}
+
+	serial := train(1)
+	parallel := train(4)
+
+	equalWithin(t, "weights", serial.Weights, parallel.Weights, 1e-9)
+	equalWithin(t, "bias", serial.Bias, parallel.Bias, 1e-9)
+}
+
+func TestWorkersRejectBatchNorm(t *testing.T) {
+	mlp, X, y := gradientCheckSetup("batch")
+	mlp.Workers = 2
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic")
+		}
+	}()
+	mlp.batchGradients(X, y, nil)
+}
+
+// times the gradients of one batch, without the rest of an epoch such as shuffling and the end of epoch metrics
+func BenchmarkBatchGradientsWorkers(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	batchSize, nFeatures, nClasses := 256, 64, 10
+	X := mat.NewDense(batchSize, nFeatures, nil)
+	y := mat.NewDense(batchSize, nClasses, nil)
+	for i := range batchSize {
+		for j := range nFeatures {
+			X.Set(i, j, r.NormFloat64())
+		}
+		y.Set(i, r.Intn(nClasses), 1)
+	}
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			mlp := NewMultiLayerPerceptron()
+			mlp.Arch = []int{nFeatures, 256, 256, nClasses}
+			mlp.OutputActivation = "softmax"
+			mlp.Seed = 1
+			mlp.Workers = workers
+			mlp.initWeights()
+
+			b.ResetTimer()
+			for range b.N {
+				mlp.batchGradients(X, y, nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package neuralnetwork
+
+import (
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Max pooling over each channel of images stored channels first, Shape{channels, height, width}
+// each Size x Size window is replaced by its largest value
+type MaxPool2D struct {
+	Size int
+	// step between windows, Size if 0 so the windows don't overlap
+	Stride int
+
+	window window
+}
+
+func NewMaxPool2D(size int) *MaxPool2D {
+	return &MaxPool2D{Size: size}
+}
+
+// what MaxPool2D.Backward needs from the forward pass
+type maxPoolCache struct {
+	//index of the largest value within the unrolled window of each output
+	argmax []int
+}
+
+func (l *MaxPool2D) Build(input Shape, rng *rand.Rand) Shape {
+	l.window = newPoolWindow("MaxPool2D", input, l.Size, l.Stride)
+	return Shape{l.window.channels, l.window.outHeight, l.window.outWidth}
+}
+
+func (l *MaxPool2D) Forward(X *mat.Dense, training bool) (*mat.Dense, any) {
+	n, _ := X.Dims()
+	cols := l.window.im2col(X)
+	k := l.Size * l.Size
+
+	pooled := mat.NewDense(n*l.window.positions(), l.window.channels, nil)
+	rows, _ := cols.Dims()
+	argmax := make([]int, rows*l.window.channels)
+	for i := range rows {
+		row := cols.RawRowView(i)
+		for c := range l.window.channels {
+			best := c * k
+			for j := best + 1; j < (c+1)*k; j++ {
+				if row[j] > row[best] {
+					best = j
+				}
+			}
+			pooled.Set(i, c, row[best])
+			argmax[i*l.window.channels+c] = best
+		}
+	}
+
+	return l.window.channelsFirst(pooled, n), &maxPoolCache{argmax: argmax}
+}
+
+// the gradient only flows back to the largest value of each window
+func (l *MaxPool2D) Backward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense) {
+	argmax := cache.(*maxPoolCache).argmax
+	n, _ := grad.Dims()
+	dpooled := l.window.channelsLast(grad, n, l.window.channels)
+
+	rows, _ := dpooled.Dims()
+	dcols := mat.NewDense(rows, l.window.windowSize(), nil)
+	for i := range rows {
+		for c, g := range dpooled.RawRowView(i) {
+			dcols.Set(i, argmax[i*l.window.channels+c], g)
+		}
+	}
+
+	return l.window.col2im(dcols, n), nil
+}
+
+func (l *MaxPool2D) Params() []*mat.Dense {
+	return nil
+}
+
+// Average pooling over each channel of images stored channels first, Shape{channels, height, width}
+// each Size x Size window is replaced by its mean
+type AvgPool2D struct {
+	Size int
+	// step between windows, Size if 0 so the windows don't overlap
+	Stride int
+
+	window window
+}
+
+func NewAvgPool2D(size int) *AvgPool2D {
+	return &AvgPool2D{Size: size}
+}
+
+func (l *AvgPool2D) Build(input Shape, rng *rand.Rand) Shape {
+	l.window = newPoolWindow("AvgPool2D", input, l.Size, l.Stride)
+	return Shape{l.window.channels, l.window.outHeight, l.window.outWidth}
+}
+
+func (l *AvgPool2D) Forward(X *mat.Dense, training bool) (*mat.Dense, any) {
+	n, _ := X.Dims()
+	cols := l.window.im2col(X)
+	k := l.Size * l.Size
+
+	rows, _ := cols.Dims()
+	pooled := mat.NewDense(rows, l.window.channels, nil)
+	for i := range rows {
+		row := cols.RawRowView(i)
+		for c := range l.window.channels {
+			sum := 0.0
+			for _, value := range row[c*k : (c+1)*k] {
+				sum += value
+			}
+			pooled.Set(i, c, sum/float64(k))
+		}
+	}
+
+	return l.window.channelsFirst(pooled, n), nil
+}
+
+// every value of a window gets an equal share of the gradient of its mean
+func (l *AvgPool2D) Backward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense) {
+	n, _ := grad.Dims()
+	dpooled := l.window.channelsLast(grad, n, l.window.channels)
+	k := l.Size * l.Size
+
+	rows, _ := dpooled.Dims()
+	dcols := mat.NewDense(rows, l.window.windowSize(), nil)
+	for i := range rows {
+		row := dcols.RawRowView(i)
+		for c, g := range dpooled.RawRowView(i) {
+			for j := c * k; j < (c+1)*k; j++ {
+				row[j] = g / float64(k)
+			}
+		}
+	}
+
+	return l.window.col2im(dcols, n), nil
+}
+
+func (l *AvgPool2D) Params() []*mat.Dense {
+	return nil
+}
+
+// the window of a pooling layer, which has no padding or dilation
+func newPoolWindow(layer string, input Shape, size, stride int) window {
+	if stride == 0 {
+		stride = size
+	}
+	return newWindow(layer, input, size, stride, 0, 1)
+}
+
+// Flatten turns any input shape into a vector, e.g. the images from a convolution into the input of the dense layers
+// samples are always stored as flattened rows so only the shape changes
+type Flatten struct{}
+
+func NewFlatten() *Flatten {
+	return &Flatten{}
+}
+
+func (l *Flatten) Build(input Shape, rng *rand.Rand) Shape {
+	return Shape{input.Size()}
+}
+
+func (l *Flatten) Forward(X *mat.Dense, training bool) (*mat.Dense, any) {
+	return X, nil
+}
+
+func (l *Flatten) Backward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense) {
+	return grad, nil
+}
+
+func (l *Flatten) Params() []*mat.Dense {
+	return nil
+}
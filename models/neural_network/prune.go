@@ -0,0 +1,208 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/training"
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// layers of weights with at least this fraction pruned use the sparse multiply in inference
+const sparseInferenceSparsity = 0.75
+
+// Sets the fraction sparsity of the dense weights with the smallest magnitudes to zero and keeps them there
+// scope "global" ranks the weights of every layer together, so layers with many small weights lose more, and
+// "layerwise" prunes the same fraction of each layer
+// the pruned weights are recorded in mlp.WeightMasks, weights that are already pruned stay pruned
+func (mlp *MultiLayerPerceptron) Prune(sparsity float64, scope string) {
+	if sparsity < 0 || sparsity >= 1 {
+		panic(fmt.Sprintf("pruning sparsity %v must be in [0, 1)", sparsity))
+	}
+	if len(mlp.Weights) == 0 {
+		panic("the network has no weights to prune, it needs to be trained first")
+	}
+	if mlp.WeightMasks == nil {
+		mlp.WeightMasks = make([]*mat.Dense, len(mlp.Weights))
+		for i, w := range mlp.Weights {
+			rows, cols := w.Dims()
+			mlp.WeightMasks[i] = mat.NewDense(rows, cols, nil)
+			mlp.WeightMasks[i].Apply(func(_, _ int, _ float64) float64 { return 1 }, mlp.WeightMasks[i])
+		}
+	}
+
+	switch scope {
+	case "global":
+		pruneSmallest(mlp.Weights, mlp.WeightMasks, sparsity)
+	case "layerwise":
+		for i := range mlp.Weights {
+			pruneSmallest(mlp.Weights[i:i+1], mlp.WeightMasks[i:i+1], sparsity)
+		}
+	default:
+		panic(fmt.Sprintf("pruning scope %q is not global or layerwise", scope))
+	}
+	mlp.applyMasks()
+	mlp.buildSparse()
+}
+
+// masks the fraction sparsity of the weights across all of weights with the smallest magnitudes
+// pruned weights are 0 so they're ranked first and are pruned again
+func pruneSmallest(weights, masks []*mat.Dense, sparsity float64) {
+	type position struct{ layer, row, col int }
+	var positions []position
+	var magnitudes []float64
+	for l, w := range weights {
+		rows, cols := w.Dims()
+		for i := range rows {
+			for j := range cols {
+				positions = append(positions, position{l, i, j})
+				magnitudes = append(magnitudes, math.Abs(w.At(i, j)*masks[l].At(i, j)))
+			}
+		}
+	}
+
+	order := make([]int, len(positions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return magnitudes[order[a]] < magnitudes[order[b]] })
+
+	for _, k := range order[:int(sparsity*float64(len(order)))] {
+		p := positions[k]
+		masks[p.layer].Set(p.row, p.col, 0)
+	}
+}
+
+// zeros the pruned weights and their velocities so momentum can't bring them back
+func (mlp *MultiLayerPerceptron) applyMasks() {
+	if mlp.WeightMasks == nil {
+		return
+	}
+	if len(mlp.WeightMasks) != len(mlp.Weights) {
+		panic(fmt.Sprintf("mlp.WeightMasks has %d layers, the network has %d", len(mlp.WeightMasks), len(mlp.Weights)))
+	}
+	for i, mask := range mlp.WeightMasks {
+		if r, c := mask.Dims(); r != mlp.Arch[i] || c != mlp.Arch[i+1] {
+			panic(fmt.Sprintf("mlp.WeightMasks[%d] is %dx%d, the weights are %dx%d", i, r, c, mlp.Arch[i], mlp.Arch[i+1]))
+		}
+		mlp.Weights[i].MulElem(mlp.Weights[i], mask)
+		if mlp.weightVelocities != nil {
+			mlp.weightVelocities[i].MulElem(mlp.weightVelocities[i], mask)
+		}
+	}
+}
+
+// Prunes to sparsity in steps, training for epochs on the training data after each step so the network can recover
+// the sparsity after step t of n follows s (1 - (1 - t/n)³), pruning most while there are many redundant weights
+// returns the history of the fine tuning after each step, or the first error from Train with the histories so far
+func (mlp *MultiLayerPerceptron) PruneAndFinetune(XTrain, yTrain, XTest, yTest *mat.Dense, sparsity float64, scope string, steps, epochs int) ([]*training.History, error) {
+	if steps < 1 || epochs < 0 {
+		panic("pruning needs at least 1 step and epochs can't be negative")
+	}
+
+	warmStart, totalEpochs := mlp.WarmStart, mlp.Epochs
+	defer func() { mlp.WarmStart, mlp.Epochs = warmStart, totalEpochs }()
+	mlp.WarmStart, mlp.Epochs = true, epochs
+
+	histories := make([]*training.History, 0, steps)
+	for t := 1; t <= steps; t++ {
+		mlp.Prune(sparsity*(1-math.Pow(1-float64(t)/float64(steps), 3)), scope)
+		if epochs > 0 {
+			history, err := mlp.Train(XTrain, yTrain, XTest, yTest)
+			histories = append(histories, history)
+			if err != nil {
+				return histories, err
+			}
+		}
+	}
+	return histories, nil
+}
+
+// Fraction of the dense weights that are zero, over the whole network and for each layer
+func (mlp *MultiLayerPerceptron) Sparsity() (float64, []float64) {
+	layers := make([]float64, len(mlp.Weights))
+	zeros, total := 0, 0
+	for i, w := range mlp.Weights {
+		rows, cols := w.Dims()
+		layerZeros := 0
+		for r := range rows {
+			for _, v := range w.RawRowView(r) {
+				if v == 0 {
+					layerZeros++
+				}
+			}
+		}
+		layers[i] = float64(layerZeros) / float64(rows*cols)
+		zeros += layerZeros
+		total += rows * cols
+	}
+	if total == 0 {
+		return 0, layers
+	}
+	return float64(zeros) / float64(total), layers
+}
+
+// csrMatrix holds the non zero values of a matrix row by row, compressed sparse row format
+// the values of row i are values[indptr[i]:indptr[i+1]] in the columns indices[indptr[i]:indptr[i+1]]
+type csrMatrix struct {
+	rows, cols int
+	indptr     []int
+	indices    []int
+	values     []float64
+}
+
+func newCSR(m *mat.Dense) *csrMatrix {
+	rows, cols := m.Dims()
+	csr := &csrMatrix{rows: rows, cols: cols, indptr: make([]int, rows+1)}
+	for i := range rows {
+		for j, v := range m.RawRowView(i) {
+			if v != 0 {
+				csr.indices = append(csr.indices, j)
+				csr.values = append(csr.values, v)
+			}
+		}
+		csr.indptr[i+1] = len(csr.values)
+	}
+	return csr
+}
+
+func (csr *csrMatrix) density() float64 {
+	return float64(len(csr.values)) / float64(csr.rows*csr.cols)
+}
+
+// X • csr, skipping the zeros of X too, which are common after a ReLU
+func (csr *csrMatrix) mulLeft(X *mat.Dense) *mat.Dense {
+	n, _ := X.Dims()
+	out := mat.NewDense(n, csr.cols, nil)
+	for s := range n {
+		row := out.RawRowView(s)
+		for i, x := range X.RawRowView(s) {
+			if x == 0 {
+				continue
+			}
+			start, end := csr.indptr[i], csr.indptr[i+1]
+			values := csr.values[start:end]
+			for k, j := range csr.indices[start:end] {
+				row[j] += x * values[k]
+			}
+		}
+	}
+	return out
+}
+
+// Converts the weights of each layer that is sparse enough to multiply faster in CSR form, nil for the others
+// only pruned networks are checked, the others are dense
+// it is built once when the weights are pruned, loaded or trained so predictions don't convert them every time
+func (mlp *MultiLayerPerceptron) buildSparse() {
+	mlp.sparse = nil
+	if mlp.WeightMasks == nil {
+		return
+	}
+	mlp.sparse = make([]*csrMatrix, len(mlp.Weights))
+	for i, w := range mlp.Weights {
+		if csr := newCSR(w); csr.density() <= 1-sparseInferenceSparsity {
+			mlp.sparse[i] = csr
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package neuralnetwork
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// smallest magnitude of the weights kept by each mask and largest of the weights it removed, from the weights before
+// pruning
+func prunedMagnitudes(before, masks []*mat.Dense) (float64, float64) {
+	smallestKept, largestPruned := math.Inf(1), 0.0
+	for l := range before {
+		rows, cols := before[l].Dims()
+		for i := range rows {
+			for j := range cols {
+				magnitude := math.Abs(before[l].At(i, j))
+				if masks[l].At(i, j) == 0 {
+					largestPruned = math.Max(largestPruned, magnitude)
+				} else {
+					smallestKept = math.Min(smallestKept, magnitude)
+				}
+			}
+		}
+	}
+	return smallestKept, largestPruned
+}
+
+func copyWeights(weights []*mat.Dense) []*mat.Dense {
+	copies := make([]*mat.Dense, len(weights))
+	for i, w := range weights {
+		copies[i] = mat.DenseCopyOf(w)
+	}
+	return copies
+}
+
+func TestPruneLayerwise(t *testing.T) {
+	mlp, _ := predictSetup([]int{6, 10, 8, 3}, "softmax", true)
+	before := copyWeights(mlp.Weights)
+	mlp.Prune(0.7, "layerwise")
+
+	_, layers := mlp.Sparsity()
+	for l, sparsity := range layers {
+		size := mlp.Arch[l] * mlp.Arch[l+1]
+		if want := float64(int(0.7*float64(size))) / float64(size); sparsity != want {
+			t.Errorf("layer %d sparsity %v, want %v", l, sparsity, want)
+		}
+		kept, pruned := prunedMagnitudes(before[l:l+1], mlp.WeightMasks[l:l+1])
+		if kept < pruned {
+			t.Errorf("layer %d kept a weight of %v and pruned one of %v", l, kept, pruned)
+		}
+	}
+}
+
+func TestPruneGlobal(t *testing.T) {
+	mlp, _ := predictSetup([]int{6, 10, 8, 3}, "softmax", true)
+	mlp.Weights[1].Scale(10, mlp.Weights[1])
+	before := copyWeights(mlp.Weights)
+	mlp.Prune(0.5, "global")
+
+	sparsity, layers := mlp.Sparsity()
+	if want := float64(int(0.5*138)) / 138; sparsity != want {
+		t.Errorf("sparsity %v, want %v", sparsity, want)
+	}
+	if layers[1] >= layers[0] || layers[1] >= layers[2] {
+		t.Errorf("layer sparsities %v, the layer with the biggest weights should lose the fewest", layers)
+	}
+	if kept, pruned := prunedMagnitudes(before, mlp.WeightMasks); kept < pruned {
+		t.Errorf("kept a weight of %v and pruned one of %v", kept, pruned)
+	}
+}
+
+func TestPruneKeepsPrunedWeights(t *testing.T) {
+	mlp, _ := predictSetup([]int{6, 10, 3}, "softmax", true)
+	mlp.Prune(0.5, "global")
+	masks := copyWeights(mlp.WeightMasks)
+
+	//a lower target doesn't bring weights back
+	mlp.Prune(0.2, "global")
+	for l := range masks {
+		if !mat.Equal(mlp.WeightMasks[l], masks[l]) {
+			t.Errorf("layer %d mask changed when pruning less", l)
+		}
+	}
+	mlp.Prune(0.8, "global")
+	if sparsity, _ := mlp.Sparsity(); math.Abs(sparsity-0.8) > 0.01 {
+		t.Errorf("sparsity %v after pruning more, want 0.8", sparsity)
+	}
+}
+
+func TestTrainingRespectsMasks(t *testing.T) {
+	mlp, X, y := trainedClassifier(t, "none")
+	mlp.Prune(0.6, "layerwise")
+	before := copyWeights(mlp.Weights)
+
+	mlp.WarmStart = true
+	mlp.Epochs = 3
+	mlp.Workers = 2
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := false
+	for l, w := range mlp.Weights {
+		rows, cols := w.Dims()
+		for i := range rows {
+			for j := range cols {
+				if mlp.WeightMasks[l].At(i, j) == 0 && w.At(i, j) != 0 {
+					t.Fatalf("pruned weight %d [%d][%d] was trained to %v", l, i, j, w.At(i, j))
+				}
+				changed = changed || w.At(i, j) != before[l].At(i, j)
+			}
+		}
+	}
+	if !changed {
+		t.Errorf("training didn't change the weights that were kept")
+	}
+
+	//the masks also apply to weights that are initialised again
+	mlp.WarmStart = false
+	mlp.Seed = 2
+	mlp.initWeights()
+	for l, w := range mlp.Weights {
+		var masked mat.Dense
+		masked.MulElem(w, mlp.WeightMasks[l])
+		if !mat.Equal(&masked, w) {
+			t.Errorf("new weights of layer %d are not masked", l)
+		}
+	}
+}
+
+func TestSparseInference(t *testing.T) {
+	mlp, X := predictSetup([]int{6, 12, 10, 3}, "softmax", true)
+	mlp.Prune(0.8, "layerwise")
+	if mlp.sparse == nil || mlp.sparse[0] == nil {
+		t.Fatalf("pruned layers should be multiplied as sparse matrices")
+	}
+
+	//training passes use the dense weights
+	activations, _, _ := mlp.forward(X, true)
+	want := activations[len(activations)-1]
+	if got := mlp.PredictProba(X); !mat.EqualApprox(got, want, 1e-12) {
+		t.Errorf("sparse inference gives\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(want))
+	}
+}
+
+func TestSparseWeightsKept(t *testing.T) {
+	mlp, X, y := trainedClassifier(t, "none")
+	if mlp.sparse != nil {
+		t.Errorf("an unpruned network has sparse weights")
+	}
+
+	mlp.Prune(0.8, "layerwise")
+	sparse := mlp.sparse
+	mlp.PredictProba(X)
+	mlp.PredictProba(X)
+	if len(mlp.sparse) == 0 || &mlp.sparse[0] != &sparse[0] {
+		t.Fatalf("predicting should reuse the sparse weights built by Prune")
+	}
+
+	//training changes the weights so the sparse weights are built again from the new ones
+	mlp.WarmStart = true
+	mlp.Epochs = 2
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if mlp.sparse == nil {
+		t.Errorf("the sparse weights were not built again after training")
+	}
+	for l, csr := range mlp.sparse {
+		if csr != nil && !reflect.DeepEqual(csr, newCSR(mlp.Weights[l])) {
+			t.Errorf("sparse weights of layer %d are out of date after training", l)
+		}
+	}
+	activations, _, _ := mlp.forward(X, true)
+	if got, want := mlp.PredictProba(X), activations[len(activations)-1]; !mat.EqualApprox(got, want, 1e-12) {
+		t.Errorf("predictions after training don't match the dense weights")
+	}
+
+	mlp.initWeights()
+	if mlp.sparse != nil {
+		t.Errorf("new weights kept the old sparse weights")
+	}
+}
+
+func TestCSR(t *testing.T) {
+	r := rand.New(rand.NewSource(10))
+	w := randomDense(r, 5, 4)
+	w.Set(0, 1, 0)
+	w.Set(2, 0, 0)
+	w.Set(2, 3, 0)
+	X := randomDense(r, 3, 5)
+	X.Set(1, 2, 0)
+
+	csr := newCSR(w)
+	if len(csr.values) != 17 || csr.density() != 17.0/20 {
+		t.Errorf("%d values with density %v, want 17 and 0.85", len(csr.values), csr.density())
+	}
+	var want mat.Dense
+	want.Mul(X, w)
+	if got := csr.mulLeft(X); !mat.EqualApprox(got, &want, 1e-12) {
+		t.Errorf("X • csr\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(&want))
+	}
+}
+
+func TestPruneAndFinetune(t *testing.T) {
+	mlp, X, y := trainedClassifier(t, "none")
+	histories, err := mlp.PruneAndFinetune(X, y, nil, nil, 0.85, "global", 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(histories) != 3 {
+		t.Fatalf("%d histories, want one for each of the 3 steps", len(histories))
+	}
+	if sparsity, _ := mlp.Sparsity(); math.Abs(sparsity-0.85) > 0.01 {
+		t.Errorf("sparsity %v, want 0.85", sparsity)
+	}
+	if mlp.Epochs != 20 || mlp.WarmStart {
+		t.Errorf("Epochs %d and WarmStart %v were not restored", mlp.Epochs, mlp.WarmStart)
+	}
+	if accuracy := mlp.Accuracy(y, mlp.PredictProba(X)); accuracy < 95 {
+		t.Errorf("accuracy %v%% after pruning, expected the fine tuning to recover", accuracy)
+	}
+}
+
+func TestSaveLoadMasks(t *testing.T) {
+	mlp, X := predictSetup([]int{6, 10, 3}, "softmax", true)
+	mlp.Prune(0.7, "global")
+
+	var buf bytes.Buffer
+	if err := mlp.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMultiLayerPerceptron()
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for l := range mlp.WeightMasks {
+		if !mat.Equal(loaded.WeightMasks[l], mlp.WeightMasks[l]) {
+			t.Errorf("mask of layer %d was not loaded", l)
+		}
+	}
+	if loaded.sparse == nil {
+		t.Errorf("the sparse weights were not built when loading")
+	}
+	if got, want := loaded.PredictProba(X), mlp.PredictProba(X); !mat.EqualApprox(got, want, 1e-12) {
+		t.Errorf("loaded network predicts differently")
+	}
+}
+
+func TestPruneBadConfig(t *testing.T) {
+	for name, prune := range map[string]func(mlp *MultiLayerPerceptron){
+		"sparsity":  func(mlp *MultiLayerPerceptron) { mlp.Prune(1, "global") },
+		"negative":  func(mlp *MultiLayerPerceptron) { mlp.Prune(-0.1, "global") },
+		"scope":     func(mlp *MultiLayerPerceptron) { mlp.Prune(0.5, "unit") },
+		"untrained": func(mlp *MultiLayerPerceptron) { NewMultiLayerPerceptron().Prune(0.5, "global") },
+		"steps":     func(mlp *MultiLayerPerceptron) { mlp.PruneAndFinetune(nil, nil, nil, nil, 0.5, "global", 0, 1) },
+		"mask shape": func(mlp *MultiLayerPerceptron) {
+			mlp.WeightMasks = []*mat.Dense{mat.NewDense(2, 2, nil), mat.NewDense(4, 2, nil)}
+			mlp.applyMasks()
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mlp, _ := predictSetup([]int{3, 4, 2}, "softmax", true)
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic")
+				}
+			}()
+			prune(mlp)
+		})
+	}
+}
+
+// Predict of an MNIST sized network, the pruned ones use the sparse multiply
+func BenchmarkPredictPruned(b *testing.B) {
+	r := rand.New(rand.NewSource(11))
+	X := randomDense(r, 256, 784)
+	X.Apply(func(_, _ int, v float64) float64 { return math.Max(v, 0) }, X)
+
+	for _, sparsity := range []float64{0, 0.8, 0.9, 0.95} {
+		b.Run(fmt.Sprintf("sparsity %v", sparsity), func(b *testing.B) {
+			mlp := NewMultiLayerPerceptron()
+			mlp.Arch = []int{784, 512, 256, 10}
+			mlp.OutputActivation = "softmax"
+			mlp.Seed = 1
+			mlp.initWeights()
+			mlp.Fitted = true
+			if sparsity > 0 {
+				mlp.Prune(sparsity, "layerwise")
+			}
+
+			b.ResetTimer()
+			for range b.N {
+				mlp.Predict(X)
+			}
+		})
+	}
+}
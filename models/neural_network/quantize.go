@@ -0,0 +1,438 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/serialization"
+	"fmt"
+	"io"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+const quantizedKind = "QuantizedMLP"
+
+// QuantizedMLP is a trained MultiLayerPerceptron with int8 weights and activations, for inference on devices where
+// float64 weights are too big or too slow, see MultiLayerPerceptron.Quantize
+//
+// a real value r is stored as an int8 q with r = scale (q - zeroPoint)
+// each layer multiplies the int8 input by the int8 weights into int32 sums, which are rescaled with a fixed point
+// multiplier to the int8 input of the activation, and the activation is a lookup table from int8 to int8
+// only the output layer goes back to floats, for the logits
+type QuantizedMLP struct {
+	Arch             []int
+	Activation       string
+	OutputActivation string
+	IsClassifier     bool
+	Classes          []float64
+	// "perTensor" for one scale for all the weights of a layer, "perChannel" for a scale for each output unit
+	Scheme string
+	Layers []QuantizedLayer
+}
+
+// QuantizedLayer is one dense layer of a QuantizedMLP
+type QuantizedLayer struct {
+	// weights of each output unit next to each other, Arch[l+1] rows of Arch[l] values
+	Weights []int8
+	// scale of the weights, one for the layer or one for each output unit
+	WeightScales []float64
+	// biases in the scale of the sums, InputScale · WeightScale, with a zero point of 0
+	Bias []int32
+
+	InputScale     float64
+	InputZeroPoint int32
+
+	// hidden layers turn the sum of each output unit into the int8 pre-activation with
+	// q = OutputZeroPoint + sum · Multiplier · 2^-Shift, where Multiplier · 2^-31 is in [0.5, 1)
+	Multiplier      []int32
+	Shift           []int
+	OutputScale     float64
+	OutputZeroPoint int32
+	// int8 activation of each int8 pre-activation q at q + 128, in the scale of the input of the next layer
+	ActivationTable []int8
+}
+
+// Quantizes the weights and activations of a trained dense network to int8, the ranges of the activations are
+// calibrated on the samples in X, which should be representative of the data the network will see
+// scheme is "perTensor" or "perChannel", per channel scales usually lose less accuracy
+// batch normalization is folded into the weights, layer normalization and mlp.Layers can't be quantized
+func (mlp *MultiLayerPerceptron) Quantize(X *mat.Dense, scheme string) *QuantizedMLP {
+	mlp.checkFitted()
+	if scheme != "perTensor" && scheme != "perChannel" {
+		panic(fmt.Sprintf("quantization scheme %q is not perTensor or perChannel", scheme))
+	}
+	if len(mlp.Layers) > 0 {
+		panic("only the dense layers of a network can be quantized, it has mlp.Layers")
+	}
+	if mlp.Normalization == "layer" {
+		panic("layer normalization can't be quantized, it depends on the statistics of each sample")
+	}
+	if mlp.MultiLabel {
+		panic("multi-label networks can't be quantized")
+	}
+	if mlp.Activation == "softmax" || mlp.Activation == "logsoftmax" {
+		panic(fmt.Sprintf("the hidden activation %q is not applied to each unit on its own so it can't be a lookup table", mlp.Activation))
+	}
+
+	weights, bias := mlp.foldedLayers()
+	activations, zs := calibrate(X, weights, bias, mlp.Activation)
+
+	q := &QuantizedMLP{
+		Arch:             mlp.Arch,
+		Activation:       mlp.Activation,
+		OutputActivation: mlp.outputActivation(),
+		IsClassifier:     mlp.IsClassifier,
+		Classes:          mlp.Classes,
+		Scheme:           scheme,
+		Layers:           make([]QuantizedLayer, len(weights)),
+	}
+	for l := range weights {
+		layer := &q.Layers[l]
+		layer.InputScale, layer.InputZeroPoint = quantizationParams(activations[l])
+		layer.Weights, layer.WeightScales = quantizeWeights(weights[l], scheme)
+
+		_, out := weights[l].Dims()
+		layer.Bias = make([]int32, out)
+		for j := range out {
+			layer.Bias[j] = int32(math.Round(bias[l].At(0, j) / (layer.InputScale * layer.weightScale(j))))
+		}
+
+		if l == len(weights)-1 {
+			break
+		}
+		layer.OutputScale, layer.OutputZeroPoint = quantizationParams(zs[l])
+		layer.Multiplier = make([]int32, out)
+		layer.Shift = make([]int, out)
+		for j := range out {
+			layer.Multiplier[j], layer.Shift[j] = quantizeMultiplier(layer.InputScale * layer.weightScale(j) / layer.OutputScale)
+		}
+		nextScale, nextZeroPoint := quantizationParams(activations[l+1])
+		layer.ActivationTable = activationTable(mlp.Activation, layer.OutputScale, layer.OutputZeroPoint, nextScale, nextZeroPoint)
+	}
+	return q
+}
+
+// the float weights and biases of each layer with batch normalization folded in
+// γ (xW + b - μ) / √(σ² + ε) + β = x W' + b' with W' = W γ / √(σ² + ε) and b' = (b - μ) γ / √(σ² + ε) + β
+func (mlp *MultiLayerPerceptron) foldedLayers() ([]*mat.Dense, []*mat.Dense) {
+	weights := make([]*mat.Dense, len(mlp.Weights))
+	bias := make([]*mat.Dense, len(mlp.Bias))
+	for l := range mlp.Weights {
+		weights[l] = mat.DenseCopyOf(mlp.Weights[l])
+		bias[l] = mat.DenseCopyOf(mlp.Bias[l])
+		if mlp.Normalization != "batch" || l == len(mlp.Weights)-1 {
+			continue
+		}
+
+		rows, cols := weights[l].Dims()
+		for j := range cols {
+			scale := mlp.Gamma[l].At(0, j) / math.Sqrt(mlp.RunningVar[l].At(0, j)+mlp.NormEpsilon)
+			for i := range rows {
+				weights[l].Set(i, j, weights[l].At(i, j)*scale)
+			}
+			bias[l].Set(0, j, (bias[l].At(0, j)-mlp.RunningMean[l].At(0, j))*scale+mlp.Beta[l].At(0, j))
+		}
+	}
+	return weights, bias
+}
+
+// float forward pass of X, the input of each layer and the pre-activation of each hidden layer
+func calibrate(X *mat.Dense, weights, bias []*mat.Dense, activation string) ([]*mat.Dense, []*mat.Dense) {
+	activations := []*mat.Dense{X}
+	zs := make([]*mat.Dense, 0, len(weights)-1)
+	for l := range len(weights) - 1 {
+		var z mat.Dense
+		z.Mul(activations[l], weights[l])
+		addIntercepts(z, *bias[l])
+		a := mat.DenseCopyOf(&z)
+		Activate[activation](a)
+		zs = append(zs, &z)
+		activations = append(activations, a)
+	}
+	return activations, zs
+}
+
+// scale and zero point that cover the range of the values in m and 0, which has to be exact for zero padding and
+// ReLU outputs, over the 256 values of an int8
+func quantizationParams(m *mat.Dense) (float64, int32) {
+	low, high := math.Min(mat.Min(m), 0), math.Max(mat.Max(m), 0)
+	if high == low {
+		return 1, 0
+	}
+	scale := (high - low) / 255
+	return scale, int32(clampInt8(math.Round(-128 - low/scale)))
+}
+
+// symmetric int8 weights, zero point 0, with scales from the largest absolute weight of the layer or of each unit
+// the weights are transposed so those of each output unit are next to each other
+func quantizeWeights(w *mat.Dense, scheme string) ([]int8, []float64) {
+	in, out := w.Dims()
+	scales := make([]float64, 1)
+	if scheme == "perChannel" {
+		scales = make([]float64, out)
+	}
+	for j := range out {
+		for i := range in {
+			k := min(j, len(scales)-1)
+			scales[k] = math.Max(scales[k], math.Abs(w.At(i, j)))
+		}
+	}
+	for k := range scales {
+		if scales[k] == 0 {
+			scales[k] = 1
+		}
+		scales[k] /= 127
+	}
+
+	q := make([]int8, in*out)
+	for j := range out {
+		scale := scales[min(j, len(scales)-1)]
+		for i := range in {
+			q[j*in+i] = int8(clampInt8(math.Round(w.At(i, j) / scale)))
+		}
+	}
+	return q, scales
+}
+
+func (layer *QuantizedLayer) weightScale(unit int) float64 {
+	return layer.WeightScales[min(unit, len(layer.WeightScales)-1)]
+}
+
+// m = multiplier · 2^-shift with multiplier a Q31 fixed point number in [2^30, 2^31)
+func quantizeMultiplier(m float64) (int32, int) {
+	if m <= 0 {
+		return 0, 0
+	}
+	fraction, exponent := math.Frexp(m)
+	multiplier := int64(math.Round(fraction * (1 << 31)))
+	if multiplier == 1<<31 {
+		multiplier /= 2
+		exponent++
+	}
+	return int32(multiplier), 31 - exponent
+}
+
+// x · multiplier · 2^-shift rounded to the nearest integer, with only integer arithmetic
+func multiplyByQuantized(x, multiplier int32, shift int) int64 {
+	product := int64(x) * int64(multiplier)
+	if shift <= 0 {
+		return product << -shift
+	}
+	if shift > 62 {
+		return 0
+	}
+	return (product + 1<<(shift-1)) >> shift
+}
+
+// lookup table of the activation from int8 pre-activations to int8 outputs
+func activationTable(activation string, inScale float64, inZeroPoint int32, outScale float64, outZeroPoint int32) []int8 {
+	z := mat.NewDense(1, 256, nil)
+	for q := range 256 {
+		z.Set(0, q, inScale*float64(int32(q-128)-inZeroPoint))
+	}
+	Activate[activation](z)
+
+	table := make([]int8, 256)
+	for q := range 256 {
+		table[q] = int8(clampInt8(math.Round(z.At(0, q)/outScale) + float64(outZeroPoint)))
+	}
+	return table
+}
+
+func clampInt8(x float64) float64 {
+	return math.Max(-128, math.Min(127, x))
+}
+
+// the int8 input of the first layer
+func (q *QuantizedMLP) quantizeInput(X *mat.Dense) []int8 {
+	rows, cols := X.Dims()
+	if cols != q.Arch[0] {
+		panic(fmt.Sprintf("samples have %d features, the network takes %d", cols, q.Arch[0]))
+	}
+	first := q.Layers[0]
+	input := make([]int8, rows*cols)
+	for i := range rows {
+		for j := range cols {
+			input[i*cols+j] = int8(clampInt8(math.Round(X.At(i, j)/first.InputScale) + float64(first.InputZeroPoint)))
+		}
+	}
+	return input
+}
+
+// Logits of each sample from integer inference, the output of the last layer before its activation
+func (q *QuantizedMLP) DecisionFunction(X *mat.Dense) *mat.Dense {
+	rows, _ := X.Dims()
+	input := q.quantizeInput(X)
+	outputs := q.Arch[len(q.Arch)-1]
+	logits := mat.NewDense(rows, outputs, nil)
+
+	widest := 0
+	for _, units := range q.Arch {
+		widest = max(widest, units)
+	}
+	current, next := make([]int8, widest), make([]int8, widest)
+	sums := make([]int32, widest)
+
+	for i := range rows {
+		copy(current, input[i*q.Arch[0]:(i+1)*q.Arch[0]])
+		for l := range q.Layers {
+			layer := &q.Layers[l]
+			in, out := q.Arch[l], q.Arch[l+1]
+			layer.accumulate(current[:in], sums[:out])
+
+			if l == len(q.Layers)-1 {
+				for j := range out {
+					logits.Set(i, j, float64(sums[j])*layer.InputScale*layer.weightScale(j))
+				}
+				break
+			}
+			for j := range out {
+				z := int64(layer.OutputZeroPoint) + multiplyByQuantized(sums[j], layer.Multiplier[j], layer.Shift[j])
+				next[j] = layer.ActivationTable[int(max(-128, min(127, z)))+128]
+			}
+			current, next = next, current
+		}
+	}
+	return logits
+}
+
+// int32 sums of the weights of each unit times the input, plus the bias
+// Σ (x - zeroPoint) w + b
+func (layer *QuantizedLayer) accumulate(input []int8, sums []int32) {
+	in := len(input)
+	for j := range sums {
+		weights := layer.Weights[j*in : (j+1)*in]
+		sum := layer.Bias[j]
+		for k, x := range input {
+			sum += (int32(x) - layer.InputZeroPoint) * int32(weights[k])
+		}
+		sums[j] = sum
+	}
+}
+
+// Predictions of each sample like MultiLayerPerceptron.Predict, class labels for classifiers and values for regression
+func (q *QuantizedMLP) Predict(X *mat.Dense) *mat.Dense {
+	if !q.IsClassifier {
+		output := q.DecisionFunction(X)
+		Activate[q.OutputActivation](output)
+		return output
+	}
+	return predictClasses(q.PredictProba(X), q.Classes)
+}
+
+// Probability of each class for every sample like MultiLayerPerceptron.PredictProba
+func (q *QuantizedMLP) PredictProba(X *mat.Dense) *mat.Dense {
+	if !q.IsClassifier {
+		panic("PredictProba is only for classifiers, use Predict for regression")
+	}
+	return probabilities(q.DecisionFunction(X), q.OutputActivation, false)
+}
+
+// Bytes of the weights, biases, scales and tables needed for inference
+func (q *QuantizedMLP) Size() int {
+	size := 0
+	for _, layer := range q.Layers {
+		size += len(layer.Weights) + 4*len(layer.Bias) + 8*len(layer.WeightScales) + len(layer.ActivationTable)
+		size += 4*len(layer.Multiplier) + 8*len(layer.Shift) + 2*(8+4)
+	}
+	return size
+}
+
+// QuantizationReport compares a quantized network with the float network it came from
+type QuantizationReport struct {
+	// % of the samples classified correctly by each network, 0 for regression
+	FloatAccuracy     float64
+	QuantizedAccuracy float64
+	// FloatAccuracy - QuantizedAccuracy, in percentage points
+	AccuracyDrop float64
+	// % of the samples where both networks make the same prediction
+	Agreement float64
+	// mean and largest absolute difference between the probabilities of a classifier, or the outputs of a regression
+	MeanOutputError float64
+	MaxOutputError  float64
+	// bytes of the parameters of each network
+	FloatBytes     int
+	QuantizedBytes int
+}
+
+// Compares the quantized network with mlp on samples X with targets y, one hot encoded for classifiers
+// or the class, 0 or 1, of a binary classifier with a single output unit
+func (q *QuantizedMLP) Report(mlp *MultiLayerPerceptron, X, y *mat.Dense) QuantizationReport {
+	report := QuantizationReport{QuantizedBytes: q.Size()}
+	for _, params := range [][]*mat.Dense{mlp.Weights, mlp.Bias, mlp.Gamma, mlp.Beta, mlp.RunningMean, mlp.RunningVar} {
+		for _, p := range params {
+			r, c := p.Dims()
+			report.FloatBytes += 8 * r * c
+		}
+	}
+
+	var floatOutput, quantizedOutput *mat.Dense
+	if q.IsClassifier {
+		floatOutput, quantizedOutput = mlp.PredictProba(X), q.PredictProba(X)
+		report.FloatAccuracy = mlp.Accuracy(y, floatOutput)
+		report.QuantizedAccuracy = mlp.Accuracy(y, quantizedOutput)
+		report.AccuracyDrop = report.FloatAccuracy - report.QuantizedAccuracy
+	} else {
+		floatOutput, quantizedOutput = mlp.Predict(X), q.Predict(X)
+	}
+
+	rows, cols := floatOutput.Dims()
+	same := 0
+	for i := range rows {
+		floatRow, quantizedRow := floatOutput.RawRowView(i), quantizedOutput.RawRowView(i)
+		for j := range cols {
+			diff := math.Abs(floatRow[j] - quantizedRow[j])
+			report.MeanOutputError += diff / float64(rows*cols)
+			report.MaxOutputError = math.Max(report.MaxOutputError, diff)
+		}
+		if q.IsClassifier && predictedClass(floatRow) == predictedClass(quantizedRow) {
+			same++
+		}
+	}
+	if q.IsClassifier {
+		report.Agreement = 100 * float64(same) / float64(rows)
+	}
+	return report
+}
+
+// Writes the quantized network in the compact binary format
+func (q *QuantizedMLP) Save(w io.Writer) error {
+	return serialization.Write(w, quantizedKind, serialization.Binary, q)
+}
+
+// Writes the quantized network as JSON
+func (q *QuantizedMLP) SaveJSON(w io.Writer) error {
+	return serialization.Write(w, quantizedKind, serialization.JSON, q)
+}
+
+// Reads a quantized network written by Save or SaveJSON
+func (q *QuantizedMLP) Load(r io.Reader) error {
+	var loaded QuantizedMLP
+	if err := serialization.Read(r, quantizedKind, &loaded); err != nil {
+		return err
+	}
+	if err := loaded.check(); err != nil {
+		return err
+	}
+	*q = loaded
+	return nil
+}
+
+// checks the sizes of the layers match the architecture
+func (q *QuantizedMLP) check() error {
+	if len(q.Layers) != len(q.Arch)-1 {
+		return fmt.Errorf("saved network has %d layers for an architecture of %d layers", len(q.Layers), len(q.Arch))
+	}
+	for l, layer := range q.Layers {
+		in, out := q.Arch[l], q.Arch[l+1]
+		hidden := l < len(q.Layers)-1
+		switch {
+		case len(layer.Weights) != in*out, len(layer.Bias) != out:
+			return fmt.Errorf("saved weights for layer %d do not match the architecture %v", l, q.Arch)
+		case len(layer.WeightScales) != 1 && len(layer.WeightScales) != out:
+			return fmt.Errorf("layer %d has %d weight scales for %d units", l, len(layer.WeightScales), out)
+		case hidden && (len(layer.Multiplier) != out || len(layer.Shift) != out || len(layer.ActivationTable) != 256):
+			return fmt.Errorf("layer %d is missing its requantization or activation table", l)
+		}
+	}
+	return nil
+}
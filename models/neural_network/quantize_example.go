@@ -0,0 +1,45 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/datasets/mnist"
+	"Go-Machine-Learning/preprocessing"
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// MNIST classifier quantized to int8 for inference on small devices, calibrated on 1000 training images
+func QuantizeExample() {
+
+	XTrain, yTrain := mnist.LoadMnistTrain()
+	XTest, yTest := mnist.LoadMnistTest()
+
+	yTrain = preprocessing.OneHotEncodeDense(10, yTrain)
+	yTest = preprocessing.OneHotEncodeDense(10, yTest)
+
+	//normalise data
+	XTrain.Scale(1.0/255, XTrain)
+	XTest.Scale(1.0/255, XTest)
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{784, 256, 128, 10}
+	mlp.Epochs = 10
+	mlp.BatchSize = 64
+	mlp.LearningRate = 0.01
+	mlp.Activation = "relu"
+	mlp.IsClassifier = true
+	if _, err := mlp.Train(XTrain, yTrain, XTest, yTest); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	_, xcols := XTrain.Dims()
+	calibration := XTrain.Slice(0, 1000, 0, xcols).(*mat.Dense)
+	for _, scheme := range []string{"perTensor", "perChannel"} {
+		quantized := mlp.Quantize(calibration, scheme)
+		report := quantized.Report(mlp, XTest, yTest)
+		fmt.Printf("%s: float accuracy %.2f%%, int8 accuracy %.2f%%, agreement %.2f%%, %d bytes instead of %d\n",
+			scheme, report.FloatAccuracy, report.QuantizedAccuracy, report.Agreement, report.QuantizedBytes, report.FloatBytes)
+	}
+
+}
@@ -0,0 +1,259 @@
+package neuralnetwork
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// samples of 3 classes around different centres in 8 dimensions, with one hot targets
+func blobs(r *rand.Rand, n int) (*mat.Dense, *mat.Dense) {
+	centres := randomDense(r, 3, 8)
+	centres.Scale(3, centres)
+	X := mat.NewDense(n, 8, nil)
+	y := mat.NewDense(n, 3, nil)
+	for i := range n {
+		class := i % 3
+		for j := range 8 {
+			X.Set(i, j, centres.At(class, j)+r.NormFloat64())
+		}
+		y.Set(i, class, 1)
+	}
+	return X, y
+}
+
+func trainedClassifier(t *testing.T, normalization string) (*MultiLayerPerceptron, *mat.Dense, *mat.Dense) {
+	t.Helper()
+	r := rand.New(rand.NewSource(8))
+	X, y := blobs(r, 300)
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{8, 16, 16, 3}
+	mlp.Epochs = 20
+	mlp.BatchSize = 16
+	mlp.Normalization = normalization
+	mlp.Verbose = false
+	mlp.Seed = 1
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return mlp, X, y
+}
+
+func TestQuantizeMultiplier(t *testing.T) {
+	for _, m := range []float64{0.3, 0.5, 0.999, 1, 2.5, 1e-4, 37} {
+		multiplier, shift := quantizeMultiplier(m)
+		if multiplier < 1<<30 {
+			t.Errorf("multiplier of %v is %d, expected it in [2^30, 2^31)", m, multiplier)
+		}
+		for _, x := range []int32{0, 1, -1, 1000, -123456, 1 << 24} {
+			got := multiplyByQuantized(x, multiplier, shift)
+			if want := float64(x) * m; math.Abs(float64(got)-want) > 0.5+math.Abs(want)*1e-9 {
+				t.Errorf("%d · %v = %d, want %v", x, m, got, want)
+			}
+		}
+	}
+}
+
+func TestFoldedBatchNorm(t *testing.T) {
+	mlp, X, _ := gradientCheckSetup("batch")
+	mlp.Fitted = true
+	mlp.IsClassifier = true
+	//move the running statistics away from their starting values
+	r := rand.New(rand.NewSource(9))
+	for l := range mlp.RunningMean {
+		_, cols := mlp.RunningMean[l].Dims()
+		for j := range cols {
+			mlp.RunningMean[l].Set(0, j, r.NormFloat64())
+			mlp.RunningVar[l].Set(0, j, 0.5+r.Float64())
+		}
+	}
+
+	weights, bias := mlp.foldedLayers()
+	activations, _ := calibrate(X, weights, bias, mlp.Activation)
+	var logits mat.Dense
+	last := len(weights) - 1
+	logits.Mul(activations[last], weights[last])
+	addIntercepts(logits, *bias[last])
+
+	if want := mlp.DecisionFunction(X); !mat.EqualApprox(&logits, want, 1e-12) {
+		t.Errorf("folded network gives\n%v\nwant\n%v", mat.Formatted(&logits), mat.Formatted(want))
+	}
+}
+
+func TestQuantizedClassifier(t *testing.T) {
+	for _, normalization := range []string{"none", "batch"} {
+		for _, scheme := range []string{"perTensor", "perChannel"} {
+			t.Run(normalization+" "+scheme, func(t *testing.T) {
+				mlp, X, y := trainedClassifier(t, normalization)
+				q := mlp.Quantize(X.Slice(0, 100, 0, 8).(*mat.Dense), scheme)
+
+				report := q.Report(mlp, X, y)
+				if report.FloatAccuracy < 95 {
+					t.Fatalf("the float network is only %v%% accurate", report.FloatAccuracy)
+				}
+				if report.AccuracyDrop > 1 || report.Agreement < 98 || report.MaxOutputError > 0.2 {
+					t.Errorf("quantization lost too much: %+v", report)
+				}
+				if report.QuantizedBytes*2 > report.FloatBytes {
+					t.Errorf("quantized network takes %d bytes, the float one %d", report.QuantizedBytes, report.FloatBytes)
+				}
+
+				predictions := q.Predict(X)
+				if _, cols := predictions.Dims(); cols != 1 {
+					t.Errorf("Predict returned %d columns, want one class per sample", cols)
+				}
+			})
+		}
+	}
+}
+
+func TestQuantizedBinaryClassifier(t *testing.T) {
+	//the first of the blobs against the other two, with a single sigmoid output
+	X, classes := blobs(rand.New(rand.NewSource(8)), 300)
+	y := mat.NewDense(300, 1, nil)
+	y.Copy(classes.Slice(0, 300, 0, 1))
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{8, 16, 1}
+	mlp.OutputActivation = "sigmoid"
+	mlp.LossFunction = "binaryCrossEntropyLoss"
+	mlp.Epochs = 20
+	mlp.BatchSize = 16
+	mlp.Verbose = false
+	mlp.Seed = 1
+	if _, err := mlp.Train(X, y, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	q := mlp.Quantize(X.Slice(0, 100, 0, 8).(*mat.Dense), "perChannel")
+	report := q.Report(mlp, X, y)
+
+	//the accuracies and agreement of the report match counting the predictions of each network
+	floatPredictions, quantizedPredictions := mlp.Predict(X), q.Predict(X)
+	floatCorrect, quantizedCorrect, same := 0, 0, 0
+	for i := range 300 {
+		if floatPredictions.At(i, 0) == y.At(i, 0) {
+			floatCorrect++
+		}
+		if quantizedPredictions.At(i, 0) == y.At(i, 0) {
+			quantizedCorrect++
+		}
+		if floatPredictions.At(i, 0) == quantizedPredictions.At(i, 0) {
+			same++
+		}
+	}
+	percent := func(n int) float64 { return 100 * float64(n) / 300 }
+	if math.Abs(report.FloatAccuracy-percent(floatCorrect)) > 1e-9 || math.Abs(report.QuantizedAccuracy-percent(quantizedCorrect)) > 1e-9 ||
+		math.Abs(report.Agreement-percent(same)) > 1e-9 {
+		t.Errorf("report %+v, want accuracies %v%% and %v%% and agreement %v%%", report, percent(floatCorrect), percent(quantizedCorrect), percent(same))
+	}
+	if report.FloatAccuracy < 95 || report.AccuracyDrop > 1 {
+		t.Errorf("float accuracy %v%% and drop %v", report.FloatAccuracy, report.AccuracyDrop)
+	}
+}
+
+func TestQuantizePerChannel(t *testing.T) {
+	//one unit with much bigger weights than the others leaves the rest with few levels in a per tensor scale
+	mlp, X := predictSetup([]int{4, 6, 3}, "softmax", true)
+	_, cols := mlp.Weights[0].Dims()
+	for i := range 4 {
+		mlp.Weights[0].Set(i, cols-1, 100*mlp.Weights[0].At(i, cols-1))
+	}
+
+	want := mlp.DecisionFunction(X)
+	errors := map[string]float64{}
+	for _, scheme := range []string{"perTensor", "perChannel"} {
+		var diff mat.Dense
+		diff.Sub(mlp.Quantize(X, scheme).DecisionFunction(X), want)
+		errors[scheme] = mat.Norm(&diff, 2)
+	}
+	if errors["perChannel"] >= errors["perTensor"] {
+		t.Errorf("per channel error %v, per tensor %v, expected per channel scales to be more precise", errors["perChannel"], errors["perTensor"])
+	}
+}
+
+func TestQuantizedRegression(t *testing.T) {
+	mlp, X := predictSetup([]int{4, 8, 2}, "identity", false)
+	mlp.Activation = "tanh"
+	q := mlp.Quantize(X, "perChannel")
+
+	report := q.Report(mlp, X, nil)
+	if report.MeanOutputError > 0.02 || report.Agreement != 0 || report.FloatAccuracy != 0 {
+		t.Errorf("regression report %+v", report)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected PredictProba to panic for regression")
+		}
+	}()
+	q.PredictProba(X)
+}
+
+func TestSaveLoadQuantized(t *testing.T) {
+	mlp, X := predictSetup([]int{4, 6, 3}, "softmax", true)
+	mlp.Classes = []float64{2, 4, 8}
+	q := mlp.Quantize(X, "perChannel")
+	want := q.DecisionFunction(X)
+
+	for name, save := range map[string]func(*bytes.Buffer) error{
+		"binary": func(b *bytes.Buffer) error { return q.Save(b) },
+		"json":   func(b *bytes.Buffer) error { return q.SaveJSON(b) },
+	} {
+		var buf bytes.Buffer
+		if err := save(&buf); err != nil {
+			t.Fatal(err)
+		}
+		var loaded QuantizedMLP
+		if err := loaded.Load(&buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := loaded.DecisionFunction(X); !mat.Equal(got, want) {
+			t.Errorf("%s: loaded network gives different logits", name)
+		}
+		if got := loaded.Predict(X); !mat.Equal(got, q.Predict(X)) {
+			t.Errorf("%s: loaded network predicts different labels", name)
+		}
+	}
+
+	q.Layers[0].Bias = q.Layers[0].Bias[1:]
+	var buf bytes.Buffer
+	if err := q.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var loaded QuantizedMLP
+	if err := loaded.Load(&buf); err == nil {
+		t.Errorf("expected an error loading a layer with the wrong number of biases")
+	}
+}
+
+func TestQuantizeBadConfig(t *testing.T) {
+	for name, quantize := range map[string]func(mlp *MultiLayerPerceptron, X *mat.Dense){
+		"scheme": func(mlp *MultiLayerPerceptron, X *mat.Dense) { mlp.Quantize(X, "perRow") },
+		"layers": func(mlp *MultiLayerPerceptron, X *mat.Dense) {
+			mlp.Layers = []Layer{NewFlatten()}
+			mlp.Quantize(X, "perTensor")
+		},
+		"layer norm": func(mlp *MultiLayerPerceptron, X *mat.Dense) {
+			mlp.Normalization = "layer"
+			mlp.Quantize(X, "perTensor")
+		},
+		"multi-label": func(mlp *MultiLayerPerceptron, X *mat.Dense) { mlp.MultiLabel = true; mlp.Quantize(X, "perTensor") },
+		"not fitted":  func(mlp *MultiLayerPerceptron, X *mat.Dense) { mlp.Fitted = false; mlp.Quantize(X, "perTensor") },
+		"features": func(mlp *MultiLayerPerceptron, X *mat.Dense) {
+			mlp.Quantize(X, "perTensor").Predict(mat.NewDense(1, 2, nil))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mlp, X := predictSetup([]int{3, 4, 2}, "softmax", true)
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic")
+				}
+			}()
+			quantize(mlp, X)
+		})
+	}
+}
@@ -0,0 +1,538 @@
+package neuralnetwork
+
+import (
+	"fmt"
+	"math"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// settings shared by the recurrent layers, which take sequences of Shape{steps, features} stored step by step in each row
+type recurrent struct {
+	// size of the hidden state
+	Units int
+	// Output the hidden state after every step, Shape{steps, Units}, instead of only the last one, Shape{Units}
+	ReturnSequences bool
+	// Truncated backpropagation through time, the sequence is split into chunks of TruncateSteps steps and the gradient
+	// is not carried back through the hidden state from one chunk to the one before, 0 backpropagates through every step
+	TruncateSteps int
+	// Skip the steps where every feature is MaskValue, such as the padding after a sequence shorter than the rest
+	// the state is carried over a skipped step unchanged, so the last state is the one after the last real step
+	Mask      bool
+	MaskValue float64
+
+	steps, features int
+}
+
+// one step of a recurrent layer
+type recurrentCell interface {
+	// the next hidden state and cell state after the input x, the cell state is nil for cells that don't have one
+	// h and c must not be changed as they are needed for backprop
+	step(x, h, c *mat.Dense) (*mat.Dense, *mat.Dense, any)
+	// backprop through one step, adding the gradients of the parameters to grads
+	// returns the gradients with respect to x and to the previous hidden and cell states
+	stepBackward(dh, dc *mat.Dense, cache any, grads []*mat.Dense) (*mat.Dense, *mat.Dense, *mat.Dense)
+	// whether the cell keeps a cell state as well as the hidden state
+	hasCellState() bool
+}
+
+// what the recurrent layers need from a forward pass
+type sequenceCache struct {
+	steps []any
+	//for each step, whether each sample was skipped by the mask, nil when nothing is masked
+	masked [][]bool
+}
+
+func (r *recurrent) build(layer string, input Shape) Shape {
+	if len(input) != 2 {
+		panic(fmt.Sprintf("%s needs inputs of Shape{steps, features}, got %v", layer, input))
+	}
+	if r.Units <= 0 {
+		panic(fmt.Sprintf("%s.Units must be greater than zero", layer))
+	}
+	r.steps, r.features = input[0], input[1]
+
+	if r.ReturnSequences {
+		return Shape{r.steps, r.Units}
+	}
+	return Shape{r.Units}
+}
+
+// which samples have every feature equal to the mask value at this step
+func (r *recurrent) maskedRows(x *mat.Dense) []bool {
+	rows, _ := x.Dims()
+	masked := make([]bool, rows)
+	for i := range rows {
+		masked[i] = true
+		for _, value := range x.RawRowView(i) {
+			if value != r.MaskValue {
+				masked[i] = false
+				break
+			}
+		}
+	}
+	return masked
+}
+
+// Runs the cell over every step of the sequences, starting from a zero state
+// h_t = cell(x_t, h_t-1)
+func (r *recurrent) forward(cell recurrentCell, X *mat.Dense) (*mat.Dense, any) {
+	n, _ := X.Dims()
+	h := mat.NewDense(n, r.Units, nil)
+	var c *mat.Dense
+	if cell.hasCellState() {
+		c = mat.NewDense(n, r.Units, nil)
+	}
+
+	cache := &sequenceCache{steps: make([]any, r.steps), masked: make([][]bool, r.steps)}
+	var sequence *mat.Dense
+	if r.ReturnSequences {
+		sequence = mat.NewDense(n, r.steps*r.Units, nil)
+	}
+
+	for t := range r.steps {
+		x := X.Slice(0, n, t*r.features, (t+1)*r.features).(*mat.Dense)
+		hNext, cNext, stepCache := cell.step(x, h, c)
+
+		if r.Mask {
+			masked := r.maskedRows(x)
+			for i, skip := range masked {
+				if skip {
+					copy(hNext.RawRowView(i), h.RawRowView(i))
+					if c != nil {
+						copy(cNext.RawRowView(i), c.RawRowView(i))
+					}
+				}
+			}
+			cache.masked[t] = masked
+		}
+
+		h, c = hNext, cNext
+		cache.steps[t] = stepCache
+		if sequence != nil {
+			sequence.Slice(0, n, t*r.Units, (t+1)*r.Units).(*mat.Dense).Copy(h)
+		}
+	}
+
+	if sequence != nil {
+		return sequence, cache
+	}
+	return h, cache
+}
+
+// Backpropagation through time, from the last step to the first
+// the gradient of a skipped step goes straight to the step before, and is cut at the start of every truncated chunk
+func (r *recurrent) backward(cell recurrentCell, grad *mat.Dense, cache any, params []*mat.Dense) (*mat.Dense, []*mat.Dense) {
+	s := cache.(*sequenceCache)
+	n, _ := grad.Dims()
+	grads := zerosLike(params)
+	dX := mat.NewDense(n, r.steps*r.features, nil)
+
+	dh := mat.NewDense(n, r.Units, nil)
+	var dc *mat.Dense
+	if cell.hasCellState() {
+		dc = mat.NewDense(n, r.Units, nil)
+	}
+	if !r.ReturnSequences {
+		dh.Copy(grad)
+	}
+
+	for t := r.steps - 1; t >= 0; t-- {
+		if r.ReturnSequences {
+			dh.Add(dh, grad.Slice(0, n, t*r.Units, (t+1)*r.Units))
+		}
+
+		//a skipped sample does not take part in the step
+		stepDh, stepDc := dh, dc
+		masked := s.masked[t]
+		if masked != nil {
+			stepDh = maskRows(dh, masked)
+			if dc != nil {
+				stepDc = maskRows(dc, masked)
+			}
+		}
+
+		dx, dhPrev, dcPrev := cell.stepBackward(stepDh, stepDc, s.steps[t], grads)
+
+		for i, skip := range masked {
+			if skip {
+				copy(dhPrev.RawRowView(i), dh.RawRowView(i))
+				if dc != nil {
+					copy(dcPrev.RawRowView(i), dc.RawRowView(i))
+				}
+			}
+		}
+
+		dX.Slice(0, n, t*r.features, (t+1)*r.features).(*mat.Dense).Copy(dx)
+
+		if r.TruncateSteps > 0 && t%r.TruncateSteps == 0 {
+			dhPrev.Zero()
+			if dcPrev != nil {
+				dcPrev.Zero()
+			}
+		}
+		dh, dc = dhPrev, dcPrev
+	}
+
+	return dX, grads
+}
+
+// copy of m with the masked rows set to zero
+func maskRows(m *mat.Dense, masked []bool) *mat.Dense {
+	out := mat.DenseCopyOf(m)
+	for i, skip := range masked {
+		if skip {
+			row := out.RawRowView(i)
+			for j := range row {
+				row[j] = 0
+			}
+		}
+	}
+	return out
+}
+
+// dst += a • b
+func addMul(dst *mat.Dense, a, b mat.Matrix) {
+	var product mat.Dense
+	product.Mul(a, b)
+	dst.Add(dst, &product)
+}
+
+// x • Wx + h • Wh + b
+func recurrentInput(x, h, inputWeights, recurrentWeights, bias *mat.Dense) *mat.Dense {
+	var z, hw mat.Dense
+	z.Mul(x, inputWeights)
+	hw.Mul(h, recurrentWeights)
+	z.Add(&z, &hw)
+	addIntercepts(z, *bias)
+	return &z
+}
+
+// the input weights are Glorot uniform and the recurrent weights orthogonal, for each of the gates
+func initRecurrent(features, units, gates int, rng *rand.Rand) (*mat.Dense, *mat.Dense, *mat.Dense) {
+	return GlorotUniform{}.Initialize(features, gates*units, rng),
+		Orthogonal{}.Initialize(units, gates*units, rng),
+		mat.NewDense(1, gates*units, nil)
+}
+
+// Fully connected recurrent layer, the output after each step is fed back in with the next input
+// h_t = g(x_t • Wx + h_t-1 • Wh + b)
+type SimpleRNN struct {
+	recurrent
+	// activation of the hidden state, "tanh", "relu", "sigmoid" or "identity"
+	Activation string
+
+	InputWeights     *mat.Dense `json:"-"`
+	RecurrentWeights *mat.Dense `json:"-"`
+	Bias             *mat.Dense `json:"-"`
+}
+
+// SimpleRNN with a tanh activation that returns the last hidden state
+func NewSimpleRNN(units int) *SimpleRNN {
+	return &SimpleRNN{recurrent: recurrent{Units: units}, Activation: "tanh"}
+}
+
+type rnnStep struct {
+	x, h, z *mat.Dense
+}
+
+func (l *SimpleRNN) Build(input Shape, rng *rand.Rand) Shape {
+	if _, ok := Derivative[l.Activation]; !ok {
+		panic(fmt.Sprintf("SimpleRNN.Activation %q must be \"tanh\", \"relu\", \"sigmoid\" or \"identity\"", l.Activation))
+	}
+	output := l.build("SimpleRNN", input)
+	l.InputWeights, l.RecurrentWeights, l.Bias = initRecurrent(l.features, l.Units, 1, rng)
+	return output
+}
+
+func (l *SimpleRNN) Forward(X *mat.Dense, training bool) (*mat.Dense, any) {
+	return l.forward(l, X)
+}
+
+func (l *SimpleRNN) Backward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense) {
+	return l.backward(l, grad, cache, l.Params())
+}
+
+func (l *SimpleRNN) Params() []*mat.Dense {
+	return []*mat.Dense{l.InputWeights, l.RecurrentWeights, l.Bias}
+}
+
+func (l *SimpleRNN) hasCellState() bool {
+	return false
+}
+
+func (l *SimpleRNN) step(x, h, c *mat.Dense) (*mat.Dense, *mat.Dense, any) {
+	z := recurrentInput(x, h, l.InputWeights, l.RecurrentWeights, l.Bias)
+	a := mat.DenseCopyOf(z)
+	Activate[l.Activation](a)
+	return a, nil, &rnnStep{x: x, h: h, z: z}
+}
+
+// δz = δh ⊙ g'(z)
+// ΔWx += x^T • δz, ΔWh += h_t-1^T • δz, Δb += Σ δz
+// δx = δz • Wx^T, δh_t-1 = δz • Wh^T
+func (l *SimpleRNN) stepBackward(dh, dc *mat.Dense, cache any, grads []*mat.Dense) (*mat.Dense, *mat.Dense, *mat.Dense) {
+	s := cache.(*rnnStep)
+
+	dz := mat.DenseCopyOf(s.z)
+	Derivative[l.Activation](dz)
+	dz.MulElem(dz, dh)
+
+	addMul(grads[0], s.x.T(), dz)
+	addMul(grads[1], s.h.T(), dz)
+	grads[2].Add(grads[2], columnSums(dz))
+
+	var dx, dhPrev mat.Dense
+	dx.Mul(dz, l.InputWeights.T())
+	dhPrev.Mul(dz, l.RecurrentWeights.T())
+	return &dx, &dhPrev, nil
+}
+
+// Long short-term memory layer, a cell state carries information across many steps and gates decide what is
+// written to it, forgotten from it and read out of it
+// i, f, o = σ(x_t • Wx + h_t-1 • Wh + b), one block of units each
+// g = math.Tanh(x_t • Wx + h_t-1 • Wh + b)
+// c_t = f ⊙ c_t-1 + i ⊙ g
+// h_t = o ⊙ math.Tanh(c_t)
+// the weights of the gates are stored side by side in the order i, f, g, o
+type LSTM struct {
+	recurrent
+
+	InputWeights     *mat.Dense `json:"-"`
+	RecurrentWeights *mat.Dense `json:"-"`
+	Bias             *mat.Dense `json:"-"`
+}
+
+// LSTM that returns the last hidden state
+func NewLSTM(units int) *LSTM {
+	return &LSTM{recurrent: recurrent{Units: units}}
+}
+
+type lstmStep struct {
+	x, h, c *mat.Dense
+	//activated gates i, f, g, o side by side, and math.Tanh(c_t)
+	gates, tanhC *mat.Dense
+}
+
+// the forget gate bias starts at 1 so the cell state is kept by default early in training
+func (l *LSTM) Build(input Shape, rng *rand.Rand) Shape {
+	output := l.build("LSTM", input)
+	l.InputWeights, l.RecurrentWeights, l.Bias = initRecurrent(l.features, l.Units, 4, rng)
+	for j := l.Units; j < 2*l.Units; j++ {
+		l.Bias.Set(0, j, 1)
+	}
+	return output
+}
+
+func (l *LSTM) Forward(X *mat.Dense, training bool) (*mat.Dense, any) {
+	return l.forward(l, X)
+}
+
+func (l *LSTM) Backward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense) {
+	return l.backward(l, grad, cache, l.Params())
+}
+
+func (l *LSTM) Params() []*mat.Dense {
+	return []*mat.Dense{l.InputWeights, l.RecurrentWeights, l.Bias}
+}
+
+func (l *LSTM) hasCellState() bool {
+	return true
+}
+
+func (l *LSTM) step(x, h, c *mat.Dense) (*mat.Dense, *mat.Dense, any) {
+	units := l.Units
+	gates := recurrentInput(x, h, l.InputWeights, l.RecurrentWeights, l.Bias)
+	n, _ := gates.Dims()
+
+	cNext := mat.NewDense(n, units, nil)
+	tanhC := mat.NewDense(n, units, nil)
+	hNext := mat.NewDense(n, units, nil)
+	for s := range n {
+		row := gates.RawRowView(s)
+		for j := range units {
+			i, f, g, o := sigmoid(row[j]), sigmoid(row[units+j]), math.Tanh(row[2*units+j]), sigmoid(row[3*units+j])
+			row[j], row[units+j], row[2*units+j], row[3*units+j] = i, f, g, o
+
+			cell := f*c.At(s, j) + i*g
+			cNext.Set(s, j, cell)
+			tanhC.Set(s, j, math.Tanh(cell))
+			hNext.Set(s, j, o*math.Tanh(cell))
+		}
+	}
+
+	return hNext, cNext, &lstmStep{x: x, h: h, c: c, gates: gates, tanhC: tanhC}
+}
+
+// δo = δh ⊙ math.Tanh(c_t)
+// δc = δc_t + δh ⊙ o ⊙ (1 - tanh²(c_t))
+// δi = δc ⊙ g, δf = δc ⊙ c_t-1, δg = δc ⊙ i, δc_t-1 = δc ⊙ f
+// then through the gate activations to δz, which goes through the weights like SimpleRNN
+func (l *LSTM) stepBackward(dh, dc *mat.Dense, cache any, grads []*mat.Dense) (*mat.Dense, *mat.Dense, *mat.Dense) {
+	s := cache.(*lstmStep)
+	units := l.Units
+	n, _ := dh.Dims()
+
+	dz := mat.NewDense(n, 4*units, nil)
+	dcPrev := mat.NewDense(n, units, nil)
+	for sample := range n {
+		gates, dzRow := s.gates.RawRowView(sample), dz.RawRowView(sample)
+		for j := range units {
+			i, f, g, o := gates[j], gates[units+j], gates[2*units+j], gates[3*units+j]
+			tc := s.tanhC.At(sample, j)
+			dhValue := dh.At(sample, j)
+
+			dcValue := dc.At(sample, j) + dhValue*o*(1-tc*tc)
+			dzRow[j] = dcValue * g * i * (1 - i)
+			dzRow[units+j] = dcValue * s.c.At(sample, j) * f * (1 - f)
+			dzRow[2*units+j] = dcValue * i * (1 - g*g)
+			dzRow[3*units+j] = dhValue * tc * o * (1 - o)
+			dcPrev.Set(sample, j, dcValue*f)
+		}
+	}
+
+	addMul(grads[0], s.x.T(), dz)
+	addMul(grads[1], s.h.T(), dz)
+	grads[2].Add(grads[2], columnSums(dz))
+
+	var dx, dhPrev mat.Dense
+	dx.Mul(dz, l.InputWeights.T())
+	dhPrev.Mul(dz, l.RecurrentWeights.T())
+	return &dx, &dhPrev, dcPrev
+}
+
+// Gated recurrent unit, a lighter alternative to the LSTM without a separate cell state
+// z, r = σ(x_t • Wx + h_t-1 • Wh + b), the update and reset gates
+// n = math.Tanh(x_t • Wx + (r ⊙ h_t-1) • Wh + b)
+// h_t = z ⊙ h_t-1 + (1 - z) ⊙ n
+// the weights of the gates are stored side by side in the order z, r, n
+type GRU struct {
+	recurrent
+
+	InputWeights     *mat.Dense `json:"-"`
+	RecurrentWeights *mat.Dense `json:"-"`
+	Bias             *mat.Dense `json:"-"`
+}
+
+// GRU that returns the last hidden state
+func NewGRU(units int) *GRU {
+	return &GRU{recurrent: recurrent{Units: units}}
+}
+
+type gruStep struct {
+	x, h *mat.Dense
+	//activated gates z, r, n side by side, and r ⊙ h_t-1
+	gates, resetH *mat.Dense
+}
+
+func (l *GRU) Build(input Shape, rng *rand.Rand) Shape {
+	output := l.build("GRU", input)
+	l.InputWeights, l.RecurrentWeights, l.Bias = initRecurrent(l.features, l.Units, 3, rng)
+	return output
+}
+
+func (l *GRU) Forward(X *mat.Dense, training bool) (*mat.Dense, any) {
+	return l.forward(l, X)
+}
+
+func (l *GRU) Backward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense) {
+	return l.backward(l, grad, cache, l.Params())
+}
+
+func (l *GRU) Params() []*mat.Dense {
+	return []*mat.Dense{l.InputWeights, l.RecurrentWeights, l.Bias}
+}
+
+func (l *GRU) hasCellState() bool {
+	return false
+}
+
+// the recurrent weights of the update and reset gates, and of the candidate state
+func (l *GRU) recurrentBlocks() (*mat.Dense, *mat.Dense) {
+	units := l.Units
+	return l.RecurrentWeights.Slice(0, units, 0, 2*units).(*mat.Dense),
+		l.RecurrentWeights.Slice(0, units, 2*units, 3*units).(*mat.Dense)
+}
+
+func (l *GRU) step(x, h, c *mat.Dense) (*mat.Dense, *mat.Dense, any) {
+	units := l.Units
+	n, _ := x.Dims()
+	gateWeights, candidateWeights := l.recurrentBlocks()
+
+	var gates, hw mat.Dense
+	gates.Mul(x, l.InputWeights)
+	addIntercepts(gates, *l.Bias)
+	hw.Mul(h, gateWeights)
+
+	resetH := mat.NewDense(n, units, nil)
+	for s := range n {
+		row, hwRow := gates.RawRowView(s), hw.RawRowView(s)
+		for j := range units {
+			row[j] = sigmoid(row[j] + hwRow[j])
+			row[units+j] = sigmoid(row[units+j] + hwRow[units+j])
+			resetH.Set(s, j, row[units+j]*h.At(s, j))
+		}
+	}
+
+	var candidate mat.Dense
+	candidate.Mul(resetH, candidateWeights)
+	hNext := mat.NewDense(n, units, nil)
+	for s := range n {
+		row := gates.RawRowView(s)
+		for j := range units {
+			z := row[j]
+			nValue := math.Tanh(row[2*units+j] + candidate.At(s, j))
+			row[2*units+j] = nValue
+			hNext.Set(s, j, z*h.At(s, j)+(1-z)*nValue)
+		}
+	}
+
+	return hNext, nil, &gruStep{x: x, h: h, gates: &gates, resetH: resetH}
+}
+
+// δn = δh ⊙ (1 - z), δz = δh ⊙ (h_t-1 - n), δh_t-1 = δh ⊙ z + ...
+// the candidate's gradient goes through Wh_n to r ⊙ h_t-1, giving δr = δ(r ⊙ h_t-1) ⊙ h_t-1 and more of δh_t-1
+func (l *GRU) stepBackward(dh, dc *mat.Dense, cache any, grads []*mat.Dense) (*mat.Dense, *mat.Dense, *mat.Dense) {
+	s := cache.(*gruStep)
+	units := l.Units
+	n, _ := dh.Dims()
+	gateWeights, candidateWeights := l.recurrentBlocks()
+
+	dz := mat.NewDense(n, 3*units, nil)
+	dhPrev := mat.NewDense(n, units, nil)
+	for sample := range n {
+		gates, dzRow := s.gates.RawRowView(sample), dz.RawRowView(sample)
+		for j := range units {
+			z, nValue := gates[j], gates[2*units+j]
+			dhValue := dh.At(sample, j)
+			dzRow[j] = dhValue * (s.h.At(sample, j) - nValue) * z * (1 - z)
+			dzRow[2*units+j] = dhValue * (1 - z) * (1 - nValue*nValue)
+			dhPrev.Set(sample, j, dhValue*z)
+		}
+	}
+	dCandidate := dz.Slice(0, n, 2*units, 3*units)
+
+	//through the candidate's recurrent weights to the reset gate
+	var dResetH mat.Dense
+	dResetH.Mul(dCandidate, candidateWeights.T())
+	for sample := range n {
+		gates, dzRow := s.gates.RawRowView(sample), dz.RawRowView(sample)
+		for j := range units {
+			r, hValue := gates[units+j], s.h.At(sample, j)
+			dzRow[units+j] = dResetH.At(sample, j) * hValue * r * (1 - r)
+			dhPrev.Set(sample, j, dhPrev.At(sample, j)+dResetH.At(sample, j)*r)
+		}
+	}
+	dGates := dz.Slice(0, n, 0, 2*units)
+
+	addMul(grads[0], s.x.T(), dz)
+	addMul(grads[1].Slice(0, units, 0, 2*units).(*mat.Dense), s.h.T(), dGates)
+	addMul(grads[1].Slice(0, units, 2*units, 3*units).(*mat.Dense), s.resetH.T(), dCandidate)
+	grads[2].Add(grads[2], columnSums(dz))
+
+	var dx mat.Dense
+	dx.Mul(dz, l.InputWeights.T())
+	addMul(dhPrev, dGates, gateWeights.T())
+	return &dx, dhPrev, nil
+}
@@ -0,0 +1,282 @@
+package neuralnetwork
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+var recurrentLayers = map[string]func(units int) recurrentLayer{
+	"SimpleRNN": func(units int) recurrentLayer { return NewSimpleRNN(units) },
+	"LSTM":      func(units int) recurrentLayer { return NewLSTM(units) },
+	"GRU":       func(units int) recurrentLayer { return NewGRU(units) },
+}
+
+// a recurrent layer with its settings exposed to the tests
+type recurrentLayer interface {
+	Layer
+	settings() *recurrent
+}
+
+func (r *recurrent) settings() *recurrent {
+	return r
+}
+
+// sequences of 4 steps of 3 features, the second and fourth samples are padded after 2 and 3 steps when masked
+func sequenceSetup(layer recurrentLayer, masked bool) (*MultiLayerPerceptron, *mat.Dense, *mat.Dense) {
+	r := rand.New(rand.NewSource(5))
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.InputShape = Shape{4, 3}
+	mlp.Layers = []Layer{layer}
+	mlp.Arch = []int{0, 3}
+	mlp.Activation = "tanh"
+	mlp.OutputActivation = "softmax"
+	mlp.LearningRate = 1
+
+	rng, _ := newRNG(1)
+	mlp.Arch[0] = layer.Build(mlp.InputShape, rng).Size()
+	mlp.initWeights()
+
+	params := layer.Params()
+	bias := params[len(params)-1]
+	_, cols := bias.Dims()
+	bias.Copy(randomDense(r, 1, cols))
+
+	X := randomDense(r, 5, 12)
+	if masked {
+		layer.settings().Mask = true
+		for j := 6; j < 12; j++ {
+			X.Set(1, j, 0)
+		}
+		for j := 9; j < 12; j++ {
+			X.Set(3, j, 0)
+		}
+	}
+	y := mat.NewDense(5, 3, nil)
+	for i := range 5 {
+		y.Set(i, r.Intn(3), 1)
+	}
+	return mlp, X, y
+}
+
+func TestRecurrentGradients(t *testing.T) {
+	for name, newLayer := range recurrentLayers {
+		for _, config := range []struct{ sequences, masked bool }{{false, false}, {true, false}, {false, true}, {true, true}} {
+			t.Run(fmt.Sprintf("%s %+v", name, config), func(t *testing.T) {
+				layer := newLayer(3)
+				layer.settings().ReturnSequences = config.sequences
+				mlp, X, y := sequenceSetup(layer, config.masked)
+				grads := mlp.backprop(X, y, nil)
+
+				for i, param := range layer.Params() {
+					checkGradient(t, fmt.Sprintf("param %d", i), mlp, X, y, param, grads.layers[i])
+				}
+				for l := range mlp.Weights {
+					checkGradient(t, "weights", mlp, X, y, mlp.Weights[l], grads.weights[l])
+				}
+
+				//the gradient of the input, with the loss Σ G ⊙ output
+				r := rand.New(rand.NewSource(6))
+				out, cache := layer.Forward(X, true)
+				rows, cols := out.Dims()
+				G := randomDense(r, rows, cols)
+				dX, _ := layer.Backward(G, cache)
+				loss := func() float64 {
+					out, _ := layer.Forward(X, true)
+					var product mat.Dense
+					product.MulElem(out, G)
+					return mat.Sum(&product)
+				}
+
+				const h = 1e-5
+				for i := range 5 {
+					for j := range 12 {
+						original := X.At(i, j)
+						//moving a padded value would unmask the step
+						if config.masked && original == 0 {
+							continue
+						}
+						X.Set(i, j, original+h)
+						plus := loss()
+						X.Set(i, j, original-h)
+						minus := loss()
+						X.Set(i, j, original)
+
+						if numeric := (plus - minus) / (2 * h); math.Abs(numeric-dX.At(i, j)) > 1e-6*math.Max(1, math.Abs(numeric)) {
+							t.Errorf("input[%d][%d]: backprop gradient %v, numerical gradient %v", i, j, dX.At(i, j), numeric)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestTruncatedBackprop(t *testing.T) {
+	for name, newLayer := range recurrentLayers {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(7))
+			X := randomDense(r, 3, 5*2)
+
+			gradients := func(truncate int) (*mat.Dense, []*mat.Dense) {
+				layer := newLayer(4)
+				layer.settings().TruncateSteps = truncate
+				rng, _ := newRNG(1)
+				layer.Build(Shape{5, 2}, rng)
+				out, cache := layer.Forward(X, true)
+				rows, cols := out.Dims()
+				return layer.Backward(randomDense(rand.New(rand.NewSource(8)), rows, cols), cache)
+			}
+
+			full, fullGrads := gradients(0)
+			whole, wholeGrads := gradients(5)
+			if !mat.EqualApprox(full, whole, 1e-12) {
+				t.Errorf("truncating after every step of the sequence should backpropagate through all of it")
+			}
+			equalWithin(t, "params", fullGrads, wholeGrads, 1e-12)
+
+			//chunks of steps 0-1, 2-3 and 4, only the last step's output is used so only it gets a gradient
+			truncated, truncatedGrads := gradients(2)
+			for j := range 10 {
+				got := truncated.At(0, j)
+				if j < 8 && got != 0 {
+					t.Errorf("input %d is before the last chunk but has gradient %v", j, got)
+				}
+				if j >= 8 && got != full.At(0, j) {
+					t.Errorf("input %d is in the last chunk, gradient %v want %v", j, got, full.At(0, j))
+				}
+			}
+			if mat.EqualApprox(truncatedGrads[1], fullGrads[1], 1e-12) {
+				t.Errorf("truncation did not change the gradient of the recurrent weights")
+			}
+		})
+	}
+}
+
+func TestRecurrentMaskMatchesShorterSequences(t *testing.T) {
+	for name, newLayer := range recurrentLayers {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(9))
+			short := randomDense(r, 2, 3*2)
+
+			//the same sequences padded from 3 to 5 steps
+			padded := mat.NewDense(2, 5*2, nil)
+			padded.Slice(0, 2, 0, 6).(*mat.Dense).Copy(short)
+
+			//the weights don't depend on the number of steps, so the same seed gives the same layer
+			rng, _ := newRNG(1)
+			shorter := newLayer(4)
+			shorter.Build(Shape{3, 2}, rng)
+			want, _ := shorter.Forward(short, false)
+
+			rng, _ = newRNG(1)
+			layer := newLayer(4)
+			layer.settings().Mask, layer.settings().ReturnSequences = true, true
+			layer.Build(Shape{5, 2}, rng)
+
+			got, _ := layer.Forward(padded, false)
+			for step := 2; step < 5; step++ {
+				last := got.Slice(0, 2, step*4, (step+1)*4)
+				if !mat.EqualApprox(last, want, 1e-12) {
+					t.Errorf("state after padded step %d\n%v\nwant\n%v", step, mat.Formatted(last), mat.Formatted(want))
+				}
+			}
+		})
+	}
+}
+
+func TestSaveLoadRecurrent(t *testing.T) {
+	for name, newLayer := range recurrentLayers {
+		t.Run(name, func(t *testing.T) {
+			layer := newLayer(3)
+			layer.settings().ReturnSequences = true
+			layer.settings().TruncateSteps = 2
+			mlp, X, _ := sequenceSetup(layer, true)
+			mlp.Fitted = true
+			want := mlp.DecisionFunction(X)
+
+			var buf bytes.Buffer
+			if err := mlp.Save(&buf); err != nil {
+				t.Fatal(err)
+			}
+			loaded := NewMultiLayerPerceptron()
+			if err := loaded.Load(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			settings := loaded.Layers[0].(recurrentLayer).settings()
+			if settings.Units != 3 || !settings.ReturnSequences || settings.TruncateSteps != 2 || !settings.Mask {
+				t.Errorf("the configuration of the layer was not saved: %+v", settings)
+			}
+			if got := loaded.DecisionFunction(X); !mat.EqualApprox(got, want, 1e-12) {
+				t.Errorf("loaded network predicts\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(want))
+			}
+		})
+	}
+}
+
+func TestRecurrentTrains(t *testing.T) {
+	//the class is the sign of the first step, followed by noise, so it has to be remembered to the end
+	r := rand.New(rand.NewSource(10))
+	X := mat.NewDense(100, 6, nil)
+	y := mat.NewDense(100, 2, nil)
+	for i := range 100 {
+		class := i % 2
+		X.Set(i, 0, float64(2*class-1))
+		for j := 1; j < 6; j++ {
+			X.Set(i, j, r.NormFloat64()*0.5)
+		}
+		y.Set(i, class, 1)
+	}
+
+	for name, newLayer := range recurrentLayers {
+		t.Run(name, func(t *testing.T) {
+			mlp := NewMultiLayerPerceptron()
+			mlp.InputShape = Shape{6, 1}
+			mlp.Layers = []Layer{newLayer(8)}
+			mlp.Arch = []int{8, 2}
+			mlp.Epochs = 30
+			mlp.BatchSize = 10
+			mlp.LearningRate = 0.1
+			mlp.Verbose = false
+			mlp.EpochMetrics = true
+			mlp.Seed = 1
+
+			history, err := mlp.Train(X, y, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			accuracy := history.Metric("accuracy")
+			if last := accuracy[len(accuracy)-1]; last < 95 {
+				t.Errorf("accuracy %v%%, expected the layer to remember the first step", last)
+			}
+		})
+	}
+}
+
+func TestRecurrentBadConfig(t *testing.T) {
+	for name, build := range map[string]func(){
+		"not a sequence": func() { NewLSTM(2).Build(Shape{1, 4, 4}, nil) },
+		"no units":       func() { NewGRU(0).Build(Shape{4, 4}, nil) },
+		"softmax": func() {
+			l := NewSimpleRNN(2)
+			l.Activation = "softmax"
+			l.Build(Shape{4, 4}, nil)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic")
+				}
+			}()
+			build()
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package neuralnetwork
+
+import "math"
+
+// Returns the regularisation strength for the weights of a layer
+// mlp.LayerAlpha overrides mlp.Alpha when it is set
+func (mlp *MultiLayerPerceptron) layerAlpha(layer int) float64 {
+	if mlp.LayerAlpha != nil {
+		if len(mlp.LayerAlpha) != len(mlp.Weights) {
+			panic("mlp.LayerAlpha needs one value for each layer of weights")
+		}
+		return mlp.LayerAlpha[layer]
+	}
+	return mlp.Alpha
+}
+
+// Returns how much of the penalty is l1 and how much is l2
+func (mlp *MultiLayerPerceptron) penaltyRatios() (float64, float64) {
+	switch mlp.Regularisation {
+	case "", "none":
+		return 0, 0
+	case "l1":
+		return 1, 0
+	case "l2":
+		return 0, 1
+	case "elasticnet":
+		return mlp.L1Ratio, 1 - mlp.L1Ratio
+	default:
+		panic("mlp.Regularisation must be \"l1\", \"l2\", \"elasticnet\" or \"none\"")
+	}
+}
+
+// Penalty on the weights (not the biases) that is added to the loss
+// l1 = α Σ|w|
+// l2 = α/2 Σw²
+// elasticnet = α (ρ Σ|w| + (1-ρ)/2 Σw²)
+func (mlp *MultiLayerPerceptron) penalty() float64 {
+	l1, l2 := mlp.penaltyRatios()
+	if l1 == 0 && l2 == 0 {
+		return 0
+	}
+
+	total := 0.0
+	for i := range mlp.Weights {
+		alpha := mlp.layerAlpha(i)
+		for _, w := range mlp.Weights[i].RawMatrix().Data {
+			total += alpha * (l1*math.Abs(w) + l2*w*w/2)
+		}
+	}
+	return total
+}
+
+// Adds the gradient of the penalty to the weight gradients, scaled by the learning rate like the rest of the gradients
+// Δw += η α (ρ sign(w) + (1-ρ) w)
+func (mlp *MultiLayerPerceptron) addPenaltyGrads(grads *gradients) {
+	l1, l2 := mlp.penaltyRatios()
+	if l1 == 0 && l2 == 0 {
+		return
+	}
+
+	for i := range grads.weights {
+		scale := mlp.LearningRate * mlp.layerAlpha(i)
+		weights := mlp.Weights[i].RawMatrix().Data
+		dw := grads.weights[i].RawMatrix().Data
+		for j, w := range weights {
+			dw[j] += scale * (l1*sign(w) + l2*w)
+		}
+	}
+}
+
+// Rescales the incoming weights of every unit so that their l2 norm is at most mlp.MaxNorm
+func (mlp *MultiLayerPerceptron) applyMaxNorm() {
+	if mlp.MaxNorm <= 0 {
+		return
+	}
+
+	for i := range mlp.Weights {
+		rows, cols := mlp.Weights[i].Dims()
+		for c := range cols {
+			norm := 0.0
+			for r := range rows {
+				w := mlp.Weights[i].At(r, c)
+				norm += w * w
+			}
+			norm = math.Sqrt(norm)
+
+			if norm > mlp.MaxNorm {
+				scale := mlp.MaxNorm / norm
+				for r := range rows {
+					mlp.Weights[i].Set(r, c, mlp.Weights[i].At(r, c)*scale)
+				}
+			}
+		}
+	}
+}
+
+// returns 1 x > 0, 0 if x = 0 and -1 if x < 0
+func sign(x float64) float64 {
+	if x > 0 {
+		return 1.0
+	} else if x < 0 {
+		return -1.0
+	}
+	return 0.0
+}
@@ -0,0 +1,81 @@
+package neuralnetwork
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestPenalty(t *testing.T) {
+	mlp := NewMultiLayerPerceptron()
+	mlp.Weights = []*mat.Dense{
+		mat.NewDense(1, 2, []float64{1, -2}),
+		mat.NewDense(2, 1, []float64{3, 0}),
+	}
+	mlp.Alpha = 0.1
+
+	tests := []struct {
+		regularisation string
+		l1Ratio        float64
+		layerAlpha     []float64
+		want           float64
+	}{
+		{"none", 0, nil, 0},
+		// 0.1 * (1 + 2 + 3)
+		{"l1", 0, nil, 0.6},
+		// 0.1/2 * (1 + 4 + 9)
+		{"l2", 0, nil, 0.7},
+		// 0.25 * 0.6 + 0.75 * 0.7
+		{"elasticnet", 0.25, nil, 0.675},
+		// only the second layer is penalised, 0.5/2 * 9
+		{"l2", 0, []float64{0, 0.5}, 2.25},
+	}
+
+	for _, test := range tests {
+		mlp.Regularisation = test.regularisation
+		mlp.L1Ratio = test.l1Ratio
+		mlp.LayerAlpha = test.layerAlpha
+
+		if got := mlp.penalty(); math.Abs(got-test.want) > 1e-12 {
+			t.Errorf("%s %v: got %v want %v", test.regularisation, test.layerAlpha, got, test.want)
+		}
+	}
+}
+
+func TestRegularisationGradients(t *testing.T) {
+	for _, regularisation := range []string{"l1", "l2", "elasticnet"} {
+		t.Run(regularisation, func(t *testing.T) {
+			mlp, X, y := gradientCheckSetup("none")
+			mlp.Regularisation = regularisation
+			mlp.LayerAlpha = []float64{0.05, 0, 0.2}
+
+			grads := mlp.backprop(X, y, nil)
+
+			//the biases are not penalised so only the weights are checked
+			for l := range mlp.Weights {
+				checkGradient(t, "weights", mlp, X, y, mlp.Weights[l], grads.weights[l])
+			}
+		})
+	}
+}
+
+func TestMaxNorm(t *testing.T) {
+	mlp := NewMultiLayerPerceptron()
+	mlp.MaxNorm = 1
+	mlp.Weights = []*mat.Dense{mat.NewDense(2, 2, []float64{
+		3, 0.6,
+		4, 0.8,
+	})}
+
+	mlp.applyMaxNorm()
+
+	//the first unit has norm 5 and is rescaled, the second already has norm 1
+	want := mat.NewDense(2, 2, []float64{
+		0.6, 0.6,
+		0.8, 0.8,
+	})
+	if !mat.EqualApprox(mlp.Weights[0], want, 1e-12) {
+		t.Errorf("got %v want %v", mat.Formatted(mlp.Weights[0]), mat.Formatted(want))
+	}
+}
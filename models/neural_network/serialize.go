@@ -0,0 +1,236 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/serialization"
+	"fmt"
+	"io"
+)
+
+const mlpKind = "MultiLayerPerceptron"
+
+// everything needed to make predictions with a trained network and to keep training it
+type mlpState struct {
+	Arch             []int
+	Activation       string
+	OutputActivation string
+	IsClassifier     bool
+	MultiLabel       bool
+	Thresholds       []float64
+	Classes          []float64
+	LossFunction     string
+	Fitted           bool
+
+	Epochs       int
+	BatchSize    int
+	LearningRate float64
+	Momentum     float64
+	Epsilon      float64
+	Workers      int
+	Seed         uint64
+
+	Regularisation string
+	Alpha          float64
+	L1Ratio        float64
+	LayerAlpha     []float64
+	MaxNorm        float64
+
+	Weights     []*serialization.Matrix
+	Bias        []*serialization.Matrix
+	WeightMasks []*serialization.Matrix
+
+	Normalization string
+	NormMomentum  float64
+	NormEpsilon   float64
+	Gamma         []*serialization.Matrix
+	Beta          []*serialization.Matrix
+	RunningMean   []*serialization.Matrix
+	RunningVar    []*serialization.Matrix
+
+	ClassWeight         map[int]float64
+	BalancedClassWeight bool
+
+	InputShape []int
+	Layers     []layerState
+}
+
+func (mlp *MultiLayerPerceptron) state() (*mlpState, error) {
+	layers, err := layerStates(mlp.Layers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mlpState{
+		Arch:             mlp.Arch,
+		Activation:       mlp.Activation,
+		OutputActivation: mlp.OutputActivation,
+		IsClassifier:     mlp.IsClassifier,
+		MultiLabel:       mlp.MultiLabel,
+		Thresholds:       mlp.Thresholds,
+		Classes:          mlp.Classes,
+		LossFunction:     mlp.LossFunction,
+		Fitted:           mlp.Fitted,
+		Epochs:           mlp.Epochs,
+		BatchSize:        mlp.BatchSize,
+		LearningRate:     mlp.LearningRate,
+		Momentum:         mlp.Momentum,
+		Epsilon:          mlp.Epsilon,
+		Workers:          mlp.Workers,
+		Seed:             mlp.Seed,
+		Regularisation:   mlp.Regularisation,
+		Alpha:            mlp.Alpha,
+		L1Ratio:          mlp.L1Ratio,
+		LayerAlpha:       mlp.LayerAlpha,
+		MaxNorm:          mlp.MaxNorm,
+		Weights:          serialization.FromDenses(mlp.Weights),
+		Bias:             serialization.FromDenses(mlp.Bias),
+		WeightMasks:      serialization.FromDenses(mlp.WeightMasks),
+		Normalization:    mlp.Normalization,
+		NormMomentum:     mlp.NormMomentum,
+		NormEpsilon:      mlp.NormEpsilon,
+		Gamma:            serialization.FromDenses(mlp.Gamma),
+		Beta:             serialization.FromDenses(mlp.Beta),
+		RunningMean:      serialization.FromDenses(mlp.RunningMean),
+		RunningVar:       serialization.FromDenses(mlp.RunningVar),
+
+		ClassWeight:         mlp.ClassWeight,
+		BalancedClassWeight: mlp.BalancedClassWeight,
+
+		InputShape: mlp.InputShape,
+		Layers:     layers,
+	}, nil
+}
+
+func (mlp *MultiLayerPerceptron) setState(s *mlpState) error {
+	weights, err := serialization.ToDenses(s.Weights)
+	if err != nil {
+		return err
+	}
+	bias, err := serialization.ToDenses(s.Bias)
+	if err != nil {
+		return err
+	}
+	gamma, err := serialization.ToDenses(s.Gamma)
+	if err != nil {
+		return err
+	}
+	beta, err := serialization.ToDenses(s.Beta)
+	if err != nil {
+		return err
+	}
+	runningMean, err := serialization.ToDenses(s.RunningMean)
+	if err != nil {
+		return err
+	}
+	runningVar, err := serialization.ToDenses(s.RunningVar)
+	if err != nil {
+		return err
+	}
+	masks, err := serialization.ToDenses(s.WeightMasks)
+	if err != nil {
+		return err
+	}
+	layers, err := layersFromStates(s.Layers, s.InputShape)
+	if err != nil {
+		return err
+	}
+
+	//check the matrices match the architecture before replacing anything, an untrained network has no weights
+	if s.Fitted || len(weights) > 0 {
+		if len(weights) != len(s.Arch)-1 || len(bias) != len(s.Arch)-1 {
+			return fmt.Errorf("saved network has %d layers of weights for an architecture of %d layers", len(weights), len(s.Arch))
+		}
+		for i := range weights {
+			r, c := weights[i].Dims()
+			_, bc := bias[i].Dims()
+			if r != s.Arch[i] || c != s.Arch[i+1] || bc != s.Arch[i+1] {
+				return fmt.Errorf("saved weights for layer %d do not match the architecture %v", i, s.Arch)
+			}
+		}
+	}
+	if masks != nil {
+		if len(masks) != len(s.Arch)-1 {
+			return fmt.Errorf("saved network has %d weight masks for an architecture of %d layers", len(masks), len(s.Arch))
+		}
+		for i := range masks {
+			if r, c := masks[i].Dims(); r != s.Arch[i] || c != s.Arch[i+1] {
+				return fmt.Errorf("saved weight mask for layer %d does not match the architecture %v", i, s.Arch)
+			}
+		}
+	}
+
+	mlp.Arch = s.Arch
+	mlp.Nlayers = len(s.Arch)
+	mlp.Activation = s.Activation
+	mlp.OutputActivation = s.OutputActivation
+	mlp.IsClassifier = s.IsClassifier
+	mlp.MultiLabel = s.MultiLabel
+	mlp.Thresholds = s.Thresholds
+	mlp.Classes = s.Classes
+	mlp.ClassWeight = s.ClassWeight
+	mlp.BalancedClassWeight = s.BalancedClassWeight
+	mlp.LossFunction = s.LossFunction
+	mlp.Fitted = s.Fitted
+	mlp.Epochs = s.Epochs
+	mlp.BatchSize = s.BatchSize
+	mlp.LearningRate = s.LearningRate
+	mlp.Momentum = s.Momentum
+	mlp.Epsilon = s.Epsilon
+	mlp.Workers = s.Workers
+	mlp.Seed = s.Seed
+	mlp.Regularisation = s.Regularisation
+	mlp.Alpha = s.Alpha
+	mlp.L1Ratio = s.L1Ratio
+	mlp.LayerAlpha = s.LayerAlpha
+	mlp.MaxNorm = s.MaxNorm
+	mlp.Weights = weights
+	mlp.Bias = bias
+	mlp.WeightMasks = masks
+	mlp.Normalization = s.Normalization
+	mlp.NormMomentum = s.NormMomentum
+	mlp.NormEpsilon = s.NormEpsilon
+	mlp.Gamma = gamma
+	mlp.Beta = beta
+	mlp.RunningMean = runningMean
+	mlp.RunningVar = runningVar
+	mlp.InputShape = s.InputShape
+	mlp.Layers = layers
+
+	//the optimizer starts again from a loaded model
+	mlp.weightVelocities, mlp.biasVelocities = nil, nil
+	mlp.gammaVelocities, mlp.betaVelocities = nil, nil
+	mlp.layerVelocities = nil
+	mlp.buildSparse()
+
+	return nil
+}
+
+// Saves the network in the compact binary format
+// the weights and the hyperparameters that decide how it predicts and trains are kept, including Epsilon, Workers and Seed
+// the settings of a training run are not, such as Verbose, Callbacks, early stopping, checkpointing and the initial weights,
+// nor the momentum and random number generator state that a checkpoint keeps, see Resume
+func (mlp *MultiLayerPerceptron) Save(w io.Writer) error {
+	return mlp.save(w, serialization.Binary)
+}
+
+// Saves the network as human readable JSON
+func (mlp *MultiLayerPerceptron) SaveJSON(w io.Writer) error {
+	return mlp.save(w, serialization.JSON)
+}
+
+// the layers of mlp.Layers have to be LayerTypes to be saved
+func (mlp *MultiLayerPerceptron) save(w io.Writer, format serialization.Format) error {
+	state, err := mlp.state()
+	if err != nil {
+		return err
+	}
+	return serialization.Write(w, mlpKind, format, state)
+}
+
+// Loads a network saved with Save or SaveJSON, replacing the architecture, hyperparameters and weights
+func (mlp *MultiLayerPerceptron) Load(r io.Reader) error {
+	var s mlpState
+	if err := serialization.Read(r, mlpKind, &s); err != nil {
+		return err
+	}
+	return mlp.setState(&s)
+}
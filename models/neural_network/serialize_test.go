@@ -0,0 +1,73 @@
+package neuralnetwork
+
+import (
+	"Go-Machine-Learning/serialization"
+	"bytes"
+	"errors"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestSaveLoad(t *testing.T) {
+	for _, normalization := range []string{"none", "batch"} {
+		mlp, X, _ := gradientCheckSetup(normalization)
+		mlp.Fitted = true
+		mlp.Epsilon = 1e-7
+		mlp.Workers = 3
+		mlp.Seed = 42
+		//move the running statistics away from their starting values
+		mlp.forward(X, true)
+		want := mlp.DecisionFunction(X)
+
+		saves := map[string]func(*bytes.Buffer) error{
+			"binary": func(b *bytes.Buffer) error { return mlp.Save(b) },
+			"json":   func(b *bytes.Buffer) error { return mlp.SaveJSON(b) },
+		}
+		for name, save := range saves {
+			var buf bytes.Buffer
+			if err := save(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			loaded := NewMultiLayerPerceptron()
+			if err := loaded.Load(&buf); err != nil {
+				t.Fatalf("%s %s: %v", normalization, name, err)
+			}
+
+			if !mat.EqualApprox(loaded.DecisionFunction(X), want, 1e-12) {
+				t.Errorf("%s %s: predictions of the loaded network differ", normalization, name)
+			}
+			if loaded.Activation != "tanh" || loaded.Normalization != normalization || loaded.LearningRate != 1 {
+				t.Errorf("%s %s: hyperparameters were not loaded", normalization, name)
+			}
+			if loaded.Epsilon != 1e-7 || loaded.Workers != 3 || loaded.Seed != 42 {
+				t.Errorf("%s %s: Epsilon %v, Workers %d and Seed %d were not loaded", normalization, name, loaded.Epsilon, loaded.Workers, loaded.Seed)
+			}
+		}
+	}
+}
+
+func TestLoadWrongModel(t *testing.T) {
+	var buf bytes.Buffer
+	serialization.Write(&buf, "Kmeans", serialization.Binary, struct{ NClusters int }{3})
+
+	err := NewMultiLayerPerceptron().Load(&buf)
+	if !errors.Is(err, serialization.ErrWrongKind) {
+		t.Errorf("got error %v want %v", err, serialization.ErrWrongKind)
+	}
+}
+
+func TestLoadMismatchedWeights(t *testing.T) {
+	mlp, _, _ := gradientCheckSetup("none")
+	mlp.Fitted = true
+	mlp.Arch = []int{4, 6, 6, 3}
+
+	var buf bytes.Buffer
+	if err := mlp.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewMultiLayerPerceptron().Load(&buf); err == nil {
+		t.Errorf("expected an error when the weights do not match the architecture")
+	}
+}
@@ -0,0 +1,111 @@
+package neuralnetwork
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// predictions are clipped to [epsilon, 1 - epsilon] before taking logs when no epsilon is given
+const defaultEpsilon = 1e-12
+
+// Softmax over each row of x in place
+// the row max is subtracted before exponentiating so large logits can't overflow, softmax(x) = softmax(x - max(x))
+func Softmax(x *mat.Dense) {
+	rows, _ := x.Dims()
+	for i := range rows {
+		row := x.RawRowView(i)
+		max := rowMax(row)
+
+		sum := 0.0
+		for j, value := range row {
+			row[j] = math.Exp(value - max)
+			sum += row[j]
+		}
+		for j := range row {
+			row[j] /= sum
+		}
+	}
+}
+
+// Log of the softmax over each row of x in place, using the log-sum-exp trick
+// log softmax(x) = x - max(x) - log Σ exp(x - max(x))
+func LogSoftmax(x *mat.Dense) {
+	rows, _ := x.Dims()
+	for i := range rows {
+		row := x.RawRowView(i)
+		logSum := logSumExp(row)
+		for j := range row {
+			row[j] -= logSum
+		}
+	}
+}
+
+// Cross entropy of the probabilities h, clipped to [epsilon, 1 - epsilon] so a confident wrong prediction is not +Inf
+// -1/m Σ y log(h)
+func CrossEntropy(y, h *mat.Dense, epsilon float64) float64 {
+	sum := 0.0
+	rows, cols := y.Dims()
+	for i := range rows {
+		for j := range cols {
+			if target := y.At(i, j); target != 0 {
+				p := math.Min(math.Max(h.At(i, j), epsilon), 1-epsilon)
+				sum += -target * math.Log(p)
+			}
+		}
+	}
+	return sum / float64(rows)
+}
+
+// Cross entropy of the softmax of the logits, fused so it stays finite however large the logits are
+// -1/m Σ y log softmax(z)
+func CrossEntropyFromLogits(y, logits *mat.Dense) float64 {
+	sum := 0.0
+	rows, cols := y.Dims()
+	row := make([]float64, cols)
+	for i := range rows {
+		mat.Row(row, i, logits)
+		logSum := logSumExp(row)
+		for j := range cols {
+			if target := y.At(i, j); target != 0 {
+				sum += -target * (row[j] - logSum)
+			}
+		}
+	}
+	return sum / float64(rows)
+}
+
+// Gradient of CrossEntropyFromLogits with respect to the logits
+// ∂L/∂z = (softmax(z) - y) / m
+func CrossEntropyFromLogitsGradient(y, logits *mat.Dense) *mat.Dense {
+	rows, _ := y.Dims()
+
+	var grad mat.Dense
+	grad.CloneFrom(logits)
+	Softmax(&grad)
+	grad.Sub(&grad, y)
+	grad.Scale(1/float64(rows), &grad)
+	return &grad
+}
+
+func rowMax(row []float64) float64 {
+	max := math.Inf(-1)
+	for _, value := range row {
+		max = math.Max(max, value)
+	}
+	return max
+}
+
+// log Σ exp(x), shifted by the max so it never overflows
+func logSumExp(row []float64) float64 {
+	max := rowMax(row)
+	if math.IsInf(max, 0) {
+		return max
+	}
+
+	sum := 0.0
+	for _, value := range row {
+		sum += math.Exp(value - max)
+	}
+	return max + math.Log(sum)
+}
@@ -0,0 +1,172 @@
+package neuralnetwork
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func finite(t *testing.T, name string, m *mat.Dense) {
+	t.Helper()
+	for _, value := range m.RawMatrix().Data {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			t.Fatalf("%s has a non finite value: %v", name, mat.Formatted(m))
+		}
+	}
+}
+
+func TestSoftmaxExtremeLogits(t *testing.T) {
+	x := mat.NewDense(3, 3, []float64{
+		1000, 0, -1000,
+		-1000, -1000, -1000,
+		800, 800, -800,
+	})
+	Softmax(x)
+	finite(t, "softmax", x)
+
+	want := mat.NewDense(3, 3, []float64{
+		1, 0, 0,
+		1.0 / 3, 1.0 / 3, 1.0 / 3,
+		0.5, 0.5, 0,
+	})
+	if !mat.EqualApprox(x, want, 1e-12) {
+		t.Errorf("got %v want %v", mat.Formatted(x), mat.Formatted(want))
+	}
+}
+
+func TestLogSoftmax(t *testing.T) {
+	x := mat.NewDense(2, 3, []float64{
+		1, 2, 3,
+		1000, 0, -1000,
+	})
+	LogSoftmax(x)
+	finite(t, "log softmax", x)
+
+	//the first row is small enough to check against the naive formula
+	logSum := math.Log(math.Exp(1) + math.Exp(2) + math.Exp(3))
+	for j, logit := range []float64{1, 2, 3} {
+		if math.Abs(x.At(0, j)-(logit-logSum)) > 1e-12 {
+			t.Errorf("log softmax %v want %v", x.At(0, j), logit-logSum)
+		}
+	}
+	if x.At(1, 0) != 0 || x.At(1, 1) != -1000 || x.At(1, 2) != -2000 {
+		t.Errorf("log softmax of extreme logits %v", mat.Row(nil, 1, x))
+	}
+}
+
+func TestCrossEntropyFromLogitsExtreme(t *testing.T) {
+	y := mat.NewDense(2, 3, []float64{
+		0, 0, 1,
+		1, 0, 0,
+	})
+	//the first sample is confidently wrong, the second confidently right
+	logits := mat.NewDense(2, 3, []float64{
+		1000, 0, -1000,
+		1000, 0, -1000,
+	})
+
+	loss := CrossEntropyFromLogits(y, logits)
+	if math.Abs(loss-1000) > 1e-9 {
+		t.Errorf("loss %v want 1000", loss)
+	}
+
+	grad := CrossEntropyFromLogitsGradient(y, logits)
+	finite(t, "gradient", grad)
+	want := mat.NewDense(2, 3, []float64{
+		0.5, 0, -0.5,
+		0, 0, 0,
+	})
+	if !mat.EqualApprox(grad, want, 1e-12) {
+		t.Errorf("gradient %v want %v", mat.Formatted(grad), mat.Formatted(want))
+	}
+}
+
+func TestCrossEntropyFromLogitsGradient(t *testing.T) {
+	y := mat.NewDense(2, 3, []float64{
+		0, 1, 0,
+		0.2, 0.3, 0.5,
+	})
+	logits := mat.NewDense(2, 3, []float64{
+		0.5, -1, 2,
+		3, 0.1, -0.7,
+	})
+
+	grad := CrossEntropyFromLogitsGradient(y, logits)
+
+	h := 1e-6
+	for i := range 2 {
+		for j := range 3 {
+			original := logits.At(i, j)
+			logits.Set(i, j, original+h)
+			plus := CrossEntropyFromLogits(y, logits)
+			logits.Set(i, j, original-h)
+			minus := CrossEntropyFromLogits(y, logits)
+			logits.Set(i, j, original)
+
+			numeric := (plus - minus) / (2 * h)
+			if math.Abs(numeric-grad.At(i, j)) > 1e-7 {
+				t.Errorf("gradient (%d, %d) %v numeric %v", i, j, grad.At(i, j), numeric)
+			}
+		}
+	}
+}
+
+func TestCrossEntropyClipping(t *testing.T) {
+	y := mat.NewDense(1, 2, []float64{1, 0})
+	h := mat.NewDense(1, 2, []float64{0, 1})
+
+	loss := CrossEntropy(y, h, 1e-7)
+	if math.Abs(loss-(-math.Log(1e-7))) > 1e-9 {
+		t.Errorf("loss %v want %v", loss, -math.Log(1e-7))
+	}
+	if loss := LossFunctions["crossEntropyLoss"](y, h); math.IsInf(loss, 0) {
+		t.Errorf("crossEntropyLoss of a confident wrong prediction is %v", loss)
+	}
+}
+
+func TestTrainingLossWithExtremeLogits(t *testing.T) {
+	mlp, X, y := gradientCheckSetup("none")
+	//weights this large saturate the softmax so the naive loss would be +Inf
+	mlp.Weights[len(mlp.Weights)-1].Scale(1e4, mlp.Weights[len(mlp.Weights)-1])
+
+	loss := trainingLoss(mlp, X, y)
+	if math.IsNaN(loss) || math.IsInf(loss, 0) {
+		t.Fatalf("loss %v", loss)
+	}
+
+	grads := mlp.backprop(X, y, nil)
+	for i := range grads.weights {
+		finite(t, "weight gradients", grads.weights[i])
+	}
+}
+
+func TestTrainLogSoftmax(t *testing.T) {
+	X, y := blobs(rand.New(rand.NewSource(8)), 300)
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{8, 16, 3}
+	mlp.OutputActivation = "logsoftmax"
+	mlp.Epochs = 20
+	mlp.BatchSize = 16
+	mlp.Verbose = false
+	mlp.EpochMetrics = true
+	mlp.Seed = 1
+	history, err := mlp.Train(X, y, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the cross entropy of log probabilities is the negative log likelihood, without changing the configured loss
+	if got := mlp.lossFunction(); got != "nllLoss" || mlp.LossFunction != "crossEntropyLoss" {
+		t.Errorf("trained %q with mlp.LossFunction %q, want nllLoss and crossEntropyLoss", got, mlp.LossFunction)
+	}
+	loss := history.Metric("loss")
+	if loss[len(loss)-1] > loss[0]/2 {
+		t.Errorf("loss went from %v to %v", loss[0], loss[len(loss)-1])
+	}
+	if accuracy := mlp.Accuracy(y, mlp.PredictProba(X)); accuracy < 95 {
+		t.Errorf("accuracy %v%%", accuracy)
+	}
+}
@@ -0,0 +1,166 @@
+package neuralnetwork
+
+import (
+	"fmt"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Encoder block of a transformer, self-attention followed by a feed forward network applied to every step on its own,
+// each with a residual connection and layer normalization
+// h = LayerNorm(x + MultiHeadAttention(x))
+// output = LayerNorm(h + g(h • W1 + b1) • W2 + b2)
+// the input and output have Shape{steps, dim}, so blocks can be stacked
+type TransformerEncoder struct {
+	sequenceLayer
+	// number of attention heads, which has to divide the dim of the input
+	Heads int
+	// size of the hidden layer of the feed forward network, 0 for four times the dim of the input
+	FeedForward int
+	// activation of the feed forward hidden layer, "relu", "tanh", "sigmoid" or "identity"
+	Activation string
+	// added to the variance in the layer normalizations
+	Epsilon float64
+
+	// weights of the feed forward network
+	Weights1 *mat.Dense `json:"-"`
+	Bias1    *mat.Dense `json:"-"`
+	Weights2 *mat.Dense `json:"-"`
+	Bias2    *mat.Dense `json:"-"`
+	// scale and shift after the attention and after the feed forward network
+	Gamma1 *mat.Dense `json:"-"`
+	Beta1  *mat.Dense `json:"-"`
+	Gamma2 *mat.Dense `json:"-"`
+	Beta2  *mat.Dense `json:"-"`
+
+	attention *MultiHeadAttention
+	hidden    int
+}
+
+// TransformerEncoder with relu in the feed forward network
+func NewTransformerEncoder(heads, feedForward int) *TransformerEncoder {
+	return &TransformerEncoder{Heads: heads, FeedForward: feedForward, Activation: "relu", Epsilon: 1e-5}
+}
+
+type encoderCache struct {
+	attention *attentionCache
+	norm1     *normCache
+	norm2     *normCache
+	//the output of the first layer normalization, and the feed forward hidden layer before and after the activation
+	h, z, a *mat.Dense
+}
+
+func (l *TransformerEncoder) Build(input Shape, rng *rand.Rand) Shape {
+	l.build("TransformerEncoder", input)
+	if _, ok := Derivative[l.Activation]; !ok {
+		panic(fmt.Sprintf("TransformerEncoder.Activation %q must be \"relu\", \"tanh\", \"sigmoid\" or \"identity\"", l.Activation))
+	}
+
+	l.attention = &MultiHeadAttention{sequenceLayer: l.sequenceLayer, Heads: l.Heads}
+	l.attention.Build(input, rng)
+
+	l.hidden = l.FeedForward
+	if l.hidden == 0 {
+		l.hidden = 4 * l.dim
+	}
+	l.Weights1 = DefaultInitializer(l.Activation).Initialize(l.dim, l.hidden, rng)
+	l.Bias1 = mat.NewDense(1, l.hidden, nil)
+	l.Weights2 = GlorotUniform{}.Initialize(l.hidden, l.dim, rng)
+	l.Bias2 = mat.NewDense(1, l.dim, nil)
+
+	l.Gamma1, l.Beta1 = mat.NewDense(1, l.dim, nil), mat.NewDense(1, l.dim, nil)
+	l.Gamma2, l.Beta2 = mat.NewDense(1, l.dim, nil), mat.NewDense(1, l.dim, nil)
+	for j := range l.dim {
+		l.Gamma1.Set(0, j, 1)
+		l.Gamma2.Set(0, j, 1)
+	}
+	return input
+}
+
+func (l *TransformerEncoder) Forward(X *mat.Dense, training bool) (*mat.Dense, any) {
+	n, _ := X.Dims()
+	tokens := l.tokens(X)
+	padding := l.paddingSteps(tokens)
+
+	attended, attentionCache := l.attention.attend(tokens, padding)
+	attended.Add(attended, tokens)
+	h, norm1 := l.normalize(attended, l.Gamma1, l.Beta1)
+
+	var z mat.Dense
+	z.Mul(h, l.Weights1)
+	addIntercepts(z, *l.Bias1)
+	a := mat.DenseCopyOf(&z)
+	Activate[l.Activation](a)
+
+	var f mat.Dense
+	f.Mul(a, l.Weights2)
+	addIntercepts(f, *l.Bias2)
+	f.Add(&f, h)
+	out, norm2 := l.normalize(&f, l.Gamma2, l.Beta2)
+	l.fillPadding(out, padding)
+
+	return reshape(out, n, l.steps*l.dim), &encoderCache{attention: attentionCache, norm1: norm1, norm2: norm2, h: h, z: &z, a: a}
+}
+
+// the backward pass of each part of Forward in reverse, the residual connections add their gradient to the one that
+// went through the part they skipped
+func (l *TransformerEncoder) Backward(grad *mat.Dense, cache any) (*mat.Dense, []*mat.Dense) {
+	c := cache.(*encoderCache)
+	n, _ := grad.Dims()
+	dOut := maskRows(l.tokens(grad), c.attention.padding)
+
+	dF, dGamma2, dBeta2 := l.normalizeBackward(dOut, c.norm2, l.Gamma2)
+
+	var dWeights2, dA mat.Dense
+	dWeights2.Mul(c.a.T(), dF)
+	dA.Mul(dF, l.Weights2.T())
+	dZ := mat.DenseCopyOf(c.z)
+	Derivative[l.Activation](dZ)
+	dZ.MulElem(dZ, &dA)
+
+	var dWeights1 mat.Dense
+	dWeights1.Mul(c.h.T(), dZ)
+	dH := mat.DenseCopyOf(dF)
+	addMul(dH, dZ, l.Weights1.T())
+
+	dAttended, dGamma1, dBeta1 := l.normalizeBackward(dH, c.norm1, l.Gamma1)
+	dTokens, attentionGrads := l.attention.attendBackward(dAttended, c.attention)
+	dTokens.Add(dTokens, dAttended)
+
+	grads := append(attentionGrads,
+		dGamma1, dBeta1,
+		&dWeights1, columnSums(dZ), &dWeights2, columnSums(dF),
+		dGamma2, dBeta2,
+	)
+	return reshape(dTokens, n, l.steps*l.dim), grads
+}
+
+func (l *TransformerEncoder) Params() []*mat.Dense {
+	return append(l.attention.Params(),
+		l.Gamma1, l.Beta1,
+		l.Weights1, l.Bias1, l.Weights2, l.Bias2,
+		l.Gamma2, l.Beta2,
+	)
+}
+
+// layer normalization of each step, γ ⊙ x̂ + β
+func (l *TransformerEncoder) normalize(x, gamma, beta *mat.Dense) (*mat.Dense, *normCache) {
+	xhat, cache := normalizeRows(x, l.Epsilon)
+	rows, _ := xhat.Dims()
+	y := mat.NewDense(rows, l.dim, nil)
+	for i := range rows {
+		for j := range l.dim {
+			y.Set(i, j, gamma.At(0, j)*xhat.At(i, j)+beta.At(0, j))
+		}
+	}
+	return y, cache
+}
+
+// returns the gradients of the input, γ and β of normalize
+func (l *TransformerEncoder) normalizeBackward(dout *mat.Dense, cache *normCache, gamma *mat.Dense) (*mat.Dense, *mat.Dense, *mat.Dense) {
+	var dgamma, dxhat mat.Dense
+	dgamma.MulElem(dout, cache.xhat)
+	dxhat.Apply(func(i, j int, v float64) float64 { return v * gamma.At(0, j) }, dout)
+	return normalizeRowsBackward(&dxhat, cache), columnSums(&dgamma), columnSums(dout)
+}
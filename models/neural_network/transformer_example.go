@@ -0,0 +1,77 @@
+package neuralnetwork
+
+import (
+	"fmt"
+
+	"golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Transformer classifying sequences of tokens by their order, which a bag of words can't do
+// each sequence has 8 to 16 tokens from 1 to 9 padded with 0, and the class is whether a 1 comes before a 2
+// trains in a few minutes on a CPU
+func TransformerExample() {
+
+	rng := rand.New(rand.NewSource(1))
+	XTrain, yTrain := orderedSequences(rng, 4000, 16)
+	XTest, yTest := orderedSequences(rng, 1000, 16)
+
+	// 16 token IDs -> 16x32 vectors with their positions -> 2 encoder blocks -> 512
+	embedding := NewEmbedding(10, 32)
+	embedding.HasPadding = true
+	embedding.PaddingIndex = 0
+	positions := NewPositionalEncoding()
+	positions.Mask = true
+	encoder1 := NewTransformerEncoder(4, 64)
+	encoder1.Mask = true
+	encoder2 := NewTransformerEncoder(4, 64)
+	encoder2.Mask = true
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.InputShape = Shape{16}
+	mlp.Layers = []Layer{embedding, positions, encoder1, encoder2}
+	mlp.Arch = []int{512, 32, 2}
+	mlp.Epochs = 10
+	mlp.BatchSize = 32
+	mlp.LearningRate = 0.01
+	mlp.IsClassifier = true
+	mlp.Workers = 4
+
+	//Train the model
+	if _, err := mlp.Train(XTrain, yTrain, XTest, yTest); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	//Make a prediciton of one of the samples
+	xPredict := XTest.Slice(0, 2, 0, 16).(*mat.Dense)
+	prediction := mlp.Predict(xPredict)
+	fmt.Printf("sequences: %v\n", mat.Formatted(xPredict))
+	fmt.Printf("prediction: %v\n", prediction)
+
+}
+
+// n sequences of up to steps tokens, one hot encoded by whether the first 1 comes before the first 2
+func orderedSequences(rng *rand.Rand, n, steps int) (*mat.Dense, *mat.Dense) {
+	X := mat.NewDense(n, steps, nil)
+	y := mat.NewDense(n, 2, nil)
+	for i := range n {
+		length := steps/2 + rng.Intn(steps/2+1)
+		for j := range length {
+			X.Set(i, j, float64(3+rng.Intn(7)))
+		}
+		first, second := rng.Intn(length), rng.Intn(length-1)
+		if second >= first {
+			second++
+		}
+		X.Set(i, first, 1)
+		X.Set(i, second, 2)
+
+		if first < second {
+			y.Set(i, 1, 1)
+		} else {
+			y.Set(i, 0, 1)
+		}
+	}
+	return X, y
+}
@@ -0,0 +1,104 @@
+package neuralnetwork
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestTransformerEncoderGradients(t *testing.T) {
+	for _, masked := range []bool{false, true} {
+		t.Run(fmt.Sprintf("masked %v", masked), func(t *testing.T) {
+			encoder := NewTransformerEncoder(2, 6)
+			encoder.Activation = "tanh"
+			checkLayerGradients(t, masked, NewPositionalEncoding(), encoder, NewTransformerEncoder(1, 0))
+		})
+	}
+}
+
+func TestTransformerEncoderIgnoresPadding(t *testing.T) {
+	r := rand.New(rand.NewSource(18))
+	short := randomDense(r, 2, 3*4)
+	padded := mat.NewDense(2, 5*4, nil)
+	padded.Slice(0, 2, 0, 12).(*mat.Dense).Copy(short)
+
+	rng, _ := newRNG(1)
+	shorter := NewTransformerEncoder(2, 8)
+	shorter.Build(Shape{3, 4}, rng)
+	want, _ := shorter.Forward(short, false)
+
+	rng, _ = newRNG(1)
+	encoder := NewTransformerEncoder(2, 8)
+	encoder.Mask = true
+	encoder.Build(Shape{5, 4}, rng)
+	got, _ := encoder.Forward(padded, false)
+
+	if real := got.Slice(0, 2, 0, 12); !mat.EqualApprox(real, want, 1e-12) {
+		t.Errorf("encoding of the real steps\n%v\nwant\n%v", mat.Formatted(real), mat.Formatted(want))
+	}
+	if padding := got.Slice(0, 2, 12, 20); !mat.Equal(padding, mat.NewDense(2, 8, nil)) {
+		t.Errorf("padding steps should stay as MaskValue, got %v", mat.Formatted(padding))
+	}
+}
+
+func TestSaveLoadTransformer(t *testing.T) {
+	learned := NewPositionalEncoding()
+	learned.Encoding = "learned"
+	mlp, X, _ := attentionSetup(false, learned, NewMultiHeadAttention(2), NewTransformerEncoder(2, 6))
+	mlp.Fitted = true
+	want := mlp.DecisionFunction(X)
+
+	var buf bytes.Buffer
+	if err := mlp.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMultiLayerPerceptron()
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	encoder := loaded.Layers[2].(*TransformerEncoder)
+	if encoder.Heads != 2 || encoder.FeedForward != 6 || encoder.Activation != "relu" {
+		t.Errorf("the configuration of the encoder was not saved: %+v", encoder)
+	}
+	if got := loaded.DecisionFunction(X); !mat.EqualApprox(got, want, 1e-12) {
+		t.Errorf("loaded network predicts\n%v\nwant\n%v", mat.Formatted(got), mat.Formatted(want))
+	}
+}
+
+func TestTransformerTrains(t *testing.T) {
+	rng, _ := newRNG(19)
+	X, y := orderedSequences(rng, 200, 8)
+
+	embedding := NewEmbedding(10, 8)
+	embedding.HasPadding = true
+	embedding.PaddingIndex = 0
+	positions := NewPositionalEncoding()
+	positions.Mask = true
+	encoder := NewTransformerEncoder(2, 16)
+	encoder.Mask = true
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.InputShape = Shape{8}
+	mlp.Layers = []Layer{embedding, positions, encoder}
+	mlp.Arch = []int{64, 16, 2}
+	mlp.Epochs = 30
+	mlp.BatchSize = 10
+	mlp.LearningRate = 0.02
+	mlp.Verbose = false
+	mlp.EpochMetrics = true
+	mlp.Seed = 1
+
+	history, err := mlp.Train(X, y, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accuracy := history.Metric("accuracy")
+	if last := accuracy[len(accuracy)-1]; last < 95 {
+		t.Errorf("accuracy %v%%, expected the encoder to learn the order of the tokens", last)
+	}
+}
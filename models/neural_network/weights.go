@@ -0,0 +1,118 @@
+package neuralnetwork
+
+import (
+	"fmt"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Weight of every class in the loss, from mlp.ClassWeight or balanced from the class counts of ds
+// returns nil when the classes are not weighted
+// balanced weights are n_samples / (n_classes · count), so each class adds the same total weight to the loss
+// n_classes is every class of the network, a class missing from ds keeps a weight of 1 as it never adds to the loss
+func (mlp *MultiLayerPerceptron) classWeights(ds Dataset, batchSize int) ([]float64, error) {
+	if mlp.ClassWeight == nil && !mlp.BalancedClassWeight {
+		return nil, nil
+	}
+	if !mlp.IsClassifier || mlp.MultiLabel {
+		panic("class weights can only be used by single label classifiers")
+	}
+
+	nClasses := max(mlp.Arch[len(mlp.Arch)-1], 2)
+	weights := make([]float64, nClasses)
+
+	if !mlp.BalancedClassWeight {
+		for i := range weights {
+			weights[i] = 1
+		}
+		for class, w := range mlp.ClassWeight {
+			if class < 0 || class >= nClasses {
+				panic(fmt.Sprintf("mlp.ClassWeight has a weight for class %d but there are %d classes", class, nClasses))
+			}
+			weights[class] = w
+		}
+		return weights, nil
+	}
+
+	counts := make([]float64, nClasses)
+	loader := &DataLoader{Dataset: ds, BatchSize: batchSize}
+	batches := loader.Iter()
+	defer batches.Close()
+	for batches.Next() {
+		_, y := batches.Batch()
+		rows, _ := y.Dims()
+		for i := range rows {
+			counts[sampleClass(y, i)]++
+		}
+	}
+	if err := batches.Err(); err != nil {
+		return nil, err
+	}
+
+	for class, count := range counts {
+		weights[class] = 1
+		if count > 0 {
+			weights[class] = float64(ds.Len()) / (float64(nClasses) * count)
+		}
+	}
+	return weights, nil
+}
+
+// the class of sample i of one hot targets, or of 0/1 targets when there is a single output
+func sampleClass(y *mat.Dense, i int) int {
+	_, cols := y.Dims()
+	if cols == 1 {
+		if y.At(i, 0) > 0.5 {
+			return 1
+		}
+		return 0
+	}
+	return argmax(y.RawRowView(i))
+}
+
+// Weight of each sample of a batch, its sample weight times the weight of its class
+// returns nil if neither are used so the batch is unweighted
+func batchWeights(sampleWeight []float64, y *mat.Dense, classWeight []float64) []float64 {
+	if classWeight == nil {
+		return sampleWeight
+	}
+
+	rows, _ := y.Dims()
+	weights := make([]float64, rows)
+	for i := range rows {
+		weights[i] = classWeight[sampleClass(y, i)]
+		if sampleWeight != nil {
+			weights[i] *= sampleWeight[i]
+		}
+	}
+	return weights
+}
+
+// Loss of the output of a forward pass with the loss of each sample multiplied by its weight
+// 1/m Σ w_i L_i, which is outputLoss when w is nil
+func (mlp *MultiLayerPerceptron) weightedOutputLoss(y *mat.Dense, activations, zs []*mat.Dense, w []float64) float64 {
+	if w == nil {
+		return mlp.outputLoss(y, activations, zs)
+	}
+
+	h, z := activations[len(activations)-1], zs[len(zs)-1]
+	rows, cols := y.Dims()
+	total := 0.0
+	for i := range rows {
+		row := func(m *mat.Dense) *mat.Dense {
+			return m.Slice(i, i+1, 0, cols).(*mat.Dense)
+		}
+		total += w[i] * mlp.outputLoss(row(y), []*mat.Dense{row(h)}, []*mat.Dense{row(z)})
+	}
+	return total / float64(rows)
+}
+
+// multiplies each row of m by the weight of its sample
+func scaleRows(m *mat.Dense, w []float64) {
+	for i, weight := range w {
+		row := m.RawRowView(i)
+		for j := range row {
+			row[j] *= weight
+		}
+	}
+}
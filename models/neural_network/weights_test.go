@@ -0,0 +1,178 @@
+package neuralnetwork
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// appends a copy of row i to the end of m
+func withRepeatedRow(m *mat.Dense, i int) *mat.Dense {
+	rows, cols := m.Dims()
+	repeated := mat.NewDense(rows+1, cols, nil)
+	repeated.Slice(0, rows, 0, cols).(*mat.Dense).Copy(m)
+	repeated.SetRow(rows, m.RawRowView(i))
+	return repeated
+}
+
+func TestSampleWeightsMatchRepeatedSamples(t *testing.T) {
+	for _, normalization := range []string{"none", "layer"} {
+		t.Run(normalization, func(t *testing.T) {
+			mlp, X, y := gradientCheckSetup(normalization)
+			nSamples, _ := X.Dims()
+
+			//a weight of 2 counts the sample twice, the weighted mean is over the m samples rather than m + 1
+			weights := make([]float64, nSamples)
+			for i := range weights {
+				weights[i] = 1
+			}
+			weights[3] = 2
+			weighted := mlp.backprop(X, y, weights)
+			repeated := mlp.backprop(withRepeatedRow(X, 3), withRepeatedRow(y, 3), nil)
+
+			scale := float64(nSamples+1) / float64(nSamples)
+			for _, grads := range [][]*mat.Dense{repeated.weights, repeated.bias, repeated.gamma, repeated.beta} {
+				for _, grad := range grads {
+					grad.Scale(scale, grad)
+				}
+			}
+
+			equalWithin(t, "weights", repeated.weights, weighted.weights, 1e-12)
+			equalWithin(t, "bias", repeated.bias, weighted.bias, 1e-12)
+			equalWithin(t, "gamma", repeated.gamma, weighted.gamma, 1e-12)
+			equalWithin(t, "beta", repeated.beta, weighted.beta, 1e-12)
+			if math.Abs(repeated.loss*scale-weighted.loss) > 1e-12 {
+				t.Errorf("loss %v want %v", weighted.loss, repeated.loss*scale)
+			}
+		})
+	}
+}
+
+func TestUnitSampleWeights(t *testing.T) {
+	mlp, X, y := gradientCheckSetup("none")
+	nSamples, _ := X.Dims()
+
+	weights := make([]float64, nSamples)
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	unweighted := mlp.backprop(X, y, nil)
+	weighted := mlp.backprop(X, y, weights)
+	parallel := mlp.parallelBackprop(X, y, weights, 3)
+
+	equalWithin(t, "weights", unweighted.weights, weighted.weights, 1e-12)
+	equalWithin(t, "bias", unweighted.bias, weighted.bias, 1e-12)
+	equalWithin(t, "parallel weights", unweighted.weights, parallel.weights, 1e-12)
+	if math.Abs(unweighted.loss-weighted.loss) > 1e-12 {
+		t.Errorf("loss %v want %v", weighted.loss, unweighted.loss)
+	}
+}
+
+func TestClassWeights(t *testing.T) {
+	//6 samples of class 0, 2 of class 1
+	y := mat.NewDense(8, 2, []float64{1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 0, 1, 0, 1})
+	ds := NewDenseDataset(mat.NewDense(8, 1, nil), y)
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{1, 2}
+
+	if weights, _ := mlp.classWeights(ds, 3); weights != nil {
+		t.Errorf("got class weights %v without asking for them", weights)
+	}
+
+	mlp.ClassWeight = map[int]float64{1: 5}
+	weights, err := mlp.classWeights(ds, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if weights[0] != 1 || weights[1] != 5 {
+		t.Errorf("class weights %v want [1 5]", weights)
+	}
+
+	//8 / (2 · 6) and 8 / (2 · 2)
+	mlp.BalancedClassWeight = true
+	weights, err = mlp.classWeights(ds, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(weights[0]-2.0/3) > 1e-12 || weights[1] != 2 {
+		t.Errorf("balanced class weights %v want [0.667 2]", weights)
+	}
+
+	got := batchWeights([]float64{3, 1}, y.Slice(5, 7, 0, 2).(*mat.Dense), weights)
+	if math.Abs(got[0]-2) > 1e-12 || got[1] != 2 {
+		t.Errorf("batch weights %v want the sample weights times the class weights [2 2]", got)
+	}
+}
+
+func TestBalancedClassWeightsMissingClass(t *testing.T) {
+	//3 samples of class 0, 1 of class 2 and none of class 1
+	y := mat.NewDense(4, 3, []float64{1, 0, 0, 1, 0, 0, 1, 0, 0, 0, 0, 1})
+	ds := NewDenseDataset(mat.NewDense(4, 1, nil), y)
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{1, 3}
+	mlp.BalancedClassWeight = true
+
+	//4 / (3 · 3) and 4 / (3 · 1), n_classes counts the class that is missing
+	weights, err := mlp.classWeights(ds, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{4.0 / 9, 1, 4.0 / 3}
+	for i := range want {
+		if math.Abs(weights[i]-want[i]) > 1e-12 {
+			t.Errorf("balanced class weights %v want %v", weights, want)
+			break
+		}
+	}
+}
+
+func TestTrainWeightedIgnoresZeroWeights(t *testing.T) {
+	//y = x, with the second half of the samples corrupted but given no weight
+	X := mat.NewDense(40, 1, nil)
+	y := mat.NewDense(40, 1, nil)
+	weights := make([]float64, 40)
+	for i := range 40 {
+		x := float64(i%20) / 20
+		X.Set(i, 0, x)
+		y.Set(i, 0, x)
+		weights[i] = 1
+		if i >= 20 {
+			y.Set(i, 0, 5)
+			weights[i] = 0
+		}
+	}
+
+	mlp := NewMultiLayerPerceptron()
+	mlp.Arch = []int{1, 8, 1}
+	mlp.IsClassifier = false
+	mlp.LossFunction = "MSELoss"
+	mlp.Epochs = 300
+	mlp.BatchSize = 8
+	mlp.Verbose = false
+	mlp.EpochMetrics = true
+	mlp.Seed = 1
+
+	history, err := mlp.TrainWeighted(X, y, weights, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clean := NewDenseDataset(X.Slice(0, 20, 0, 1).(*mat.Dense), y.Slice(0, 20, 0, 1).(*mat.Dense))
+	logs, err := mlp.evaluate(clean, 8, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logs["loss"] > 0.005 {
+		t.Errorf("loss on the weighted samples %v, the samples with no weight should be ignored", logs["loss"])
+	}
+
+	//the training loss is weighted the same way, so it is half the loss of the weighted samples
+	loss := history.Metric("loss")
+	if last := loss[len(loss)-1]; math.Abs(last-logs["loss"]/2) > 1e-9 {
+		t.Errorf("training loss %v want %v", last, logs["loss"]/2)
+	}
+}
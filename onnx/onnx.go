@@ -0,0 +1,604 @@
+// Exchange of trained models as ONNX files, so they can be served by any ONNX runtime
+//
+// Only the part of the ONNX protobuf schema that dense models need is covered: a model with one graph of nodes,
+// float tensors for the parameters and typed inputs and outputs. Write and Read encode it without a protobuf
+// dependency and Model.Run evaluates the graphs these models produce.
+package onnx
+
+import (
+	"fmt"
+	"io"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+const (
+	// IR version of the files written, the first one that goes with opset 13
+	IRVersion = 7
+	// version of the default operator set the nodes are taken from
+	OpsetVersion = 13
+	// written to the producer_name of a model
+	ProducerName = "Go-Machine-Learning"
+)
+
+// DataType is the element type of a tensor, using the numbers of TensorProto.DataType
+type DataType int32
+
+const (
+	Float  DataType = 1
+	Double DataType = 11
+)
+
+// AttributeType is the kind of value held by an attribute, using the numbers of AttributeProto.AttributeType
+type AttributeType int32
+
+const (
+	AttributeFloat  AttributeType = 1
+	AttributeInt    AttributeType = 2
+	AttributeString AttributeType = 3
+	AttributeFloats AttributeType = 6
+	AttributeInts   AttributeType = 7
+)
+
+type Model struct {
+	IRVersion    int64
+	OpsetVersion int64
+	ProducerName string
+	Graph        Graph
+}
+
+// Graph is a list of nodes in the order they run, the initializers are the constant inputs of the nodes such as
+// weights
+type Graph struct {
+	Name         string
+	Nodes        []Node
+	Initializers []Tensor
+	Inputs       []ValueInfo
+	Outputs      []ValueInfo
+}
+
+// Node applies the operator OpType to the values named in Inputs and names its results Outputs
+type Node struct {
+	Name       string
+	OpType     string
+	Inputs     []string
+	Outputs    []string
+	Attributes []Attribute
+}
+
+// Attribute of a node, only the field of its Type is used
+type Attribute struct {
+	Name   string
+	Type   AttributeType
+	Float  float32
+	Int    int64
+	String string
+	Floats []float32
+	Ints   []int64
+}
+
+// Tensor holds its values in row major order whatever its DataType, which decides how they're written
+type Tensor struct {
+	Name     string
+	DataType DataType
+	Dims     []int64
+	Values   []float64
+}
+
+// ValueInfo is the name, element type and shape of a graph input or output
+type ValueInfo struct {
+	Name     string
+	ElemType DataType
+	Shape    []Dimension
+}
+
+// Dimension of a shape, either a fixed Value or a named Param such as the batch size
+type Dimension struct {
+	Value int64
+	Param string
+}
+
+// name of the batch dimension of the graph inputs and outputs
+const batchDimension = "N"
+
+// Empty model of the current versions whose graph has the given name
+func NewModel(name string) *Model {
+	return &Model{
+		IRVersion:    IRVersion,
+		OpsetVersion: OpsetVersion,
+		ProducerName: ProducerName,
+		Graph:        Graph{Name: name},
+	}
+}
+
+func FloatAttribute(name string, f float64) Attribute {
+	return Attribute{Name: name, Type: AttributeFloat, Float: float32(f)}
+}
+
+func IntAttribute(name string, i int64) Attribute {
+	return Attribute{Name: name, Type: AttributeInt, Int: i}
+}
+
+// Adds a float input of shape N x features, where N is the batch size
+func (g *Graph) AddInput(name string, features int) {
+	g.Inputs = append(g.Inputs, batchValue(name, features))
+}
+
+// Adds a float output of shape N x features
+func (g *Graph) AddOutput(name string, features int) {
+	g.Outputs = append(g.Outputs, batchValue(name, features))
+}
+
+func batchValue(name string, features int) ValueInfo {
+	return ValueInfo{Name: name, ElemType: Float, Shape: []Dimension{{Param: batchDimension}, {Value: int64(features)}}}
+}
+
+// Adds m as a float matrix initializer
+func (g *Graph) AddMatrix(name string, m mat.Matrix) {
+	rows, cols := m.Dims()
+	values := make([]float64, 0, rows*cols)
+	for i := range rows {
+		for j := range cols {
+			values = append(values, m.At(i, j))
+		}
+	}
+	g.Initializers = append(g.Initializers, Tensor{Name: name, DataType: Float, Dims: []int64{int64(rows), int64(cols)}, Values: values})
+}
+
+// Adds values as a float vector initializer
+func (g *Graph) AddVector(name string, values []float64) {
+	g.Initializers = append(g.Initializers, Tensor{Name: name, DataType: Float, Dims: []int64{int64(len(values))}, Values: values})
+}
+
+// Adds a node named after its operator and position in the graph
+func (g *Graph) AddNode(opType string, inputs, outputs []string, attributes ...Attribute) {
+	g.Nodes = append(g.Nodes, Node{
+		Name:       fmt.Sprintf("%s_%d", opType, len(g.Nodes)),
+		OpType:     opType,
+		Inputs:     inputs,
+		Outputs:    outputs,
+		Attributes: attributes,
+	})
+}
+
+// Adds a fully connected layer, output = input • weights + bias, as a Gemm node whose parameters are the initializers
+// prefix_weight and prefix_bias
+func (g *Graph) AddDense(prefix, input, output string, weights mat.Matrix, bias []float64) {
+	g.AddMatrix(prefix+"_weight", weights)
+	g.AddVector(prefix+"_bias", bias)
+	g.AddNode("Gemm", []string{input, prefix + "_weight", prefix + "_bias"}, []string{output})
+}
+
+// Writes the model as an ONNX protobuf file
+func Write(w io.Writer, m *Model) error {
+	_, err := w.Write(m.marshal())
+	return err
+}
+
+// Reads a model from an ONNX protobuf file
+func Read(r io.Reader) (*Model, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalModel(b)
+}
+
+// field numbers of the ONNX messages, from onnx.proto
+const (
+	modelIRVersion    = 1
+	modelProducerName = 2
+	modelGraph        = 7
+	modelOpsetImport  = 8
+
+	opsetVersion = 2
+
+	graphNode        = 1
+	graphName        = 2
+	graphInitializer = 5
+	graphInput       = 11
+	graphOutput      = 12
+
+	nodeInput     = 1
+	nodeOutput    = 2
+	nodeName      = 3
+	nodeOpType    = 4
+	nodeAttribute = 5
+
+	attributeName   = 1
+	attributeFloat  = 2
+	attributeInt    = 3
+	attributeString = 4
+	attributeFloats = 7
+	attributeInts   = 8
+	attributeType   = 20
+
+	tensorDims       = 1
+	tensorDataType   = 2
+	tensorFloatData  = 4
+	tensorName       = 8
+	tensorRawData    = 9
+	tensorDoubleData = 10
+
+	valueInfoName      = 1
+	valueInfoType      = 2
+	typeTensorType     = 1
+	tensorTypeElemType = 1
+	tensorTypeShape    = 2
+	shapeDim           = 1
+	dimValue           = 1
+	dimParam           = 2
+)
+
+func (m *Model) marshal() []byte {
+	var e encoder
+	e.varint(modelIRVersion, m.IRVersion)
+	e.string(modelProducerName, m.ProducerName)
+	e.message(modelGraph, m.Graph.marshal)
+	e.message(modelOpsetImport, func(e *encoder) { e.varint(opsetVersion, m.OpsetVersion) })
+	return e.buf
+}
+
+func (g *Graph) marshal(e *encoder) {
+	for i := range g.Nodes {
+		e.message(graphNode, g.Nodes[i].marshal)
+	}
+	e.string(graphName, g.Name)
+	for i := range g.Initializers {
+		e.message(graphInitializer, g.Initializers[i].marshal)
+	}
+	for i := range g.Inputs {
+		e.message(graphInput, g.Inputs[i].marshal)
+	}
+	for i := range g.Outputs {
+		e.message(graphOutput, g.Outputs[i].marshal)
+	}
+}
+
+func (n *Node) marshal(e *encoder) {
+	//empty names are kept, they mark optional inputs that are left out
+	for _, input := range n.Inputs {
+		e.bytes(nodeInput, []byte(input))
+	}
+	for _, output := range n.Outputs {
+		e.bytes(nodeOutput, []byte(output))
+	}
+	e.string(nodeName, n.Name)
+	e.string(nodeOpType, n.OpType)
+	for i := range n.Attributes {
+		e.message(nodeAttribute, n.Attributes[i].marshal)
+	}
+}
+
+func (a *Attribute) marshal(e *encoder) {
+	e.string(attributeName, a.Name)
+	switch a.Type {
+	case AttributeFloat:
+		e.float(attributeFloat, a.Float)
+	case AttributeInt:
+		e.varint(attributeInt, a.Int)
+	case AttributeString:
+		e.bytes(attributeString, []byte(a.String))
+	case AttributeFloats:
+		e.packedFloats(attributeFloats, a.Floats)
+	case AttributeInts:
+		e.packedInts(attributeInts, a.Ints)
+	}
+	e.varint(attributeType, int64(a.Type))
+}
+
+func (t *Tensor) marshal(e *encoder) {
+	e.packedInts(tensorDims, t.Dims)
+	e.varint(tensorDataType, int64(t.DataType))
+	e.string(tensorName, t.Name)
+	if t.DataType == Double {
+		raw := make([]byte, 0, 8*len(t.Values))
+		for _, v := range t.Values {
+			raw = appendDouble(raw, v)
+		}
+		e.bytes(tensorRawData, raw)
+		return
+	}
+	raw := make([]byte, 0, 4*len(t.Values))
+	for _, v := range t.Values {
+		raw = appendFloat(raw, float32(v))
+	}
+	e.bytes(tensorRawData, raw)
+}
+
+func (v *ValueInfo) marshal(e *encoder) {
+	e.string(valueInfoName, v.Name)
+	e.message(valueInfoType, func(e *encoder) {
+		e.message(typeTensorType, func(e *encoder) {
+			e.varint(tensorTypeElemType, int64(v.ElemType))
+			e.message(tensorTypeShape, func(e *encoder) {
+				for _, d := range v.Shape {
+					e.message(shapeDim, func(e *encoder) {
+						if d.Param != "" {
+							e.string(dimParam, d.Param)
+						} else {
+							e.varint(dimValue, d.Value)
+						}
+					})
+				}
+			})
+		})
+	})
+}
+
+// checks f has the wire type of the field being read
+func expectWire(f field, wire int) error {
+	if f.wire != wire {
+		return fmt.Errorf("field %d has wire type %d, expected %d", f.number, f.wire, wire)
+	}
+	return nil
+}
+
+// fields this package doesn't use are skipped
+func unmarshalModel(b []byte) (*Model, error) {
+	m := &Model{}
+	hasGraph := false
+	err := readFields(b, func(f field) error {
+		switch f.number {
+		case modelIRVersion:
+			m.IRVersion = int64(f.value)
+			return expectWire(f, wireVarint)
+		case modelProducerName:
+			m.ProducerName = string(f.data)
+			return expectWire(f, wireBytes)
+		case modelGraph:
+			hasGraph = true
+			if err := expectWire(f, wireBytes); err != nil {
+				return err
+			}
+			return m.Graph.unmarshal(f.data)
+		case modelOpsetImport:
+			if err := expectWire(f, wireBytes); err != nil {
+				return err
+			}
+			return m.unmarshalOpset(f.data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !hasGraph {
+		return nil, fmt.Errorf("the ONNX model has no graph")
+	}
+	return m, nil
+}
+
+// only the version of the default domain is kept, other domains hold custom operators
+func (m *Model) unmarshalOpset(b []byte) error {
+	domain, version := "", int64(0)
+	err := readFields(b, func(f field) error {
+		switch f.number {
+		case 1:
+			domain = string(f.data)
+			return expectWire(f, wireBytes)
+		case opsetVersion:
+			version = int64(f.value)
+			return expectWire(f, wireVarint)
+		}
+		return nil
+	})
+	if domain == "" || domain == "ai.onnx" {
+		m.OpsetVersion = version
+	}
+	return err
+}
+
+func (g *Graph) unmarshal(b []byte) error {
+	return readFields(b, func(f field) error {
+		if err := expectWire(f, wireBytes); err != nil {
+			return err
+		}
+		switch f.number {
+		case graphNode:
+			var n Node
+			if err := n.unmarshal(f.data); err != nil {
+				return err
+			}
+			g.Nodes = append(g.Nodes, n)
+		case graphName:
+			g.Name = string(f.data)
+		case graphInitializer:
+			var t Tensor
+			if err := t.unmarshal(f.data); err != nil {
+				return err
+			}
+			g.Initializers = append(g.Initializers, t)
+		case graphInput, graphOutput:
+			var v ValueInfo
+			if err := v.unmarshal(f.data); err != nil {
+				return err
+			}
+			if f.number == graphInput {
+				g.Inputs = append(g.Inputs, v)
+			} else {
+				g.Outputs = append(g.Outputs, v)
+			}
+		}
+		return nil
+	})
+}
+
+func (n *Node) unmarshal(b []byte) error {
+	return readFields(b, func(f field) error {
+		if err := expectWire(f, wireBytes); err != nil {
+			return err
+		}
+		switch f.number {
+		case nodeInput:
+			n.Inputs = append(n.Inputs, string(f.data))
+		case nodeOutput:
+			n.Outputs = append(n.Outputs, string(f.data))
+		case nodeName:
+			n.Name = string(f.data)
+		case nodeOpType:
+			n.OpType = string(f.data)
+		case nodeAttribute:
+			var a Attribute
+			if err := a.unmarshal(f.data); err != nil {
+				return err
+			}
+			n.Attributes = append(n.Attributes, a)
+		}
+		return nil
+	})
+}
+
+func (a *Attribute) unmarshal(b []byte) error {
+	return readFields(b, func(f field) error {
+		switch f.number {
+		case attributeName:
+			a.Name = string(f.data)
+			return expectWire(f, wireBytes)
+		case attributeFloat:
+			floats, err := f.floats()
+			if err == nil && len(floats) == 1 {
+				a.Float = float32(floats[0])
+			}
+			return expectWire(f, wireFixed32)
+		case attributeInt:
+			a.Int = int64(f.value)
+			return expectWire(f, wireVarint)
+		case attributeString:
+			a.String = string(f.data)
+			return expectWire(f, wireBytes)
+		case attributeFloats:
+			floats, err := f.floats()
+			for _, v := range floats {
+				a.Floats = append(a.Floats, float32(v))
+			}
+			return err
+		case attributeInts:
+			ints, err := f.ints()
+			a.Ints = append(a.Ints, ints...)
+			return err
+		case attributeType:
+			a.Type = AttributeType(f.value)
+			return expectWire(f, wireVarint)
+		}
+		return nil
+	})
+}
+
+func (t *Tensor) unmarshal(b []byte) error {
+	var raw []byte
+	err := readFields(b, func(f field) error {
+		switch f.number {
+		case tensorDims:
+			dims, err := f.ints()
+			t.Dims = append(t.Dims, dims...)
+			return err
+		case tensorDataType:
+			t.DataType = DataType(f.value)
+			return expectWire(f, wireVarint)
+		case tensorFloatData:
+			values, err := f.floats()
+			t.Values = append(t.Values, values...)
+			return err
+		case tensorName:
+			t.Name = string(f.data)
+			return expectWire(f, wireBytes)
+		case tensorRawData:
+			raw = f.data
+			return expectWire(f, wireBytes)
+		case tensorDoubleData:
+			values, err := f.doubles()
+			t.Values = append(t.Values, values...)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	switch t.DataType {
+	case Float:
+		if len(raw)%4 != 0 {
+			return fmt.Errorf("tensor %q has %d bytes of raw data, not a whole number of floats", t.Name, len(raw))
+		}
+		t.Values = append(t.Values, littleEndianFloats(raw)...)
+	case Double:
+		if len(raw)%8 != 0 {
+			return fmt.Errorf("tensor %q has %d bytes of raw data, not a whole number of doubles", t.Name, len(raw))
+		}
+		t.Values = append(t.Values, littleEndianDoubles(raw)...)
+	default:
+		return fmt.Errorf("tensor %q has data type %d, only float and double tensors are supported", t.Name, t.DataType)
+	}
+
+	size := int64(1)
+	for _, d := range t.Dims {
+		size *= d
+	}
+	if size != int64(len(t.Values)) {
+		return fmt.Errorf("tensor %q has dims %v but %d values", t.Name, t.Dims, len(t.Values))
+	}
+	return nil
+}
+
+func (v *ValueInfo) unmarshal(b []byte) error {
+	return readFields(b, func(f field) error {
+		switch f.number {
+		case valueInfoName:
+			v.Name = string(f.data)
+			return expectWire(f, wireBytes)
+		case valueInfoType:
+			if err := expectWire(f, wireBytes); err != nil {
+				return err
+			}
+			return readFields(f.data, func(f field) error {
+				if f.number != typeTensorType {
+					return nil
+				}
+				if err := expectWire(f, wireBytes); err != nil {
+					return err
+				}
+				return v.unmarshalTensorType(f.data)
+			})
+		}
+		return nil
+	})
+}
+
+func (v *ValueInfo) unmarshalTensorType(b []byte) error {
+	return readFields(b, func(f field) error {
+		switch f.number {
+		case tensorTypeElemType:
+			v.ElemType = DataType(f.value)
+			return expectWire(f, wireVarint)
+		case tensorTypeShape:
+			if err := expectWire(f, wireBytes); err != nil {
+				return err
+			}
+			return readFields(f.data, func(f field) error {
+				if f.number != shapeDim {
+					return nil
+				}
+				if err := expectWire(f, wireBytes); err != nil {
+					return err
+				}
+				var d Dimension
+				err := readFields(f.data, func(f field) error {
+					switch f.number {
+					case dimValue:
+						d.Value = int64(f.value)
+						return expectWire(f, wireVarint)
+					case dimParam:
+						d.Param = string(f.data)
+						return expectWire(f, wireBytes)
+					}
+					return nil
+				})
+				v.Shape = append(v.Shape, d)
+				return err
+			})
+		}
+		return nil
+	})
+}
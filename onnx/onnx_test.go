@@ -0,0 +1,227 @@
+package onnx
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// model that uses every operator and attribute type the package supports
+func testModel() *Model {
+	m := NewModel("test")
+	g := &m.Graph
+	g.AddInput("x", 3)
+	g.AddMatrix("w", mat.NewDense(2, 3, []float64{1, -2, 0.5, 3, 0.25, -1}))
+	g.AddVector("c", []float64{0.5})
+	g.AddVector("b", []float64{-1, 2})
+	g.AddNode("Gemm", []string{"x", "w", "c"}, []string{"z"},
+		FloatAttribute("alpha", 2), FloatAttribute("beta", 0.5), IntAttribute("transB", 1))
+	g.AddNode("LeakyRelu", []string{"z"}, []string{"a"}, FloatAttribute("alpha", 0.1))
+	g.AddNode("Add", []string{"a", "b"}, []string{"s"})
+	g.AddNode("Softmax", []string{"s"}, []string{"y"}, IntAttribute("axis", -1),
+		Attribute{Name: "floats", Type: AttributeFloats, Floats: []float32{1.5, -2}},
+		Attribute{Name: "ints", Type: AttributeInts, Ints: []int64{3, 300}},
+		Attribute{Name: "string", Type: AttributeString, String: "unused"})
+	g.AddOutput("y", 2)
+	return m
+}
+
+func TestRoundTrip(t *testing.T) {
+	m := testModel()
+	var buf bytes.Buffer
+	if err := Write(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("read\n%+v\nwant\n%+v", got, m)
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	var e encoder
+	attribute := IntAttribute("axis", 1)
+	attribute.marshal(&e)
+	//name, i and then type in field 20, whose tag takes 2 bytes
+	if want := []byte{0x0a, 4, 'a', 'x', 'i', 's', 0x18, 1, 0xa0, 0x01, 2}; !bytes.Equal(e.buf, want) {
+		t.Errorf("attribute encoded as % x, want % x", e.buf, want)
+	}
+
+	e = encoder{}
+	tensor := Tensor{Name: "b", DataType: Float, Dims: []int64{2}, Values: []float64{1, -2}}
+	tensor.marshal(&e)
+	//packed dims, data type, name and the values as little endian float32 raw data
+	want := []byte{0x0a, 1, 2, 0x10, 1, 0x42, 1, 'b', 0x4a, 8, 0, 0, 0x80, 0x3f, 0, 0, 0, 0xc0}
+	if !bytes.Equal(e.buf, want) {
+		t.Errorf("tensor encoded as % x, want % x", e.buf, want)
+	}
+}
+
+func TestReadUnpackedTensor(t *testing.T) {
+	//other producers can write dims one per field and values as float_data or double_data
+	var e encoder
+	e.varint(tensorDims, 1)
+	e.varint(tensorDims, 2)
+	e.varint(tensorDataType, int64(Float))
+	e.float(tensorFloatData, 0.5)
+	e.float(tensorFloatData, -4)
+	var tensor Tensor
+	if err := tensor.unmarshal(e.buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tensor.Dims, []int64{1, 2}) || !reflect.DeepEqual(tensor.Values, []float64{0.5, -4}) {
+		t.Errorf("read dims %v and values %v", tensor.Dims, tensor.Values)
+	}
+
+	e = encoder{}
+	e.packedInts(tensorDims, []int64{2})
+	e.varint(tensorDataType, int64(Double))
+	e.bytes(tensorDoubleData, appendDouble(appendDouble(nil, math.Pi), 1e-300))
+	tensor = Tensor{}
+	if err := tensor.unmarshal(e.buf); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tensor.Values, []float64{math.Pi, 1e-300}) {
+		t.Errorf("read doubles %v", tensor.Values)
+	}
+}
+
+func TestRun(t *testing.T) {
+	m := testModel()
+	X := mat.NewDense(2, 3, []float64{1, 2, 3, -1, 0.5, 4})
+	outputs, err := m.Run(map[string]*mat.Dense{"x": X})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the same steps by hand
+	w := mat.NewDense(2, 3, []float64{1, -2, 0.5, 3, 0.25, -1})
+	var z mat.Dense
+	z.Mul(X, w.T())
+	want := mat.NewDense(2, 2, nil)
+	for i := range 2 {
+		for j := range 2 {
+			v := 2*z.At(i, j) + 0.25
+			if v < 0 {
+				v *= 0.1
+			}
+			want.Set(i, j, v+[]float64{-1, 2}[j])
+		}
+		sum := math.Exp(want.At(i, 0)) + math.Exp(want.At(i, 1))
+		want.Set(i, 0, math.Exp(want.At(i, 0))/sum)
+		want.Set(i, 1, math.Exp(want.At(i, 1))/sum)
+	}
+	if got := outputs["y"]; got == nil || !mat.EqualApprox(got, want, 1e-6) {
+		t.Errorf("Run gives\n%v\nwant\n%v", mat.Formatted(outputs["y"]), mat.Formatted(want))
+	}
+}
+
+func TestRunOperators(t *testing.T) {
+	x := mat.NewDense(2, 2, []float64{-1, 0.5, 2, -3})
+	for op, want := range map[string][]float64{
+		"Identity":   {-1, 0.5, 2, -3},
+		"Relu":       {0, 0.5, 2, 0},
+		"LeakyRelu":  {-0.01, 0.5, 2, -0.03},
+		"Sigmoid":    {1 / (1 + math.E), 1 / (1 + math.Exp(-0.5)), 1 / (1 + math.Exp(-2)), 1 / (1 + math.Exp(3))},
+		"Tanh":       {math.Tanh(-1), math.Tanh(0.5), math.Tanh(2), math.Tanh(-3)},
+		"LogSoftmax": {-1.5 - math.Log(1+math.Exp(-1.5)), -math.Log(1 + math.Exp(-1.5)), -math.Log(1 + math.Exp(-5)), -5 - math.Log(1+math.Exp(-5))},
+		"MatMul":     {-2, -2, 8, 4},
+	} {
+		m := NewModel(op)
+		m.Graph.AddInput("x", 2)
+		inputs := []string{"x"}
+		if op == "MatMul" {
+			m.Graph.AddMatrix("w", mat.NewDense(2, 2, []float64{1, 2, -2, 0}))
+			inputs = append(inputs, "w")
+		}
+		m.Graph.AddNode(op, inputs, []string{"y"})
+		m.Graph.AddOutput("y", 2)
+
+		outputs, err := m.Run(map[string]*mat.Dense{"x": x})
+		if err != nil {
+			t.Errorf("%s: %v", op, err)
+			continue
+		}
+		if got := outputs["y"]; !mat.EqualApprox(got, mat.NewDense(2, 2, want), 1e-12) {
+			t.Errorf("%s gives %v, want %v", op, got.RawMatrix().Data, want)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		change func(m *Model)
+		inputs map[string]*mat.Dense
+		err    string
+	}{
+		"missing input": {func(m *Model) {}, map[string]*mat.Dense{}, `missing input "x"`},
+		"features":      {func(m *Model) {}, map[string]*mat.Dense{"x": mat.NewDense(2, 4, nil)}, "dimension 1 should be 3"},
+		"operator": {
+			func(m *Model) { m.Graph.Nodes[1].OpType = "Conv" },
+			nil, `operator "Conv" is not supported`,
+		},
+		"order": {
+			func(m *Model) { m.Graph.Nodes[0], m.Graph.Nodes[1] = m.Graph.Nodes[1], m.Graph.Nodes[0] },
+			nil, `input "z" is not computed before it`,
+		},
+		"broadcast": {
+			func(m *Model) {
+				m.Graph.Initializers[2].Dims, m.Graph.Initializers[2].Values = []int64{3}, []float64{1, 2, 3}
+			},
+			nil, "can't broadcast 2x2 to 2x3",
+		},
+		"axis": {
+			func(m *Model) { m.Graph.Nodes[3].Attributes[0].Int = 0 },
+			nil, "only the last axis is supported",
+		},
+		"output": {
+			func(m *Model) { m.Graph.Outputs[0].Name = "probabilities" },
+			nil, `output "probabilities" is not computed`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := testModel()
+			test.change(m)
+			inputs := test.inputs
+			if inputs == nil {
+				inputs = map[string]*mat.Dense{"x": mat.NewDense(2, 3, nil)}
+			}
+			if _, err := m.Run(inputs); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testModel()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(bytes.NewReader(buf.Bytes()[:buf.Len()-3])); err == nil {
+		t.Errorf("expected an error reading a truncated model")
+	}
+
+	var e encoder
+	e.varint(modelIRVersion, IRVersion)
+	if _, err := Read(bytes.NewReader(e.buf)); err == nil || !strings.Contains(err.Error(), "no graph") {
+		t.Errorf("got error %v reading a model without a graph", err)
+	}
+
+	m := testModel()
+	m.Graph.Initializers[0].Dims = []int64{3, 3}
+	buf.Reset()
+	if err := Write(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(&buf); err == nil || !strings.Contains(err.Error(), "has dims [3 3] but 6 values") {
+		t.Errorf("got error %v reading a tensor with too few values", err)
+	}
+}
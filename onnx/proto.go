@@ -0,0 +1,193 @@
+package onnx
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// protobuf wire types used by the ONNX messages
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// encoder appends the fields of a protobuf message to buf
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) tag(field, wire int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field<<3|wire))
+}
+
+func (e *encoder) varint(field int, v int64) {
+	e.tag(field, wireVarint)
+	e.buf = binary.AppendUvarint(e.buf, uint64(v))
+}
+
+func (e *encoder) bytes(field int, b []byte) {
+	e.tag(field, wireBytes)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// strings are only written when they're set, like proto3 does for its defaults
+func (e *encoder) string(field int, s string) {
+	if s != "" {
+		e.bytes(field, []byte(s))
+	}
+}
+
+func (e *encoder) float(field int, f float32) {
+	e.tag(field, wireFixed32)
+	e.buf = appendFloat(e.buf, f)
+}
+
+// a nested message, written by fn into its own encoder so its length is known
+func (e *encoder) message(field int, fn func(e *encoder)) {
+	var nested encoder
+	fn(&nested)
+	e.bytes(field, nested.buf)
+}
+
+func (e *encoder) packedInts(field int, values []int64) {
+	var packed []byte
+	for _, v := range values {
+		packed = binary.AppendUvarint(packed, uint64(v))
+	}
+	e.bytes(field, packed)
+}
+
+func (e *encoder) packedFloats(field int, values []float32) {
+	packed := make([]byte, 0, 4*len(values))
+	for _, v := range values {
+		packed = appendFloat(packed, v)
+	}
+	e.bytes(field, packed)
+}
+
+// field is one field read from a message, value holds varints and fixed numbers and data length delimited bytes
+type field struct {
+	number int
+	wire   int
+	value  uint64
+	data   []byte
+}
+
+// calls fn with each field of the message in b in order
+func readFields(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+
+		f := field{number: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.value, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			f.value, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			f.value, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return errTruncated
+			}
+			f.data, b = b[n:n+int(length)], b[n+int(length):]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d in field %d", f.wire, f.number)
+		}
+		if f.number == 0 {
+			return errors.New("protobuf field number 0 is invalid")
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repeated integers, which can be packed into one field or written one per field
+func (f field) ints() ([]int64, error) {
+	if f.wire == wireVarint {
+		return []int64{int64(f.value)}, nil
+	}
+	if f.wire != wireBytes {
+		return nil, fmt.Errorf("field %d is not an integer", f.number)
+	}
+	var values []int64
+	for b := f.data; len(b) > 0; {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errTruncated
+		}
+		values = append(values, int64(v))
+		b = b[n:]
+	}
+	return values, nil
+}
+
+// repeated floats, packed or one per field
+func (f field) floats() ([]float64, error) {
+	if f.wire == wireFixed32 {
+		return []float64{float64(math.Float32frombits(uint32(f.value)))}, nil
+	}
+	if f.wire != wireBytes || len(f.data)%4 != 0 {
+		return nil, fmt.Errorf("field %d is not a list of floats", f.number)
+	}
+	return littleEndianFloats(f.data), nil
+}
+
+// repeated doubles, packed or one per field
+func (f field) doubles() ([]float64, error) {
+	if f.wire == wireFixed64 {
+		return []float64{math.Float64frombits(f.value)}, nil
+	}
+	if f.wire != wireBytes || len(f.data)%8 != 0 {
+		return nil, fmt.Errorf("field %d is not a list of doubles", f.number)
+	}
+	return littleEndianDoubles(f.data), nil
+}
+
+func appendFloat(b []byte, f float32) []byte {
+	return binary.LittleEndian.AppendUint32(b, math.Float32bits(f))
+}
+
+func appendDouble(b []byte, f float64) []byte {
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(f))
+}
+
+func littleEndianFloats(b []byte) []float64 {
+	values := make([]float64, len(b)/4)
+	for i := range values {
+		values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:])))
+	}
+	return values
+}
+
+func littleEndianDoubles(b []byte) []float64 {
+	values := make([]float64, len(b)/8)
+	for i := range values {
+		values[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[8*i:]))
+	}
+	return values
+}
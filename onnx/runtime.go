@@ -0,0 +1,298 @@
+package onnx
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// operator computes the output of a node from its inputs, a missing optional input is nil
+type operator func(n *Node, inputs []*mat.Dense) (*mat.Dense, error)
+
+// operators Run can evaluate, those of dense networks and linear models
+var operators = map[string]operator{
+	"Gemm":       gemm,
+	"MatMul":     matMul,
+	"Add":        add,
+	"Identity":   elementwise(func(x float64) float64 { return x }),
+	"Relu":       elementwise(func(x float64) float64 { return math.Max(x, 0) }),
+	"Sigmoid":    elementwise(func(x float64) float64 { return 1 / (1 + math.Exp(-x)) }),
+	"Tanh":       elementwise(math.Tanh),
+	"LeakyRelu":  leakyRelu,
+	"Softmax":    softmax(false),
+	"LogSoftmax": softmax(true),
+}
+
+// Evaluates the graph on the named inputs and returns its outputs by name
+// every value is held as a matrix, so tensors can have at most 2 dimensions and a vector is a 1 x n row that
+// broadcasts over the rows of a matrix like the last dimension of an ONNX tensor
+func (m *Model) Run(inputs map[string]*mat.Dense) (map[string]*mat.Dense, error) {
+	values := make(map[string]*mat.Dense, len(m.Graph.Initializers)+len(inputs))
+	for i := range m.Graph.Initializers {
+		t := &m.Graph.Initializers[i]
+		value, err := t.dense()
+		if err != nil {
+			return nil, err
+		}
+		values[t.Name] = value
+	}
+
+	for _, input := range m.Graph.Inputs {
+		x, ok := inputs[input.Name]
+		if !ok {
+			//inputs that are also initializers have a default value
+			if _, ok := values[input.Name]; ok {
+				continue
+			}
+			return nil, fmt.Errorf("missing input %q", input.Name)
+		}
+		if err := input.check(x); err != nil {
+			return nil, err
+		}
+		values[input.Name] = x
+	}
+
+	for i := range m.Graph.Nodes {
+		n := &m.Graph.Nodes[i]
+		op, ok := operators[n.OpType]
+		if !ok {
+			return nil, fmt.Errorf("node %s: operator %q is not supported", n.Name, n.OpType)
+		}
+		if len(n.Outputs) != 1 {
+			return nil, fmt.Errorf("node %s: %s has %d outputs, only single outputs are supported", n.Name, n.OpType, len(n.Outputs))
+		}
+
+		nodeInputs := make([]*mat.Dense, len(n.Inputs))
+		for j, name := range n.Inputs {
+			if name == "" {
+				continue
+			}
+			if nodeInputs[j], ok = values[name]; !ok {
+				return nil, fmt.Errorf("node %s: input %q is not computed before it", n.Name, name)
+			}
+		}
+		output, err := op(n, nodeInputs)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", n.Name, err)
+		}
+		values[n.Outputs[0]] = output
+	}
+
+	outputs := make(map[string]*mat.Dense, len(m.Graph.Outputs))
+	for _, output := range m.Graph.Outputs {
+		value, ok := values[output.Name]
+		if !ok {
+			return nil, fmt.Errorf("output %q is not computed by the graph", output.Name)
+		}
+		outputs[output.Name] = value
+	}
+	return outputs, nil
+}
+
+// the tensor as a matrix, a scalar is 1 x 1 and a vector 1 x n
+func (t *Tensor) dense() (*mat.Dense, error) {
+	rows, cols := 1, 1
+	switch len(t.Dims) {
+	case 0:
+	case 1:
+		cols = int(t.Dims[0])
+	case 2:
+		rows, cols = int(t.Dims[0]), int(t.Dims[1])
+	default:
+		return nil, fmt.Errorf("tensor %q has %d dimensions, at most 2 are supported", t.Name, len(t.Dims))
+	}
+	if rows == 0 || cols == 0 {
+		return nil, fmt.Errorf("tensor %q is empty", t.Name)
+	}
+	return mat.NewDense(rows, cols, append([]float64(nil), t.Values...)), nil
+}
+
+// checks x matches the type and fixed dimensions of the input
+func (v *ValueInfo) check(x *mat.Dense) error {
+	if v.ElemType != Float && v.ElemType != Double {
+		return fmt.Errorf("input %q has element type %d, only float and double inputs are supported", v.Name, v.ElemType)
+	}
+	if len(v.Shape) != 2 {
+		return fmt.Errorf("input %q has %d dimensions, only matrices are supported", v.Name, len(v.Shape))
+	}
+	rows, cols := x.Dims()
+	for i, size := range []int{rows, cols} {
+		if d := v.Shape[i]; d.Param == "" && d.Value != int64(size) {
+			return fmt.Errorf("input %q is %dx%d, dimension %d should be %d", v.Name, rows, cols, i, d.Value)
+		}
+	}
+	return nil
+}
+
+func (n *Node) attribute(name string) (Attribute, bool) {
+	for _, a := range n.Attributes {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Attribute{}, false
+}
+
+func (n *Node) intAttribute(name string, def int64) int64 {
+	if a, ok := n.attribute(name); ok {
+		return a.Int
+	}
+	return def
+}
+
+func (n *Node) floatAttribute(name string, def float64) float64 {
+	if a, ok := n.attribute(name); ok {
+		return float64(a.Float)
+	}
+	return def
+}
+
+func checkInputs(n *Node, inputs []*mat.Dense, required, optional int) error {
+	if len(inputs) < required || len(inputs) > required+optional {
+		return fmt.Errorf("%s takes %d to %d inputs, it has %d", n.OpType, required, required+optional, len(inputs))
+	}
+	for i := range required {
+		if inputs[i] == nil {
+			return fmt.Errorf("%s input %d is required", n.OpType, i)
+		}
+	}
+	return nil
+}
+
+// Y = α A' B' + β C, where A' and B' are transposed when transA and transB are set and C broadcasts to the shape of
+// A' B'
+func gemm(n *Node, inputs []*mat.Dense) (*mat.Dense, error) {
+	if err := checkInputs(n, inputs, 2, 1); err != nil {
+		return nil, err
+	}
+	var a, b mat.Matrix = inputs[0], inputs[1]
+	if n.intAttribute("transA", 0) != 0 {
+		a = a.T()
+	}
+	if n.intAttribute("transB", 0) != 0 {
+		b = b.T()
+	}
+	aRows, k := a.Dims()
+	if bRows, bCols := b.Dims(); bRows != k {
+		return nil, fmt.Errorf("Gemm can't multiply %dx%d by %dx%d", aRows, k, bRows, bCols)
+	}
+
+	var y mat.Dense
+	y.Mul(a, b)
+	y.Scale(n.floatAttribute("alpha", 1), &y)
+	if len(inputs) < 3 || inputs[2] == nil {
+		return &y, nil
+	}
+	rows, cols := y.Dims()
+	c, err := broadcast(inputs[2], rows, cols)
+	if err != nil {
+		return nil, err
+	}
+	var scaled mat.Dense
+	scaled.Scale(n.floatAttribute("beta", 1), c)
+	y.Add(&y, &scaled)
+	return &y, nil
+}
+
+func matMul(n *Node, inputs []*mat.Dense) (*mat.Dense, error) {
+	if err := checkInputs(n, inputs, 2, 0); err != nil {
+		return nil, err
+	}
+	aRows, k := inputs[0].Dims()
+	if bRows, bCols := inputs[1].Dims(); bRows != k {
+		return nil, fmt.Errorf("MatMul can't multiply %dx%d by %dx%d", aRows, k, bRows, bCols)
+	}
+	var y mat.Dense
+	y.Mul(inputs[0], inputs[1])
+	return &y, nil
+}
+
+// A + B, broadcasting each of them to the larger size of every dimension
+func add(n *Node, inputs []*mat.Dense) (*mat.Dense, error) {
+	if err := checkInputs(n, inputs, 2, 0); err != nil {
+		return nil, err
+	}
+	aRows, aCols := inputs[0].Dims()
+	bRows, bCols := inputs[1].Dims()
+	rows, cols := max(aRows, bRows), max(aCols, bCols)
+	a, err := broadcast(inputs[0], rows, cols)
+	if err != nil {
+		return nil, err
+	}
+	b, err := broadcast(inputs[1], rows, cols)
+	if err != nil {
+		return nil, err
+	}
+	var y mat.Dense
+	y.Add(a, b)
+	return &y, nil
+}
+
+// m repeated along its dimensions of size 1 to rows x cols
+func broadcast(m *mat.Dense, rows, cols int) (*mat.Dense, error) {
+	r, c := m.Dims()
+	if r == rows && c == cols {
+		return m, nil
+	}
+	if (r != rows && r != 1) || (c != cols && c != 1) {
+		return nil, fmt.Errorf("can't broadcast %dx%d to %dx%d", r, c, rows, cols)
+	}
+	out := mat.NewDense(rows, cols, nil)
+	out.Apply(func(i, j int, _ float64) float64 { return m.At(min(i, r-1), min(j, c-1)) }, out)
+	return out, nil
+}
+
+func elementwise(f func(x float64) float64) operator {
+	return func(n *Node, inputs []*mat.Dense) (*mat.Dense, error) {
+		if err := checkInputs(n, inputs, 1, 0); err != nil {
+			return nil, err
+		}
+		var y mat.Dense
+		y.Apply(func(_, _ int, x float64) float64 { return f(x) }, inputs[0])
+		return &y, nil
+	}
+}
+
+func leakyRelu(n *Node, inputs []*mat.Dense) (*mat.Dense, error) {
+	alpha := n.floatAttribute("alpha", 0.01)
+	return elementwise(func(x float64) float64 {
+		if x < 0 {
+			return alpha * x
+		}
+		return x
+	})(n, inputs)
+}
+
+// softmax over each row, or its log, only the last axis of a matrix is supported
+func softmax(log bool) operator {
+	return func(n *Node, inputs []*mat.Dense) (*mat.Dense, error) {
+		if err := checkInputs(n, inputs, 1, 0); err != nil {
+			return nil, err
+		}
+		if axis := n.intAttribute("axis", -1); axis != -1 && axis != 1 {
+			return nil, fmt.Errorf("%s over axis %d, only the last axis is supported", n.OpType, axis)
+		}
+		y := mat.DenseCopyOf(inputs[0])
+		rows, _ := y.Dims()
+		for i := range rows {
+			row := y.RawRowView(i)
+			maximum := math.Inf(-1)
+			for _, x := range row {
+				maximum = math.Max(maximum, x)
+			}
+			sum := 0.0
+			for _, x := range row {
+				sum += math.Exp(x - maximum)
+			}
+			for j, x := range row {
+				if log {
+					row[j] = x - maximum - math.Log(sum)
+				} else {
+					row[j] = math.Exp(x-maximum) / sum
+				}
+			}
+		}
+		return y, nil
+	}
+}
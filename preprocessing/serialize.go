@@ -0,0 +1,50 @@
+package preprocessing
+
+import (
+	"Go-Machine-Learning/serialization"
+	"io"
+)
+
+const standardScalerKind = "StandardScaler"
+
+type standardScalerState struct {
+	Mean, Std *serialization.Matrix
+}
+
+// Saves the fitted means and stds in the compact binary format
+func (scaler *StandardScaler) Save(w io.Writer) error {
+	return serialization.Write(w, standardScalerKind, serialization.Binary, scaler.state())
+}
+
+// Saves the fitted means and stds as human readable JSON
+func (scaler *StandardScaler) SaveJSON(w io.Writer) error {
+	return serialization.Write(w, standardScalerKind, serialization.JSON, scaler.state())
+}
+
+// Loads a scaler saved with Save or SaveJSON
+func (scaler *StandardScaler) Load(r io.Reader) error {
+	var s standardScalerState
+	if err := serialization.Read(r, standardScalerKind, &s); err != nil {
+		return err
+	}
+
+	mean, err := s.Mean.Dense()
+	if err != nil {
+		return err
+	}
+	std, err := s.Std.Dense()
+	if err != nil {
+		return err
+	}
+
+	scaler.Mean = mean
+	scaler.Std = std
+	return nil
+}
+
+func (scaler *StandardScaler) state() *standardScalerState {
+	return &standardScalerState{
+		Mean: serialization.FromDense(scaler.Mean),
+		Std:  serialization.FromDense(scaler.Std),
+	}
+}
@@ -0,0 +1,29 @@
+package preprocessing
+
+import (
+	"bytes"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestStandardScalerSaveLoad(t *testing.T) {
+	X := mat.NewDense(3, 2, []float64{1, 10, 2, 20, 3, 60})
+
+	scaler := NewStandardScaler()
+	scaler.Fit(X)
+
+	var buf bytes.Buffer
+	if err := scaler.SaveJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewStandardScaler()
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !mat.Equal(loaded.Mean, scaler.Mean) || !mat.Equal(loaded.Std, scaler.Std) {
+		t.Errorf("got mean %v std %v want mean %v std %v", loaded.Mean, loaded.Std, scaler.Mean, scaler.Std)
+	}
+}
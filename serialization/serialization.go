@@ -0,0 +1,249 @@
+// Versioned on disk format shared by every model so trained models can be saved and loaded again
+//
+// A model is saved as its kind (e.g. "MultiLayerPerceptron") and a state struct, either as
+// JSON for humans or as a compact binary file:
+//
+//	magic "GOML" | version uint16 | kind length uint16 | kind | payload length uint64 | gob payload | crc32
+//
+// Read works out which of the two formats it was given.
+package serialization
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Version of the format written by this build, files with a different version are rejected
+const Version = 1
+
+// Format decides how a model is written
+type Format int
+
+const (
+	Binary Format = iota
+	JSON
+)
+
+var magic = []byte("GOML")
+
+var (
+	ErrIncompatibleVersion = errors.New("incompatible model file version")
+	ErrChecksum            = errors.New("model file checksum mismatch, the file is corrupt")
+	ErrWrongKind           = errors.New("model file contains a different kind of model")
+	ErrUnknownFormat       = errors.New("not a model file")
+)
+
+// JSON layout of a saved model
+type envelope struct {
+	Format  string          `json:"format"`
+	Version int             `json:"version"`
+	Kind    string          `json:"kind"`
+	Model   json.RawMessage `json:"model"`
+}
+
+const jsonFormatName = "go-machine-learning"
+
+// Writes the state of a model of the given kind
+func Write(w io.Writer, kind string, format Format, state any) error {
+	switch format {
+	case JSON:
+		return writeJSON(w, kind, state)
+	case Binary:
+		return writeBinary(w, kind, state)
+	default:
+		return fmt.Errorf("unknown format %d", format)
+	}
+}
+
+func writeJSON(w io.Writer, kind string, state any) error {
+	model, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", kind, err)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(envelope{Format: jsonFormatName, Version: Version, Kind: kind, Model: model})
+}
+
+func writeBinary(w io.Writer, kind string, state any) error {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(state); err != nil {
+		return fmt.Errorf("error encoding %s: %w", kind, err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(magic)
+	binary.Write(&buf, binary.LittleEndian, uint16(Version))
+	binary.Write(&buf, binary.LittleEndian, uint16(len(kind)))
+	buf.WriteString(kind)
+	binary.Write(&buf, binary.LittleEndian, uint64(payload.Len()))
+	buf.Write(payload.Bytes())
+	binary.Write(&buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Reads a model written by Write into state, which must be a pointer to the same type that was written
+// Returns an error if the file is a different version, a different kind of model or is corrupt
+func Read(r io.Reader, kind string, state any) error {
+	reader := bufio.NewReader(r)
+
+	//skip any whitespace so the first byte tells us the format
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+		}
+		if b[0] != ' ' && b[0] != '\n' && b[0] != '\r' && b[0] != '\t' {
+			break
+		}
+		reader.ReadByte()
+	}
+
+	start, _ := reader.Peek(len(magic))
+	if bytes.Equal(start, magic) {
+		return readBinary(reader, kind, state)
+	}
+	if start[0] == '{' {
+		return readJSON(reader, kind, state)
+	}
+	return ErrUnknownFormat
+}
+
+func readJSON(r io.Reader, kind string, state any) error {
+	var env envelope
+	if err := json.NewDecoder(r).Decode(&env); err != nil {
+		return fmt.Errorf("error decoding model file: %w", err)
+	}
+	if env.Format != jsonFormatName {
+		return ErrUnknownFormat
+	}
+	if env.Version != Version {
+		return fmt.Errorf("%w: file has version %d, this build reads version %d", ErrIncompatibleVersion, env.Version, Version)
+	}
+	if env.Kind != kind {
+		return fmt.Errorf("%w: file has %s, expected %s", ErrWrongKind, env.Kind, kind)
+	}
+	if err := json.Unmarshal(env.Model, state); err != nil {
+		return fmt.Errorf("error decoding %s: %w", kind, err)
+	}
+	return nil
+}
+
+func readBinary(r io.Reader, kind string, state any) error {
+	//everything read is also fed to the checksum
+	checksum := crc32.NewIEEE()
+	tee := io.TeeReader(r, checksum)
+
+	header := make([]byte, len(magic)+4)
+	if _, err := io.ReadFull(tee, header); err != nil {
+		return fmt.Errorf("error reading model file header: %w", err)
+	}
+
+	version := binary.LittleEndian.Uint16(header[len(magic):])
+	if version != Version {
+		return fmt.Errorf("%w: file has version %d, this build reads version %d", ErrIncompatibleVersion, version, Version)
+	}
+
+	kindBytes := make([]byte, binary.LittleEndian.Uint16(header[len(magic)+2:]))
+	if _, err := io.ReadFull(tee, kindBytes); err != nil {
+		return fmt.Errorf("error reading model file header: %w", err)
+	}
+
+	var payloadLen uint64
+	if err := binary.Read(tee, binary.LittleEndian, &payloadLen); err != nil {
+		return fmt.Errorf("error reading model file header: %w", err)
+	}
+
+	var payload bytes.Buffer
+	if _, err := io.CopyN(&payload, tee, int64(payloadLen)); err != nil {
+		return fmt.Errorf("error reading model: %w", err)
+	}
+
+	sum := checksum.Sum32()
+	var stored uint32
+	if err := binary.Read(r, binary.LittleEndian, &stored); err != nil {
+		return fmt.Errorf("error reading model checksum: %w", err)
+	}
+	if stored != sum {
+		return ErrChecksum
+	}
+
+	if string(kindBytes) != kind {
+		return fmt.Errorf("%w: file has %s, expected %s", ErrWrongKind, kindBytes, kind)
+	}
+
+	if err := gob.NewDecoder(&payload).Decode(state); err != nil {
+		return fmt.Errorf("error decoding %s: %w", kind, err)
+	}
+	return nil
+}
+
+// Matrix is a dense matrix in a form that can be encoded
+type Matrix struct {
+	Rows, Cols int
+	Data       []float64
+}
+
+// Converts a gonum matrix, nil stays nil
+func FromDense(m *mat.Dense) *Matrix {
+	if m == nil {
+		return nil
+	}
+	rows, cols := m.Dims()
+	data := make([]float64, 0, rows*cols)
+	for i := range rows {
+		data = append(data, m.RawRowView(i)...)
+	}
+	return &Matrix{Rows: rows, Cols: cols, Data: data}
+}
+
+// Converts back to a gonum matrix, nil stays nil
+func (m *Matrix) Dense() (*mat.Dense, error) {
+	if m == nil {
+		return nil, nil
+	}
+	if m.Rows*m.Cols != len(m.Data) || m.Rows <= 0 || m.Cols <= 0 {
+		return nil, fmt.Errorf("matrix of %dx%d has %d values", m.Rows, m.Cols, len(m.Data))
+	}
+	return mat.NewDense(m.Rows, m.Cols, append([]float64(nil), m.Data...)), nil
+}
+
+// Converts a slice of gonum matrices, such as the weights of each layer
+func FromDenses(ms []*mat.Dense) []*Matrix {
+	if ms == nil {
+		return nil
+	}
+	out := make([]*Matrix, len(ms))
+	for i := range ms {
+		out[i] = FromDense(ms[i])
+	}
+	return out
+}
+
+// Converts a slice of matrices back to gonum matrices
+func ToDenses(ms []*Matrix) ([]*mat.Dense, error) {
+	if ms == nil {
+		return nil, nil
+	}
+	out := make([]*mat.Dense, len(ms))
+	for i := range ms {
+		m, err := ms[i].Dense()
+		if err != nil {
+			return nil, err
+		}
+		out[i] = m
+	}
+	return out, nil
+}
@@ -0,0 +1,126 @@
+package serialization
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+type testState struct {
+	Name    string
+	Values  []float64
+	Weights []*Matrix
+}
+
+func newTestState() *testState {
+	return &testState{
+		Name:   "test",
+		Values: []float64{1.5, -2, 3e-9},
+		Weights: FromDenses([]*mat.Dense{
+			mat.NewDense(2, 3, []float64{1, 2, 3, 4, 5, 6}),
+			mat.NewDense(1, 1, []float64{-7}),
+		}),
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{Binary, JSON} {
+		var buf bytes.Buffer
+		if err := Write(&buf, "Test", format, newTestState()); err != nil {
+			t.Fatal(err)
+		}
+
+		var got testState
+		if err := Read(&buf, "Test", &got); err != nil {
+			t.Fatalf("format %d: %v", format, err)
+		}
+		if !reflect.DeepEqual(&got, newTestState()) {
+			t.Errorf("format %d: got %+v want %+v", format, got, newTestState())
+		}
+
+		weights, err := ToDenses(got.Weights)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if weights[0].At(1, 2) != 6 {
+			t.Errorf("format %d: weights[0][1][2] = %v want 6", format, weights[0].At(1, 2))
+		}
+	}
+}
+
+func TestJSONIsReadable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, "Test", JSON, newTestState()); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"kind": "Test"`, `"version": 1`, `"Name": "test"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("JSON does not contain %s:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRejectsCorruptBinary(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, "Test", Binary, newTestState()); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	data[len(data)-10] ^= 0xff
+
+	err := Read(bytes.NewReader(data), "Test", &testState{})
+	if !errors.Is(err, ErrChecksum) {
+		t.Errorf("got error %v want %v", err, ErrChecksum)
+	}
+}
+
+func TestRejectsOtherVersions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, "Test", Binary, newTestState()); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint16(data[len(magic):], Version+1)
+
+	err := Read(bytes.NewReader(data), "Test", &testState{})
+	if !errors.Is(err, ErrIncompatibleVersion) {
+		t.Errorf("binary: got error %v want %v", err, ErrIncompatibleVersion)
+	}
+	if err != nil && !strings.Contains(err.Error(), "version 2") {
+		t.Errorf("the error should say which version the file has: %v", err)
+	}
+
+	json := `{"format": "go-machine-learning", "version": 0, "kind": "Test", "model": {}}`
+	err = Read(strings.NewReader(json), "Test", &testState{})
+	if !errors.Is(err, ErrIncompatibleVersion) {
+		t.Errorf("json: got error %v want %v", err, ErrIncompatibleVersion)
+	}
+}
+
+func TestRejectsOtherKinds(t *testing.T) {
+	for _, format := range []Format{Binary, JSON} {
+		var buf bytes.Buffer
+		if err := Write(&buf, "Test", format, newTestState()); err != nil {
+			t.Fatal(err)
+		}
+		err := Read(&buf, "Other", &testState{})
+		if !errors.Is(err, ErrWrongKind) {
+			t.Errorf("format %d: got error %v want %v", format, err, ErrWrongKind)
+		}
+	}
+}
+
+func TestRejectsUnknownFormat(t *testing.T) {
+	for _, contents := range []string{"", "hello world", `{"some": "json"}`} {
+		err := Read(strings.NewReader(contents), "Test", &testState{})
+		if !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("%q: got error %v want %v", contents, err, ErrUnknownFormat)
+		}
+	}
+}
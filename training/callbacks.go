@@ -0,0 +1,257 @@
+// Hooks that are called while a model trains, used for printing progress, logging metrics and stopping early
+package training
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Logs holds the metrics at a point in training
+// e.g. "loss", "accuracy", "val_loss" and "val_accuracy" at the end of an epoch
+type Logs map[string]float64
+
+// JSON has no NaN or infinity, so a diverged loss is written as the string "NaN", "+Inf" or "-Inf"
+func (l Logs) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("null"), nil
+	}
+	values := make(map[string]any, len(l))
+	for k, v := range l {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			values[k] = strconv.FormatFloat(v, 'g', -1, 64)
+			continue
+		}
+		values[k] = v
+	}
+	return json.Marshal(values)
+}
+
+// Reads the logs written by MarshalJSON, a null is read as NaN
+func (l *Logs) UnmarshalJSON(data []byte) error {
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	if values == nil {
+		*l = nil
+		return nil
+	}
+
+	logs := make(Logs, len(values))
+	for k, v := range values {
+		switch v := v.(type) {
+		case float64:
+			logs[k] = v
+		case nil:
+			logs[k] = math.NaN()
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("metric %q: %w", k, err)
+			}
+			logs[k] = f
+		default:
+			return fmt.Errorf("metric %q is %v, want a number", k, v)
+		}
+	}
+	*l = logs
+	return nil
+}
+
+// Returned by a callback to stop training, the model finishes cleanly and no error is reported
+var ErrStopTraining = errors.New("training stopped by callback")
+
+// Callback is notified as training progresses
+// Returning ErrStopTraining stops training, any other error stops training and is returned by Train or Fit
+type Callback interface {
+	OnTrainBegin(logs Logs) error
+	OnEpochBegin(epoch int, logs Logs) error
+	OnBatchEnd(batch int, logs Logs) error
+	OnEpochEnd(epoch int, logs Logs) error
+	OnTrainEnd(logs Logs) error
+}
+
+// BaseCallback does nothing, embed it to only implement some of the methods of Callback
+type BaseCallback struct{}
+
+func (BaseCallback) OnTrainBegin(logs Logs) error            { return nil }
+func (BaseCallback) OnEpochBegin(epoch int, logs Logs) error { return nil }
+func (BaseCallback) OnBatchEnd(batch int, logs Logs) error   { return nil }
+func (BaseCallback) OnEpochEnd(epoch int, logs Logs) error   { return nil }
+func (BaseCallback) OnTrainEnd(logs Logs) error              { return nil }
+
+// CallbackList calls every callback in order, stopping at the first error
+type CallbackList []Callback
+
+func (cl CallbackList) OnTrainBegin(logs Logs) error {
+	for _, c := range cl {
+		if err := c.OnTrainBegin(logs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cl CallbackList) OnEpochBegin(epoch int, logs Logs) error {
+	for _, c := range cl {
+		if err := c.OnEpochBegin(epoch, logs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cl CallbackList) OnBatchEnd(batch int, logs Logs) error {
+	for _, c := range cl {
+		if err := c.OnBatchEnd(batch, logs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cl CallbackList) OnEpochEnd(epoch int, logs Logs) error {
+	for _, c := range cl {
+		if err := c.OnEpochEnd(epoch, logs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cl CallbackList) OnTrainEnd(logs Logs) error {
+	for _, c := range cl {
+		if err := c.OnTrainEnd(logs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Splits the error from a callback into whether training should stop and the error that should be returned
+func Stopped(err error) (bool, error) {
+	if errors.Is(err, ErrStopTraining) {
+		return true, nil
+	}
+	return err != nil, err
+}
+
+// WeightRestorer is a model whose parameters can be saved and put back, used to restore the best weights
+type WeightRestorer interface {
+	SnapshotWeights() any
+	RestoreWeights(snapshot any)
+}
+
+// EarlyStopping stops training when the Monitor metric has not improved for Patience epochs
+type EarlyStopping struct {
+	BaseCallback
+
+	// key of the logs that is watched, e.g. "val_loss"
+	Monitor string
+	// "min" if lower is better, "max" if higher is better, when empty it is "max" for accuracies and "min" otherwise
+	Mode string
+	// number of epochs without improvement before stopping
+	Patience int
+	// the metric has to improve by more than MinDelta to count as an improvement
+	MinDelta float64
+	// if set, the weights from the best epoch are restored when training ends
+	Restore WeightRestorer
+
+	// best value of the metric, the epoch it happened in and the epoch training was stopped at (-1 if it wasn't)
+	Best         float64
+	BestEpoch    int
+	StoppedEpoch int
+
+	wait        int
+	bestWeights any
+}
+
+func NewEarlyStopping(monitor string, patience int) *EarlyStopping {
+	return &EarlyStopping{Monitor: monitor, Patience: patience}
+}
+
+func (es *EarlyStopping) maximise() bool {
+	if es.Mode == "" {
+		return strings.Contains(es.Monitor, "acc")
+	}
+	return es.Mode == "max"
+}
+
+func (es *EarlyStopping) OnTrainBegin(logs Logs) error {
+	if es.Mode != "" && es.Mode != "min" && es.Mode != "max" {
+		return fmt.Errorf("early stopping mode must be \"min\" or \"max\", got %q", es.Mode)
+	}
+
+	es.wait = 0
+	es.bestWeights = nil
+	es.BestEpoch = -1
+	es.StoppedEpoch = -1
+	es.Best = math.Inf(1)
+	if es.maximise() {
+		es.Best = math.Inf(-1)
+	}
+	return nil
+}
+
+func (es *EarlyStopping) OnEpochEnd(epoch int, logs Logs) error {
+	value, ok := logs[es.Monitor]
+	if !ok {
+		return fmt.Errorf("early stopping monitors %q which is not in the logs", es.Monitor)
+	}
+
+	improved := value < es.Best-es.MinDelta
+	if es.maximise() {
+		improved = value > es.Best+es.MinDelta
+	}
+
+	if improved {
+		es.Best = value
+		es.BestEpoch = epoch
+		es.wait = 0
+		if es.Restore != nil {
+			es.bestWeights = es.Restore.SnapshotWeights()
+		}
+		return nil
+	}
+
+	es.wait++
+	if es.wait >= es.Patience {
+		es.StoppedEpoch = epoch
+		return ErrStopTraining
+	}
+	return nil
+}
+
+func (es *EarlyStopping) OnTrainEnd(logs Logs) error {
+	if es.Restore != nil && es.bestWeights != nil {
+		es.Restore.RestoreWeights(es.bestWeights)
+	}
+	return nil
+}
+
+// Orders the keys of the logs with the common metrics first and the rest alphabetically
+func sortedKeys(logs Logs) []string {
+	order := map[string]int{"loss": 0, "accuracy": 1, "val_loss": 2, "val_accuracy": 3}
+
+	keys := make([]string, 0, len(logs))
+	for k := range logs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		oi, iok := order[keys[i]]
+		oj, jok := order[keys[j]]
+		if iok && jok {
+			return oi < oj
+		}
+		if iok != jok {
+			return iok
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,200 @@
+package training
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// remembers the value it was given so restoring can be checked
+type fakeModel struct {
+	weight float64
+}
+
+func (m *fakeModel) SnapshotWeights() any        { return m.weight }
+func (m *fakeModel) RestoreWeights(snapshot any) { m.weight = snapshot.(float64) }
+
+func TestEarlyStoppingMin(t *testing.T) {
+	model := &fakeModel{}
+	es := NewEarlyStopping("val_loss", 2)
+	es.MinDelta = 0.1
+	es.Restore = model
+
+	if err := es.OnTrainBegin(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	//0.75 is not enough of an improvement on 0.8 because of MinDelta
+	losses := []float64{1.0, 0.8, 0.75, 0.85}
+	for epoch, loss := range losses {
+		model.weight = float64(epoch)
+		err := es.OnEpochEnd(epoch, Logs{"val_loss": loss})
+		if stop := errors.Is(err, ErrStopTraining); stop != (epoch == 3) {
+			t.Errorf("epoch %d: stopped = %v", epoch, stop)
+		}
+	}
+
+	if es.BestEpoch != 1 || es.Best != 0.8 || es.StoppedEpoch != 3 {
+		t.Errorf("best epoch %d best %v stopped %d, want 1, 0.8 and 3", es.BestEpoch, es.Best, es.StoppedEpoch)
+	}
+
+	es.OnTrainEnd(nil)
+	if model.weight != 1 {
+		t.Errorf("restored the weights from epoch %v, want 1", model.weight)
+	}
+}
+
+func TestEarlyStoppingMax(t *testing.T) {
+	es := NewEarlyStopping("val_accuracy", 1)
+	es.OnTrainBegin(nil)
+
+	if es.OnEpochEnd(0, Logs{"val_accuracy": 50}) != nil || es.OnEpochEnd(1, Logs{"val_accuracy": 60}) != nil {
+		t.Fatalf("stopped while the accuracy was increasing")
+	}
+	if !errors.Is(es.OnEpochEnd(2, Logs{"val_accuracy": 55}), ErrStopTraining) {
+		t.Errorf("expected to stop once the accuracy decreased")
+	}
+}
+
+func TestEarlyStoppingMissingMetric(t *testing.T) {
+	es := NewEarlyStopping("val_loss", 1)
+	es.OnTrainBegin(nil)
+
+	err := es.OnEpochEnd(0, Logs{"loss": 1})
+	if err == nil || errors.Is(err, ErrStopTraining) {
+		t.Errorf("expected an error for a metric that isn't logged, got %v", err)
+	}
+}
+
+func TestStopped(t *testing.T) {
+	other := errors.New("disk full")
+
+	for _, tc := range []struct {
+		in      error
+		stop    bool
+		wantErr error
+	}{
+		{nil, false, nil},
+		{ErrStopTraining, true, nil},
+		{other, true, other},
+	} {
+		stop, err := Stopped(tc.in)
+		if stop != tc.stop || err != tc.wantErr {
+			t.Errorf("Stopped(%v) = %v, %v want %v, %v", tc.in, stop, err, tc.stop, tc.wantErr)
+		}
+	}
+}
+
+func TestCallbackListStopsAtFirstError(t *testing.T) {
+	var calls []string
+	record := func(name string, err error) Callback {
+		return callbackFunc(func(epoch int) error {
+			calls = append(calls, name)
+			return err
+		})
+	}
+
+	cl := CallbackList{record("a", nil), record("b", ErrStopTraining), record("c", nil)}
+	if err := cl.OnEpochEnd(0, Logs{}); !errors.Is(err, ErrStopTraining) {
+		t.Errorf("got %v want ErrStopTraining", err)
+	}
+	if strings.Join(calls, "") != "ab" {
+		t.Errorf("called %v, want a then b", calls)
+	}
+}
+
+type callbackFunc func(epoch int) error
+
+func (callbackFunc) OnTrainBegin(logs Logs) error            { return nil }
+func (callbackFunc) OnEpochBegin(epoch int, logs Logs) error { return nil }
+func (callbackFunc) OnBatchEnd(batch int, logs Logs) error   { return nil }
+func (f callbackFunc) OnEpochEnd(epoch int, logs Logs) error { return f(epoch) }
+func (callbackFunc) OnTrainEnd(logs Logs) error              { return nil }
+
+func TestCSVLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewCSVLogger(&buf)
+
+	logger.OnTrainBegin(nil)
+	logger.OnEpochEnd(0, Logs{"val_loss": 0.5, "loss": 1, "accuracy": 40})
+	logger.OnEpochEnd(1, Logs{"loss": 0.25, "accuracy": 80})
+
+	want := "epoch,loss,accuracy,val_loss\n0,1,40,0.5\n1,0.25,80,\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestJSONLLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONLLogger(&buf)
+
+	logger.OnTrainBegin(nil)
+	logger.OnEpochEnd(0, Logs{"loss": 1})
+	logger.OnEpochEnd(1, Logs{"loss": 0.5})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines want 2", len(lines))
+	}
+
+	var record map[string]float64
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["epoch"] != 1 || record["loss"] != 0.5 {
+		t.Errorf("second line %v", record)
+	}
+}
+
+func TestJSONLLoggerNonFinite(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewJSONLLogger(&buf)
+
+	logger.OnTrainBegin(nil)
+	if err := logger.OnEpochEnd(0, Logs{"loss": math.NaN(), "val_loss": math.Inf(1)}); err != nil {
+		t.Fatalf("a diverged loss can't be logged: %v", err)
+	}
+
+	var record Logs
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(record["loss"]) || !math.IsInf(record["val_loss"], 1) || record["epoch"] != 0 {
+		t.Errorf("got %v", record)
+	}
+	if !strings.Contains(buf.String(), `"loss":"NaN"`) {
+		t.Errorf("NaN loss written as %s", buf.String())
+	}
+}
+
+func TestMetricsLoggerFormat(t *testing.T) {
+	logger := &MetricsLogger{Format: "xml"}
+	if err := logger.OnTrainBegin(nil); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func TestProgressLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &ProgressLogger{W: &buf}
+
+	logger.OnTrainBegin(nil)
+	logger.OnEpochBegin(0, nil)
+	logger.OnEpochEnd(0, Logs{"val_accuracy": 90, "loss": 0.12345})
+	logger.OnTrainEnd(Logs{"stopped_epoch": 0, "best_epoch": 0})
+
+	out := buf.String()
+	for _, want := range []string{
+		"Epoch 0, loss: 0.1235, val_accuracy: 90.0000%, time:",
+		"Early stopping after epoch 0, best epoch 0\n",
+		"Training finished, time taken :",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output\n%s\ndoes not contain %q", out, want)
+		}
+	}
+}
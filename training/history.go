@@ -0,0 +1,134 @@
+package training
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// History is returned by Train and Fit, it records how every epoch of training went
+type History struct {
+	Epochs []EpochRecord `json:"epochs"`
+
+	// iterations run across every epoch, for SGD an iteration is one batch
+	Iterations int `json:"iterations"`
+	// wall time of the whole of training in seconds
+	Seconds float64 `json:"seconds"`
+	// epoch training was stopped early at, -1 if every epoch was run
+	// a stop decided at the end of an epoch, by early stopping or a callback, is the last epoch recorded, Len()-1
+	// an epoch interrupted by a cancelled context isn't recorded, so that stop is Len()
+	StoppedEpoch int `json:"stopped_epoch"`
+}
+
+// EpochRecord is one epoch of a History
+type EpochRecord struct {
+	Epoch int `json:"epoch"`
+	// the metrics passed to the callbacks at the end of the epoch, e.g. "loss" and "val_loss"
+	Metrics      Logs    `json:"metrics"`
+	LearningRate float64 `json:"learning_rate"`
+	Iterations   int     `json:"iterations"`
+	Seconds      float64 `json:"seconds"`
+}
+
+func NewHistory() *History {
+	return &History{StoppedEpoch: -1}
+}
+
+// Records an epoch, the logs are copied so the caller can keep using them
+func (h *History) Add(epoch int, logs Logs, learningRate float64, iterations int, elapsed time.Duration) {
+	metrics := make(Logs, len(logs))
+	for k, v := range logs {
+		metrics[k] = v
+	}
+
+	h.Epochs = append(h.Epochs, EpochRecord{
+		Epoch:        epoch,
+		Metrics:      metrics,
+		LearningRate: learningRate,
+		Iterations:   iterations,
+		Seconds:      elapsed.Seconds(),
+	})
+	h.Iterations += iterations
+}
+
+// Number of epochs that were run
+func (h *History) Len() int {
+	return len(h.Epochs)
+}
+
+// Values of a metric for every epoch, NaN for the epochs it wasn't recorded in
+func (h *History) Metric(name string) []float64 {
+	values := make([]float64, len(h.Epochs))
+	for i, e := range h.Epochs {
+		value, ok := e.Metrics[name]
+		if !ok {
+			value = math.NaN()
+		}
+		values[i] = value
+	}
+	return values
+}
+
+// Names of every metric recorded, the common metrics first and the rest alphabetically
+func (h *History) MetricNames() []string {
+	all := Logs{}
+	for _, e := range h.Epochs {
+		for k := range e.Metrics {
+			all[k] = 0
+		}
+	}
+	return sortedKeys(all)
+}
+
+// Writes the history as indented JSON, a NaN or infinite metric is written as a string as JSON has no such numbers
+func (h *History) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(h)
+}
+
+// Reads a history written by WriteJSON
+func ReadHistoryJSON(r io.Reader) (*History, error) {
+	h := NewHistory()
+	if err := json.NewDecoder(r).Decode(h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Writes one row per epoch, metrics missing from an epoch are left empty
+func (h *History) WriteCSV(w io.Writer) error {
+	names := h.MetricNames()
+
+	writer := csv.NewWriter(w)
+	header := append([]string{"epoch", "learning_rate", "iterations", "seconds"}, names...)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, e := range h.Epochs {
+		row := []string{
+			strconv.Itoa(e.Epoch),
+			strconv.FormatFloat(e.LearningRate, 'g', -1, 64),
+			strconv.Itoa(e.Iterations),
+			strconv.FormatFloat(e.Seconds, 'g', -1, 64),
+		}
+		for _, name := range names {
+			value, ok := e.Metrics[name]
+			if !ok {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, strconv.FormatFloat(value, 'g', -1, 64))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
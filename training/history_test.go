@@ -0,0 +1,104 @@
+package training
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exampleHistory() *History {
+	h := NewHistory()
+	h.Add(0, Logs{"loss": 1, "val_loss": 2}, 0.1, 4, time.Second)
+	h.Add(1, Logs{"loss": 0.5}, 0.05, 4, 2*time.Second)
+	return h
+}
+
+func TestHistoryMetric(t *testing.T) {
+	h := exampleHistory()
+
+	if h.Len() != 2 || h.Iterations != 8 {
+		t.Errorf("%d epochs and %d iterations, want 2 and 8", h.Len(), h.Iterations)
+	}
+	if got := h.Metric("loss"); !reflect.DeepEqual(got, []float64{1, 0.5}) {
+		t.Errorf("loss %v", got)
+	}
+	if got := h.Metric("val_loss"); got[0] != 2 || !math.IsNaN(got[1]) {
+		t.Errorf("val_loss %v, want 2 then NaN", got)
+	}
+	if got := h.MetricNames(); !reflect.DeepEqual(got, []string{"loss", "val_loss"}) {
+		t.Errorf("metric names %v", got)
+	}
+}
+
+func TestHistoryCopiesLogs(t *testing.T) {
+	h := NewHistory()
+	logs := Logs{"loss": 1}
+	h.Add(0, logs, 0, 1, 0)
+	logs["loss"] = 2
+
+	if h.Metric("loss")[0] != 1 {
+		t.Errorf("changing the logs after adding them changed the history")
+	}
+}
+
+func TestHistoryJSON(t *testing.T) {
+	h := exampleHistory()
+	h.Seconds = 3
+	h.StoppedEpoch = 1
+
+	var buf bytes.Buffer
+	if err := h.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadHistoryJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, h) {
+		t.Errorf("got %+v want %+v", read, h)
+	}
+}
+
+func TestHistoryJSONNonFinite(t *testing.T) {
+	h := NewHistory()
+	h.Add(0, Logs{"loss": math.NaN(), "val_loss": math.Inf(1), "accuracy": math.Inf(-1)}, 0.1, 1, 0)
+
+	var buf bytes.Buffer
+	if err := h.WriteJSON(&buf); err != nil {
+		t.Fatalf("a diverged loss can't be written: %v", err)
+	}
+
+	read, err := ReadHistoryJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := read.Epochs[0].Metrics
+	if !math.IsNaN(metrics["loss"]) || !math.IsInf(metrics["val_loss"], 1) || !math.IsInf(metrics["accuracy"], -1) {
+		t.Errorf("got %v want NaN, +Inf and -Inf", metrics)
+	}
+
+	//null is read as a missing value
+	read, err = ReadHistoryJSON(strings.NewReader(`{"epochs": [{"metrics": {"loss": null}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(read.Epochs[0].Metrics["loss"]) {
+		t.Errorf("null loss read as %v want NaN", read.Epochs[0].Metrics["loss"])
+	}
+}
+
+func TestHistoryCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exampleHistory().WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "epoch,learning_rate,iterations,seconds,loss,val_loss\n0,0.1,4,1,1,2\n1,0.05,4,2,0.5,\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
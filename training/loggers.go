@@ -0,0 +1,138 @@
+package training
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProgressLogger prints the metrics of every epoch, this is what Verbose turns on
+type ProgressLogger struct {
+	BaseCallback
+
+	// where to print, os.Stdout if nil
+	W io.Writer
+
+	trainStart time.Time
+	epochStart time.Time
+}
+
+func NewProgressLogger() *ProgressLogger {
+	return &ProgressLogger{}
+}
+
+func (p *ProgressLogger) writer() io.Writer {
+	if p.W == nil {
+		return os.Stdout
+	}
+	return p.W
+}
+
+func (p *ProgressLogger) OnTrainBegin(logs Logs) error {
+	p.trainStart = time.Now()
+	return nil
+}
+
+func (p *ProgressLogger) OnEpochBegin(epoch int, logs Logs) error {
+	p.epochStart = time.Now()
+	return nil
+}
+
+// prints e.g. "Epoch 3, loss: 0.1234, accuracy: 96.5000%, val_loss: 0.2345, val_accuracy: 94.0000%, time: 1.2s"
+func (p *ProgressLogger) OnEpochEnd(epoch int, logs Logs) error {
+	var line strings.Builder
+	fmt.Fprintf(&line, "Epoch %v", epoch)
+	for _, k := range sortedKeys(logs) {
+		if strings.Contains(k, "accuracy") {
+			fmt.Fprintf(&line, ", %s: %.4f%%", k, logs[k])
+		} else {
+			fmt.Fprintf(&line, ", %s: %.4f", k, logs[k])
+		}
+	}
+	fmt.Fprintf(&line, ", time: %v\n", time.Since(p.epochStart))
+
+	_, err := io.WriteString(p.writer(), line.String())
+	return err
+}
+
+// the model adds "stopped_epoch" and "best_epoch" to the logs when it stopped early
+func (p *ProgressLogger) OnTrainEnd(logs Logs) error {
+	if stopped, ok := logs["stopped_epoch"]; ok {
+		fmt.Fprintf(p.writer(), "Early stopping after epoch %v", stopped)
+		if best, ok := logs["best_epoch"]; ok {
+			fmt.Fprintf(p.writer(), ", best epoch %v", best)
+		}
+		fmt.Fprintln(p.writer())
+	}
+	_, err := fmt.Fprintln(p.writer(), "Training finished, time taken :", time.Since(p.trainStart))
+	return err
+}
+
+// MetricsLogger writes the metrics of every epoch to W as CSV or JSON lines
+// in JSON a NaN or infinite metric is written as the string "NaN", "+Inf" or "-Inf"
+type MetricsLogger struct {
+	BaseCallback
+
+	W io.Writer
+	// "csv" or "jsonl"
+	Format string
+
+	columns []string
+	csv     *csv.Writer
+}
+
+func NewCSVLogger(w io.Writer) *MetricsLogger {
+	return &MetricsLogger{W: w, Format: "csv"}
+}
+
+func NewJSONLLogger(w io.Writer) *MetricsLogger {
+	return &MetricsLogger{W: w, Format: "jsonl"}
+}
+
+func (m *MetricsLogger) OnTrainBegin(logs Logs) error {
+	if m.Format != "csv" && m.Format != "jsonl" {
+		return fmt.Errorf("metrics logger format must be \"csv\" or \"jsonl\", got %q", m.Format)
+	}
+	m.columns = nil
+	return nil
+}
+
+// For CSV the columns are fixed by the first epoch, metrics missing from a later epoch are left empty
+func (m *MetricsLogger) OnEpochEnd(epoch int, logs Logs) error {
+	if m.Format == "jsonl" {
+		record := make(Logs, len(logs)+1)
+		for k, v := range logs {
+			record[k] = v
+		}
+		record["epoch"] = float64(epoch)
+		return json.NewEncoder(m.W).Encode(record)
+	}
+
+	if m.columns == nil {
+		m.columns = sortedKeys(logs)
+		m.csv = csv.NewWriter(m.W)
+		if err := m.csv.Write(append([]string{"epoch"}, m.columns...)); err != nil {
+			return err
+		}
+	}
+
+	row := []string{strconv.Itoa(epoch)}
+	for _, k := range m.columns {
+		value, ok := logs[k]
+		if !ok {
+			row = append(row, "")
+			continue
+		}
+		row = append(row, strconv.FormatFloat(value, 'g', -1, 64))
+	}
+	if err := m.csv.Write(row); err != nil {
+		return err
+	}
+	m.csv.Flush()
+	return m.csv.Error()
+}
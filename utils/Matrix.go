@@ -519,7 +519,8 @@ func (m *Matrix) T() {
 // Ramdomly shuffles the rows of the Matrix, needed for stochastic gradient descent
 // Picks the current row and swaps with a random row in the matrix
 // Takes the X and y matrix and shuffles such that they still correspond to each other
-func ShuffleRows(X, y *Matrix) {
+// any other matrices with the same number of rows, such as sample weights, are shuffled the same way
+func ShuffleRows(X, y *Matrix, others ...*Matrix) {
 	for i, r := range rand.Perm(X.Rows) {
 
 		//Shuffle the X data
@@ -536,5 +537,16 @@ func ShuffleRows(X, y *Matrix) {
 			yCurrentRow[i], yRandomRow[i] = yRandomRow[i], yCurrentRow[i]
 		}
 
+		for _, m := range others {
+			if m == nil {
+				continue
+			}
+			mCurrentRow := m.Data[m.Cols*i : m.Cols*i+m.Cols]
+			mRandomRow := m.Data[m.Cols*r : m.Cols*r+m.Cols]
+			for i := range mCurrentRow {
+				mCurrentRow[i], mRandomRow[i] = mRandomRow[i], mCurrentRow[i]
+			}
+		}
+
 	}
 }
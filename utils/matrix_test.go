@@ -542,3 +542,23 @@ func TestRow(t *testing.T) {
 	}
 
 }
+
+func TestShuffleRowsKeepsRowsTogether(t *testing.T) {
+	X := CreateMatrix(50, 2, make([]float64, 100))
+	y := CreateMatrix(50, 1, make([]float64, 50))
+	w := CreateMatrix(50, 1, make([]float64, 50))
+	for i := range 50 {
+		X.Data[2*i], X.Data[2*i+1] = float64(i), float64(-i)
+		y.Data[i] = float64(10 * i)
+		w.Data[i] = float64(100 * i)
+	}
+
+	ShuffleRows(X, y, w, nil)
+
+	for i := range 50 {
+		x := X.Data[2*i]
+		if X.Data[2*i+1] != -x || y.Data[i] != 10*x || w.Data[i] != 100*x {
+			t.Fatalf("row %d was split up: X %v, y %v, w %v", i, X.Data[2*i:2*i+2], y.Data[i], w.Data[i])
+		}
+	}
+}